@@ -0,0 +1,20 @@
+package config
+
+import "time"
+
+type APIKeyConfiguration struct {
+	RateLimit       int64         `mapstructure:"API_KEY_RATE_LIMIT" default:"600" usage:"创建 API 密钥时没有指定 rate_limit 时，每个密钥在时间窗口内允许的请求次数"`
+	RateLimitWindow time.Duration `mapstructure:"API_KEY_RATE_LIMIT_WINDOW" default:"1m" usage:"按 API 密钥限流的时间窗口"`
+	MaxLifetime     time.Duration `mapstructure:"API_KEY_MAX_LIFETIME" default:"8760h" usage:"API 密钥有效期的上限，到期后需要重新创建"`
+}
+
+func (a APIKeyConfiguration) validate() []string {
+	var problems []string
+	if a.RateLimit <= 0 || a.RateLimitWindow <= 0 {
+		problems = append(problems, "API_KEY_RATE_LIMIT and API_KEY_RATE_LIMIT_WINDOW must be greater than 0")
+	}
+	if a.MaxLifetime < 24*time.Hour {
+		problems = append(problems, "API_KEY_MAX_LIFETIME must be at least 24h")
+	}
+	return problems
+}
@@ -1,30 +1,205 @@
 package config
 
 import (
-	"gin-boilerplate/infra/logger"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+
+	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 )
 
+/*
+配置加载顺序（优先级从高到低）：命令行参数 > 环境变量 > 配置文件 > 默认值
+
+- 配置文件默认为工作目录下的 .env，可以通过 --config 指定其他文件（支持 .env/.yaml/.json 等 viper 支持的格式）
+- 每个配置项都对应一个同名环境变量（如 SERVER_PORT），以及一个小写中划线形式的命令行参数（如 --server-port）
+*/
+
+const defaultConfigFile = ".env"
+
+// Configuration 全部配置项，字段通过 mapstructure 标签映射到配置键
+//
+// 字段标签说明：
+//   - mapstructure: 配置键（同时也是环境变量名）
+//   - default: 默认值
+//   - secret: 为 true 时在输出配置时隐藏其值
+//   - usage: 命令行参数的说明
 type Configuration struct {
-	Server   ServerConfiguration
-	Database DatabaseConfiguration
+	Server        ServerConfiguration        `mapstructure:",squash"`
+	Database      DatabaseConfiguration      `mapstructure:",squash"`
+	JWT           JWTConfiguration           `mapstructure:",squash"`
+	Log           LogConfiguration           `mapstructure:",squash"`
+	Metrics       MetricsConfiguration       `mapstructure:",squash"`
+	Finance       FinanceConfiguration       `mapstructure:",squash"`
+	PII           PIIConfiguration           `mapstructure:",squash"`
+	RateLimit     RateLimitConfiguration     `mapstructure:",squash"`
+	Login         LoginConfiguration         `mapstructure:",squash"`
+	Password      PasswordConfiguration      `mapstructure:",squash"`
+	TOTP          TOTPConfiguration          `mapstructure:",squash"`
+	OIDC          OIDCConfiguration          `mapstructure:",squash"`
+	APIKey        APIKeyConfiguration        `mapstructure:",squash"`
+	Impersonation ImpersonationConfiguration `mapstructure:",squash"`
+	Delegation    DelegationConfiguration    `mapstructure:",squash"`
+
+	// 实际读取的配置文件，为空表示未使用配置文件
+	File string `mapstructure:"-"`
 }
 
-// SetupConfig configuration
-func SetupConfig() error {
-	var configuration *Configuration
+// 单例模式，保存校验通过的配置
+var configuration *Configuration
 
-	viper.SetConfigFile(".env")
-	if err := viper.ReadInConfig(); err != nil {
-		logger.Errorf("Error to reading config file, %s", err)
-		return err
+// Get 返回已加载的配置，必须在 SetupConfig 成功之后调用
+func Get() *Configuration {
+	if configuration == nil {
+		panic("config: Get() called before SetupConfig()")
 	}
+	return configuration
+}
 
-	err := viper.Unmarshal(&configuration)
+// SetupConfig 加载并校验配置，校验失败时返回错误，调用方应拒绝启动
+func SetupConfig(args []string) error {
+	cfg, err := Load(args)
 	if err != nil {
-		logger.Errorf("error to decode, %v", err)
 		return err
 	}
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	configuration = cfg
+	return nil
+}
+
+// Load 从配置文件、环境变量和命令行参数读取配置，不做校验
+func Load(args []string) (*Configuration, error) {
+	v := viper.New()
+	keys := configKeys()
+
+	flags := pflag.NewFlagSet("config", pflag.ContinueOnError)
+	configFile := flags.String("config", defaultConfigFile, "配置文件路径")
+	for _, key := range keys {
+		flags.String(key.flagName(), "", key.usage)
+	}
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+
+	for _, key := range keys {
+		v.SetDefault(key.name, key.defaultValue)
+		// 只有显式传入的参数才覆盖环境变量和配置文件
+		if f := flags.Lookup(key.flagName()); f.Changed {
+			v.Set(key.name, f.Value.String())
+		}
+	}
+	v.AutomaticEnv()
+
+	cfg := &Configuration{}
+	v.SetConfigFile(*configFile)
+	if err := v.ReadInConfig(); err != nil {
+		// 未显式指定配置文件且默认文件不存在时，仅使用环境变量（例如容器部署）
+		var pathErr *os.PathError
+		if flags.Changed("config") || !errors.As(err, &pathErr) {
+			return nil, fmt.Errorf("failed to read config file %s: %w", *configFile, err)
+		}
+	} else {
+		cfg.File = v.ConfigFileUsed()
+	}
 
+	if err := v.Unmarshal(cfg); err != nil {
+		return nil, fmt.Errorf("failed to decode config: %w", err)
+	}
+	return cfg, nil
+}
+
+// ValidationError 汇总全部校验失败的配置项
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid configuration:\n  - " + strings.Join(e.Problems, "\n  - ")
+}
+
+// Validate 校验配置，返回全部不合法的配置项
+func (c *Configuration) Validate() error {
+	var problems []string
+	problems = append(problems, c.Server.validate()...)
+	problems = append(problems, c.Database.validate()...)
+	problems = append(problems, c.JWT.validate()...)
+	problems = append(problems, c.Log.validate()...)
+	problems = append(problems, c.Metrics.validate(c.Server.Debug)...)
+	problems = append(problems, c.Finance.validate()...)
+	problems = append(problems, c.PII.validate()...)
+	problems = append(problems, c.RateLimit.validate()...)
+	problems = append(problems, c.Login.validate()...)
+	problems = append(problems, c.Password.validate()...)
+	problems = append(problems, c.TOTP.validate()...)
+	problems = append(problems, c.OIDC.validate()...)
+	problems = append(problems, c.APIKey.validate()...)
+	problems = append(problems, c.Impersonation.validate()...)
+	problems = append(problems, c.Delegation.validate()...)
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
 	return nil
 }
+
+// Redacted 以 KEY=value 的形式输出生效的配置，secret 配置项的值被隐藏
+func (c *Configuration) Redacted() string {
+	var sb strings.Builder
+	if c.File != "" {
+		sb.WriteString(fmt.Sprintf("# config file: %s\n", c.File))
+	} else {
+		sb.WriteString("# config file: <none>\n")
+	}
+	root := reflect.ValueOf(c).Elem()
+	for i := 0; i < root.NumField(); i++ {
+		section := root.Field(i)
+		if section.Kind() != reflect.Struct {
+			continue
+		}
+		sb.WriteString(fmt.Sprintf("\n# %s\n", root.Type().Field(i).Name))
+		for j := 0; j < section.NumField(); j++ {
+			field := section.Type().Field(j)
+			value := fmt.Sprint(section.Field(j).Interface())
+			if field.Tag.Get("secret") == "true" && value != "" {
+				value = "******"
+			}
+			sb.WriteString(fmt.Sprintf("%s=%s\n", field.Tag.Get("mapstructure"), value))
+		}
+	}
+	return sb.String()
+}
+
+// configKey 单个配置项的元信息，从 Configuration 的字段标签中读取
+type configKey struct {
+	name         string
+	defaultValue string
+	usage        string
+}
+
+func (k configKey) flagName() string {
+	return strings.ReplaceAll(strings.ToLower(k.name), "_", "-")
+}
+
+func configKeys() []configKey {
+	var keys []configKey
+	root := reflect.TypeOf(Configuration{})
+	for i := 0; i < root.NumField(); i++ {
+		section := root.Field(i).Type
+		if section.Kind() != reflect.Struct {
+			continue
+		}
+		for j := 0; j < section.NumField(); j++ {
+			field := section.Field(j)
+			keys = append(keys, configKey{
+				name:         field.Tag.Get("mapstructure"),
+				defaultValue: field.Tag.Get("default"),
+				usage:        field.Tag.Get("usage"),
+			})
+		}
+	}
+	return keys
+}
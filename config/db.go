@@ -2,18 +2,37 @@ package config
 
 import (
 	"fmt"
-
-	"github.com/spf13/viper"
+	"net"
+	"strings"
+	"time"
 )
 
 type DatabaseConfiguration struct {
-	Driver   string
-	Dbname   string
-	Username string
-	Password string
-	Host     string
-	Port     string
-	LogMode  bool
+	MasterName     string `mapstructure:"MASTER_DB_NAME" usage:"主数据库名"`
+	MasterUser     string `mapstructure:"MASTER_DB_USER" usage:"主数据库用户名"`
+	MasterPassword string `mapstructure:"MASTER_DB_PASSWORD" secret:"true" usage:"主数据库密码"`
+	MasterHost     string `mapstructure:"MASTER_DB_HOST" default:"localhost" usage:"主数据库地址"`
+	MasterPort     string `mapstructure:"MASTER_DB_PORT" default:"5432" usage:"主数据库端口"`
+	MasterSslMode  string `mapstructure:"MASTER_SSL_MODE" default:"disable" usage:"主数据库 sslmode"`
+
+	// 从数据库共用库名、用户名、密码和 sslmode，REPLICA_DB_HOST 为逗号分隔的 host 或 host:port 列表，为空表示不使用从数据库
+	ReplicaName     string `mapstructure:"REPLICA_DB_NAME" usage:"从数据库名"`
+	ReplicaUser     string `mapstructure:"REPLICA_DB_USER" usage:"从数据库用户名"`
+	ReplicaPassword string `mapstructure:"REPLICA_DB_PASSWORD" secret:"true" usage:"从数据库密码"`
+	ReplicaHost     string `mapstructure:"REPLICA_DB_HOST" usage:"从数据库地址，多个从库用逗号分隔，例如 replica1,replica2:5433"`
+	ReplicaPort     string `mapstructure:"REPLICA_DB_PORT" default:"5432" usage:"从数据库默认端口"`
+	ReplicaSslMode  string `mapstructure:"REPLICA_SSL_MODE" default:"disable" usage:"从数据库 sslmode"`
+
+	// 连接池配置，主库和每个从库各自使用一个连接池
+	MaxOpenConns    int           `mapstructure:"DB_MAX_OPEN_CONNS" default:"25" usage:"每个连接池的最大连接数"`
+	MaxIdleConns    int           `mapstructure:"DB_MAX_IDLE_CONNS" default:"10" usage:"每个连接池的最大空闲连接数"`
+	ConnMaxLifetime time.Duration `mapstructure:"DB_CONN_MAX_LIFETIME" default:"30m" usage:"连接最长存活时间"`
+	ConnMaxIdleTime time.Duration `mapstructure:"DB_CONN_MAX_IDLE_TIME" default:"5m" usage:"连接最长空闲时间"`
+
+	// 从库健康检查间隔，不健康的从库不会被用于读请求，全部不健康时读请求回退到主库
+	ReplicaHealthCheckInterval time.Duration `mapstructure:"DB_REPLICA_HEALTH_CHECK_INTERVAL" default:"10s" usage:"从库健康检查间隔"`
+
+	LogMode bool `mapstructure:"DB_LOG_MODE" default:"false" usage:"是否打印 SQL 日志"`
 }
 
 type DSN struct {
@@ -21,43 +40,106 @@ type DSN struct {
 	Dbname string
 }
 
-func DbConfiguration() (DSN, DSN, DSN) {
-	masterDBName := viper.GetString("MASTER_DB_NAME")
-	masterDBUser := viper.GetString("MASTER_DB_USER")
-	masterDBPassword := viper.GetString("MASTER_DB_PASSWORD")
-	masterDBHost := viper.GetString("MASTER_DB_HOST")
-	masterDBPort := viper.GetString("MASTER_DB_PORT")
-	masterDBSslMode := viper.GetString("MASTER_SSL_MODE")
+// postgres 支持的 sslmode
+var sslModes = map[string]bool{
+	"disable":     true,
+	"allow":       true,
+	"prefer":      true,
+	"require":     true,
+	"verify-ca":   true,
+	"verify-full": true,
+}
+
+// 只有配置了 REPLICA_DB_HOST 时才校验从数据库配置
+func (d DatabaseConfiguration) validate() []string {
+	problems := validateDSN("MASTER", d.MasterName, d.MasterUser, d.MasterHost, d.MasterPort, d.MasterSslMode)
+	if d.ReplicaHost != "" {
+		for _, host := range d.replicaHosts() {
+			hostname, port := splitHostPort(host, d.ReplicaPort)
+			problems = append(problems, validateDSN("REPLICA", d.ReplicaName, d.ReplicaUser, hostname, port, d.ReplicaSslMode)...)
+		}
+	}
+	if d.MaxOpenConns <= 0 {
+		problems = append(problems, "DB_MAX_OPEN_CONNS must be greater than 0")
+	}
+	if d.MaxIdleConns < 0 || d.MaxIdleConns > d.MaxOpenConns {
+		problems = append(problems, "DB_MAX_IDLE_CONNS must be between 0 and DB_MAX_OPEN_CONNS")
+	}
+	if d.ConnMaxLifetime < 0 || d.ConnMaxIdleTime < 0 {
+		problems = append(problems, "DB_CONN_MAX_LIFETIME and DB_CONN_MAX_IDLE_TIME must not be negative")
+	}
+	if d.ReplicaHealthCheckInterval <= 0 {
+		problems = append(problems, "DB_REPLICA_HEALTH_CHECK_INTERVAL must be greater than 0")
+	}
+	return problems
+}
+
+func validateDSN(prefix, name, user, host, port, sslMode string) []string {
+	var problems []string
+	required := []struct{ key, value string }{
+		{prefix + "_DB_NAME", name},
+		{prefix + "_DB_USER", user},
+		{prefix + "_DB_HOST", host},
+	}
+	for _, r := range required {
+		if r.value == "" {
+			problems = append(problems, r.key+" is required")
+		}
+	}
+	if !isValidPort(port) {
+		problems = append(problems, fmt.Sprintf("%s_DB_PORT %q is not a valid port", prefix, port))
+	}
+	if !sslModes[sslMode] {
+		problems = append(problems, fmt.Sprintf("%s_SSL_MODE %q is not a valid sslmode", prefix, sslMode))
+	}
+	return problems
+}
+
+func (d DatabaseConfiguration) replicaHosts() []string {
+	var hosts []string
+	for _, host := range strings.Split(d.ReplicaHost, ",") {
+		if host = strings.TrimSpace(host); host != "" {
+			hosts = append(hosts, host)
+		}
+	}
+	return hosts
+}
 
-	replicaDBName := viper.GetString("REPLICA_DB_NAME")
-	replicaDBUser := viper.GetString("REPLICA_DB_USER")
-	replicaDBPassword := viper.GetString("REPLICA_DB_PASSWORD")
-	replicaDBHost := viper.GetString("REPLICA_DB_HOST")
-	replicaDBPort := viper.GetString("REPLICA_DB_PORT")
-	replicaDBSslMode := viper.GetString("REPLICA_SSL_MODE")
+// 拆分 host:port，未指定端口时使用默认端口
+func splitHostPort(host, defaultPort string) (string, string) {
+	if hostname, port, err := net.SplitHostPort(host); err == nil {
+		return hostname, port
+	}
+	return host, defaultPort
+}
+
+func postgresDSN(host, user, password, dbname, port, sslMode string) string {
+	return fmt.Sprintf(
+		"host=%s user=%s password=%s dbname=%s port=%s sslmode=%s",
+		host, user, password, dbname, port, sslMode,
+	)
+}
+
+// DbConfiguration 返回默认库、主库和全部从库的 DSN
+func DbConfiguration() (DSN, DSN, []DSN) {
+	db := Get().Database
 
 	defaultDBDSN := DSN{
-		fmt.Sprintf(
-			"host=%s user=%s password=%s dbname=%s port=%s sslmode=%s",
-			masterDBHost, masterDBUser, masterDBPassword, "postgres", masterDBPort, masterDBSslMode,
-		),
+		postgresDSN(db.MasterHost, db.MasterUser, db.MasterPassword, "postgres", db.MasterPort, db.MasterSslMode),
 		"postgres",
 	}
 	masterDBDSN := DSN{
-		fmt.Sprintf(
-			"host=%s user=%s password=%s dbname=%s port=%s sslmode=%s",
-			masterDBHost, masterDBUser, masterDBPassword, masterDBName, masterDBPort, masterDBSslMode,
-		),
-		masterDBName,
+		postgresDSN(db.MasterHost, db.MasterUser, db.MasterPassword, db.MasterName, db.MasterPort, db.MasterSslMode),
+		db.MasterName,
 	}
-
-	replicaDBDSN := DSN{
-		fmt.Sprintf(
-			"host=%s user=%s password=%s dbname=%s port=%s sslmode=%s",
-			replicaDBHost, replicaDBUser, replicaDBPassword, replicaDBName, replicaDBPort, replicaDBSslMode,
-		),
-		replicaDBName,
+	var replicaDBDSNs []DSN
+	for _, host := range db.replicaHosts() {
+		hostname, port := splitHostPort(host, db.ReplicaPort)
+		replicaDBDSNs = append(replicaDBDSNs, DSN{
+			postgresDSN(hostname, db.ReplicaUser, db.ReplicaPassword, db.ReplicaName, port, db.ReplicaSslMode),
+			db.ReplicaName,
+		})
 	}
 
-	return defaultDBDSN, masterDBDSN, replicaDBDSN
+	return defaultDBDSN, masterDBDSN, replicaDBDSNs
 }
@@ -0,0 +1,15 @@
+package config
+
+import "time"
+
+type DelegationConfiguration struct {
+	MaxDuration time.Duration `mapstructure:"DELEGATION_MAX_DURATION" default:"720h" usage:"审批委托有效期的上限"`
+}
+
+func (d DelegationConfiguration) validate() []string {
+	var problems []string
+	if d.MaxDuration < 24*time.Hour {
+		problems = append(problems, "DELEGATION_MAX_DURATION must be at least 24h")
+	}
+	return problems
+}
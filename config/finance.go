@@ -0,0 +1,25 @@
+package config
+
+import (
+	"fmt"
+
+	"github.com/shopspring/decimal"
+)
+
+type FinanceConfiguration struct {
+	ReconciliationTolerance string `mapstructure:"RECONCILIATION_TOLERANCE" default:"100" usage:"合同金额与银行金额之差超过该值（元）时生成对账差异"`
+}
+
+func (f FinanceConfiguration) validate() []string {
+	var problems []string
+	if tolerance, err := decimal.NewFromString(f.ReconciliationTolerance); err != nil || tolerance.IsNegative() {
+		problems = append(problems, fmt.Sprintf("RECONCILIATION_TOLERANCE %q is not a non-negative amount", f.ReconciliationTolerance))
+	}
+	return problems
+}
+
+// Tolerance 对账容差，配置已经过校验
+func (f FinanceConfiguration) Tolerance() decimal.Decimal {
+	tolerance, _ := decimal.NewFromString(f.ReconciliationTolerance)
+	return tolerance
+}
@@ -0,0 +1,16 @@
+package config
+
+import "time"
+
+type ImpersonationConfiguration struct {
+	DefaultDuration time.Duration `mapstructure:"IMPERSONATION_DEFAULT_DURATION" default:"30m" usage:"系统管理员代登录时没有指定 minutes 时代登录令牌的有效期"`
+	MaxDuration     time.Duration `mapstructure:"IMPERSONATION_MAX_DURATION" default:"2h" usage:"代登录令牌有效期的上限"`
+}
+
+func (i ImpersonationConfiguration) validate() []string {
+	var problems []string
+	if i.DefaultDuration < time.Minute || i.MaxDuration < i.DefaultDuration {
+		problems = append(problems, "IMPERSONATION_DEFAULT_DURATION must be at least 1m and not greater than IMPERSONATION_MAX_DURATION")
+	}
+	return problems
+}
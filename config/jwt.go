@@ -1,15 +1,61 @@
 package config
 
-import "github.com/spf13/viper"
+import (
+	"fmt"
 
-func JWTSecret() string {
-	return viper.GetString("JWT_SECRET")
+	"gin-boilerplate/infra/jwtkeys"
+)
+
+// JWT 密钥的最短长度（字节）
+const minJWTSecretLength = 32
+
+// 允许使用的签名算法，RS256 和 EdDSA 使用 JWT_KEYS_DIR 中的密钥
+var jwtAlgorithms = map[string]bool{
+	"HS256": true,
+	"HS384": true,
+	"HS512": true,
+	"RS256": true,
+	"EdDSA": true,
+}
+
+type JWTConfiguration struct {
+	Secret                    string `mapstructure:"JWT_SECRET" secret:"true" usage:"JWT 签名密钥，至少 32 字节，只用于 HS256/HS384/HS512"`
+	Algorithm                 string `mapstructure:"JWT_ALGORITHM" default:"HS256" usage:"JWT 签名算法，HS256、HS384、HS512、RS256 或 EdDSA，验证时只接受该算法"`
+	KeysDir                   string `mapstructure:"JWT_KEYS_DIR" usage:"RS256 和 EdDSA 的私钥目录，每个 <kid>.pem 文件是一个 PKCS#8 私钥，由 main jwt rotate 生成"`
+	Issuer                    string `mapstructure:"JWT_ISSUER" default:"gin-boilerplate" usage:"令牌的 iss，验证时必须一致"`
+	Audience                  string `mapstructure:"JWT_AUDIENCE" default:"gin-boilerplate-api" usage:"令牌的 aud，验证时必须一致"`
+	AccessTokenExpireMinutes  uint   `mapstructure:"JWT_ACCESS_TOKEN_EXPIRE_MINUTES" default:"30" usage:"访问令牌有效期（分钟）"`
+	RefreshTokenExpireMinutes uint   `mapstructure:"JWT_REFRESH_TOKEN_EXPIRE_MINUTES" default:"10080" usage:"刷新令牌有效期（分钟）"`
+}
+
+func (j JWTConfiguration) validate() []string {
+	var problems []string
+	if !jwtAlgorithms[j.Algorithm] {
+		problems = append(problems, fmt.Sprintf("JWT_ALGORITHM %q is not allowed, use one of HS256, HS384, HS512, RS256, EdDSA", j.Algorithm))
+	}
+	if jwtkeys.IsAsymmetric(j.Algorithm) {
+		if j.KeysDir == "" {
+			problems = append(problems, fmt.Sprintf("JWT_KEYS_DIR is required for %s", j.Algorithm))
+		}
+	} else if len(j.Secret) < minJWTSecretLength {
+		problems = append(problems, fmt.Sprintf("JWT_SECRET must be at least %d bytes long", minJWTSecretLength))
+	}
+	if j.Issuer == "" || j.Audience == "" {
+		problems = append(problems, "JWT_ISSUER and JWT_AUDIENCE must not be empty")
+	}
+	if j.AccessTokenExpireMinutes == 0 {
+		problems = append(problems, "JWT_ACCESS_TOKEN_EXPIRE_MINUTES must be greater than 0")
+	}
+	if j.RefreshTokenExpireMinutes <= j.AccessTokenExpireMinutes {
+		problems = append(problems, "JWT_REFRESH_TOKEN_EXPIRE_MINUTES must be greater than JWT_ACCESS_TOKEN_EXPIRE_MINUTES")
+	}
+	return problems
 }
 
-func JWTConfiguration() (string, string, uint, uint) {
-	jwtSecret := viper.GetString("JWT_SECRET")
-	jwtAlgorithm := viper.GetString("JWT_ALGORITHM")
-	jwtExpirationTime := viper.GetInt64("JWT_ACCESS_TOKEN_EXPIRE_MINUTES")
-	jwtRefreshTime := viper.GetInt64("JWT_REFRESH_TOKEN_EXPIRE_MINUTES")
-	return jwtSecret, jwtAlgorithm, uint(jwtExpirationTime), uint(jwtRefreshTime)
+// Keyring 按配置的算法读取签名密钥，RS256 和 EdDSA 的密钥目录中至少要有一个密钥
+func (j JWTConfiguration) Keyring() (*jwtkeys.Keyring, error) {
+	if jwtkeys.IsAsymmetric(j.Algorithm) {
+		return jwtkeys.LoadDir(j.Algorithm, j.KeysDir)
+	}
+	return jwtkeys.NewHMAC(j.Algorithm, []byte(j.Secret)), nil
 }
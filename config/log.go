@@ -0,0 +1,31 @@
+package config
+
+import "fmt"
+
+var logLevels = map[string]bool{
+	"debug": true,
+	"info":  true,
+	"warn":  true,
+	"error": true,
+}
+
+var logFormats = map[string]bool{
+	"json":    true,
+	"console": true,
+}
+
+type LogConfiguration struct {
+	Level  string `mapstructure:"LOG_LEVEL" default:"info" usage:"日志级别: debug, info, warn, error"`
+	Format string `mapstructure:"LOG_FORMAT" default:"console" usage:"日志格式: json, console"`
+}
+
+func (l LogConfiguration) validate() []string {
+	var problems []string
+	if !logLevels[l.Level] {
+		problems = append(problems, fmt.Sprintf("LOG_LEVEL %q is not allowed, use one of debug, info, warn, error", l.Level))
+	}
+	if !logFormats[l.Format] {
+		problems = append(problems, fmt.Sprintf("LOG_FORMAT %q is not allowed, use one of json, console", l.Format))
+	}
+	return problems
+}
@@ -0,0 +1,33 @@
+package config
+
+import "time"
+
+type LoginConfiguration struct {
+	DelayAfter      int           `mapstructure:"LOGIN_DELAY_AFTER" default:"3" usage:"同一用户名连续密码错误达到该次数后，每次重试前需要等待，等待时间逐次加倍"`
+	DelayBase       time.Duration `mapstructure:"LOGIN_DELAY_BASE" default:"1s" usage:"第一次需要等待的时间"`
+	DelayMax        time.Duration `mapstructure:"LOGIN_DELAY_MAX" default:"1m" usage:"每次等待时间的上限"`
+	LockoutAfter    int           `mapstructure:"LOGIN_LOCKOUT_AFTER" default:"5" usage:"同一用户名连续密码错误达到该次数后临时锁定账户"`
+	LockoutDuration time.Duration `mapstructure:"LOGIN_LOCKOUT_DURATION" default:"15m" usage:"账户锁定时长，系统管理员可以提前解锁"`
+	IPMaxFailures   int64         `mapstructure:"LOGIN_IP_MAX_FAILURES" default:"20" usage:"同一客户端IP在时间窗口内登录失败达到该次数后拒绝该IP登录"`
+	IPWindow        time.Duration `mapstructure:"LOGIN_IP_WINDOW" default:"15m" usage:"按客户端IP统计登录失败次数的时间窗口"`
+}
+
+func (l LoginConfiguration) validate() []string {
+	var problems []string
+	if l.LockoutAfter <= 0 {
+		problems = append(problems, "LOGIN_LOCKOUT_AFTER must be greater than 0")
+	}
+	if l.DelayAfter <= 0 || l.DelayAfter > l.LockoutAfter {
+		problems = append(problems, "LOGIN_DELAY_AFTER must be greater than 0 and not greater than LOGIN_LOCKOUT_AFTER")
+	}
+	if l.DelayBase <= 0 || l.DelayMax < l.DelayBase {
+		problems = append(problems, "LOGIN_DELAY_BASE must be greater than 0 and not greater than LOGIN_DELAY_MAX")
+	}
+	if l.LockoutDuration <= 0 {
+		problems = append(problems, "LOGIN_LOCKOUT_DURATION must be greater than 0")
+	}
+	if l.IPMaxFailures <= 0 || l.IPWindow <= 0 {
+		problems = append(problems, "LOGIN_IP_MAX_FAILURES and LOGIN_IP_WINDOW must be greater than 0")
+	}
+	return problems
+}
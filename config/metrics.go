@@ -0,0 +1,18 @@
+package config
+
+// metrics 令牌的最短长度
+const minMetricsTokenLength = 16
+
+type MetricsConfiguration struct {
+	Enabled bool   `mapstructure:"METRICS_ENABLED" default:"false" usage:"是否开放 /metrics 路由"`
+	Token   string `mapstructure:"METRICS_TOKEN" secret:"true" usage:"访问 /metrics 所需的 Bearer 令牌，至少 16 字节"`
+}
+
+// 非调试模式下开放 /metrics 时必须配置令牌
+func (m MetricsConfiguration) validate(debug bool) []string {
+	var problems []string
+	if m.Enabled && !debug && len(m.Token) < minMetricsTokenLength {
+		problems = append(problems, "METRICS_TOKEN must be at least 16 bytes long when METRICS_ENABLED is true")
+	}
+	return problems
+}
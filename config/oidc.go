@@ -0,0 +1,92 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"time"
+
+	"gin-boilerplate/models"
+)
+
+type OIDCConfiguration struct {
+	ProvidersFile string        `mapstructure:"OIDC_PROVIDERS_FILE" usage:"OpenID Connect 单点登录的身份提供方配置文件（JSON 数组），为空表示不启用单点登录"`
+	StateLifetime time.Duration `mapstructure:"OIDC_STATE_LIFETIME" default:"10m" usage:"跳转到身份提供方登录后，回调的有效时间"`
+}
+
+// OIDCProvider 一个身份提供方，配置文件中的每一项
+type OIDCProvider struct {
+	Name         string   `json:"name"`          // 路由中使用的名称，/api/v1/sso/{name}/login
+	Issuer       string   `json:"issuer"`        // 身份提供方的 issuer，从 {issuer}/.well-known/openid-configuration 读取端点
+	ClientID     string   `json:"client_id"`     // 在身份提供方注册的客户端
+	ClientSecret string   `json:"client_secret"` // 客户端密钥
+	RedirectURL  string   `json:"redirect_url"`  // 回调地址，/api/v1/sso/{name}/callback 的完整 URL
+	Scopes       []string `json:"scopes"`        // 为空时使用 openid profile email
+	// 用户名与 preferred_username 相同的已有用户在第一次单点登录时自动关联，只应在身份提供方是公司目录时开启
+	// 特权角色（models.NonLinkableRoles）和开启了两步验证的用户不会自动关联
+	LinkByUsername bool `json:"link_by_username"`
+	// 分组声明的名称，为空时不按分组设置角色
+	GroupsClaim string `json:"groups_claim"`
+	// 按顺序匹配，用户属于的第一个分组决定角色，都不匹配时为默认权限；每次登录都按分组同步角色
+	RoleMapping []OIDCRoleMapping `json:"role_mapping"`
+}
+
+// OIDCRoleMapping 身份提供方的分组对应的角色名称
+type OIDCRoleMapping struct {
+	Group string `json:"group"`
+	Role  string `json:"role"`
+}
+
+var oidcProviderName = regexp.MustCompile(`^[a-z0-9-]+$`)
+
+func (o OIDCConfiguration) validate() []string {
+	var problems []string
+	if o.StateLifetime <= 0 {
+		problems = append(problems, "OIDC_STATE_LIFETIME must be greater than 0")
+	}
+	if _, err := o.Providers(); err != nil {
+		problems = append(problems, err.Error())
+	}
+	return problems
+}
+
+// Providers 读取并校验 OIDC_PROVIDERS_FILE，未配置时返回空
+func (o OIDCConfiguration) Providers() ([]OIDCProvider, error) {
+	if o.ProvidersFile == "" {
+		return nil, nil
+	}
+	content, err := os.ReadFile(o.ProvidersFile)
+	if err != nil {
+		return nil, fmt.Errorf("OIDC_PROVIDERS_FILE is not readable: %w", err)
+	}
+	var providers []OIDCProvider
+	if err := json.Unmarshal(content, &providers); err != nil {
+		return nil, fmt.Errorf("OIDC_PROVIDERS_FILE is not a JSON array of providers: %w", err)
+	}
+	names := map[string]bool{}
+	for i, p := range providers {
+		if !oidcProviderName.MatchString(p.Name) || names[p.Name] {
+			return nil, fmt.Errorf("OIDC provider %d: name %q must be unique and contain only a-z, 0-9 and -", i, p.Name)
+		}
+		names[p.Name] = true
+		if p.ClientID == "" {
+			return nil, fmt.Errorf("OIDC provider %s: client_id is required", p.Name)
+		}
+		for field, value := range map[string]string{"issuer": p.Issuer, "redirect_url": p.RedirectURL} {
+			if u, err := url.Parse(value); err != nil || u.Scheme == "" || u.Host == "" {
+				return nil, fmt.Errorf("OIDC provider %s: %s %q is not an absolute URL", p.Name, field, value)
+			}
+		}
+		for _, mapping := range p.RoleMapping {
+			if _, ok := models.RoleStrToEnumMap[mapping.Role]; !ok || mapping.Group == "" {
+				return nil, fmt.Errorf("OIDC provider %s: role_mapping %q => %q is invalid", p.Name, mapping.Group, mapping.Role)
+			}
+		}
+		if len(p.RoleMapping) > 0 && p.GroupsClaim == "" {
+			return nil, fmt.Errorf("OIDC provider %s: groups_claim is required when role_mapping is set", p.Name)
+		}
+	}
+	return providers, nil
+}
@@ -0,0 +1,41 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+type PasswordConfiguration struct {
+	MinLength         int           `mapstructure:"PASSWORD_MIN_LENGTH" default:"8" usage:"密码最少字符数，中文等非ASCII字符按一个字符计算"`
+	MaxLength         int           `mapstructure:"PASSWORD_MAX_LENGTH" default:"72" usage:"密码最多字节数，bcrypt 只使用前72字节，不能超过72"`
+	MinClasses        int           `mapstructure:"PASSWORD_MIN_CLASSES" default:"2" usage:"密码至少包含的字符种类数（小写字母、大写字母、数字、其他字符），1-4"`
+	BlacklistFile     string        `mapstructure:"PASSWORD_BLACKLIST_FILE" usage:"常见密码列表文件，每行一个，与内置列表合并，不区分大小写"`
+	History           int           `mapstructure:"PASSWORD_HISTORY" default:"5" usage:"修改密码时不能与最近几次使用过的密码相同，0 表示只检查当前密码"`
+	TemporaryLifetime time.Duration `mapstructure:"PASSWORD_TEMPORARY_LIFETIME" default:"24h" usage:"系统管理员重置密码后生成的临时密码的有效期，过期后需要重新重置"`
+}
+
+// bcrypt 只使用密码的前72字节
+const maxBcryptPasswordBytes = 72
+
+func (p PasswordConfiguration) validate() []string {
+	var problems []string
+	if p.MinLength <= 0 || p.MaxLength < p.MinLength || p.MaxLength > maxBcryptPasswordBytes {
+		problems = append(problems, fmt.Sprintf("PASSWORD_MIN_LENGTH must be greater than 0 and not greater than PASSWORD_MAX_LENGTH, which must not exceed %d", maxBcryptPasswordBytes))
+	}
+	if p.MinClasses < 1 || p.MinClasses > 4 {
+		problems = append(problems, "PASSWORD_MIN_CLASSES must be between 1 and 4")
+	}
+	if p.BlacklistFile != "" {
+		if _, err := os.Stat(p.BlacklistFile); err != nil {
+			problems = append(problems, fmt.Sprintf("PASSWORD_BLACKLIST_FILE is not readable: %s", err))
+		}
+	}
+	if p.History < 0 {
+		problems = append(problems, "PASSWORD_HISTORY must not be negative")
+	}
+	if p.TemporaryLifetime <= 0 {
+		problems = append(problems, "PASSWORD_TEMPORARY_LIFETIME must be greater than 0")
+	}
+	return problems
+}
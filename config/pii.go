@@ -0,0 +1,61 @@
+package config
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+// PII 加密密钥的长度（字节），使用 AES-256-GCM
+const piiKeyLength = 32
+
+// 盲索引密钥的最短长度（字节）
+const minBlindIndexKeyLength = 32
+
+type PIIConfiguration struct {
+	EncryptionKeys string `mapstructure:"PII_ENCRYPTION_KEYS" secret:"true" usage:"客户敏感信息的加密密钥，格式 id:base64密钥，多个用逗号分隔，第一个用于加密"`
+	BlindIndexKey  string `mapstructure:"PII_BLIND_INDEX_KEY" secret:"true" usage:"电话号码盲索引的 HMAC 密钥，至少 32 字节"`
+}
+
+func (p PIIConfiguration) validate() []string {
+	var problems []string
+	if _, _, err := p.Keys(); err != nil {
+		problems = append(problems, err.Error())
+	}
+	if len(p.BlindIndexKey) < minBlindIndexKeyLength {
+		problems = append(problems, fmt.Sprintf("PII_BLIND_INDEX_KEY must be at least %d bytes long", minBlindIndexKeyLength))
+	}
+	return problems
+}
+
+// Keys 解析加密密钥，返回用于加密的密钥ID和全部密钥（轮换期间旧密钥仍用于解密）
+func (p PIIConfiguration) Keys() (string, map[string][]byte, error) {
+	var active string
+	keys := map[string][]byte{}
+	for _, entry := range strings.Split(p.EncryptionKeys, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.SplitN(entry, ":", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return "", nil, fmt.Errorf("PII_ENCRYPTION_KEYS entry %q is not in the form id:base64key", entry)
+		}
+		id := parts[0]
+		key, err := base64.StdEncoding.DecodeString(parts[1])
+		if err != nil || len(key) != piiKeyLength {
+			return "", nil, fmt.Errorf("PII_ENCRYPTION_KEYS key %q must be %d bytes encoded in base64", id, piiKeyLength)
+		}
+		if _, ok := keys[id]; ok {
+			return "", nil, fmt.Errorf("PII_ENCRYPTION_KEYS key id %q is duplicated", id)
+		}
+		if active == "" {
+			active = id
+		}
+		keys[id] = key
+	}
+	if active == "" {
+		return "", nil, fmt.Errorf("PII_ENCRYPTION_KEYS is required")
+	}
+	return active, keys, nil
+}
@@ -0,0 +1,67 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 没有单独配置的路由使用该规则
+const DefaultRateLimitRoute = "*"
+
+type RateLimitConfiguration struct {
+	Backend       string `mapstructure:"RATE_LIMIT_BACKEND" default:"memory" usage:"限流计数的存储：memory（单实例）或 redis（多实例共享）"`
+	Rules         string `mapstructure:"RATE_LIMIT_RULES" default:"/api/v1/login=20/1m,/api/v1/login/verify=20/1m,/api/v1/register=10/1m,*=600/1m" usage:"每个客户端IP的限流规则，格式为 路由=次数/时间窗口，多条用逗号分隔，* 表示其他路由"`
+	RedisAddr     string `mapstructure:"REDIS_ADDR" default:"localhost:6379" usage:"Redis 地址，RATE_LIMIT_BACKEND=redis 时使用"`
+	RedisPassword string `mapstructure:"REDIS_PASSWORD" secret:"true" usage:"Redis 密码"`
+	RedisDB       int    `mapstructure:"REDIS_DB" default:"0" usage:"Redis 数据库编号"`
+}
+
+// RateLimitRule 时间窗口内最多允许的请求次数
+type RateLimitRule struct {
+	Limit  int64
+	Window time.Duration
+}
+
+func (r RateLimitConfiguration) validate() []string {
+	var problems []string
+	if r.Backend != "memory" && r.Backend != "redis" {
+		problems = append(problems, fmt.Sprintf("RATE_LIMIT_BACKEND %q is not allowed, use memory or redis", r.Backend))
+	}
+	if r.Backend == "redis" && r.RedisAddr == "" {
+		problems = append(problems, "REDIS_ADDR is required when RATE_LIMIT_BACKEND is redis")
+	}
+	if _, err := r.ParseRules(); err != nil {
+		problems = append(problems, err.Error())
+	}
+	return problems
+}
+
+// ParseRules 解析 RATE_LIMIT_RULES，返回路由到规则的映射，为空表示不限流
+func (r RateLimitConfiguration) ParseRules() (map[string]RateLimitRule, error) {
+	rules := map[string]RateLimitRule{}
+	for _, item := range strings.Split(r.Rules, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		parts := strings.SplitN(item, "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" || !strings.Contains(parts[1], "/") {
+			return nil, fmt.Errorf("RATE_LIMIT_RULES entry %q is not in the form route=limit/window", item)
+		}
+		route := parts[0]
+		limitAndWindow := strings.SplitN(parts[1], "/", 2)
+		limit, window := limitAndWindow[0], limitAndWindow[1]
+		count, err := strconv.ParseInt(strings.TrimSpace(limit), 10, 64)
+		if err != nil || count <= 0 {
+			return nil, fmt.Errorf("RATE_LIMIT_RULES entry %q has an invalid limit", item)
+		}
+		duration, err := time.ParseDuration(strings.TrimSpace(window))
+		if err != nil || duration <= 0 {
+			return nil, fmt.Errorf("RATE_LIMIT_RULES entry %q has an invalid window", item)
+		}
+		rules[strings.TrimSpace(route)] = RateLimitRule{Limit: count, Window: duration}
+	}
+	return rules, nil
+}
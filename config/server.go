@@ -2,21 +2,43 @@ package config
 
 import (
 	"fmt"
-	"github.com/spf13/viper"
-	"log"
+	"strconv"
+	"time"
+
+	"gin-boilerplate/infra/logger"
 )
 
 type ServerConfiguration struct {
-	Port                 string
-	Secret               string
-	LimitCountPerRequest int64
+	Host         string `mapstructure:"SERVER_HOST" default:"0.0.0.0" usage:"服务监听地址"`
+	Port         string `mapstructure:"SERVER_PORT" default:"8000" usage:"服务监听端口"`
+	Timezone     string `mapstructure:"SERVER_TIMEZONE" default:"Asia/Shanghai" usage:"服务时区"`
+	Secret       string `mapstructure:"SECRET" secret:"true" usage:"应用密钥"`
+	Debug        bool   `mapstructure:"DEBUG" default:"false" usage:"调试模式，生产环境必须为 false"`
+	AllowedHosts string `mapstructure:"ALLOWED_HOSTS" usage:"受信任的代理地址"`
 }
 
-func ServerConfig() string {
-	viper.SetDefault("SERVER_HOST", "0.0.0.0")
-	viper.SetDefault("SERVER_PORT", "8000")
+func (s ServerConfiguration) validate() []string {
+	var problems []string
+	if s.Host == "" {
+		problems = append(problems, "SERVER_HOST is required")
+	}
+	if !isValidPort(s.Port) {
+		problems = append(problems, fmt.Sprintf("SERVER_PORT %q is not a valid port", s.Port))
+	}
+	if _, err := time.LoadLocation(s.Timezone); err != nil {
+		problems = append(problems, fmt.Sprintf("SERVER_TIMEZONE %q is not a valid timezone", s.Timezone))
+	}
+	return problems
+}
 
-	appServer := fmt.Sprintf("%s:%s", viper.GetString("SERVER_HOST"), viper.GetString("SERVER_PORT"))
-	log.Print("Server Running at :", appServer)
+func ServerConfig() string {
+	server := Get().Server
+	appServer := fmt.Sprintf("%s:%s", server.Host, server.Port)
+	logger.Infof("Server Running at :%s", appServer)
 	return appServer
 }
+
+func isValidPort(port string) bool {
+	p, err := strconv.Atoi(port)
+	return err == nil && p > 0 && p <= 65535
+}
@@ -0,0 +1,60 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"gin-boilerplate/models"
+)
+
+type TOTPConfiguration struct {
+	Issuer            string        `mapstructure:"TOTP_ISSUER" default:"gin-boilerplate" usage:"验证器应用中显示的发行方名称"`
+	RequiredRoles     string        `mapstructure:"TOTP_REQUIRED_ROLES" default:"系统管理员,金融经理,总经理" usage:"必须使用两步验证的角色，多个用逗号分隔，为空表示都不强制"`
+	ChallengeLifetime time.Duration `mapstructure:"TOTP_CHALLENGE_LIFETIME" default:"5m" usage:"密码验证通过后，输入两步验证码的有效时间"`
+	Skew              int           `mapstructure:"TOTP_SKEW" default:"1" usage:"允许的时间偏差，按30秒一个周期计算"`
+	RecoveryCodes     int           `mapstructure:"TOTP_RECOVERY_CODES" default:"10" usage:"每次生成的恢复码数量，每个恢复码只能使用一次"`
+}
+
+func (t TOTPConfiguration) validate() []string {
+	var problems []string
+	if t.Issuer == "" || strings.Contains(t.Issuer, ":") {
+		problems = append(problems, "TOTP_ISSUER is required and must not contain ':'")
+	}
+	for _, role := range t.Roles() {
+		if _, ok := models.RoleStrToEnumMap[role]; !ok {
+			problems = append(problems, fmt.Sprintf("TOTP_REQUIRED_ROLES contains unknown role %q", role))
+		}
+	}
+	if t.ChallengeLifetime <= 0 {
+		problems = append(problems, "TOTP_CHALLENGE_LIFETIME must be greater than 0")
+	}
+	if t.Skew < 0 || t.Skew > 10 {
+		problems = append(problems, "TOTP_SKEW must be between 0 and 10")
+	}
+	if t.RecoveryCodes <= 0 {
+		problems = append(problems, "TOTP_RECOVERY_CODES must be greater than 0")
+	}
+	return problems
+}
+
+// Roles 必须使用两步验证的角色名称
+func (t TOTPConfiguration) Roles() []string {
+	var roles []string
+	for _, role := range strings.Split(t.RequiredRoles, ",") {
+		if role = strings.TrimSpace(role); role != "" {
+			roles = append(roles, role)
+		}
+	}
+	return roles
+}
+
+// Required 该角色是否必须使用两步验证
+func (t TOTPConfiguration) Required(role string) bool {
+	for _, required := range t.Roles() {
+		if required == role {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,98 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"gin-boilerplate/config"
+	"gin-boilerplate/helpers"
+	"gin-boilerplate/infra/apperror"
+	"gin-boilerplate/models"
+	"gin-boilerplate/repository"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AdministratorCreateAPIKey 系统管理员为用户创建 API 密钥，返回的 key 只显示这一次，之后无法再次查看
+func (c *Controller) AdministratorCreateAPIKey(ctx *gin.Context) {
+	var createForm CreateAPIKeyForm
+	if err := ctx.ShouldBind(&createForm); err != nil {
+		_ = ctx.Error(invalidParams(err))
+		return
+	}
+	apiKeyConfig := config.Get().APIKey
+	lifetime := time.Duration(createForm.ExpiresInDays) * 24 * time.Hour
+	if maxDays := int64(apiKeyConfig.MaxLifetime / (24 * time.Hour)); int64(createForm.ExpiresInDays) > maxDays {
+		_ = ctx.Error(apperror.New(apperror.CodeInvalidParams).WithDetails([]FieldError{{
+			Field: "expires_in_days", Rule: "max", Param: strconv.FormatInt(maxDays, 10),
+		}}))
+		return
+	}
+	scopes, _ := models.ParsePermissions(createForm.Scopes)
+
+	plaintext, prefix, secretHash, err := helpers.GenerateAPIKey()
+	if err != nil {
+		_ = ctx.Error(fmt.Errorf("failed to generate api key: %w", err))
+		return
+	}
+	key, err := c.repos.APIKeys.CreateAPIKey(ctx, currentClaims(ctx).UserID, repository.NewAPIKey{
+		UserID:     createForm.UserID,
+		Name:       createForm.Name,
+		Scopes:     scopes,
+		RateLimit:  createForm.RateLimit,
+		ExpiresAt:  time.Now().Add(lifetime),
+		Prefix:     prefix,
+		SecretHash: secretHash,
+	})
+	if err != nil {
+		_ = ctx.Error(fmt.Errorf("failed to create api key: %w", err))
+		return
+	}
+
+	response := Response{
+		Code:    http.StatusOK,
+		Message: "API key created, store it now as it will not be shown again",
+		Data:    CreatedAPIKeyDTO{Key: plaintext, APIKey: toAPIKeyDTO(key)},
+	}
+	ctx.JSON(http.StatusOK, response)
+}
+
+// AdministratorListAPIKeys 系统管理员查看全部 API 密钥及其最近使用时间
+func (c *Controller) AdministratorListAPIKeys(ctx *gin.Context) {
+	keys, err := c.repos.APIKeys.ListAPIKeys(ctx, currentClaims(ctx).UserID)
+	if err != nil {
+		_ = ctx.Error(fmt.Errorf("failed to list api keys: %w", err))
+		return
+	}
+
+	response := Response{
+		Code:    http.StatusOK,
+		Message: "List API keys successful",
+		Data:    toAPIKeyDTOs(keys),
+	}
+	ctx.JSON(http.StatusOK, response)
+}
+
+// AdministratorRevokeAPIKey 系统管理员撤销 API 密钥，立即生效
+func (c *Controller) AdministratorRevokeAPIKey(ctx *gin.Context) {
+	var revokeForm RevokeAPIKeyForm
+	if err := ctx.ShouldBind(&revokeForm); err != nil {
+		_ = ctx.Error(invalidParams(err))
+		return
+	}
+
+	key, err := c.repos.APIKeys.RevokeAPIKey(ctx, currentClaims(ctx).UserID, revokeForm.APIKeyID)
+	if err != nil {
+		_ = ctx.Error(fmt.Errorf("failed to revoke api key: %w", err))
+		return
+	}
+
+	response := Response{
+		Code:    http.StatusOK,
+		Message: "API key revoked",
+		Data:    toAPIKeyDTO(key),
+	}
+	ctx.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,181 @@
+package controllers
+
+import (
+	"fmt"
+	"gin-boilerplate/infra/apperror"
+	"gin-boilerplate/models"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AccountantCreateCommissionPlan 会计为销售角色配置新的提成方案
+func (c *Controller) AccountantCreateCommissionPlan(ctx *gin.Context) {
+	var createForm CreateCommissionPlanForm
+	if err := ctx.ShouldBind(&createForm); err != nil {
+		_ = ctx.Error(invalidParams(err))
+		return
+	}
+	if len(createForm.TierMinVolumes) != len(createForm.TierRates) {
+		_ = ctx.Error(apperror.New(apperror.CodeInvalidParams).WithDetails([]FieldError{{
+			Field: "tier_rates", Rule: "len", Param: strconv.Itoa(len(createForm.TierMinVolumes)),
+		}}))
+		return
+	}
+
+	tiers := make([]models.CommissionTier, 0, len(createForm.TierRates))
+	for i := range createForm.TierRates {
+		tiers = append(tiers, models.CommissionTier{
+			MinVolume: createForm.TierMinVolumes[i],
+			Rate:      createForm.TierRates[i],
+		})
+	}
+	plan, err := c.repos.Commission.CreateCommissionPlan(
+		ctx,
+		currentClaims(ctx).UserID,
+		createForm.Name,
+		models.RoleStrToEnumMap[createForm.Role],
+		createForm.BaseRate,
+		createForm.OverrideRate,
+		tiers,
+	)
+	if err != nil {
+		_ = ctx.Error(fmt.Errorf("failed to create commission plan: %w", err))
+		return
+	}
+
+	response := Response{
+		Code:    http.StatusOK,
+		Message: "Create commission plan successful",
+		Data:    toCommissionPlanDTO(plan),
+	}
+	ctx.JSON(http.StatusOK, response)
+}
+
+func (c *Controller) AccountantGetCommissionPlans(ctx *gin.Context) {
+	plans, err := c.repos.Commission.GetCommissionPlans(ctx)
+	if err != nil {
+		_ = ctx.Error(fmt.Errorf("failed to get commission plans: %w", err))
+		return
+	}
+
+	response := Response{
+		Code:    http.StatusOK,
+		Message: "Get commission plans successful",
+		Data:    toCommissionPlanDTOs(plans),
+	}
+	ctx.JSON(http.StatusOK, response)
+}
+
+// AccountantSettleCommissions 手动结算某月提成，每月初的定时任务会自动结算上个月
+func (c *Controller) AccountantSettleCommissions(ctx *gin.Context) {
+	var settleForm SettleCommissionsForm
+	if err := ctx.ShouldBind(&settleForm); err != nil {
+		_ = ctx.Error(invalidParams(err))
+		return
+	}
+
+	statements, err := c.repos.Commission.SettleCommissions(ctx, currentClaims(ctx).UserID, settleForm.Period)
+	if err != nil {
+		_ = ctx.Error(fmt.Errorf("failed to settle commissions: %w", err))
+		return
+	}
+
+	response := Response{
+		Code:    http.StatusOK,
+		Message: "Settle commissions successful",
+		Data:    toCommissionStatementDTOs(statements),
+	}
+	ctx.JSON(http.StatusOK, response)
+}
+
+func (c *Controller) AccountantGetCommissionStatements(ctx *gin.Context) {
+	var getForm GetCommissionStatementsForm
+	if err := ctx.ShouldBind(&getForm); err != nil {
+		_ = ctx.Error(invalidParams(err))
+		return
+	}
+
+	statements, err := c.repos.Commission.GetCommissionStatements(ctx, currentClaims(ctx).UserID, getForm.Period)
+	if err != nil {
+		_ = ctx.Error(fmt.Errorf("failed to get commission statements: %w", err))
+		return
+	}
+
+	response := Response{
+		Code:    http.StatusOK,
+		Message: "Get commission statements successful",
+		Data:    toCommissionStatementDTOs(statements),
+	}
+	ctx.JSON(http.StatusOK, response)
+}
+
+func (c *Controller) AccountantGetCommissionStatement(ctx *gin.Context) {
+	var getForm GetCommissionStatementForm
+	if err := ctx.ShouldBind(&getForm); err != nil {
+		_ = ctx.Error(invalidParams(err))
+		return
+	}
+
+	statement, err := c.repos.Commission.GetCommissionStatement(ctx, currentClaims(ctx).UserID, getForm.StatementID)
+	if err != nil {
+		_ = ctx.Error(fmt.Errorf("failed to get commission statement: %w", err))
+		return
+	}
+
+	response := Response{
+		Code:    http.StatusOK,
+		Message: "Get commission statement successful",
+		Data:    toCommissionStatementDTO(statement),
+	}
+	ctx.JSON(http.StatusOK, response)
+}
+
+func (c *Controller) AccountantAdjustCommissionStatement(ctx *gin.Context) {
+	var adjustForm AdjustCommissionStatementForm
+	if err := ctx.ShouldBind(&adjustForm); err != nil {
+		_ = ctx.Error(invalidParams(err))
+		return
+	}
+
+	statement, err := c.repos.Commission.AdjustCommissionStatement(
+		ctx,
+		currentClaims(ctx).UserID,
+		adjustForm.StatementID,
+		adjustForm.Adjustment,
+		adjustForm.Note,
+	)
+	if err != nil {
+		_ = ctx.Error(fmt.Errorf("failed to adjust commission statement: %w", err))
+		return
+	}
+
+	response := Response{
+		Code:    http.StatusOK,
+		Message: "Adjust commission statement successful",
+		Data:    toCommissionStatementDTO(statement),
+	}
+	ctx.JSON(http.StatusOK, response)
+}
+
+func (c *Controller) AccountantLockCommissionStatement(ctx *gin.Context) {
+	var lockForm LockCommissionStatementForm
+	if err := ctx.ShouldBind(&lockForm); err != nil {
+		_ = ctx.Error(invalidParams(err))
+		return
+	}
+
+	statement, err := c.repos.Commission.LockCommissionStatement(ctx, currentClaims(ctx).UserID, lockForm.StatementID)
+	if err != nil {
+		_ = ctx.Error(fmt.Errorf("failed to lock commission statement: %w", err))
+		return
+	}
+
+	response := Response{
+		Code:    http.StatusOK,
+		Message: "Lock commission statement successful",
+		Data:    toCommissionStatementDTO(statement),
+	}
+	ctx.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,19 @@
+package controllers
+
+import (
+	"gin-boilerplate/infra/ratelimit"
+	"gin-boilerplate/repository"
+)
+
+// Controller 业务接口控制器，通过仓储接口访问数据，不直接依赖数据库连接
+type Controller struct {
+	repos  *repository.Repositories
+	limits ratelimit.Store // 按客户端IP统计登录失败次数
+	sso    map[string]*ssoProvider
+}
+
+// NewController 创建控制器，repos 可以是 Postgres 或 SQLite 上的仓储实现
+func NewController(repos *repository.Repositories, limits ratelimit.Store) *Controller {
+	registerValidators()
+	return &Controller{repos: repos, limits: limits, sso: newSSOProviders()}
+}
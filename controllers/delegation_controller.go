@@ -0,0 +1,171 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"gin-boilerplate/config"
+	"gin-boilerplate/infra/apperror"
+	"gin-boilerplate/repository"
+
+	"github.com/gin-gonic/gin"
+)
+
+// UserCreateDelegation 当前用户把审批和合同访问权限委托给其他用户，到期后自动失效
+func (c *Controller) UserCreateDelegation(ctx *gin.Context) {
+	var createForm CreateDelegationForm
+	if err := ctx.ShouldBind(&createForm); err != nil {
+		_ = ctx.Error(invalidParams(err))
+		return
+	}
+
+	if err := checkDelegationPeriod(createForm.StartDate, createForm.EndDate); err != nil {
+		_ = ctx.Error(err)
+		return
+	}
+
+	userID := currentClaims(ctx).UserID
+	delegation, err := c.repos.Delegations.CreateDelegation(ctx, userID, repository.NewDelegation{
+		PrincipalID: userID,
+		DelegateID:  createForm.DelegateID,
+		Reason:      createForm.Reason,
+		StartsAt:    createForm.StartDate,
+		EndsAt:      createForm.EndDate,
+	})
+	if err != nil {
+		_ = ctx.Error(fmt.Errorf("failed to create delegation: %w", err))
+		return
+	}
+
+	response := Response{
+		Code:    http.StatusOK,
+		Message: "Delegation created",
+		Data:    toDelegationDTO(delegation),
+	}
+	ctx.JSON(http.StatusOK, response)
+}
+
+// UserListDelegations 当前用户委托出去的和委托给自己的委托
+func (c *Controller) UserListDelegations(ctx *gin.Context) {
+	delegations, err := c.repos.Delegations.ListDelegations(ctx, currentClaims(ctx).UserID)
+	if err != nil {
+		_ = ctx.Error(fmt.Errorf("failed to list delegations: %w", err))
+		return
+	}
+
+	response := Response{
+		Code:    http.StatusOK,
+		Message: "List delegations successful",
+		Data:    toDelegationDTOs(delegations),
+	}
+	ctx.JSON(http.StatusOK, response)
+}
+
+// UserRevokeDelegation 委托人提前结束自己的委托
+func (c *Controller) UserRevokeDelegation(ctx *gin.Context) {
+	var revokeForm RevokeDelegationForm
+	if err := ctx.ShouldBind(&revokeForm); err != nil {
+		_ = ctx.Error(invalidParams(err))
+		return
+	}
+
+	userID := currentClaims(ctx).UserID
+	delegation, err := c.repos.Delegations.RevokeDelegation(ctx, userID, revokeForm.DelegationID, &userID)
+	if err != nil {
+		_ = ctx.Error(fmt.Errorf("failed to revoke delegation: %w", err))
+		return
+	}
+
+	response := Response{
+		Code:    http.StatusOK,
+		Message: "Delegation revoked",
+		Data:    toDelegationDTO(delegation),
+	}
+	ctx.JSON(http.StatusOK, response)
+}
+
+// AdministratorCreateDelegation 系统管理员为已经休假、无法自己创建委托的用户创建委托
+func (c *Controller) AdministratorCreateDelegation(ctx *gin.Context) {
+	var createForm AdministratorCreateDelegationForm
+	if err := ctx.ShouldBind(&createForm); err != nil {
+		_ = ctx.Error(invalidParams(err))
+		return
+	}
+
+	if err := checkDelegationPeriod(createForm.StartDate, createForm.EndDate); err != nil {
+		_ = ctx.Error(err)
+		return
+	}
+
+	delegation, err := c.repos.Delegations.CreateDelegation(ctx, currentClaims(ctx).UserID, repository.NewDelegation{
+		PrincipalID: createForm.PrincipalID,
+		DelegateID:  createForm.DelegateID,
+		Reason:      createForm.Reason,
+		StartsAt:    createForm.StartDate,
+		EndsAt:      createForm.EndDate,
+	})
+	if err != nil {
+		_ = ctx.Error(fmt.Errorf("failed to create delegation: %w", err))
+		return
+	}
+
+	response := Response{
+		Code:    http.StatusOK,
+		Message: "Delegation created",
+		Data:    toDelegationDTO(delegation),
+	}
+	ctx.JSON(http.StatusOK, response)
+}
+
+// AdministratorListDelegations 系统管理员查看全部委托
+func (c *Controller) AdministratorListDelegations(ctx *gin.Context) {
+	delegations, err := c.repos.Delegations.GetAllDelegations(ctx, currentClaims(ctx).UserID)
+	if err != nil {
+		_ = ctx.Error(fmt.Errorf("failed to list delegations: %w", err))
+		return
+	}
+
+	response := Response{
+		Code:    http.StatusOK,
+		Message: "List delegations successful",
+		Data:    toDelegationDTOs(delegations),
+	}
+	ctx.JSON(http.StatusOK, response)
+}
+
+// AdministratorRevokeDelegation 系统管理员提前结束任意委托
+func (c *Controller) AdministratorRevokeDelegation(ctx *gin.Context) {
+	var revokeForm AdministratorRevokeDelegationForm
+	if err := ctx.ShouldBind(&revokeForm); err != nil {
+		_ = ctx.Error(invalidParams(err))
+		return
+	}
+
+	delegation, err := c.repos.Delegations.RevokeDelegation(ctx, currentClaims(ctx).UserID, revokeForm.DelegationID, nil)
+	if err != nil {
+		_ = ctx.Error(fmt.Errorf("failed to revoke delegation: %w", err))
+		return
+	}
+
+	response := Response{
+		Code:    http.StatusOK,
+		Message: "Delegation revoked",
+		Data:    toDelegationDTO(delegation),
+	}
+	ctx.JSON(http.StatusOK, response)
+}
+
+// checkDelegationPeriod 委托的结束时间不能早于当前时间，有效期不能超过 DELEGATION_MAX_DURATION
+func checkDelegationPeriod(startsAt, endsAt time.Time) error {
+	if !endsAt.After(time.Now()) {
+		return apperror.New(apperror.CodeInvalidParams).WithDetails([]FieldError{{Field: "end_date", Rule: "future"}})
+	}
+	if maxDuration := config.Get().Delegation.MaxDuration; endsAt.Sub(startsAt) > maxDuration {
+		return apperror.New(apperror.CodeInvalidParams).WithDetails([]FieldError{{
+			Field: "end_date", Rule: "max", Param: strconv.FormatInt(int64(maxDuration/time.Hour), 10),
+		}})
+	}
+	return nil
+}
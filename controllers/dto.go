@@ -0,0 +1,914 @@
+package controllers
+
+import (
+	"gin-boilerplate/infra/apperror"
+	"gin-boilerplate/models"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+/*
+响应 DTO
+
+接口只返回这里定义的结构，不直接序列化 gorm 模型（避免泄露 PasswordHash、DeletedAt、合同图片等）：
+  - 字段名统一为 snake_case
+  - 枚举同时返回稳定的数值（如 status）和显示名称（如 status_name，取自 models.*NameMap）
+  - 关联数据默认不返回，通过 ?include= 按需返回，例如 include=profile、include=departments
+*/
+
+// includes 请求中 include 参数的集合
+type includes map[string]bool
+
+// parseIncludes 解析 include 参数（逗号分隔或重复传入），只允许 allowed 中的值
+func parseIncludes(ctx *gin.Context, allowed ...string) (includes, error) {
+	result := includes{}
+	for _, value := range ctx.QueryArray("include") {
+		for _, name := range strings.Split(value, ",") {
+			name = strings.TrimSpace(name)
+			if name == "" {
+				continue
+			}
+			if !contains(allowed, name) {
+				return nil, apperror.New(apperror.CodeInvalidParams).WithDetails([]FieldError{{
+					Field: "include", Rule: "oneof", Param: strings.Join(allowed, " "),
+				}})
+			}
+			result[name] = true
+		}
+	}
+	return result, nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+/*用户和组织*/
+
+type UserDTO struct {
+	ID                 uint            `json:"id"`
+	UserName           string          `json:"user_name"`
+	Role               models.RoleID   `json:"role"`
+	RoleName           string          `json:"role_name"`
+	DepartmentID       *uint           `json:"department_id"`
+	ZoneID             *uint           `json:"zone_id"`
+	LockedUntil        *time.Time      `json:"locked_until"`         // 连续密码错误被锁定时的解锁时间
+	MustChangePassword bool            `json:"must_change_password"` // 使用临时密码时为 true，需要先通过 /me/password 修改密码
+	PasswordExpiresAt  *time.Time      `json:"password_expires_at"`  // 临时密码的过期时间
+	TOTPEnabled        bool            `json:"totp_enabled"`         // 是否开启了两步验证
+	CreatedAt          time.Time       `json:"created_at"`
+	UpdatedAt          time.Time       `json:"updated_at"`
+	Profile            *UserProfileDTO `json:"profile,omitempty"` // include=profile
+}
+
+type UserProfileDTO struct {
+	Name       string        `json:"name"`
+	Age        uint          `json:"age"`
+	Gender     models.Gender `json:"gender"`
+	GenderName string        `json:"gender_name"`
+	Address    string        `json:"address"`
+	Phone      string        `json:"phone"`
+}
+
+func toUserDTO(user *models.User, inc includes) UserDTO {
+	dto := UserDTO{
+		ID:                 user.ID,
+		UserName:           user.UserName,
+		Role:               user.RoleID,
+		RoleName:           models.RoleNameMap[user.RoleID],
+		DepartmentID:       user.DepartmentID,
+		ZoneID:             user.ZoneID,
+		LockedUntil:        user.LockedUntil,
+		MustChangePassword: user.MustChangePassword,
+		PasswordExpiresAt:  user.PasswordExpiresAt,
+		TOTPEnabled:        user.TOTPEnabled,
+		CreatedAt:          user.CreatedAt,
+		UpdatedAt:          user.UpdatedAt,
+	}
+	if inc["profile"] {
+		profile := user.UserProfile
+		dto.Profile = &UserProfileDTO{
+			Name:       profile.Name,
+			Age:        profile.Age,
+			Gender:     profile.Gender,
+			GenderName: models.GenderNameMap[profile.Gender],
+			Address:    string(profile.Address),
+			Phone:      string(profile.Phone),
+		}
+	}
+	return dto
+}
+
+func toUserDTOs(users []models.User, inc includes) []UserDTO {
+	dtos := make([]UserDTO, 0, len(users))
+	for i := range users {
+		dtos = append(dtos, toUserDTO(&users[i], inc))
+	}
+	return dtos
+}
+
+type ZoneDTO struct {
+	ID          uint            `json:"id"`
+	Name        string          `json:"name"`
+	DirectorID  *uint           `json:"director_id"`
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+	Departments []DepartmentDTO `json:"departments,omitempty"` // include=departments
+}
+
+func toZoneDTO(zone *models.Zone, inc includes) ZoneDTO {
+	dto := ZoneDTO{
+		ID:         zone.ID,
+		Name:       zone.Name,
+		DirectorID: zone.DirectorID,
+		CreatedAt:  zone.CreatedAt,
+		UpdatedAt:  zone.UpdatedAt,
+	}
+	if inc["departments"] {
+		dto.Departments = toDepartmentDTOs(zone.Departments, nil)
+	}
+	return dto
+}
+
+func toZoneDTOs(zones []models.Zone, inc includes) []ZoneDTO {
+	dtos := make([]ZoneDTO, 0, len(zones))
+	for i := range zones {
+		dtos = append(dtos, toZoneDTO(&zones[i], inc))
+	}
+	return dtos
+}
+
+type DepartmentDTO struct {
+	ID        uint                  `json:"id"`
+	Name      string                `json:"name"`
+	ZoneID    *uint                 `json:"zone_id"`
+	ManagerID *uint                 `json:"manager_id"`
+	CreatedAt time.Time             `json:"created_at"`
+	UpdatedAt time.Time             `json:"updated_at"`
+	Users     []DepartmentMemberDTO `json:"users,omitempty"` // include=users
+}
+
+// DepartmentMemberDTO 部门中的员工，不包含锁定、两步验证等账户安全信息
+type DepartmentMemberDTO struct {
+	ID       uint          `json:"id"`
+	UserName string        `json:"user_name"`
+	Role     models.RoleID `json:"role"`
+	RoleName string        `json:"role_name"`
+}
+
+func toDepartmentDTO(department *models.Department, inc includes) DepartmentDTO {
+	dto := DepartmentDTO{
+		ID:        department.ID,
+		Name:      department.Name,
+		ZoneID:    department.ZoneID,
+		ManagerID: department.ManagerID,
+		CreatedAt: department.CreatedAt,
+		UpdatedAt: department.UpdatedAt,
+	}
+	if inc["users"] {
+		dto.Users = make([]DepartmentMemberDTO, 0, len(department.Users))
+		for _, user := range department.Users {
+			dto.Users = append(dto.Users, DepartmentMemberDTO{
+				ID:       user.ID,
+				UserName: user.UserName,
+				Role:     user.RoleID,
+				RoleName: models.RoleNameMap[user.RoleID],
+			})
+		}
+	}
+	return dto
+}
+
+func toDepartmentDTOs(departments []models.Department, inc includes) []DepartmentDTO {
+	dtos := make([]DepartmentDTO, 0, len(departments))
+	for i := range departments {
+		dtos = append(dtos, toDepartmentDTO(&departments[i], inc))
+	}
+	return dtos
+}
+
+// SystemLogDTO 代登录时 impersonation_id 和 impersonator_id 不为空，user_id 是被代登录的用户
+// 被委托人代理委托人操作时 on_behalf_of_id 为委托人，user_id 是被委托人
+type SystemLogDTO struct {
+	ID              uint      `json:"id"`
+	UserID          uint      `json:"user_id"`
+	APIKeyID        *uint     `json:"api_key_id"`
+	ImpersonationID *uint     `json:"impersonation_id"`
+	ImpersonatorID  *uint     `json:"impersonator_id"`
+	OnBehalfOfID    *uint     `json:"on_behalf_of_id"`
+	Action          string    `json:"action"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+func toSystemLogDTOs(logs []models.SystemLog) []SystemLogDTO {
+	dtos := make([]SystemLogDTO, 0, len(logs))
+	for _, log := range logs {
+		dtos = append(dtos, SystemLogDTO{
+			ID:              log.ID,
+			UserID:          log.UserID,
+			APIKeyID:        log.APIKeyID,
+			ImpersonationID: log.ImpersonationID,
+			ImpersonatorID:  log.ImpersonatorID,
+			OnBehalfOfID:    log.OnBehalfOfID,
+			Action:          log.Action,
+			CreatedAt:       log.CreatedAt,
+		})
+	}
+	return dtos
+}
+
+// APIKeyDTO 不包含密钥本身，只有 prefix 用于识别
+type APIKeyDTO struct {
+	ID         uint                `json:"id"`
+	Name       string              `json:"name"`
+	UserID     uint                `json:"user_id"`
+	CreatedBy  uint                `json:"created_by"`
+	Prefix     string              `json:"prefix"`
+	Scopes     []models.Permission `json:"scopes"`
+	RateLimit  int64               `json:"rate_limit"`
+	ExpiresAt  *time.Time          `json:"expires_at"`
+	LastUsedAt *time.Time          `json:"last_used_at"`
+	RevokedAt  *time.Time          `json:"revoked_at"`
+	CreatedAt  time.Time           `json:"created_at"`
+}
+
+func toAPIKeyDTO(key *models.APIKey) APIKeyDTO {
+	scopes := key.Scopes.List()
+	if scopes == nil {
+		scopes = []models.Permission{}
+	}
+	return APIKeyDTO{
+		ID:         key.ID,
+		Name:       key.Name,
+		UserID:     key.UserID,
+		CreatedBy:  key.CreatedBy,
+		Prefix:     key.Prefix,
+		Scopes:     scopes,
+		RateLimit:  key.RateLimit,
+		ExpiresAt:  key.ExpiresAt,
+		LastUsedAt: key.LastUsedAt,
+		RevokedAt:  key.RevokedAt,
+		CreatedAt:  key.CreatedAt,
+	}
+}
+
+func toAPIKeyDTOs(keys []models.APIKey) []APIKeyDTO {
+	dtos := make([]APIKeyDTO, 0, len(keys))
+	for i := range keys {
+		dtos = append(dtos, toAPIKeyDTO(&keys[i]))
+	}
+	return dtos
+}
+
+type SessionDTO struct {
+	ID            uint       `json:"id"`
+	UserID        uint       `json:"user_id"`
+	Method        string     `json:"method"`
+	IP            string     `json:"ip"`
+	UserAgent     string     `json:"user_agent"`
+	CreatedAt     time.Time  `json:"created_at"`
+	LastSeenAt    time.Time  `json:"last_seen_at"`
+	ExpiresAt     time.Time  `json:"expires_at"`
+	RevokedAt     *time.Time `json:"revoked_at"`
+	RevokedReason string     `json:"revoked_reason,omitempty"`
+	// 是否是当前请求的令牌所属的会话
+	Current bool `json:"current"`
+}
+
+// toSessionDTO currentFamily 为当前请求的令牌所属的会话
+func toSessionDTO(session *models.Session, currentFamily string) SessionDTO {
+	return SessionDTO{
+		ID:            session.ID,
+		UserID:        session.UserID,
+		Method:        session.Method,
+		IP:            session.IP,
+		UserAgent:     session.UserAgent,
+		CreatedAt:     session.CreatedAt,
+		LastSeenAt:    session.LastSeenAt,
+		ExpiresAt:     session.ExpiresAt,
+		RevokedAt:     session.RevokedAt,
+		RevokedReason: session.RevokedReason,
+		Current:       currentFamily != "" && session.Family == currentFamily,
+	}
+}
+
+func toSessionDTOs(sessions []models.Session, currentFamily string) []SessionDTO {
+	dtos := make([]SessionDTO, 0, len(sessions))
+	for i := range sessions {
+		dtos = append(dtos, toSessionDTO(&sessions[i], currentFamily))
+	}
+	return dtos
+}
+
+type LoginEventDTO struct {
+	ID        uint      `json:"id"`
+	UserID    uint      `json:"user_id"`
+	SessionID uint      `json:"session_id"`
+	Method    string    `json:"method"`
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"user_agent"`
+	NewIP     bool      `json:"new_ip"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func toLoginEventDTOs(events []models.LoginEvent) []LoginEventDTO {
+	dtos := make([]LoginEventDTO, 0, len(events))
+	for _, event := range events {
+		dtos = append(dtos, LoginEventDTO{
+			ID:        event.ID,
+			UserID:    event.UserID,
+			SessionID: event.SessionID,
+			Method:    event.Method,
+			IP:        event.IP,
+			UserAgent: event.UserAgent,
+			NewIP:     event.NewIP,
+			CreatedAt: event.CreatedAt,
+		})
+	}
+	return dtos
+}
+
+// CreatedAPIKeyDTO 新建的密钥，key 只在创建时返回这一次
+type CreatedAPIKeyDTO struct {
+	Key    string    `json:"key"`
+	APIKey APIKeyDTO `json:"api_key"`
+}
+
+type ImpersonationDTO struct {
+	ID         uint       `json:"id"`
+	AdminID    uint       `json:"admin_id"`
+	UserID     uint       `json:"user_id"`
+	Reason     string     `json:"reason"`
+	AllowWrite bool       `json:"allow_write"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	EndedAt    *time.Time `json:"ended_at"`
+}
+
+func toImpersonationDTO(impersonation *models.Impersonation) ImpersonationDTO {
+	return ImpersonationDTO{
+		ID:         impersonation.ID,
+		AdminID:    impersonation.AdminID,
+		UserID:     impersonation.UserID,
+		Reason:     impersonation.Reason,
+		AllowWrite: impersonation.AllowWrite,
+		CreatedAt:  impersonation.CreatedAt,
+		ExpiresAt:  impersonation.ExpiresAt,
+		EndedAt:    impersonation.EndedAt,
+	}
+}
+
+func toImpersonationDTOs(impersonations []models.Impersonation) []ImpersonationDTO {
+	dtos := make([]ImpersonationDTO, 0, len(impersonations))
+	for i := range impersonations {
+		dtos = append(dtos, toImpersonationDTO(&impersonations[i]))
+	}
+	return dtos
+}
+
+// StartedImpersonationDTO 代登录令牌只有访问令牌，到期后需要重新发起
+type StartedImpersonationDTO struct {
+	AccessToken   string           `json:"access_token"`
+	Impersonation ImpersonationDTO `json:"impersonation"`
+}
+
+// DelegationDTO active 表示委托当前是否有效
+type DelegationDTO struct {
+	ID          uint       `json:"id"`
+	PrincipalID uint       `json:"principal_id"`
+	DelegateID  uint       `json:"delegate_id"`
+	CreatedBy   uint       `json:"created_by"`
+	Reason      string     `json:"reason"`
+	StartsAt    time.Time  `json:"starts_at"`
+	EndsAt      time.Time  `json:"ends_at"`
+	RevokedAt   *time.Time `json:"revoked_at"`
+	Active      bool       `json:"active"`
+}
+
+func toDelegationDTO(delegation *models.Delegation) DelegationDTO {
+	return DelegationDTO{
+		ID:          delegation.ID,
+		PrincipalID: delegation.PrincipalID,
+		DelegateID:  delegation.DelegateID,
+		CreatedBy:   delegation.CreatedBy,
+		Reason:      delegation.Reason,
+		StartsAt:    delegation.StartsAt,
+		EndsAt:      delegation.EndsAt,
+		RevokedAt:   delegation.RevokedAt,
+		Active:      delegation.Active(time.Now()),
+	}
+}
+
+func toDelegationDTOs(delegations []models.Delegation) []DelegationDTO {
+	dtos := make([]DelegationDTO, 0, len(delegations))
+	for i := range delegations {
+		dtos = append(dtos, toDelegationDTO(&delegations[i]))
+	}
+	return dtos
+}
+
+type NotificationDTO struct {
+	ID        uint       `json:"id"`
+	Kind      string     `json:"kind"`
+	Message   string     `json:"message"`
+	CreatedAt time.Time  `json:"created_at"`
+	ReadAt    *time.Time `json:"read_at"`
+}
+
+func toNotificationDTOs(notifications []models.Notification) []NotificationDTO {
+	dtos := make([]NotificationDTO, 0, len(notifications))
+	for _, notification := range notifications {
+		dtos = append(dtos, NotificationDTO{
+			ID:        notification.ID,
+			Kind:      notification.Kind,
+			Message:   notification.Message,
+			CreatedAt: notification.CreatedAt,
+			ReadAt:    notification.ReadAt,
+		})
+	}
+	return dtos
+}
+
+/*客户和工作日志*/
+
+type CustomerDTO struct {
+	ID            uint          `json:"id"`
+	Name          string        `json:"name"`
+	Phone         string        `json:"phone"`
+	Age           uint          `json:"age"`
+	Gender        models.Gender `json:"gender"`
+	GenderName    string        `json:"gender_name"`
+	Address       string        `json:"address"`
+	LoanIntent    int           `json:"loan_intent"`
+	IsInPublicSea bool          `json:"is_in_public_sea"`
+	SalerID       *uint         `json:"saler_id"`
+	DepartmentID  *uint         `json:"department_id"`
+	ZoneID        *uint         `json:"zone_id"`
+	CreatedAt     time.Time     `json:"created_at"`
+	UpdatedAt     time.Time     `json:"updated_at"`
+}
+
+func toCustomerDTO(customer *models.Customer) CustomerDTO {
+	return CustomerDTO{
+		ID:            customer.ID,
+		Name:          customer.Name,
+		Phone:         string(customer.Phone),
+		Age:           customer.Age,
+		Gender:        customer.Gender,
+		GenderName:    models.GenderNameMap[customer.Gender],
+		Address:       string(customer.Address),
+		LoanIntent:    customer.LoanIntent,
+		IsInPublicSea: customer.IsInPublicSea,
+		SalerID:       customer.SalerID,
+		DepartmentID:  customer.DepartmentID,
+		ZoneID:        customer.ZoneID,
+		CreatedAt:     customer.CreatedAt,
+		UpdatedAt:     customer.UpdatedAt,
+	}
+}
+
+func toCustomerDTOs(customers []models.Customer) []CustomerDTO {
+	dtos := make([]CustomerDTO, 0, len(customers))
+	for i := range customers {
+		dtos = append(dtos, toCustomerDTO(&customers[i]))
+	}
+	return dtos
+}
+
+type CustomerPIIDTO struct {
+	CustomerID uint   `json:"customer_id"`
+	Phone      string `json:"phone"`
+	Address    string `json:"address"`
+	NationalID string `json:"national_id"`
+}
+
+func toCustomerPIIDTO(revealed *models.CustomerPII) CustomerPIIDTO {
+	return CustomerPIIDTO{
+		CustomerID: revealed.CustomerID,
+		Phone:      revealed.Phone,
+		Address:    revealed.Address,
+		NationalID: revealed.NationalID,
+	}
+}
+
+type KYCProfileDTO struct {
+	CustomerID        uint                 `json:"customer_id"`
+	NationalID        string               `json:"national_id"` // 脱敏后的身份证号码
+	Occupation        string               `json:"occupation"`
+	MonthlyIncome     models.Money         `json:"monthly_income"`
+	Assets            models.Money         `json:"assets"`
+	ExistingDebts     models.Money         `json:"existing_debts"`
+	MaritalStatus     models.MaritalStatus `json:"marital_status"`
+	MaritalStatusName string               `json:"marital_status_name"`
+	Status            models.KYCStatus     `json:"status"`
+	StatusName        string               `json:"status_name"`
+	ReviewedBy        *uint                `json:"reviewed_by"`
+	ReviewedAt        *time.Time           `json:"reviewed_at"`
+	ReviewNote        string               `json:"review_note"`
+	Documents         []KYCDocumentDTO     `json:"documents"`
+	UpdatedAt         time.Time            `json:"updated_at"`
+}
+
+type KYCDocumentDTO struct {
+	ID         uint      `json:"id"`
+	Kind       string    `json:"kind"`
+	File       string    `json:"file"`
+	UploadedBy uint      `json:"uploaded_by"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+func toKYCProfileDTO(profile *models.KYCProfile) KYCProfileDTO {
+	documents := make([]KYCDocumentDTO, 0, len(profile.Documents))
+	for _, document := range profile.Documents {
+		documents = append(documents, KYCDocumentDTO{
+			ID:         document.ID,
+			Kind:       document.Kind,
+			File:       document.File,
+			UploadedBy: document.UploadedBy,
+			CreatedAt:  document.CreatedAt,
+		})
+	}
+	return KYCProfileDTO{
+		CustomerID:        profile.CustomerID,
+		NationalID:        profile.NationalID.Masked(),
+		Occupation:        profile.Occupation,
+		MonthlyIncome:     profile.MonthlyIncome,
+		Assets:            profile.Assets,
+		ExistingDebts:     profile.ExistingDebts,
+		MaritalStatus:     profile.MaritalStatus,
+		MaritalStatusName: models.MaritalStatusNameMap[profile.MaritalStatus],
+		Status:            profile.Status,
+		StatusName:        models.KYCStatusNameMap[profile.Status],
+		ReviewedBy:        profile.ReviewedBy,
+		ReviewedAt:        profile.ReviewedAt,
+		ReviewNote:        profile.ReviewNote,
+		Documents:         documents,
+		UpdatedAt:         profile.UpdatedAt,
+	}
+}
+
+type WorkLogDTO struct {
+	ID         uint      `json:"id"`
+	UserID     uint      `json:"user_id"`
+	Calls      int       `json:"calls"`
+	ValidCalls int       `json:"valid_calls"`
+	Visits     int       `json:"visits"`
+	Contracts  int       `json:"contracts"`
+	Date       time.Time `json:"date"`
+}
+
+func toWorkLogDTO(workLog *models.WorkLog) WorkLogDTO {
+	return WorkLogDTO{
+		ID:         workLog.ID,
+		UserID:     workLog.UserID,
+		Calls:      workLog.Calls,
+		ValidCalls: workLog.ValidCalls,
+		Visits:     workLog.Visits,
+		Contracts:  workLog.Contracts,
+		Date:       workLog.Date,
+	}
+}
+
+/*合同和对账*/
+
+type ContractDTO struct {
+	ID               uint                  `json:"id"`
+	Amount           models.Money          `json:"amount"`
+	ServiceFee       models.Money          `json:"service_fee"`
+	BankAmount       models.Money          `json:"bank_amount"`
+	Currency         string                `json:"currency"`
+	Status           models.ContractStatus `json:"status"`
+	StatusName       string                `json:"status_name"`
+	ApprovedAt       *time.Time            `json:"approved_at"`
+	ContractDocument string                `json:"contract_document"`
+	FinancialProduct string                `json:"financial_product"`
+	BankDocuments    string                `json:"bank_documents"`
+	BankConfirmedBy  *uint                 `json:"bank_confirmed_by"`
+	BankConfirmedAt  *time.Time            `json:"bank_confirmed_at"`
+	CustomerID       uint                  `json:"customer_id"`
+	SalerID          uint                  `json:"saler_id"`
+	FinanceID        uint                  `json:"finance_id"`
+	AccountantID     uint                  `json:"accountant_id"`
+	DepartmentID     uint                  `json:"department_id"`
+	ZoneID           uint                  `json:"zone_id"`
+	CreatedAt        time.Time             `json:"created_at"`
+	UpdatedAt        time.Time             `json:"updated_at"`
+}
+
+func toContractDTO(contract *models.Contract) ContractDTO {
+	return ContractDTO{
+		ID:               contract.ID,
+		Amount:           contract.Amount,
+		ServiceFee:       contract.ServiceFee,
+		BankAmount:       contract.BankAmount,
+		Currency:         contract.Currency,
+		Status:           contract.Status,
+		StatusName:       models.ContractStatusNameMap[contract.Status],
+		ApprovedAt:       contract.ApprovedAt,
+		ContractDocument: contract.ContractDocument,
+		FinancialProduct: contract.FinancialProduct,
+		BankDocuments:    contract.BankDocuments,
+		BankConfirmedBy:  contract.BankConfirmedBy,
+		BankConfirmedAt:  contract.BankConfirmedAt,
+		CustomerID:       contract.CustomerID,
+		SalerID:          contract.SalerID,
+		FinanceID:        contract.FinanceID,
+		AccountantID:     contract.AccountantID,
+		DepartmentID:     contract.DepartmentID,
+		ZoneID:           contract.ZoneID,
+		CreatedAt:        contract.CreatedAt,
+		UpdatedAt:        contract.UpdatedAt,
+	}
+}
+
+func toContractDTOs(contracts []models.Contract) []ContractDTO {
+	dtos := make([]ContractDTO, 0, len(contracts))
+	for i := range contracts {
+		dtos = append(dtos, toContractDTO(&contracts[i]))
+	}
+	return dtos
+}
+
+type ContractAmountVersionDTO struct {
+	Version    int          `json:"version"`
+	Amount     models.Money `json:"amount"`
+	ServiceFee models.Money `json:"service_fee"`
+	BankAmount models.Money `json:"bank_amount"`
+	ChangedBy  uint         `json:"changed_by"`
+	Reason     string       `json:"reason"`
+	CreatedAt  time.Time    `json:"created_at"`
+}
+
+func toContractAmountVersionDTOs(versions []models.ContractAmountVersion) []ContractAmountVersionDTO {
+	dtos := make([]ContractAmountVersionDTO, 0, len(versions))
+	for _, version := range versions {
+		dtos = append(dtos, ContractAmountVersionDTO{
+			Version:    version.Version,
+			Amount:     version.Amount,
+			ServiceFee: version.ServiceFee,
+			BankAmount: version.BankAmount,
+			ChangedBy:  version.ChangedBy,
+			Reason:     version.Reason,
+			CreatedAt:  version.CreatedAt,
+		})
+	}
+	return dtos
+}
+
+type ReconciliationItemDTO struct {
+	ID           uint                        `json:"id"`
+	ContractID   uint                        `json:"contract_id"`
+	AccountantID uint                        `json:"accountant_id"`
+	Amount       models.Money                `json:"amount"`
+	BankAmount   models.Money                `json:"bank_amount"`
+	Difference   models.Money                `json:"difference"`
+	Status       models.ReconciliationStatus `json:"status"`
+	StatusName   string                      `json:"status_name"`
+	ResolvedBy   *uint                       `json:"resolved_by"`
+	ResolvedAt   *time.Time                  `json:"resolved_at"`
+	Resolution   string                      `json:"resolution"`
+	CreatedAt    time.Time                   `json:"created_at"`
+	UpdatedAt    time.Time                   `json:"updated_at"`
+}
+
+func toReconciliationItemDTO(item *models.ReconciliationItem) ReconciliationItemDTO {
+	return ReconciliationItemDTO{
+		ID:           item.ID,
+		ContractID:   item.ContractID,
+		AccountantID: item.AccountantID,
+		Amount:       item.Amount,
+		BankAmount:   item.BankAmount,
+		Difference:   item.Difference,
+		Status:       item.Status,
+		StatusName:   models.ReconciliationStatusNameMap[item.Status],
+		ResolvedBy:   item.ResolvedBy,
+		ResolvedAt:   item.ResolvedAt,
+		Resolution:   item.Resolution,
+		CreatedAt:    item.CreatedAt,
+		UpdatedAt:    item.UpdatedAt,
+	}
+}
+
+func toReconciliationItemDTOs(items []models.ReconciliationItem) []ReconciliationItemDTO {
+	dtos := make([]ReconciliationItemDTO, 0, len(items))
+	for i := range items {
+		dtos = append(dtos, toReconciliationItemDTO(&items[i]))
+	}
+	return dtos
+}
+
+/*贷后管理*/
+
+type FinancialProductDTO struct {
+	ID                  uint                   `json:"id"`
+	Name                string                 `json:"name"`
+	TermMonths          int                    `json:"term_months"`
+	AnnualRate          models.Money           `json:"annual_rate"`
+	RepaymentMethod     models.RepaymentMethod `json:"repayment_method"`
+	RepaymentMethodName string                 `json:"repayment_method_name"`
+}
+
+func toFinancialProductDTO(product *models.FinancialProduct) FinancialProductDTO {
+	return FinancialProductDTO{
+		ID:                  product.ID,
+		Name:                product.Name,
+		TermMonths:          product.TermMonths,
+		AnnualRate:          product.AnnualRate,
+		RepaymentMethod:     product.RepaymentMethod,
+		RepaymentMethodName: models.RepaymentMethodNameMap[product.RepaymentMethod],
+	}
+}
+
+func toFinancialProductDTOs(products []models.FinancialProduct) []FinancialProductDTO {
+	dtos := make([]FinancialProductDTO, 0, len(products))
+	for i := range products {
+		dtos = append(dtos, toFinancialProductDTO(&products[i]))
+	}
+	return dtos
+}
+
+type DisbursementDTO struct {
+	ID             uint         `json:"id"`
+	ContractID     uint         `json:"contract_id"`
+	Bank           string       `json:"bank"`
+	Amount         models.Money `json:"amount"`
+	ExpectedAmount models.Money `json:"expected_amount"`
+	DisbursedAt    time.Time    `json:"disbursed_at"`
+	RecordedBy     uint         `json:"recorded_by"`
+}
+
+func toDisbursementDTO(disbursement *models.Disbursement) DisbursementDTO {
+	return DisbursementDTO{
+		ID:             disbursement.ID,
+		ContractID:     disbursement.ContractID,
+		Bank:           disbursement.Bank,
+		Amount:         disbursement.Amount,
+		ExpectedAmount: disbursement.ExpectedAmount,
+		DisbursedAt:    disbursement.DisbursedAt,
+		RecordedBy:     disbursement.RecordedBy,
+	}
+}
+
+type RepaymentInstallmentDTO struct {
+	Period     int                      `json:"period"`
+	DueDate    time.Time                `json:"due_date"`
+	Principal  models.Money             `json:"principal"`
+	Interest   models.Money             `json:"interest"`
+	Amount     models.Money             `json:"amount"`
+	PaidAmount models.Money             `json:"paid_amount"`
+	PaidAt     *time.Time               `json:"paid_at"`
+	Status     models.InstallmentStatus `json:"status"`
+	StatusName string                   `json:"status_name"`
+}
+
+func toRepaymentInstallmentDTOs(installments []models.RepaymentInstallment) []RepaymentInstallmentDTO {
+	dtos := make([]RepaymentInstallmentDTO, 0, len(installments))
+	for _, installment := range installments {
+		dtos = append(dtos, RepaymentInstallmentDTO{
+			Period:     installment.Period,
+			DueDate:    installment.DueDate,
+			Principal:  installment.Principal,
+			Interest:   installment.Interest,
+			Amount:     installment.Amount,
+			PaidAmount: installment.PaidAmount,
+			PaidAt:     installment.PaidAt,
+			Status:     installment.Status,
+			StatusName: models.InstallmentStatusNameMap[installment.Status],
+		})
+	}
+	return dtos
+}
+
+type RepaymentDTO struct {
+	ID         uint         `json:"id"`
+	ContractID uint         `json:"contract_id"`
+	Amount     models.Money `json:"amount"`
+	PaidAt     time.Time    `json:"paid_at"`
+	RecordedBy uint         `json:"recorded_by"`
+}
+
+func toRepaymentDTO(repayment *models.Repayment) RepaymentDTO {
+	return RepaymentDTO{
+		ID:         repayment.ID,
+		ContractID: repayment.ContractID,
+		Amount:     repayment.Amount,
+		PaidAt:     repayment.PaidAt,
+		RecordedBy: repayment.RecordedBy,
+	}
+}
+
+/*提成*/
+
+type CommissionPlanDTO struct {
+	ID           uint                `json:"id"`
+	Name         string              `json:"name"`
+	Role         models.RoleID       `json:"role"`
+	RoleName     string              `json:"role_name"`
+	BaseRate     models.Money        `json:"base_rate"`
+	OverrideRate models.Money        `json:"override_rate"`
+	Active       bool                `json:"active"`
+	Tiers        []CommissionTierDTO `json:"tiers"`
+	CreatedAt    time.Time           `json:"created_at"`
+}
+
+type CommissionTierDTO struct {
+	MinVolume models.Money `json:"min_volume"`
+	Rate      models.Money `json:"rate"`
+}
+
+func toCommissionPlanDTO(plan *models.CommissionPlan) CommissionPlanDTO {
+	tiers := make([]CommissionTierDTO, 0, len(plan.Tiers))
+	for _, tier := range plan.Tiers {
+		tiers = append(tiers, CommissionTierDTO{MinVolume: tier.MinVolume, Rate: tier.Rate})
+	}
+	return CommissionPlanDTO{
+		ID:           plan.ID,
+		Name:         plan.Name,
+		Role:         plan.RoleID,
+		RoleName:     models.RoleNameMap[plan.RoleID],
+		BaseRate:     plan.BaseRate,
+		OverrideRate: plan.OverrideRate,
+		Active:       plan.Active,
+		Tiers:        tiers,
+		CreatedAt:    plan.CreatedAt,
+	}
+}
+
+func toCommissionPlanDTOs(plans []models.CommissionPlan) []CommissionPlanDTO {
+	dtos := make([]CommissionPlanDTO, 0, len(plans))
+	for i := range plans {
+		dtos = append(dtos, toCommissionPlanDTO(&plans[i]))
+	}
+	return dtos
+}
+
+type CommissionStatementDTO struct {
+	ID                 uint                   `json:"id"`
+	UserID             uint                   `json:"user_id"`
+	Period             string                 `json:"period"`
+	Volume             models.Money           `json:"volume"`
+	OwnCommission      models.Money           `json:"own_commission"`
+	OverrideCommission models.Money           `json:"override_commission"`
+	Adjustment         models.Money           `json:"adjustment"`
+	AdjustmentNote     string                 `json:"adjustment_note"`
+	Total              models.Money           `json:"total"`
+	Status             models.StatementStatus `json:"status"`
+	StatusName         string                 `json:"status_name"`
+	LockedBy           *uint                  `json:"locked_by"`
+	LockedAt           *time.Time             `json:"locked_at"`
+	Lines              []CommissionLineDTO    `json:"lines,omitempty"` // 只有查询单张提成单和结算时返回
+}
+
+type CommissionLineDTO struct {
+	ContractID uint                  `json:"contract_id"`
+	Kind       models.CommissionKind `json:"kind"`
+	KindName   string                `json:"kind_name"`
+	ServiceFee models.Money          `json:"service_fee"`
+	Rate       models.Money          `json:"rate"`
+	Amount     models.Money          `json:"amount"`
+}
+
+func toCommissionStatementDTO(statement *models.CommissionStatement) CommissionStatementDTO {
+	var lines []CommissionLineDTO
+	for _, line := range statement.Lines {
+		lines = append(lines, CommissionLineDTO{
+			ContractID: line.ContractID,
+			Kind:       line.Kind,
+			KindName:   models.CommissionKindNameMap[line.Kind],
+			ServiceFee: line.ServiceFee,
+			Rate:       line.Rate,
+			Amount:     line.Amount,
+		})
+	}
+	return CommissionStatementDTO{
+		ID:                 statement.ID,
+		UserID:             statement.UserID,
+		Period:             statement.Period,
+		Volume:             statement.Volume,
+		OwnCommission:      statement.OwnCommission,
+		OverrideCommission: statement.OverrideCommission,
+		Adjustment:         statement.Adjustment,
+		AdjustmentNote:     statement.AdjustmentNote,
+		Total:              statement.Total,
+		Status:             statement.Status,
+		StatusName:         models.StatementStatusNameMap[statement.Status],
+		LockedBy:           statement.LockedBy,
+		LockedAt:           statement.LockedAt,
+		Lines:              lines,
+	}
+}
+
+func toCommissionStatementDTOs(statements []models.CommissionStatement) []CommissionStatementDTO {
+	dtos := make([]CommissionStatementDTO, 0, len(statements))
+	for i := range statements {
+		dtos = append(dtos, toCommissionStatementDTO(&statements[i]))
+	}
+	return dtos
+}
@@ -1,10 +1,14 @@
 package controllers
 
-import "time"
+import (
+	"time"
+
+	"gin-boilerplate/models"
+)
 
 type LoginForm struct {
-	Username string `form:"username"`
-	Password string `form:"password"`
+	Username string `form:"username" binding:"required"`
+	Password string `form:"password" binding:"required"`
 }
 
 /*
@@ -29,29 +33,156 @@ type LoginForm struct {
 - DEFAULT:              "默认权限",
 */
 type RegisterForm struct {
-	Username string `form:"username"`
-	Password string `form:"password"`
-	Role     string `form:"role"`
+	Username string `form:"username" binding:"required,username"`
+	Password string `form:"password" binding:"required,password"`
+	Role     string `form:"role" binding:"omitempty,enum=role"`
 }
 
 // 更新用户信息
 type UpdateUserNameOrPasswordForm struct {
-	SystemManagerID uint `form:"system_manager_id"`
-	UserID          uint `form:"user_id"`
+	UserID uint `form:"user_id" binding:"required"`
 	// to update
-	Username string `form:"username"`
-	Password string `form:"password"`
+	Username string `form:"username" binding:"omitempty,username"`
+	Password string `form:"password" binding:"omitempty,password"`
 }
 
 type UpdateUserRoleForm struct {
-	SystemManagerID uint `form:"system_manager_id"`
-	UserID          uint `form:"user_id"`
+	UserID uint `form:"user_id" binding:"required"`
 	// to update
-	Role string `form:"role"`
+	Role string `form:"role" binding:"required,enum=role"`
+}
+
+type UnlockUserForm struct {
+	UserID uint `form:"user_id" binding:"required"`
+}
+
+// 重置密码，生成临时密码，用户下次登录后必须修改
+type ResetPasswordForm struct {
+	UserID uint `form:"user_id" binding:"required"`
+}
+
+// 修改自己的密码，用户ID取自令牌
+type ChangePasswordForm struct {
+	CurrentPassword string `form:"current_password" binding:"required"`
+	NewPassword     string `form:"new_password" binding:"required,password"`
+}
+
+// 登录的第二步，code 为验证器应用中的6位验证码或恢复码
+type VerifyLoginTOTPForm struct {
+	ChallengeToken string `form:"challenge_token" binding:"required"`
+	Code           string `form:"code" binding:"required"`
+}
+
+// 身份提供方登录后跳回的参数，用户拒绝授权时只有 error
+type SSOCallbackForm struct {
+	Code  string `form:"code"`
+	State string `form:"state" binding:"required"`
+	Error string `form:"error"`
+}
+
+// 开始绑定两步验证，需要验证当前密码
+type StartTOTPEnrollmentForm struct {
+	Password string `form:"password" binding:"required"`
 }
 
-type ListAllUsersFrom struct {
-	SystemManagerID uint `form:"system_manager_id"`
+// 确认绑定或重新生成恢复码，需要验证器应用中的6位验证码
+type TOTPCodeForm struct {
+	Code string `form:"code" binding:"required,len=6,numeric"`
+}
+
+// 关闭两步验证，需要当前密码和验证码（或恢复码）
+type DisableTOTPForm struct {
+	Password string `form:"password" binding:"required"`
+	Code     string `form:"code" binding:"required"`
+}
+
+// 系统管理员重置用户的两步验证
+type ResetTOTPForm struct {
+	UserID uint `form:"user_id" binding:"required"`
+}
+
+// 系统管理员为用户创建 API 密钥，scopes 为逗号分隔的权限名称，rate_limit 为0时使用 API_KEY_RATE_LIMIT
+type CreateAPIKeyForm struct {
+	UserID        uint   `form:"user_id" binding:"required"`
+	Name          string `form:"name" binding:"required,max=64"`
+	Scopes        string `form:"scopes" binding:"required,permissions"`
+	ExpiresInDays uint   `form:"expires_in_days" binding:"required,min=1"`
+	RateLimit     int64  `form:"rate_limit" binding:"min=0"`
+}
+
+type RevokeAPIKeyForm struct {
+	APIKeyID uint `form:"api_key_id" binding:"required"`
+}
+
+// 使用刷新令牌换取新的访问令牌和刷新令牌
+type RefreshTokenForm struct {
+	RefreshToken string `form:"refresh_token" binding:"required"`
+}
+
+type RevokeSessionForm struct {
+	SessionID uint `form:"session_id" binding:"required"`
+}
+
+// 登录记录，limit 默认为50
+type LoginHistoryForm struct {
+	Limit int `form:"limit" binding:"omitempty,min=1,max=500"`
+}
+
+type ListUserSessionsForm struct {
+	UserID uint `form:"user_id" binding:"required"`
+}
+
+type RevokeUserSessionForm struct {
+	SessionID uint `form:"session_id" binding:"required"`
+}
+
+// 系统管理员查看登录记录，不传 user_id 时查看全部用户，new_ip_only 只返回来自新IP的登录
+type UserLoginHistoryForm struct {
+	UserID    uint `form:"user_id"`
+	NewIPOnly bool `form:"new_ip_only"`
+	Limit     int  `form:"limit" binding:"omitempty,min=1,max=500"`
+}
+
+// 系统管理员代登录，minutes 为0时使用 IMPERSONATION_DEFAULT_DURATION，allow_write 为 false 时只读
+type StartImpersonationForm struct {
+	UserID     uint   `form:"user_id" binding:"required"`
+	Reason     string `form:"reason" binding:"required,max=500"`
+	Minutes    uint   `form:"minutes"`
+	AllowWrite bool   `form:"allow_write"`
+}
+
+type EndImpersonationForm struct {
+	ImpersonationID uint `form:"impersonation_id" binding:"required"`
+}
+
+// 当前用户的通知，unread_only 只返回未读的
+type ListNotificationsForm struct {
+	UnreadOnly bool `form:"unread_only"`
+}
+
+// 委托人休假期间把审批和合同访问权限委托给 delegate_id，有效期为 [start_date, end_date)
+type CreateDelegationForm struct {
+	DelegateID uint      `form:"delegate_id" binding:"required"`
+	StartDate  time.Time `form:"start_date" binding:"required"`
+	EndDate    time.Time `form:"end_date" binding:"required,gtfield=StartDate"`
+	Reason     string    `form:"reason" binding:"max=500"`
+}
+
+type RevokeDelegationForm struct {
+	DelegationID uint `form:"delegation_id" binding:"required"`
+}
+
+// 系统管理员为已经休假的用户创建委托
+type AdministratorCreateDelegationForm struct {
+	PrincipalID uint      `form:"principal_id" binding:"required"`
+	DelegateID  uint      `form:"delegate_id" binding:"required"`
+	StartDate   time.Time `form:"start_date" binding:"required"`
+	EndDate     time.Time `form:"end_date" binding:"required,gtfield=StartDate"`
+	Reason      string    `form:"reason" binding:"max=500"`
+}
+
+type AdministratorRevokeDelegationForm struct {
+	DelegationID uint `form:"delegation_id" binding:"required"`
 }
 
 /*
@@ -61,19 +192,18 @@ type ListAllUsersFrom struct {
 
 - FEMALE: "女",
 */
+// UpdateUserProfileForm 只能修改令牌对应用户自己的资料
 type UpdateUserProfileForm struct {
-	UserID uint `form:"user_id"`
 	// to update
-	Name    string `form:"name"`
-	Age     uint   `form:"age"`
-	Gender  string `form:"gender"`
-	Address string `form:"address"`
-	Phone   string `form:"phone"`
+	Name    string `form:"name" binding:"omitempty,max=50"`
+	Age     uint   `form:"age" binding:"omitempty,max=150"`
+	Gender  string `form:"gender" binding:"omitempty,enum=gender"`
+	Address string `form:"address" binding:"omitempty,max=200"`
+	Phone   string `form:"phone" binding:"omitempty,cnmobile"`
 }
 
 type CreateZoneForm struct {
-	SystemManagerID uint   `form:"system_manager_id"`
-	Name            string `form:"name"`
+	Name string `form:"name" binding:"required,max=50"`
 }
 
 /*
@@ -84,50 +214,39 @@ Type 参数可以在以下值中选择：
 - “金融部”
 */
 type CreateDepartmentForm struct {
-	SystemManagerID uint   `form:"system_manager_id"`
-	Name            string `form:"name"`
-	Type            string `form:"type"`
-	ZoneID          *uint  `form:"zone_id"`
+	Name   string `form:"name" binding:"required,max=50"`
+	Type   string `form:"type" binding:"required,oneof=销售部 金融部"`
+	ZoneID *uint  `form:"zone_id" binding:"omitempty,min=1"`
 }
 
 type AssignDepartmentToZoneForm struct {
-	SystemManagerID uint `form:"system_manager_id"`
-	DepartmentID    uint `form:"department_id"`
-	ZoneID          uint `form:"zone_id"`
+	DepartmentID uint `form:"department_id" binding:"required"`
+	ZoneID       uint `form:"zone_id" binding:"required"`
 }
 
 type AssignUserToDepartmentForm struct {
-	SystemManagerID uint `form:"system_manager_id"`
-	UserID          uint `form:"user_id"`
-	DepartmentID    uint `form:"department_id"`
+	UserID       uint `form:"user_id" binding:"required"`
+	DepartmentID uint `form:"department_id" binding:"required"`
 }
 
 type AssignUserToZoneForm struct {
-	SystemManagerID uint `form:"system_manager_id"`
-	UserID          uint `form:"user_id"`
-	ZoneID          uint `form:"zone_id"`
+	UserID uint `form:"user_id" binding:"required"`
+	ZoneID uint `form:"zone_id" binding:"required"`
 }
 
 type AssignDirectorToZoneForm struct {
-	SystemManagerID uint `form:"system_manager_id"`
-	UserID          uint `form:"user_id"`
-	ZoneID          uint `form:"zone_id"`
+	UserID uint `form:"user_id" binding:"required"`
+	ZoneID uint `form:"zone_id" binding:"required"`
 }
 
 type AssignManagerToDepartmentForm struct {
-	SystemManagerID uint `form:"system_manager_id"`
-	UserID          uint `form:"user_id"`
-	DepartmentID    uint `form:"department_id"`
-}
-
-type QuerySystemLogForm struct {
-	SystemManagerID uint `form:"system_manager_id"`
+	UserID       uint `form:"user_id" binding:"required"`
+	DepartmentID uint `form:"department_id" binding:"required"`
 }
 
 type CreateCustomerForm struct {
-	UserID        uint   `form:"user_id"`
-	CustomerName  string `form:"customer_name"`
-	CustomerPhone string `form:"customer_phone"`
+	CustomerName  string `form:"customer_name" binding:"required,max=50"`
+	CustomerPhone string `form:"customer_phone" binding:"required,cnmobile"`
 }
 
 /*
@@ -138,27 +257,17 @@ CustomerGender同样可以使用以下值：
 - FEMALE: "女"
 */
 type UpdateCustomerForm struct {
-	UserID          uint   `form:"user_id"`
-	CustomerID      uint   `form:"customer_id"`
-	CustomerName    string `form:"customer_name"`
-	CustomerPhone   string `form:"customer_phone"`
-	CustomerAge     uint   `form:"customer_age"`
-	CustomerGender  string `form:"customer_gender"`
-	CustomerAddress string `form:"customer_address"`
-}
-
-type ListCustomersForm struct {
-	UserID uint `form:"user_id"`
+	CustomerID      uint   `form:"customer_id" binding:"required"`
+	CustomerName    string `form:"customer_name" binding:"omitempty,max=50"`
+	CustomerPhone   string `form:"customer_phone" binding:"omitempty,cnmobile"`
+	CustomerAge     uint   `form:"customer_age" binding:"omitempty,max=150"`
+	CustomerGender  string `form:"customer_gender" binding:"omitempty,enum=gender"`
+	CustomerAddress string `form:"customer_address" binding:"omitempty,max=200"`
 }
 
 type MigrateCustomerForm struct {
-	UserID     uint `form:"user_id"`
-	NewSalerID uint `form:"new_saler_id"`
-	CustomerID uint `form:"customer_id"`
-}
-
-type GetPublicSeaCustomerListForm struct {
-	UserID uint `form:"user_id"`
+	NewSalerID uint `form:"new_saler_id" binding:"required"`
+	CustomerID uint `form:"customer_id" binding:"required"`
 }
 
 /*
@@ -166,26 +275,24 @@ type GetPublicSeaCustomerListForm struct {
 （例如：2022-01-01T12:34:56Z）
 */
 type CreateWorkLogForm struct {
-	UserID     uint      `form:"user_id"`
-	Calls      int       `form:"calls"`
-	ValidCalls int       `form:"valid_calls"`
-	Visits     int       `form:"visits"`
-	Contracts  int       `form:"contracts"`
-	Date       time.Time `form:"date"`
+	Calls      int       `form:"calls" binding:"min=0"`
+	ValidCalls int       `form:"valid_calls" binding:"min=0,ltefield=Calls"`
+	Visits     int       `form:"visits" binding:"min=0"`
+	Contracts  int       `form:"contracts" binding:"min=0"`
+	Date       time.Time `form:"date" binding:"required"`
 }
 
 type SubmitContractForm struct {
-    UserID     uint      `form:"user_id"`
-	CustomerID uint      `form:"customer_id"`
-	FinanceID  uint      `form:"finance_id"`
-	AccountantID uint      `form:"accountant_id"`
-	Amount    float64   `form:"amount"`
-	ServiceFee float64   `form:"service_fee"`
-	BankAmount  float64   `form:"bank_amount"`
-	FinancialProduct string    `form:"financial_product"`
+	CustomerID       uint         `form:"customer_id" binding:"required"`
+	FinanceID        uint         `form:"finance_id" binding:"required"`
+	AccountantID     uint         `form:"accountant_id" binding:"required"`
+	Amount           models.Money `form:"amount" binding:"money"`
+	ServiceFee       models.Money `form:"service_fee" binding:"money=allowzero"`
+	BankAmount       models.Money `form:"bank_amount" binding:"money"`
+	FinancialProduct string       `form:"financial_product" binding:"required,max=100"`
 	// mock, not implemented. just upload str.
-	ContractDocument string    `form:"contract_document"`
-	BankDocuments string    `form:"bank_documents"`
+	ContractDocument string `form:"contract_document"`
+	BankDocuments    string `form:"bank_documents"`
 }
 
 /*
@@ -196,64 +303,190 @@ status同样可以使用以下值：
 "已拒绝" => "REJECTED",
 */
 type UpdateContractStatusForm struct {
-    UserID     uint      `form:"user_id"`
-	ContractID uint      `form:"contract_id"`
-	Status      string    `form:"status"`
+	ContractID uint   `form:"contract_id" binding:"required"`
+	Status     string `form:"status" binding:"required,enum=contract_status"`
 }
 
-//userID, contractID uint, amount, serviceFee, bankAmount float64
 type UpdateContractAmountForm struct {
-    UserID     uint      `form:"user_id"`
-	ContractID uint      `form:"contract_id"`
-	Amount    float64   `form:"amount"`
-	ServiceFee float64   `form:"service_fee"`
-	BankAmount  float64   `form:"bank_amount"`
+	ContractID uint         `form:"contract_id" binding:"required"`
+	Amount     models.Money `form:"amount" binding:"money"`
+	ServiceFee models.Money `form:"service_fee" binding:"money=allowzero"`
+	BankAmount models.Money `form:"bank_amount" binding:"money"`
+	Reason     string       `form:"reason" binding:"required,max=200"`
 }
 
-type GetContractListForm struct {
-	UserID uint `form:"user_id"`
+type GetContractAmountHistoryForm struct {
+	ContractID uint `form:"contract_id" binding:"required"`
 }
 
 type GetContractDetailForm struct {
-    UserID uint `form:"user_id"`
-	ContractID uint `form:"contract_id"`
+	ContractID uint `form:"contract_id" binding:"required"`
 }
 
 type GetSalerPerformanceForm struct {
-    UserID uint `form:"user_id"`
-	SalerID uint `form:"saler_id"`
-	StartDate time.Time `form:"start_date"`
-	EndDate time.Time `form:"end_date"`
+	UserID    uint      `form:"user_id" binding:"required"`
+	SalerID   uint      `form:"saler_id" binding:"required"`
+	StartDate time.Time `form:"start_date" binding:"required"`
+	EndDate   time.Time `form:"end_date" binding:"required,gtfield=StartDate"`
 }
 
 type GetDepartmentPerformanceForm struct {
-    UserID uint `form:"user_id"`
-	DepartmentID uint `form:"department_id"`
-	StartDate time.Time `form:"start_date"`
-	EndDate time.Time `form:"end_date"`
+	UserID       uint      `form:"user_id" binding:"required"`
+	DepartmentID uint      `form:"department_id" binding:"required"`
+	StartDate    time.Time `form:"start_date" binding:"required"`
+	EndDate      time.Time `form:"end_date" binding:"required,gtfield=StartDate"`
 }
 
 type GetZonePerformanceForm struct {
-    UserID uint `form:"user_id"`
-	ZoneID uint `form:"zone_id"`
-	StartDate time.Time `form:"start_date"`
-	EndDate time.Time `form:"end_date"`
+	UserID    uint      `form:"user_id" binding:"required"`
+	ZoneID    uint      `form:"zone_id" binding:"required"`
+	StartDate time.Time `form:"start_date" binding:"required"`
+	EndDate   time.Time `form:"end_date" binding:"required,gtfield=StartDate"`
 }
 
 type GetLoanAnalysisForm struct {
-    UserID uint `form:"user_id"`
+	UserID uint `form:"user_id" binding:"required"`
 }
 
 // type GetDepartmentsForm struct {
 // }
 
 type GetDepartmentByIDForm struct {
-	DepartmentID uint `form:"department_id"`
+	DepartmentID uint `form:"department_id" binding:"required"`
 }
 
 // type GetZonesForm struct {
 // }
 
 type GetZoneByIDForm struct {
-	ZoneID uint `form:"zone_id"`
-}
\ No newline at end of file
+	ZoneID uint `form:"zone_id" binding:"required"`
+}
+
+/*
+RepaymentMethod 可以使用以下值：
+
+- EQUAL_INSTALLMENT: "等额本息",
+
+- EQUAL_PRINCIPAL:   "等额本金",
+
+AnnualRate 是小数形式的年利率，例如 0.0435 表示 4.35%
+*/
+type CreateFinancialProductForm struct {
+	Name            string       `form:"name" binding:"required,max=100"`
+	TermMonths      int          `form:"term_months" binding:"required,min=1,max=360"`
+	AnnualRate      models.Money `form:"annual_rate" binding:"rate"`
+	RepaymentMethod string       `form:"repayment_method" binding:"required,enum=repayment_method"`
+}
+
+// 放款日期和还款日期的格式是标准的RFC3339格式
+type RecordDisbursementForm struct {
+	ContractID  uint         `form:"contract_id" binding:"required"`
+	Bank        string       `form:"bank" binding:"required,max=100"`
+	Amount      models.Money `form:"amount" binding:"money"`
+	DisbursedAt time.Time    `form:"disbursed_at" binding:"required"`
+}
+
+type RecordRepaymentForm struct {
+	ContractID uint         `form:"contract_id" binding:"required"`
+	Amount     models.Money `form:"amount" binding:"money"`
+	PaidAt     time.Time    `form:"paid_at" binding:"required"`
+}
+
+type GetRepaymentScheduleForm struct {
+	ContractID uint `form:"contract_id" binding:"required"`
+}
+
+/*
+提成方案，Role 只能是 "销售代表"、"销售经理" 或 "销售总监"，费率是小数形式，例如 0.3 表示服务费的30%
+
+阶梯通过重复的 tier_min_volumes 和 tier_rates 参数传入，两者一一对应，例如：
+tier_min_volumes=100000&tier_rates=0.35&tier_min_volumes=500000&tier_rates=0.4
+*/
+type CreateCommissionPlanForm struct {
+	Name           string         `form:"name" binding:"required,max=100"`
+	Role           string         `form:"role" binding:"required,oneof=销售代表 销售经理 销售总监"`
+	BaseRate       models.Money   `form:"base_rate" binding:"rate"`
+	OverrideRate   models.Money   `form:"override_rate" binding:"rate"`
+	TierMinVolumes []models.Money `form:"tier_min_volumes" binding:"dive,money"`
+	TierRates      []models.Money `form:"tier_rates" binding:"dive,rate"`
+}
+
+// 提成周期的格式为 "2006-01"，例如 "2024-05"
+type SettleCommissionsForm struct {
+	Period string `form:"period" binding:"required,datetime=2006-01"`
+}
+
+type GetCommissionStatementsForm struct {
+	Period string `form:"period" binding:"required,datetime=2006-01"`
+}
+
+type GetCommissionStatementForm struct {
+	StatementID uint `form:"statement_id" binding:"required"`
+}
+
+// Adjustment 可以为负数，表示扣减
+type AdjustCommissionStatementForm struct {
+	StatementID uint         `form:"statement_id" binding:"required"`
+	Adjustment  models.Money `form:"adjustment" binding:"money=signed"`
+	Note        string       `form:"note" binding:"required,max=200"`
+}
+
+type LockCommissionStatementForm struct {
+	StatementID uint `form:"statement_id" binding:"required"`
+}
+
+type ConfirmBankAmountForm struct {
+	ContractID uint         `form:"contract_id" binding:"required"`
+	BankAmount models.Money `form:"bank_amount" binding:"money"`
+}
+
+// Status 可以是 "待处理" 或 "已处理"，不传时返回全部
+type GetReconciliationItemsForm struct {
+	Status string `form:"status" binding:"omitempty,enum=reconciliation_status"`
+}
+
+type ResolveReconciliationItemForm struct {
+	ItemID     uint   `form:"item_id" binding:"required"`
+	Resolution string `form:"resolution" binding:"required,max=200"`
+}
+
+/*
+KYC资料，national_id 为18位身份证号码，会校验出生日期和校验码
+marital_status 可以是 "未婚"、"已婚"、"离异" 或 "丧偶"
+*/
+type UpdateCustomerKYCForm struct {
+	CustomerID    uint         `form:"customer_id" binding:"required"`
+	NationalID    string       `form:"national_id" binding:"required,nationalid"`
+	Occupation    string       `form:"occupation" binding:"required,max=50"`
+	MonthlyIncome models.Money `form:"monthly_income" binding:"money=allowzero"`
+	Assets        models.Money `form:"assets" binding:"money=allowzero"`
+	ExistingDebts models.Money `form:"existing_debts" binding:"money=allowzero"`
+	MaritalStatus string       `form:"marital_status" binding:"required,enum=marital_status"`
+}
+
+type AddKYCDocumentForm struct {
+	CustomerID uint   `form:"customer_id" binding:"required"`
+	Kind       string `form:"kind" binding:"required,max=50"`
+	File       string `form:"file" binding:"required,max=255"`
+}
+
+// Status 只能是 "已认证" 或 "已拒绝"
+type ReviewCustomerKYCForm struct {
+	CustomerID uint   `form:"customer_id" binding:"required"`
+	Status     string `form:"status" binding:"required,oneof=已认证 已拒绝"`
+	Note       string `form:"note" binding:"max=200"`
+}
+
+type GetCustomerKYCForm struct {
+	CustomerID uint `form:"customer_id" binding:"required"`
+}
+
+type FindCustomerByPhoneForm struct {
+	CustomerPhone string `form:"customer_phone" binding:"required,cnmobile"`
+}
+
+// 查看客户完整信息必须填写原因，原因记录在系统日志中
+type RevealCustomerPIIForm struct {
+	CustomerID uint   `form:"customer_id" binding:"required"`
+	Reason     string `form:"reason" binding:"required,max=200"`
+}
@@ -0,0 +1,147 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"gin-boilerplate/infra/database"
+	"gin-boilerplate/infra/logger"
+	"gin-boilerplate/infra/scheduler"
+	"gin-boilerplate/migrations"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// 单个组件检查的超时时间
+const readinessCheckTimeout = 2 * time.Second
+
+const (
+	componentOK   = "ok"
+	componentFail = "fail"
+)
+
+// ComponentStatus 单个组件的检查结果；/readyz 不需要鉴权，失败原因只写日志，不返回给客户端
+type ComponentStatus struct {
+	Status    string  `json:"status"`
+	LatencyMs float64 `json:"latency_ms"`
+}
+
+type componentCheck func(ctx context.Context) error
+
+// 启动时数据库迁移的检查结果，检查需要逐表逐列查询，不在每次探测时执行
+var migrationStatus struct {
+	sync.RWMutex
+	checked bool
+	pending []string
+	err     error
+}
+
+// CheckMigrations 在启动执行迁移后调用，检查并记录是否还有未完成的迁移，供 /readyz 使用
+func CheckMigrations(db *gorm.DB) {
+	pending, err := migrations.Pending(db)
+	migrationStatus.Lock()
+	defer migrationStatus.Unlock()
+	migrationStatus.checked, migrationStatus.pending, migrationStatus.err = true, pending, err
+}
+
+// Livez 存活检查，进程能处理请求即视为存活
+func Livez(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, gin.H{"status": componentOK})
+}
+
+// Readyz 就绪检查，检查主从数据库连接、数据库迁移和定时任务状态，任一组件失败返回503；
+// 从库不可用时读请求会回退到主库，因此从库失败只在结果中体现，不影响就绪状态
+func Readyz(ctx *gin.Context) {
+	checks := map[string]componentCheck{
+		"master":     pingCheck(database.DB),
+		"migrations": migrationCheck,
+		"scheduler":  schedulerCheck,
+	}
+	optional := map[string]bool{}
+	for i, replica := range database.Replicas {
+		name := fmt.Sprintf("replica_%d", i)
+		checks[name] = pingCheck(replica)
+		optional[name] = true
+	}
+
+	components := make(map[string]ComponentStatus, len(checks))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, check := range checks {
+		wg.Add(1)
+		go func(name string, check componentCheck) {
+			defer wg.Done()
+			status := runCheck(ctx, name, check)
+			mu.Lock()
+			components[name] = status
+			mu.Unlock()
+		}(name, check)
+	}
+	wg.Wait()
+
+	code, overall := http.StatusOK, componentOK
+	for name, component := range components {
+		if component.Status != componentOK && !optional[name] {
+			code, overall = http.StatusServiceUnavailable, componentFail
+		}
+	}
+	ctx.JSON(code, gin.H{"status": overall, "components": components})
+}
+
+func runCheck(parent *gin.Context, name string, check componentCheck) ComponentStatus {
+	ctx, cancel := context.WithTimeout(parent.Request.Context(), readinessCheckTimeout)
+	defer cancel()
+	start := time.Now()
+	err := check(ctx)
+	status := ComponentStatus{
+		Status:    componentOK,
+		LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if err != nil {
+		status.Status = componentFail
+		logger.FromContext(parent).Warnf("readiness check %s failed: %s", name, err)
+	}
+	return status
+}
+
+func pingCheck(db *gorm.DB) componentCheck {
+	return func(ctx context.Context) error {
+		if db == nil {
+			return fmt.Errorf("database not connected")
+		}
+		sqlDB, err := db.DB()
+		if err != nil {
+			return err
+		}
+		return sqlDB.PingContext(ctx)
+	}
+}
+
+func migrationCheck(ctx context.Context) error {
+	migrationStatus.RLock()
+	defer migrationStatus.RUnlock()
+	switch {
+	case !migrationStatus.checked:
+		return fmt.Errorf("migrations not checked")
+	case migrationStatus.err != nil:
+		return migrationStatus.err
+	case len(migrationStatus.pending) > 0:
+		return fmt.Errorf("pending migrations: %v", migrationStatus.pending)
+	}
+	return nil
+}
+
+func schedulerCheck(ctx context.Context) error {
+	status := scheduler.GetStatus()
+	if !status.Running {
+		return fmt.Errorf("scheduler is not running")
+	}
+	if len(status.Jobs) == 0 {
+		return fmt.Errorf("no scheduled jobs")
+	}
+	return nil
+}
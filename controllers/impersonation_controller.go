@@ -0,0 +1,139 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"gin-boilerplate/config"
+	"gin-boilerplate/helpers"
+	"gin-boilerplate/infra/apperror"
+	"gin-boilerplate/repository"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AdministratorStartImpersonation 系统管理员以其他用户的身份登录，返回有效期内的代登录令牌，默认只读
+// 代登录只能由系统管理员本人发起，不能使用 API 密钥；被代登录的用户会收到通知
+func (c *Controller) AdministratorStartImpersonation(ctx *gin.Context) {
+	var startForm StartImpersonationForm
+	if err := ctx.ShouldBind(&startForm); err != nil {
+		_ = ctx.Error(invalidParams(err))
+		return
+	}
+	if currentClaims(ctx).APIKeyID != 0 {
+		_ = ctx.Error(apperror.New(apperror.CodeForbidden))
+		return
+	}
+	impersonationConfig := config.Get().Impersonation
+	duration := impersonationConfig.DefaultDuration
+	if startForm.Minutes != 0 {
+		duration = time.Duration(startForm.Minutes) * time.Minute
+	}
+	if duration > impersonationConfig.MaxDuration {
+		_ = ctx.Error(apperror.New(apperror.CodeInvalidParams).WithDetails([]FieldError{{
+			Field: "minutes", Rule: "max", Param: strconv.FormatInt(int64(impersonationConfig.MaxDuration/time.Minute), 10),
+		}}))
+		return
+	}
+
+	impersonation, user, err := c.repos.Impersonations.StartImpersonation(ctx, currentClaims(ctx).UserID, repository.NewImpersonation{
+		UserID:     startForm.UserID,
+		Reason:     startForm.Reason,
+		AllowWrite: startForm.AllowWrite,
+		ExpiresAt:  time.Now().Add(duration),
+	})
+	if err != nil {
+		_ = ctx.Error(fmt.Errorf("failed to start impersonation: %w", err))
+		return
+	}
+	token, err := helpers.GenerateImpersonationToken(*user, impersonation.ID, impersonation.ExpiresAt)
+	if err != nil {
+		_ = ctx.Error(fmt.Errorf("failed to generate impersonation token: %w", err))
+		return
+	}
+
+	response := Response{
+		Code:    http.StatusOK,
+		Message: "Impersonation started",
+		Data:    StartedImpersonationDTO{AccessToken: token, Impersonation: toImpersonationDTO(impersonation)},
+	}
+	ctx.JSON(http.StatusOK, response)
+}
+
+// AdministratorEndImpersonation 系统管理员提前结束代登录，代登录令牌立即失效
+func (c *Controller) AdministratorEndImpersonation(ctx *gin.Context) {
+	var endForm EndImpersonationForm
+	if err := ctx.ShouldBind(&endForm); err != nil {
+		_ = ctx.Error(invalidParams(err))
+		return
+	}
+
+	impersonation, err := c.repos.Impersonations.EndImpersonation(ctx, currentClaims(ctx).UserID, endForm.ImpersonationID)
+	if err != nil {
+		_ = ctx.Error(fmt.Errorf("failed to end impersonation: %w", err))
+		return
+	}
+
+	response := Response{
+		Code:    http.StatusOK,
+		Message: "Impersonation ended",
+		Data:    toImpersonationDTO(impersonation),
+	}
+	ctx.JSON(http.StatusOK, response)
+}
+
+// AdministratorListImpersonations 系统管理员查看全部代登录记录
+func (c *Controller) AdministratorListImpersonations(ctx *gin.Context) {
+	impersonations, err := c.repos.Impersonations.ListImpersonations(ctx, currentClaims(ctx).UserID)
+	if err != nil {
+		_ = ctx.Error(fmt.Errorf("failed to list impersonations: %w", err))
+		return
+	}
+
+	response := Response{
+		Code:    http.StatusOK,
+		Message: "List impersonations successful",
+		Data:    toImpersonationDTOs(impersonations),
+	}
+	ctx.JSON(http.StatusOK, response)
+}
+
+// UserListNotifications 当前用户的通知，最新的在前
+func (c *Controller) UserListNotifications(ctx *gin.Context) {
+	var listForm ListNotificationsForm
+	if err := ctx.ShouldBind(&listForm); err != nil {
+		_ = ctx.Error(invalidParams(err))
+		return
+	}
+
+	notifications, err := c.repos.Notifications.ListNotifications(ctx, currentClaims(ctx).UserID, listForm.UnreadOnly)
+	if err != nil {
+		_ = ctx.Error(fmt.Errorf("failed to list notifications: %w", err))
+		return
+	}
+
+	response := Response{
+		Code:    http.StatusOK,
+		Message: "List notifications successful",
+		Data:    toNotificationDTOs(notifications),
+	}
+	ctx.JSON(http.StatusOK, response)
+}
+
+// UserReadNotifications 把当前用户的全部未读通知标记为已读
+func (c *Controller) UserReadNotifications(ctx *gin.Context) {
+	read, err := c.repos.Notifications.ReadNotifications(ctx, currentClaims(ctx).UserID)
+	if err != nil {
+		_ = ctx.Error(fmt.Errorf("failed to read notifications: %w", err))
+		return
+	}
+
+	response := Response{
+		Code:    http.StatusOK,
+		Message: "Notifications marked as read",
+		Data:    gin.H{"read": read},
+	}
+	ctx.JSON(http.StatusOK, response)
+}
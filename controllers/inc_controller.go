@@ -1,156 +1,139 @@
 package controllers
 
 import (
-	"gin-boilerplate/helpers"
-	"gin-boilerplate/infra/database"
+	"fmt"
+	"gin-boilerplate/config"
+	"gin-boilerplate/infra/apperror"
 	"gin-boilerplate/models"
-	"gin-boilerplate/repository"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 )
 
 // 用户注册控制器，注册完毕后返回jwt令牌和用户对象
-func UserRegister(ctx *gin.Context) {
+func (c *Controller) UserRegister(ctx *gin.Context) {
 	var registerForm RegisterForm
 	if err := ctx.ShouldBind(&registerForm); err != nil {
-		response := Response{
-			Code:    http.StatusBadRequest,
-			Message: "Invalid register form",
-		}
-		ctx.JSON(http.StatusBadRequest, response)
+		_ = ctx.Error(invalidParams(err))
+		return
+	}
+	inc, err := parseIncludes(ctx, "profile")
+	if err != nil {
+		_ = ctx.Error(err)
 		return
 	}
 
 	// 创建新用户
 	var user *models.User
-	var err error
-
-	// 判断用户名密码是否合规
-	if !helpers.IsValidUsername(registerForm.Username) {
-		response := Response{
-			Code:    http.StatusBadRequest,
-			Message: "Invalid username, only 1-20 numbers/alphabets/chinese characters allowed",
-		}
-		ctx.JSON(http.StatusBadRequest, response)
-		return
-	}
-	if !helpers.IsValidPassword(registerForm.Password) {
-		response := Response{
-			Code:    http.StatusBadRequest,
-			Message: "Invalid password, 8-16 characters, only numbers and alphabets allowed",
-		}
-		ctx.JSON(http.StatusBadRequest, response)
-		return
-	}
 
 	if registerForm.Role == models.RoleNameMap[models.SYSTEM_ADMINISTRATOR] {
 		// 如果是系统管理员，则创建系统管理员
-		user, err = repository.CreateSystemManager(database.DB,
+		user, err = c.repos.Users.CreateSystemManager(ctx,
 			registerForm.Username,
 			registerForm.Password,
 		)
 	} else {
 		// 否则创建普通用户
-		user, err = repository.CreateUser(database.DB,
+		user, err = c.repos.Users.CreateUser(ctx,
 			registerForm.Username,
 			registerForm.Password,
 		)
 	}
 
 	if err != nil {
-		response := Response{
-			Code:    http.StatusInternalServerError,
-			Message: "Failed to create user: " + err.Error(),
-		}
-		ctx.JSON(http.StatusInternalServerError, response)
+		_ = ctx.Error(fmt.Errorf("failed to create user: %w", err))
 		return
 	}
 
 	// 注册成功
-	access_token, refresh_token, err := helpers.GenerateToken(*user)
+	userDTO, err := c.userDTO(ctx, user, inc)
 	if err != nil {
-		response := Response{
-			Code:    http.StatusInternalServerError,
-			Message: "Failed to generate jwt token: " + err.Error(),
-		}
-		ctx.JSON(http.StatusInternalServerError, response)
+		_ = ctx.Error(err)
+		return
+	}
+	data, err := c.tokenData(ctx, user, userDTO, models.LoginMethodRegister)
+	if err != nil {
+		_ = ctx.Error(err)
 		return
 	}
 	response := Response{
 		Code:    http.StatusOK,
 		Message: "Register successful",
-		Data: map[string]interface{}{
-			"user":          user,
-			"access_token":  access_token,
-			"refresh_token": refresh_token,
-		},
+		Data:    data,
 	}
 	ctx.JSON(http.StatusOK, response)
 }
 
 // 登录控制器，登录成功后返回jwt令牌和用户对象
-func UserLogin(ctx *gin.Context) {
+func (c *Controller) UserLogin(ctx *gin.Context) {
 	// 获取用户名和密码
 	var loginForm LoginForm
 	if err := ctx.ShouldBind(&loginForm); err != nil {
-		response := Response{
-			Code:    http.StatusBadRequest,
-			Message: "Invalid login form",
-		}
-		ctx.JSON(http.StatusBadRequest, response)
+		_ = ctx.Error(invalidParams(err))
+		return
+	}
+	inc, err := parseIncludes(ctx, "profile")
+	if err != nil {
+		_ = ctx.Error(err)
+		return
+	}
+
+	// 同一IP登录失败次数过多时直接拒绝，不再验证密码
+	if err := c.checkIPLoginFailures(ctx); err != nil {
+		_ = ctx.Error(err)
 		return
 	}
 
 	// 验证用户名和密码
-	user, err := repository.Login(database.DB, loginForm.Username, loginForm.Password)
+	user, err := c.repos.Users.Login(ctx, loginForm.Username, loginForm.Password, loginPolicy())
 	if err != nil {
-		response := Response{
-			Code:    http.StatusUnauthorized,
-			Message: "Invalid credentials",
-		}
-		ctx.JSON(http.StatusUnauthorized, response)
+		c.recordIPLoginFailure(ctx, err)
+		_ = ctx.Error(err)
+		return
+	}
+
+	// 开启了两步验证时只返回挑战令牌，通过 /login/verify 输入验证码后才返回令牌
+	if user.TOTPEnabled {
+		c.respondLoginChallenge(ctx, user, "", nil)
 		return
 	}
 
 	// 登录成功
-	access_token, refresh_token, err := helpers.GenerateToken(*user)
+	userDTO, err := c.userDTO(ctx, user, inc)
 	if err != nil {
-		response := Response{
-			Code:    http.StatusInternalServerError,
-			Message: "Failed to generate jwt token: " + err.Error(),
-		}
-		ctx.JSON(http.StatusInternalServerError, response)
+		_ = ctx.Error(err)
+		return
+	}
+	data, err := c.tokenData(ctx, user, userDTO, models.LoginMethodPassword)
+	if err != nil {
+		_ = ctx.Error(err)
 		return
 	}
 	response := Response{
 		Code:    http.StatusOK,
 		Message: "Login successful",
-		Data: map[string]interface{}{
-			"user":          user,
-			"access_token":  access_token,
-			"refresh_token": refresh_token,
-		},
+		Data:    data,
 	}
 	ctx.JSON(http.StatusOK, response)
 }
 
 // 更新用户信息
-func UserUpdateProfile(ctx *gin.Context) {
+func (c *Controller) UserUpdateProfile(ctx *gin.Context) {
 	// 获取用户ID和更新信息
 	var updateForm UpdateUserProfileForm
 	if err := ctx.ShouldBind(&updateForm); err != nil {
-		response := Response{
-			Code:    http.StatusBadRequest,
-			Message: "Invalid update form",
-		}
-		ctx.JSON(http.StatusBadRequest, response)
+		_ = ctx.Error(invalidParams(err))
+		return
+	}
+	inc, err := parseIncludes(ctx, "profile")
+	if err != nil {
+		_ = ctx.Error(err)
 		return
 	}
 	// 更新用户信息
-	user, err := repository.UpdateUserProfile(
-		database.DB,
-		updateForm.UserID,
+	user, err := c.repos.Users.UpdateUserProfile(
+		ctx,
+		currentClaims(ctx).UserID,
 		updateForm.Name,
 		updateForm.Age,
 		models.GenderStrToEnumMap[updateForm.Gender],
@@ -158,48 +141,42 @@ func UserUpdateProfile(ctx *gin.Context) {
 		updateForm.Phone,
 	)
 	if err != nil {
-		response := Response{
-			Code:    http.StatusInternalServerError,
-			Message: "Failed to update user: " + err.Error(),
-		}
-		ctx.JSON(http.StatusInternalServerError, response)
+		_ = ctx.Error(fmt.Errorf("failed to update user: %w", err))
 		return
 	}
 	// 更新成功
 	response := Response{
 		Code:    http.StatusOK,
 		Message: "Update successful",
-		Data:    user,
+		Data:    toUserDTO(user, inc),
 	}
 	ctx.JSON(http.StatusOK, response)
 }
 
-func AdministratorUpdateUserNameOrPassword(ctx *gin.Context) {
+func (c *Controller) AdministratorUpdateUserNameOrPassword(ctx *gin.Context) {
 	// 获取用户ID和更新信息
 	var updateForm UpdateUserNameOrPasswordForm
 	if err := ctx.ShouldBind(&updateForm); err != nil {
-		response := Response{
-			Code:    http.StatusBadRequest,
-			Message: "Invalid update form",
-		}
-		ctx.JSON(http.StatusBadRequest, response)
+		_ = ctx.Error(invalidParams(err))
+		return
+	}
+	inc, err := parseIncludes(ctx, "profile")
+	if err != nil {
+		_ = ctx.Error(err)
 		return
 	}
 
 	// 更新用户信息
-	user, err := repository.UpdateUserNameOrPassword(
-		database.DB,
-		updateForm.SystemManagerID,
+	user, err := c.repos.Users.UpdateUserNameOrPassword(
+		ctx,
+		currentClaims(ctx).UserID,
 		updateForm.UserID,
 		updateForm.Username,
 		updateForm.Password,
+		config.Get().Password.History,
 	)
 	if err != nil {
-		response := Response{
-			Code:    http.StatusInternalServerError,
-			Message: "Failed to update user: " + err.Error(),
-		}
-		ctx.JSON(http.StatusInternalServerError, response)
+		_ = ctx.Error(fmt.Errorf("failed to update user: %w", err))
 		return
 	}
 
@@ -207,36 +184,33 @@ func AdministratorUpdateUserNameOrPassword(ctx *gin.Context) {
 	response := Response{
 		Code:    http.StatusOK,
 		Message: "Update successful",
-		Data:    user,
+		Data:    toUserDTO(user, inc),
 	}
 	ctx.JSON(http.StatusOK, response)
 }
 
 // 管理员更新其他信息
-func AdministratorUpdateUserRole(ctx *gin.Context) {
+func (c *Controller) AdministratorUpdateUserRole(ctx *gin.Context) {
 	// 获取用户ID和更新信息
 	var updateForm UpdateUserRoleForm
 	if err := ctx.ShouldBind(&updateForm); err != nil {
-		response := Response{
-			Code:    http.StatusBadRequest,
-			Message: "Invalid update form",
-		}
-		ctx.JSON(http.StatusBadRequest, response)
+		_ = ctx.Error(invalidParams(err))
+		return
+	}
+	inc, err := parseIncludes(ctx, "profile")
+	if err != nil {
+		_ = ctx.Error(err)
 		return
 	}
 	// 更新用户信息
-	user, err := repository.UpdateUserRole(
-		database.DB,
-		updateForm.SystemManagerID,
+	user, err := c.repos.Users.UpdateUserRole(
+		ctx,
+		currentClaims(ctx).UserID,
 		updateForm.UserID,
 		models.RoleStrToEnumMap[updateForm.Role],
 	)
 	if err != nil {
-		response := Response{
-			Code:    http.StatusInternalServerError,
-			Message: "Failed to update user: " + err.Error(),
-		}
-		ctx.JSON(http.StatusInternalServerError, response)
+		_ = ctx.Error(fmt.Errorf("failed to update user: %w", err))
 		return
 	}
 
@@ -244,77 +218,57 @@ func AdministratorUpdateUserRole(ctx *gin.Context) {
 	response := Response{
 		Code:    http.StatusOK,
 		Message: "Update successful",
-		Data:    user,
+		Data:    toUserDTO(user, inc),
 	}
 	ctx.JSON(http.StatusOK, response)
 }
 
-func AdministratorListAllUsers(ctx *gin.Context) {
-	var listForm ListAllUsersFrom
-	if err := ctx.ShouldBind(&listForm); err != nil {
-		response := Response{
-			Code:    http.StatusBadRequest,
-			Message: "Invalid list form",
-		}
-		ctx.JSON(http.StatusBadRequest, response)
+func (c *Controller) AdministratorListAllUsers(ctx *gin.Context) {
+	inc, err := parseIncludes(ctx, "profile")
+	if err != nil {
+		_ = ctx.Error(err)
 		return
 	}
-	users, err := repository.GetUserList(database.DB, listForm.SystemManagerID)
+	users, err := c.repos.Users.GetUserList(ctx, currentClaims(ctx).UserID)
 	if err != nil {
-		response := Response{
-			Code:    http.StatusInternalServerError,
-			Message: "Failed to list users: " + err.Error(),
-		}
-		ctx.JSON(http.StatusInternalServerError, response)
+		_ = ctx.Error(fmt.Errorf("failed to list users: %w", err))
 		return
 	}
 	response := Response{
 		Code:    http.StatusOK,
 		Message: "List successful",
-		Data:    users,
+		Data:    toUserDTOs(users, inc),
 	}
 	ctx.JSON(http.StatusOK, response)
 }
 
-func AdministratorCreateZone(ctx *gin.Context) {
+func (c *Controller) AdministratorCreateZone(ctx *gin.Context) {
 	var createForm CreateZoneForm
 	if err := ctx.ShouldBind(&createForm); err != nil {
-		response := Response{
-			Code:    http.StatusBadRequest,
-			Message: "Invalid create form",
-		}
-		ctx.JSON(http.StatusBadRequest, response)
+		_ = ctx.Error(invalidParams(err))
 		return
 	}
-	zone, err := repository.CreateZone(
-		database.DB,
-		createForm.SystemManagerID,
+	zone, err := c.repos.Org.CreateZone(
+		ctx,
+		currentClaims(ctx).UserID,
 		createForm.Name,
 	)
 	if err != nil {
-		response := Response{
-			Code:    http.StatusInternalServerError,
-			Message: "Failed to create zone: " + err.Error(),
-		}
-		ctx.JSON(http.StatusInternalServerError, response)
+		_ = ctx.Error(fmt.Errorf("failed to create zone: %w", err))
 		return
 	}
 	response := Response{
 		Code:    http.StatusOK,
 		Message: "Create successful",
-		Data:    zone,
+		Data:    toZoneDTO(zone, nil),
 	}
 	ctx.JSON(http.StatusOK, response)
 }
 
-func AdministratorCreateDepartment(ctx *gin.Context) {
+func (c *Controller) AdministratorCreateDepartment(ctx *gin.Context) {
 	var createForm CreateDepartmentForm
 	if err := ctx.ShouldBind(&createForm); err != nil {
-		response := Response{
-			Code:    http.StatusBadRequest,
-			Message: "Invalid create form",
-		}
-		ctx.JSON(http.StatusBadRequest, response)
+		_ = ctx.Error(invalidParams(err))
 		return
 	}
 
@@ -322,67 +276,51 @@ func AdministratorCreateDepartment(ctx *gin.Context) {
 	var err error
 
 	if createForm.Type == "销售部" {
-		department, err = repository.CreateSalesDepartment(
-			database.DB,
-			createForm.SystemManagerID,
+		department, err = c.repos.Org.CreateSalesDepartment(
+			ctx,
+			currentClaims(ctx).UserID,
 			createForm.Name,
 			createForm.ZoneID,
 		)
 	} else if createForm.Type == "金融部" {
-		department, err = repository.CreateFinanceDepartment(
-			database.DB,
-			createForm.SystemManagerID,
+		department, err = c.repos.Org.CreateFinanceDepartment(
+			ctx,
+			currentClaims(ctx).UserID,
 			createForm.Name,
 		)
 	} else {
-		response := Response{
-			Code:    http.StatusBadRequest,
-			Message: "Invalid department type",
-		}
-		ctx.JSON(http.StatusBadRequest, response)
+		_ = ctx.Error(apperror.New(apperror.CodeInvalidParams).WithDetails([]FieldError{{Field: "type", Rule: "oneof", Param: "销售部 金融部"}}))
 		return
 	}
 
 	if err != nil {
-		response := Response{
-			Code:    http.StatusInternalServerError,
-			Message: "Failed to create department: " + err.Error(),
-		}
-		ctx.JSON(http.StatusInternalServerError, response)
+		_ = ctx.Error(fmt.Errorf("failed to create department: %w", err))
 		return
 	}
 
 	response := Response{
 		Code:    http.StatusOK,
 		Message: "Create successful",
-		Data:    department,
+		Data:    toDepartmentDTO(department, nil),
 	}
 	ctx.JSON(http.StatusOK, response)
 }
 
-func AdministratorAssignDepartmentToZone(ctx *gin.Context) {
+func (c *Controller) AdministratorAssignDepartmentToZone(ctx *gin.Context) {
 	var assignForm AssignDepartmentToZoneForm
 	if err := ctx.ShouldBind(&assignForm); err != nil {
-		response := Response{
-			Code:    http.StatusBadRequest,
-			Message: "Invalid assign form",
-		}
-		ctx.JSON(http.StatusBadRequest, response)
+		_ = ctx.Error(invalidParams(err))
 		return
 	}
 
-	err := repository.AssignDepartmentToZone(
-		database.DB,
-		assignForm.SystemManagerID,
+	err := c.repos.Org.AssignDepartmentToZone(
+		ctx,
+		currentClaims(ctx).UserID,
 		assignForm.DepartmentID,
 		assignForm.ZoneID,
 	)
 	if err != nil {
-		response := Response{
-			Code:    http.StatusInternalServerError,
-			Message: "Failed to assign department to zone: " + err.Error(),
-		}
-		ctx.JSON(http.StatusInternalServerError, response)
+		_ = ctx.Error(fmt.Errorf("failed to assign department to zone: %w", err))
 		return
 	}
 
@@ -393,29 +331,21 @@ func AdministratorAssignDepartmentToZone(ctx *gin.Context) {
 	ctx.JSON(http.StatusOK, response)
 }
 
-func AdministratorAssignUserToDepartment(ctx *gin.Context) {
+func (c *Controller) AdministratorAssignUserToDepartment(ctx *gin.Context) {
 	var assignForm AssignUserToDepartmentForm
 	if err := ctx.ShouldBind(&assignForm); err != nil {
-		response := Response{
-			Code:    http.StatusBadRequest,
-			Message: "Invalid assign form",
-		}
-		ctx.JSON(http.StatusBadRequest, response)
+		_ = ctx.Error(invalidParams(err))
 		return
 	}
 
-	err := repository.AssignUserToDepartment(
-		database.DB,
-		assignForm.SystemManagerID,
+	err := c.repos.Org.AssignUserToDepartment(
+		ctx,
+		currentClaims(ctx).UserID,
 		assignForm.UserID,
 		assignForm.DepartmentID,
 	)
 	if err != nil {
-		response := Response{
-			Code:    http.StatusInternalServerError,
-			Message: "Failed to assign user to department: " + err.Error(),
-		}
-		ctx.JSON(http.StatusInternalServerError, response)
+		_ = ctx.Error(fmt.Errorf("failed to assign user to department: %w", err))
 		return
 	}
 
@@ -426,29 +356,21 @@ func AdministratorAssignUserToDepartment(ctx *gin.Context) {
 	ctx.JSON(http.StatusOK, response)
 }
 
-func AdministratorAssignUserToZone(ctx *gin.Context) {
+func (c *Controller) AdministratorAssignUserToZone(ctx *gin.Context) {
 	var assignForm AssignUserToZoneForm
 	if err := ctx.ShouldBind(&assignForm); err != nil {
-		response := Response{
-			Code:    http.StatusBadRequest,
-			Message: "Invalid assign form",
-		}
-		ctx.JSON(http.StatusBadRequest, response)
+		_ = ctx.Error(invalidParams(err))
 		return
 	}
 
-	err := repository.AssignUserToZone(
-		database.DB,
-		assignForm.SystemManagerID,
+	err := c.repos.Org.AssignUserToZone(
+		ctx,
+		currentClaims(ctx).UserID,
 		assignForm.UserID,
 		assignForm.ZoneID,
 	)
 	if err != nil {
-		response := Response{
-			Code:    http.StatusInternalServerError,
-			Message: "Failed to assign user to zone: " + err.Error(),
-		}
-		ctx.JSON(http.StatusInternalServerError, response)
+		_ = ctx.Error(fmt.Errorf("failed to assign user to zone: %w", err))
 		return
 	}
 
@@ -459,29 +381,21 @@ func AdministratorAssignUserToZone(ctx *gin.Context) {
 	ctx.JSON(http.StatusOK, response)
 }
 
-func AdministratorAssignDirectorToZone(ctx *gin.Context) {
+func (c *Controller) AdministratorAssignDirectorToZone(ctx *gin.Context) {
 	var assignForm AssignDirectorToZoneForm
 	if err := ctx.ShouldBind(&assignForm); err != nil {
-		response := Response{
-			Code:    http.StatusBadRequest,
-			Message: "Invalid assign form",
-		}
-		ctx.JSON(http.StatusBadRequest, response)
+		_ = ctx.Error(invalidParams(err))
 		return
 	}
 
-	err := repository.AssignDirectorToZone(
-		database.DB,
-		assignForm.SystemManagerID,
+	err := c.repos.Org.AssignDirectorToZone(
+		ctx,
+		currentClaims(ctx).UserID,
 		assignForm.UserID,
 		assignForm.ZoneID,
 	)
 	if err != nil {
-		response := Response{
-			Code:    http.StatusInternalServerError,
-			Message: "Failed to assign director to zone: " + err.Error(),
-		}
-		ctx.JSON(http.StatusInternalServerError, response)
+		_ = ctx.Error(fmt.Errorf("failed to assign director to zone: %w", err))
 		return
 	}
 
@@ -492,29 +406,21 @@ func AdministratorAssignDirectorToZone(ctx *gin.Context) {
 	ctx.JSON(http.StatusOK, response)
 }
 
-func AdministratorAssignManagerToDepartment(ctx *gin.Context) {
+func (c *Controller) AdministratorAssignManagerToDepartment(ctx *gin.Context) {
 	var assignForm AssignManagerToDepartmentForm
 	if err := ctx.ShouldBind(&assignForm); err != nil {
-		response := Response{
-			Code:    http.StatusBadRequest,
-			Message: "Invalid assign form",
-		}
-		ctx.JSON(http.StatusBadRequest, response)
+		_ = ctx.Error(invalidParams(err))
 		return
 	}
 
-	err := repository.AssignManagerToDepartment(
-		database.DB,
-		assignForm.SystemManagerID,
+	err := c.repos.Org.AssignManagerToDepartment(
+		ctx,
+		currentClaims(ctx).UserID,
 		assignForm.UserID,
 		assignForm.DepartmentID,
 	)
 	if err != nil {
-		response := Response{
-			Code:    http.StatusInternalServerError,
-			Message: "Failed to assign manager to department: " + err.Error(),
-		}
-		ctx.JSON(http.StatusInternalServerError, response)
+		_ = ctx.Error(fmt.Errorf("failed to assign manager to department: %w", err))
 		return
 	}
 
@@ -526,83 +432,58 @@ func AdministratorAssignManagerToDepartment(ctx *gin.Context) {
 }
 
 // 管理员系统日志查询
-func AdministratorQuerySystemLog(ctx *gin.Context) {
-	var queryForm QuerySystemLogForm
-	if err := ctx.ShouldBind(&queryForm); err != nil {
-		response := Response{
-			Code:    http.StatusBadRequest,
-			Message: "Invalid query form",
-		}
-		ctx.JSON(http.StatusBadRequest, response)
-		return
-	}
-
-	systemLogs, err := repository.GetSystemLogList(database.DB, queryForm.SystemManagerID)
+func (c *Controller) AdministratorQuerySystemLog(ctx *gin.Context) {
+	systemLogs, err := c.repos.SystemLogs.GetSystemLogList(ctx, currentClaims(ctx).UserID)
 	if err != nil {
-		response := Response{
-			Code:    http.StatusInternalServerError,
-			Message: "Failed to query system log: " + err.Error(),
-		}
-		ctx.JSON(http.StatusInternalServerError, response)
+		_ = ctx.Error(fmt.Errorf("failed to query system log: %w", err))
+		return
 	}
 
 	response := Response{
 		Code:    http.StatusOK,
 		Message: "Query successful",
-		Data:    systemLogs,
+		Data:    toSystemLogDTOs(systemLogs),
 	}
 	ctx.JSON(http.StatusOK, response)
 }
 
 // 销售部api控制器
-func SaleCreateCustomer(ctx *gin.Context) {
+func (c *Controller) SaleCreateCustomer(ctx *gin.Context) {
 	var createForm CreateCustomerForm
 	if err := ctx.ShouldBind(&createForm); err != nil {
-		response := Response{
-			Code:    http.StatusBadRequest,
-			Message: "Invalid create form",
-		}
-		ctx.JSON(http.StatusBadRequest, response)
+		_ = ctx.Error(invalidParams(err))
 		return
 	}
 
-	customer, err := repository.CreateCustomer(
-		database.DB,
-		createForm.UserID,
+	customer, err := c.repos.Customers.CreateCustomer(
+		ctx,
+		currentClaims(ctx).UserID,
 		createForm.CustomerName,
 		createForm.CustomerPhone,
 	)
 	if err != nil {
-		response := Response{
-			Code:    http.StatusInternalServerError,
-			Message: "Failed to create customer: " + err.Error(),
-		}
-		ctx.JSON(http.StatusInternalServerError, response)
+		_ = ctx.Error(fmt.Errorf("failed to create customer: %w", err))
 		return
 	}
 
 	response := Response{
 		Code:    http.StatusOK,
 		Message: "Create successful",
-		Data:    customer,
+		Data:    toCustomerDTO(customer),
 	}
 	ctx.JSON(http.StatusOK, response)
 }
 
-func SaleUpdateCustomer(ctx *gin.Context) {
+func (c *Controller) SaleUpdateCustomer(ctx *gin.Context) {
 	var updateForm UpdateCustomerForm
 	if err := ctx.ShouldBind(&updateForm); err != nil {
-		response := Response{
-			Code:    http.StatusBadRequest,
-			Message: "Invalid update form",
-		}
-		ctx.JSON(http.StatusBadRequest, response)
+		_ = ctx.Error(invalidParams(err))
 		return
 	}
 
-	updated_customer, err := repository.UpdateCustomer(
-		database.DB,
-		updateForm.UserID,
+	updated_customer, err := c.repos.Customers.UpdateCustomer(
+		ctx,
+		currentClaims(ctx).UserID,
 		updateForm.CustomerID,
 		updateForm.CustomerName,
 		updateForm.CustomerPhone,
@@ -611,138 +492,94 @@ func SaleUpdateCustomer(ctx *gin.Context) {
 		updateForm.CustomerAddress,
 	)
 	if err != nil {
-		response := Response{
-			Code:    http.StatusInternalServerError,
-			Message: "Failed to update customer: " + err.Error(),
-		}
-		ctx.JSON(http.StatusInternalServerError, response)
+		_ = ctx.Error(fmt.Errorf("failed to update customer: %w", err))
 		return
 	}
 
 	response := Response{
 		Code:    http.StatusOK,
 		Message: "Update successful",
-		Data:    updated_customer,
+		Data:    toCustomerDTO(updated_customer),
 	}
 	ctx.JSON(http.StatusOK, response)
 }
 
 // todo: repo对应的功能还没写
-func SaleListCustomers(ctx *gin.Context) {
-	var listForm ListCustomersForm
-	if err := ctx.ShouldBind(&listForm); err != nil {
-		response := Response{
-			Code:    http.StatusBadRequest,
-			Message: "Invalid list form",
-		}
-		ctx.JSON(http.StatusBadRequest, response)
-		return
-	}
-
-	customers, err := repository.ListCustomer(
-		database.DB,
-		listForm.UserID,
+func (c *Controller) SaleListCustomers(ctx *gin.Context) {
+	customers, err := c.repos.Customers.ListCustomer(
+		ctx,
+		currentClaims(ctx).UserID,
 	)
 	if err != nil {
-		response := Response{
-			Code:    http.StatusInternalServerError,
-			Message: "Failed to list customers: " + err.Error(),
-		}
-		ctx.JSON(http.StatusInternalServerError, response)
+		_ = ctx.Error(fmt.Errorf("failed to list customers: %w", err))
 		return
 	}
 
 	response := Response{
 		Code:    http.StatusOK,
 		Message: "List successful",
-		Data:    customers,
+		Data:    toCustomerDTOs(*customers),
 	}
 	ctx.JSON(http.StatusOK, response)
 
 }
 
-func SaleMigrateCustomer(ctx *gin.Context) {
+func (c *Controller) SaleMigrateCustomer(ctx *gin.Context) {
 	var migrateForm MigrateCustomerForm
 	if err := ctx.ShouldBind(&migrateForm); err != nil {
-		response := Response{
-			Code:    http.StatusBadRequest,
-			Message: "Invalid migrate form",
-		}
-		ctx.JSON(http.StatusBadRequest, response)
+		_ = ctx.Error(invalidParams(err))
 		return
 	}
 
 	// 根据user身份和migrateForm中的customerID进行迁移操作
-	migrated_customer, err := repository.MigrateCustomer(
-		database.DB,
-		migrateForm.UserID,
+	migrated_customer, err := c.repos.Customers.MigrateCustomer(
+		ctx,
+		currentClaims(ctx).UserID,
 		migrateForm.NewSalerID,
 		migrateForm.CustomerID,
 	)
 	if err != nil {
-		response := Response{
-			Code:    http.StatusInternalServerError,
-			Message: "Failed to migrate customer: " + err.Error(),
-		}
-		ctx.JSON(http.StatusInternalServerError, response)
+		_ = ctx.Error(fmt.Errorf("failed to migrate customer: %w", err))
 		return
 	}
 
 	response := Response{
 		Code:    http.StatusOK,
 		Message: "Migrate successful",
-		Data:    migrated_customer,
+		Data:    toCustomerDTO(migrated_customer),
 	}
 	ctx.JSON(http.StatusOK, response)
 }
 
-func SaleGetPublicSeaCustomerList(ctx *gin.Context) {
-	var getForm GetPublicSeaCustomerListForm
-	if err := ctx.ShouldBind(&getForm); err != nil {
-		response := Response{
-			Code:    http.StatusBadRequest,
-			Message: "Invalid get form",
-		}
-		ctx.JSON(http.StatusBadRequest, response)
-		return
-	}
-
-	customers, err := repository.GetPublicSeaCustomerList(
-		database.DB,
-		getForm.UserID,
+func (c *Controller) SaleGetPublicSeaCustomerList(ctx *gin.Context) {
+	customers, err := c.repos.Customers.GetPublicSeaCustomerList(
+		ctx,
+		currentClaims(ctx).UserID,
 	)
 	if err != nil {
-		response := Response{
-			Code:    http.StatusInternalServerError,
-			Message: "Failed to get public sea customer list: " + err.Error(),
-		}
-		ctx.JSON(http.StatusInternalServerError, response)
+		_ = ctx.Error(fmt.Errorf("failed to get public sea customer list: %w", err))
 		return
 	}
 
 	response := Response{
 		Code:    http.StatusOK,
 		Message: "Get public sea customer list successful",
-		Data:    customers,
+		Data:    toCustomerDTOs(customers),
 	}
 	ctx.JSON(http.StatusOK, response)
 }
 
 // 该控制器用于记录一日的工作情况
-func SaleCreateWorkLog(ctx *gin.Context) {
+func (c *Controller) SaleCreateWorkLog(ctx *gin.Context) {
 	var createForm CreateWorkLogForm
 	if err := ctx.ShouldBind(&createForm); err != nil {
-		response := Response{
-			Code:    http.StatusBadRequest,
-			Message: "Invalid create form",
-		}
-		ctx.JSON(http.StatusBadRequest, response)
+		_ = ctx.Error(invalidParams(err))
 		return
 	}
 
-	workLog, err := repository.CreateWorkLog(
-		database.DB,
-		createForm.UserID,
+	workLog, err := c.repos.WorkLogs.CreateWorkLog(
+		ctx,
+		currentClaims(ctx).UserID,
 		createForm.Calls,
 		createForm.ValidCalls,
 		createForm.Visits,
@@ -750,38 +587,30 @@ func SaleCreateWorkLog(ctx *gin.Context) {
 		createForm.Date,
 	)
 	if err != nil {
-		response := Response{
-			Code:    http.StatusInternalServerError,
-			Message: "Failed to create work log: " + err.Error(),
-		}
-		ctx.JSON(http.StatusInternalServerError, response)
+		_ = ctx.Error(fmt.Errorf("failed to create work log: %w", err))
 		return
 	}
 
 	response := Response{
 		Code:    http.StatusOK,
 		Message: "Create work log successful",
-		Data:    workLog,
+		Data:    toWorkLogDTO(workLog),
 	}
 	ctx.JSON(http.StatusOK, response)
 }
 
-func SaleSubmitContract(ctx *gin.Context) {
-    var submitForm SubmitContractForm
-    if err := ctx.ShouldBind(&submitForm); err != nil {
-        response := Response{
-            Code:    http.StatusBadRequest,
-            Message: "Invalid submit form",
-        }
-        ctx.JSON(http.StatusBadRequest, response)
-        return
-    }
-
-    contract, err := repository.SubmitContract(
-        database.DB,
-        submitForm.UserID,
-        submitForm.CustomerID,
-        submitForm.FinanceID,
+func (c *Controller) SaleSubmitContract(ctx *gin.Context) {
+	var submitForm SubmitContractForm
+	if err := ctx.ShouldBind(&submitForm); err != nil {
+		_ = ctx.Error(invalidParams(err))
+		return
+	}
+
+	contract, err := c.repos.Contracts.SubmitContract(
+		ctx,
+		currentClaims(ctx).UserID,
+		submitForm.CustomerID,
+		submitForm.FinanceID,
 		submitForm.AccountantID,
 		submitForm.Amount,
 		submitForm.ServiceFee,
@@ -789,409 +618,344 @@ func SaleSubmitContract(ctx *gin.Context) {
 		submitForm.FinancialProduct,
 		submitForm.ContractDocument,
 		submitForm.BankDocuments,
-    )
+	)
 	if err != nil {
-	    response := Response{
-	        Code:    http.StatusInternalServerError,
-	        Message: "Failed to submit contract: " + err.Error(),
-	    }
-	    ctx.JSON(http.StatusInternalServerError, response)
-	    return
+		_ = ctx.Error(fmt.Errorf("failed to submit contract: %w", err))
+		return
 	}
 
 	response := Response{
-	    Code:    http.StatusOK,
-	    Message: "Submit contract successful",
-	    Data:    contract,
+		Code:    http.StatusOK,
+		Message: "Submit contract successful",
+		Data:    toContractDTO(contract),
 	}
 	ctx.JSON(http.StatusOK, response)
 }
 
-func FinanaceUpdateContractStatus(ctx *gin.Context) {
+func (c *Controller) FinanaceUpdateContractStatus(ctx *gin.Context) {
 	var updateForm UpdateContractStatusForm
 	if err := ctx.ShouldBind(&updateForm); err != nil {
-	    response := Response{
-	        Code:    http.StatusBadRequest,
-	        Message: "Invalid update form",
-	    }
-	    ctx.JSON(http.StatusBadRequest, response)
-	    return
+		_ = ctx.Error(invalidParams(err))
+		return
 	}
 
-	contract, err := repository.UpdateContractStatus(
-		database.DB,
-		updateForm.UserID,
+	contract, err := c.repos.Contracts.UpdateContractStatus(
+		ctx,
+		currentClaims(ctx).UserID,
 		updateForm.ContractID,
 		models.ContractStatusStrToEnumMap[updateForm.Status],
 	)
 	if err != nil {
-	    response := Response{
-	        Code:    http.StatusInternalServerError,
-	        Message: "Failed to update contract status: " + err.Error(),
-
-	    }
-		ctx.JSON(http.StatusInternalServerError, response)
+		_ = ctx.Error(fmt.Errorf("failed to update contract status: %w", err))
 		return
 	}
 
 	response := Response{
 		Code:    http.StatusOK,
 		Message: "Update contract status successful",
-		Data:    contract,
+		Data:    toContractDTO(contract),
 	}
 	ctx.JSON(http.StatusOK, response)
 }
 
-
-func FinanaceUpdateContractAmount(ctx *gin.Context) {
-    var updateForm UpdateContractAmountForm
-    if err := ctx.ShouldBind(&updateForm); err != nil {
-        response := Response{
-            Code:    http.StatusBadRequest,
-            Message: "Invalid update form",
-        }
-        ctx.JSON(http.StatusBadRequest, response)
+func (c *Controller) FinanaceUpdateContractAmount(ctx *gin.Context) {
+	var updateForm UpdateContractAmountForm
+	if err := ctx.ShouldBind(&updateForm); err != nil {
+		_ = ctx.Error(invalidParams(err))
 		return
+	}
 
-    }
-
-	contract, err := repository.UpdateContractAmount(
-	    database.DB,
-		updateForm.UserID,
+	contract, err := c.repos.Contracts.UpdateContractAmount(
+		ctx,
+		currentClaims(ctx).UserID,
 		updateForm.ContractID,
 		updateForm.Amount,
 		updateForm.ServiceFee,
 		updateForm.BankAmount,
+		config.Get().Finance.Tolerance(),
+		updateForm.Reason,
 	)
 	if err != nil {
-	    response := Response{
-	        Code:    http.StatusInternalServerError,
-	        Message: "Failed to update contract amount: " + err.Error(),
-	    }
-	    ctx.JSON(http.StatusInternalServerError, response)
-	    return
+		_ = ctx.Error(fmt.Errorf("failed to update contract amount: %w", err))
+		return
 	}
 
 	response := Response{
-	    Code:    http.StatusOK,
-	    Message: "Update contract amount successful",
-	    Data:    contract,
+		Code:    http.StatusOK,
+		Message: "Update contract amount successful",
+		Data:    toContractDTO(contract),
 	}
 
 	ctx.JSON(http.StatusOK, response)
 }
 
-func GetContractList(ctx *gin.Context) {
-	var getForm GetContractListForm
-	if err := ctx.ShouldBind(&getForm); err != nil {
-		response := Response{
-			Code:    http.StatusBadRequest,
-			Message: "Invalid get form",
-		}
-		ctx.JSON(http.StatusBadRequest, response)
-		return
-	}
-
-	contracts, err := repository.GetContractListByUser(
-		database.DB,
-		getForm.UserID,
+func (c *Controller) GetContractList(ctx *gin.Context) {
+	contracts, err := c.repos.Contracts.GetContractListByUser(
+		ctx,
+		currentClaims(ctx).UserID,
 	)
 	if err != nil {
-	    response := Response{
-	        Code:    http.StatusInternalServerError,
-	        Message: "Failed to get contract list: " + err.Error(),
-	    }
-	    ctx.JSON(http.StatusInternalServerError, response)
-	    return
+		_ = ctx.Error(fmt.Errorf("failed to get contract list: %w", err))
+		return
 	}
 
 	response := Response{
-	    Code:    http.StatusOK,
-	    Message: "Get contract list successful",
-	    Data:    contracts,
+		Code:    http.StatusOK,
+		Message: "Get contract list successful",
+		Data:    toContractDTOs(*contracts),
 	}
 	ctx.JSON(http.StatusOK, response)
 }
 
-func GetContractDetail(ctx *gin.Context) {
-    var getForm GetContractDetailForm
-    if err := ctx.ShouldBind(&getForm); err != nil {
-        response := Response{
-            Code:    http.StatusBadRequest,
-            Message: "Invalid get form",
-        }
-        ctx.JSON(http.StatusBadRequest, response)
-        return
-    }
-
-    contract, err := repository.GetContract(
-        database.DB,
-        getForm.UserID,
-        getForm.ContractID,
-    )
-    if err != nil {
-        response := Response{
-            Code:    http.StatusInternalServerError,
-            Message: "Failed to get contract detail: " + err.Error(),
-        }
-        ctx.JSON(http.StatusInternalServerError, response)
-        return
-    }
+func (c *Controller) GetContractDetail(ctx *gin.Context) {
+	var getForm GetContractDetailForm
+	if err := ctx.ShouldBind(&getForm); err != nil {
+		_ = ctx.Error(invalidParams(err))
+		return
+	}
+
+	contract, err := c.repos.Contracts.GetContract(
+		ctx,
+		currentClaims(ctx).UserID,
+		getForm.ContractID,
+	)
+	if err != nil {
+		_ = ctx.Error(fmt.Errorf("failed to get contract detail: %w", err))
+		return
+	}
 
 	response := Response{
-	    Code:    http.StatusOK,
-	    Message: "Get contract detail successful",
-	    Data:    contract,
+		Code:    http.StatusOK,
+		Message: "Get contract detail successful",
+		Data:    toContractDTO(&contract),
 	}
 	ctx.JSON(http.StatusOK, response)
 }
 
 // GetSalerPerformance 获取销售人员的业绩
-func GetSalerPerformance(ctx *gin.Context) {
-    var getForm GetSalerPerformanceForm
-    if err := ctx.ShouldBind(&getForm); err != nil {
-        response := Response{
-            Code:    http.StatusBadRequest,
-            Message: "Invalid get form",
-        }
-        ctx.JSON(http.StatusBadRequest, response)
-        return
-    }
-
-    performance, err := repository.GetSalerPerformance(
-        database.DB,
-        getForm.UserID,
+func (c *Controller) GetSalerPerformance(ctx *gin.Context) {
+	var getForm GetSalerPerformanceForm
+	if err := ctx.ShouldBind(&getForm); err != nil {
+		_ = ctx.Error(invalidParams(err))
+		return
+	}
+
+	performance, err := c.repos.Stats.GetSalerPerformance(
+		ctx,
+		getForm.UserID,
 		getForm.SalerID,
-        getForm.StartDate,
-        getForm.EndDate,
-    )
+		getForm.StartDate,
+		getForm.EndDate,
+	)
 	if err != nil {
-	    response := Response{
-	        Code:    http.StatusInternalServerError,
-	        Message: "Failed to get saler performance: " + err.Error(),
-	    }
-	    ctx.JSON(http.StatusInternalServerError, response)
-	    return
+		_ = ctx.Error(fmt.Errorf("failed to get saler performance: %w", err))
+		return
 	}
 
 	response := Response{
-	    Code:    http.StatusOK,
-	    Message: "Get saler performance successful",
-	    Data:    performance,
+		Code:    http.StatusOK,
+		Message: "Get saler performance successful",
+		Data:    performance,
 	}
 	ctx.JSON(http.StatusOK, response)
 }
 
 // GetDepartmentPerformance 获取部门业绩
-func GetDepartmentPerformance(ctx *gin.Context) {
-    var getForm GetDepartmentPerformanceForm
-    if err := ctx.ShouldBind(&getForm); err != nil {
-        response := Response{
-            Code:    http.StatusBadRequest,
-            Message: "Invalid get form",
-        }
-		ctx.JSON(http.StatusBadRequest, response)
-		return
-    }
-    performance, err := repository.GetDepartmentPerformance(
-	    database.DB,
+func (c *Controller) GetDepartmentPerformance(ctx *gin.Context) {
+	var getForm GetDepartmentPerformanceForm
+	if err := ctx.ShouldBind(&getForm); err != nil {
+		_ = ctx.Error(invalidParams(err))
+		return
+	}
+	performance, err := c.repos.Stats.GetDepartmentPerformance(
+		ctx,
 		getForm.UserID,
 		getForm.DepartmentID,
 		getForm.StartDate,
 		getForm.EndDate,
-
 	)
 	if err != nil {
-		response := Response{
-		    Code:    http.StatusInternalServerError,
-		    Message: "Failed to get department performance: " + err.Error(),
-		}
-		ctx.JSON(http.StatusInternalServerError, response)
+		_ = ctx.Error(fmt.Errorf("failed to get department performance: %w", err))
 		return
 	}
 	response := Response{
-	    Code:    http.StatusOK,
-	    Message: "Get department performance successful",
-	    Data:    performance,
+		Code:    http.StatusOK,
+		Message: "Get department performance successful",
+		Data:    performance,
 	}
 	ctx.JSON(http.StatusOK, response)
 }
 
 // GetZonePerformance 获取战区业绩
-func GetZonePerformance(ctx *gin.Context) {
-    var getForm GetZonePerformanceForm
-    if err := ctx.ShouldBind(&getForm); err != nil {
-        response := Response{
-            Code:    http.StatusBadRequest,
-            Message: "Invalid get form",
-        }
-		ctx.JSON(http.StatusBadRequest, response)
+func (c *Controller) GetZonePerformance(ctx *gin.Context) {
+	var getForm GetZonePerformanceForm
+	if err := ctx.ShouldBind(&getForm); err != nil {
+		_ = ctx.Error(invalidParams(err))
 		return
+	}
 
-    }
-
-    performance, err := repository.GetZonePerformance(
-	    database.DB,
+	performance, err := c.repos.Stats.GetZonePerformance(
+		ctx,
 		getForm.UserID,
 		getForm.ZoneID,
 		getForm.StartDate,
 		getForm.EndDate,
 	)
 	if err != nil {
-	    response := Response{
-	        Code:    http.StatusInternalServerError,
-	        Message: "Failed to get zone performance: " + err.Error(),
-	    }
-	    ctx.JSON(http.StatusInternalServerError, response)
-	    return
+		_ = ctx.Error(fmt.Errorf("failed to get zone performance: %w", err))
+		return
 	}
 
 	response := Response{
-	    Code:    http.StatusOK,
-	    Message: "Get zone performance successful",
-	    Data:    performance,
+		Code:    http.StatusOK,
+		Message: "Get zone performance successful",
+		Data:    performance,
 	}
 	ctx.JSON(http.StatusOK, response)
 }
 
-func LoanAnalysis(ctx *gin.Context) {
-    var getForm GetLoanAnalysisForm
-    if err := ctx.ShouldBind(&getForm); err != nil {
-        response := Response{
-            Code:    http.StatusBadRequest,
-            Message: "Invalid get form",
-        }
-		ctx.JSON(http.StatusBadRequest, response)
+func (c *Controller) LoanAnalysis(ctx *gin.Context) {
+	var getForm GetLoanAnalysisForm
+	if err := ctx.ShouldBind(&getForm); err != nil {
+		_ = ctx.Error(invalidParams(err))
 		return
 	}
 
-	totalAmount, count, averageAmount, err := repository.LoanAnalysis(
-	    database.DB,
+	totalAmount, count, averageAmount, err := c.repos.Stats.LoanAnalysis(
+		ctx,
 		getForm.UserID,
 	)
 	if err != nil {
-	    response := Response{
-	        Code:    http.StatusInternalServerError,
-	        Message: "Failed to get loan analysis: " + err.Error(),
-	    }
-	    ctx.JSON(http.StatusInternalServerError, response)
-	    return
+		_ = ctx.Error(fmt.Errorf("failed to get loan analysis: %w", err))
+		return
 	}
 
 	response := Response{
-	    Code:    http.StatusOK,
-	    Message: "Get loan analysis successful",
-	    Data: gin.H{
-	        "total_amount": totalAmount,
-	        "count":         count,
-	        "average_amount": averageAmount,
-	    },
+		Code:    http.StatusOK,
+		Message: "Get loan analysis successful",
+		Data: gin.H{
+			"total_amount":   totalAmount,
+			"count":          count,
+			"average_amount": averageAmount,
+		},
 	}
 	ctx.JSON(http.StatusOK, response)
 }
 
-func GetZones(ctx *gin.Context) {
-	zones, err := repository.GetZones(
-	    database.DB,
+func (c *Controller) GetZones(ctx *gin.Context) {
+	inc, err := parseIncludes(ctx, "departments")
+	if err != nil {
+		_ = ctx.Error(err)
+		return
+	}
+	zones, err := c.repos.Org.GetZones(
+		ctx,
+		inc["departments"],
 	)
 	if err != nil {
-	    response := Response{
-	        Code:    http.StatusInternalServerError,
-	        Message: "Failed to get zones: " + err.Error(),
-	    }
-	    ctx.JSON(http.StatusInternalServerError, response)
-	    return
+		_ = ctx.Error(fmt.Errorf("failed to get zones: %w", err))
+		return
 	}
 
 	response := Response{
-	    Code:    http.StatusOK,
-	    Message: "Get zones successful",
-	    Data:    zones,
+		Code:    http.StatusOK,
+		Message: "Get zones successful",
+		Data:    toZoneDTOs(zones, inc),
 	}
 	ctx.JSON(http.StatusOK, response)
 }
 
-func GetZoneByID(ctx *gin.Context) {
+func (c *Controller) GetZoneByID(ctx *gin.Context) {
 	var getForm GetZoneByIDForm
 	if err := ctx.ShouldBind(&getForm); err != nil {
-	    response := Response{
-	        Code:    http.StatusBadRequest,
-	        Message: "Invalid get form",
-	    }
-		ctx.JSON(http.StatusBadRequest, response)
+		_ = ctx.Error(invalidParams(err))
+		return
+	}
+	inc, err := parseIncludes(ctx, "departments")
+	if err != nil {
+		_ = ctx.Error(err)
 		return
 	}
 
-	zone, err := repository.GetZoneByID(
-	    database.DB,
+	zone, err := c.repos.Org.GetZoneByID(
+		ctx,
 		getForm.ZoneID,
+		inc["departments"],
 	)
 	if err != nil {
-	    response := Response{
-	        Code:    http.StatusInternalServerError,
-	        Message: "Failed to get zone: " + err.Error(),
-	    }
-		ctx.JSON(http.StatusOK, response)
-		return 
+		_ = ctx.Error(fmt.Errorf("failed to get zone: %w", err))
+		return
 	}
 
 	response := Response{
-	    Code:    http.StatusOK,
-	    Message: "Get zone successful",
-	    Data:    zone,
+		Code:    http.StatusOK,
+		Message: "Get zone successful",
+		Data:    toZoneDTO(&zone, inc),
 	}
 	ctx.JSON(http.StatusOK, response)
 }
 
-func GetDepartments(ctx *gin.Context) {
-	departments, err := repository.GetDepartments(
-	    database.DB,
+func (c *Controller) GetDepartments(ctx *gin.Context) {
+	inc, err := parseIncludes(ctx, "users")
+	if err != nil {
+		_ = ctx.Error(err)
+		return
+	}
+	departments, err := c.repos.Org.GetDepartments(
+		ctx,
+		inc["users"],
 	)
 	if err != nil {
-	    response := Response{
-	        Code:    http.StatusInternalServerError,
-	        Message: "Failed to get departments: " + err.Error(),
-	    }
-		ctx.JSON(http.StatusOK, response)
+		_ = ctx.Error(fmt.Errorf("failed to get departments: %w", err))
 		return
 	}
 
 	response := Response{
-	    Code:    http.StatusOK,
-	    Message: "Get departments successful",
-	    Data:    departments,
+		Code:    http.StatusOK,
+		Message: "Get departments successful",
+		Data:    toDepartmentDTOs(departments, inc),
 	}
 	ctx.JSON(http.StatusOK, response)
 }
 
-func GetDepartmentByID(ctx *gin.Context) {
-    var getForm GetDepartmentByIDForm
+func (c *Controller) GetDepartmentByID(ctx *gin.Context) {
+	var getForm GetDepartmentByIDForm
 	if err := ctx.ShouldBind(&getForm); err != nil {
-	    response := Response{
-	        Code:    http.StatusBadRequest,
-	        Message: "Invalid get form",
-	    }
-		ctx.JSON(http.StatusBadRequest, response)
+		_ = ctx.Error(invalidParams(err))
+		return
+	}
+	inc, err := parseIncludes(ctx, "users")
+	if err != nil {
+		_ = ctx.Error(err)
 		return
 	}
 
-	department, err := repository.GetDepartmentByID(
-	    database.DB,
+	department, err := c.repos.Org.GetDepartmentByID(
+		ctx,
 		getForm.DepartmentID,
+		inc["users"],
 	)
 	if err != nil {
-	    response := Response{
-	        Code:    http.StatusInternalServerError,
-	        Message: "Failed to get department: " + err.Error(),
-	    }
-		ctx.JSON(http.StatusOK, response)
+		_ = ctx.Error(fmt.Errorf("failed to get department: %w", err))
 		return
 	}
 
 	response := Response{
-	    Code:    http.StatusOK,
-	    Message: "Get department successful",
-	    Data:    department,
+		Code:    http.StatusOK,
+		Message: "Get department successful",
+		Data:    toDepartmentDTO(&department, inc),
 	}
 	ctx.JSON(http.StatusOK, response)
-}
\ No newline at end of file
+}
+
+// userDTO 转换为响应，include=profile 且用户的个人信息没有查询出来时重新查询
+func (c *Controller) userDTO(ctx *gin.Context, user *models.User, inc includes) (UserDTO, error) {
+	if inc["profile"] && user.UserProfile.UserID == 0 {
+		withProfile, err := c.repos.Users.GetUserByID(ctx, user.ID)
+		if err != nil {
+			return UserDTO{}, fmt.Errorf("failed to get user profile: %w", err)
+		}
+		user = withProfile
+	}
+	return toUserDTO(user, inc), nil
+}
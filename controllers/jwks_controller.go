@@ -0,0 +1,20 @@
+package controllers
+
+import (
+	"gin-boilerplate/infra/jwtkeys"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// JWKS 验证令牌签名的公钥（RFC 7517），其他服务可以据此验证本服务签发的令牌
+// 按 JWKS 的格式直接返回，不使用 Response 包装；使用共享密钥（HS256 等）时返回空列表
+func JWKS(ctx *gin.Context) {
+	keyring, err := jwtkeys.Current()
+	if err != nil {
+		_ = ctx.Error(err)
+		return
+	}
+	ctx.Header("Cache-Control", "public, max-age=300")
+	ctx.JSON(http.StatusOK, keyring.JWKS())
+}
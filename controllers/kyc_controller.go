@@ -0,0 +1,119 @@
+package controllers
+
+import (
+	"fmt"
+	"gin-boilerplate/models"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SaleUpdateCustomerKYC 客户的销售人员填写KYC资料，修改后需要金融专员/经理重新审核
+func (c *Controller) SaleUpdateCustomerKYC(ctx *gin.Context) {
+	var updateForm UpdateCustomerKYCForm
+	if err := ctx.ShouldBind(&updateForm); err != nil {
+		_ = ctx.Error(invalidParams(err))
+		return
+	}
+
+	profile, err := c.repos.Customers.UpdateCustomerKYC(
+		ctx,
+		currentClaims(ctx).UserID,
+		updateForm.CustomerID,
+		models.NationalID(strings.ToUpper(updateForm.NationalID)),
+		updateForm.Occupation,
+		updateForm.MonthlyIncome,
+		updateForm.Assets,
+		updateForm.ExistingDebts,
+		models.MaritalStatusStrToEnumMap[updateForm.MaritalStatus],
+	)
+	if err != nil {
+		_ = ctx.Error(fmt.Errorf("failed to update customer kyc: %w", err))
+		return
+	}
+
+	response := Response{
+		Code:    http.StatusOK,
+		Message: "Update customer KYC successful",
+		Data:    toKYCProfileDTO(profile),
+	}
+	ctx.JSON(http.StatusOK, response)
+}
+
+func (c *Controller) SaleAddKYCDocument(ctx *gin.Context) {
+	var addForm AddKYCDocumentForm
+	if err := ctx.ShouldBind(&addForm); err != nil {
+		_ = ctx.Error(invalidParams(err))
+		return
+	}
+
+	profile, err := c.repos.Customers.AddKYCDocument(
+		ctx,
+		currentClaims(ctx).UserID,
+		addForm.CustomerID,
+		addForm.Kind,
+		addForm.File,
+	)
+	if err != nil {
+		_ = ctx.Error(fmt.Errorf("failed to add kyc document: %w", err))
+		return
+	}
+
+	response := Response{
+		Code:    http.StatusOK,
+		Message: "Add KYC document successful",
+		Data:    toKYCProfileDTO(profile),
+	}
+	ctx.JSON(http.StatusOK, response)
+}
+
+// FinanceReviewCustomerKYC 金融专员/经理认证或拒绝客户的KYC资料，合同批准前必须已认证
+func (c *Controller) FinanceReviewCustomerKYC(ctx *gin.Context) {
+	var reviewForm ReviewCustomerKYCForm
+	if err := ctx.ShouldBind(&reviewForm); err != nil {
+		_ = ctx.Error(invalidParams(err))
+		return
+	}
+
+	profile, err := c.repos.Customers.ReviewCustomerKYC(
+		ctx,
+		currentClaims(ctx).UserID,
+		reviewForm.CustomerID,
+		models.KYCStatusStrToEnumMap[reviewForm.Status],
+		reviewForm.Note,
+	)
+	if err != nil {
+		_ = ctx.Error(fmt.Errorf("failed to review customer kyc: %w", err))
+		return
+	}
+
+	response := Response{
+		Code:    http.StatusOK,
+		Message: "Review customer KYC successful",
+		Data:    toKYCProfileDTO(profile),
+	}
+	ctx.JSON(http.StatusOK, response)
+}
+
+// GetCustomerKYC 查看客户的KYC资料，身份证号码脱敏显示
+func (c *Controller) GetCustomerKYC(ctx *gin.Context) {
+	var getForm GetCustomerKYCForm
+	if err := ctx.ShouldBind(&getForm); err != nil {
+		_ = ctx.Error(invalidParams(err))
+		return
+	}
+
+	profile, err := c.repos.Customers.GetCustomerKYC(ctx, currentClaims(ctx).UserID, getForm.CustomerID)
+	if err != nil {
+		_ = ctx.Error(fmt.Errorf("failed to get customer kyc: %w", err))
+		return
+	}
+
+	response := Response{
+		Code:    http.StatusOK,
+		Message: "Get customer KYC successful",
+		Data:    toKYCProfileDTO(profile),
+	}
+	ctx.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,147 @@
+package controllers
+
+import (
+	"fmt"
+	"gin-boilerplate/models"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// FinanceCreateFinancialProduct 金融经理创建金融产品，放款时按产品的期限、利率和还款方式生成还款计划
+func (c *Controller) FinanceCreateFinancialProduct(ctx *gin.Context) {
+	var createForm CreateFinancialProductForm
+	if err := ctx.ShouldBind(&createForm); err != nil {
+		_ = ctx.Error(invalidParams(err))
+		return
+	}
+
+	product, err := c.repos.Loans.CreateFinancialProduct(
+		ctx,
+		currentClaims(ctx).UserID,
+		createForm.Name,
+		createForm.TermMonths,
+		createForm.AnnualRate,
+		models.RepaymentMethodStrToEnumMap[createForm.RepaymentMethod],
+	)
+	if err != nil {
+		_ = ctx.Error(fmt.Errorf("failed to create financial product: %w", err))
+		return
+	}
+
+	response := Response{
+		Code:    http.StatusOK,
+		Message: "Create financial product successful",
+		Data:    toFinancialProductDTO(product),
+	}
+	ctx.JSON(http.StatusOK, response)
+}
+
+func (c *Controller) GetFinancialProducts(ctx *gin.Context) {
+	products, err := c.repos.Loans.GetFinancialProducts(ctx)
+	if err != nil {
+		_ = ctx.Error(fmt.Errorf("failed to get financial products: %w", err))
+		return
+	}
+
+	response := Response{
+		Code:    http.StatusOK,
+		Message: "Get financial products successful",
+		Data:    toFinancialProductDTOs(products),
+	}
+	ctx.JSON(http.StatusOK, response)
+}
+
+// FinanceRecordDisbursement 录入已批准合同的放款信息，返回放款记录和生成的还款计划
+func (c *Controller) FinanceRecordDisbursement(ctx *gin.Context) {
+	var recordForm RecordDisbursementForm
+	if err := ctx.ShouldBind(&recordForm); err != nil {
+		_ = ctx.Error(invalidParams(err))
+		return
+	}
+
+	disbursement, installments, err := c.repos.Loans.RecordDisbursement(
+		ctx,
+		currentClaims(ctx).UserID,
+		recordForm.ContractID,
+		recordForm.Bank,
+		recordForm.Amount,
+		recordForm.DisbursedAt,
+	)
+	if err != nil {
+		_ = ctx.Error(fmt.Errorf("failed to record disbursement: %w", err))
+		return
+	}
+
+	response := Response{
+		Code:    http.StatusOK,
+		Message: "Record disbursement successful",
+		Data:    repaymentSchedule(disbursement, installments),
+	}
+	ctx.JSON(http.StatusOK, response)
+}
+
+// FinanceRecordRepayment 录入一笔还款，返回还款记录和更新后的还款计划
+func (c *Controller) FinanceRecordRepayment(ctx *gin.Context) {
+	var recordForm RecordRepaymentForm
+	if err := ctx.ShouldBind(&recordForm); err != nil {
+		_ = ctx.Error(invalidParams(err))
+		return
+	}
+
+	repayment, installments, err := c.repos.Loans.RecordRepayment(
+		ctx,
+		currentClaims(ctx).UserID,
+		recordForm.ContractID,
+		recordForm.Amount,
+		recordForm.PaidAt,
+	)
+	if err != nil {
+		_ = ctx.Error(fmt.Errorf("failed to record repayment: %w", err))
+		return
+	}
+
+	response := Response{
+		Code:    http.StatusOK,
+		Message: "Record repayment successful",
+		Data: gin.H{
+			"repayment":    toRepaymentDTO(repayment),
+			"installments": toRepaymentInstallmentDTOs(installments),
+		},
+	}
+	ctx.JSON(http.StatusOK, response)
+}
+
+func (c *Controller) GetRepaymentSchedule(ctx *gin.Context) {
+	var getForm GetRepaymentScheduleForm
+	if err := ctx.ShouldBind(&getForm); err != nil {
+		_ = ctx.Error(invalidParams(err))
+		return
+	}
+
+	disbursement, installments, err := c.repos.Loans.GetRepaymentSchedule(
+		ctx,
+		currentClaims(ctx).UserID,
+		getForm.ContractID,
+	)
+	if err != nil {
+		_ = ctx.Error(fmt.Errorf("failed to get repayment schedule: %w", err))
+		return
+	}
+
+	response := Response{
+		Code:    http.StatusOK,
+		Message: "Get repayment schedule successful",
+		Data:    repaymentSchedule(disbursement, installments),
+	}
+	ctx.JSON(http.StatusOK, response)
+}
+
+// repaymentSchedule 放款信息和还款计划，shortfall 为合同银行金额与实际放款金额之差
+func repaymentSchedule(disbursement *models.Disbursement, installments []models.RepaymentInstallment) gin.H {
+	return gin.H{
+		"disbursement": toDisbursementDTO(disbursement),
+		"shortfall":    disbursement.ExpectedAmount.Sub(disbursement.Amount),
+		"installments": toRepaymentInstallmentDTOs(installments),
+	}
+}
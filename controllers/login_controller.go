@@ -0,0 +1,158 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"gin-boilerplate/config"
+	"gin-boilerplate/helpers"
+	"gin-boilerplate/infra/apperror"
+	"gin-boilerplate/infra/logger"
+	"gin-boilerplate/models"
+	"gin-boilerplate/repository"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// loginPolicy 按用户名的登录保护策略
+func loginPolicy() repository.LoginPolicy {
+	login := config.Get().Login
+	return repository.LoginPolicy{
+		DelayAfter:      login.DelayAfter,
+		DelayBase:       login.DelayBase,
+		DelayMax:        login.DelayMax,
+		LockoutAfter:    login.LockoutAfter,
+		LockoutDuration: login.LockoutDuration,
+	}
+}
+
+func ipLoginFailuresKey(ctx *gin.Context) string {
+	return "login-failures:" + ctx.ClientIP()
+}
+
+// checkIPLoginFailures 同一客户端IP在时间窗口内登录失败次数达到上限时拒绝登录
+// 计数存储不可用时放行，按用户名的锁定仍然有效
+func (c *Controller) checkIPLoginFailures(ctx *gin.Context) error {
+	failures, ttl, err := c.limits.Get(ctx, ipLoginFailuresKey(ctx))
+	if err != nil {
+		logger.FromContext(ctx).Warnf("rate limit store unavailable: %s", err)
+		return nil
+	}
+	if failures >= config.Get().Login.IPMaxFailures {
+		return apperror.New(apperror.CodeLoginThrottled).WithRetryAfter(ttl)
+	}
+	return nil
+}
+
+// recordIPLoginFailure 用户名或密码错误、两步验证码错误、账户锁定和重试过快都计入客户端IP的失败次数
+func (c *Controller) recordIPLoginFailure(ctx *gin.Context, loginErr error) {
+	var appErr *apperror.Error
+	if !errors.As(loginErr, &appErr) {
+		return
+	}
+	switch appErr.Code {
+	case apperror.CodeInvalidCredentials, apperror.CodeInvalidTOTPCode, apperror.CodeLoginThrottled, apperror.CodeAccountLocked:
+		if _, _, err := c.limits.Incr(ctx, ipLoginFailuresKey(ctx), config.Get().Login.IPWindow); err != nil {
+			logger.FromContext(ctx).Warnf("rate limit store unavailable: %s", err)
+		}
+	}
+}
+
+// tokenData 登录成功后返回的用户和令牌，创建新的会话并记录登录，method 为登录方式
+// 角色必须使用两步验证但还没有绑定时，令牌只能用于绑定两步验证
+func (c *Controller) tokenData(ctx *gin.Context, user *models.User, userDTO UserDTO, method string) (map[string]interface{}, error) {
+	session, err := newTokenSession()
+	if err != nil {
+		return nil, err
+	}
+	if session.SessionID, err = helpers.NewTokenID(); err != nil {
+		return nil, fmt.Errorf("failed to generate session id: %w", err)
+	}
+	_, err = c.repos.Sessions.CreateSession(ctx, repository.NewSession{
+		UserID:    user.ID,
+		Family:    session.SessionID,
+		RefreshID: session.RefreshID,
+		Method:    method,
+		IP:        ctx.ClientIP(),
+		UserAgent: truncate(ctx.Request.UserAgent(), maxUserAgentLength),
+		ExpiresAt: time.Now().Add(helpers.RefreshTokenLifetime()),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create session: %w", err)
+	}
+	return signedTokenData(user, userDTO, session)
+}
+
+// reissueTokenData 已登录用户重新签发令牌（修改密码、绑定两步验证）时沿用当前会话，原来的刷新令牌失效
+func (c *Controller) reissueTokenData(ctx *gin.Context, user *models.User, userDTO UserDTO) (map[string]interface{}, error) {
+	session, err := newTokenSession()
+	if err != nil {
+		return nil, err
+	}
+	session.SessionID = currentClaims(ctx).SessionID
+	expiresAt := time.Now().Add(helpers.RefreshTokenLifetime())
+	if err := c.repos.Sessions.RotateRefreshToken(ctx, session.SessionID, session.RefreshID, expiresAt); err != nil {
+		return nil, fmt.Errorf("failed to rotate refresh token: %w", err)
+	}
+	return signedTokenData(user, userDTO, session)
+}
+
+func newTokenSession() (helpers.TokenSession, error) {
+	refreshID, err := helpers.NewTokenID()
+	if err != nil {
+		return helpers.TokenSession{}, fmt.Errorf("failed to generate refresh token id: %w", err)
+	}
+	return helpers.TokenSession{RefreshID: refreshID}, nil
+}
+
+// 会话中保存的 User-Agent 的最大长度（按字符计算）
+const maxUserAgentLength = 512
+
+func truncate(s string, max int) string {
+	if runes := []rune(s); len(runes) > max {
+		return string(runes[:max])
+	}
+	return s
+}
+
+// signedTokenData 签发属于 session 的令牌
+func signedTokenData(user *models.User, userDTO UserDTO, session helpers.TokenSession) (map[string]interface{}, error) {
+	enrollmentRequired := !user.TOTPEnabled && config.Get().TOTP.Required(models.RoleNameMap[user.RoleID])
+	generate := helpers.GenerateToken
+	if enrollmentRequired {
+		generate = helpers.GenerateMFAEnrollmentToken
+	}
+	access_token, refresh_token, err := generate(*user, session)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate jwt token: %w", err)
+	}
+	return map[string]interface{}{
+		"user":                    userDTO,
+		"access_token":            access_token,
+		"refresh_token":           refresh_token,
+		"mfa_enrollment_required": enrollmentRequired,
+	}, nil
+}
+
+// AdministratorUnlockUser 系统管理员解锁因连续密码错误被锁定的账户
+func (c *Controller) AdministratorUnlockUser(ctx *gin.Context) {
+	var unlockForm UnlockUserForm
+	if err := ctx.ShouldBind(&unlockForm); err != nil {
+		_ = ctx.Error(invalidParams(err))
+		return
+	}
+
+	user, err := c.repos.Users.UnlockUser(ctx, currentClaims(ctx).UserID, unlockForm.UserID)
+	if err != nil {
+		_ = ctx.Error(fmt.Errorf("failed to unlock user: %w", err))
+		return
+	}
+
+	response := Response{
+		Code:    http.StatusOK,
+		Message: "Unlock successful",
+		Data:    toUserDTO(user, nil),
+	}
+	ctx.JSON(http.StatusOK, response)
+}
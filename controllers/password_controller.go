@@ -0,0 +1,90 @@
+package controllers
+
+import (
+	"fmt"
+	"gin-boilerplate/config"
+	"gin-boilerplate/helpers"
+	"gin-boilerplate/routers/middleware"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// currentClaims 通过鉴权中间件后令牌中的声明
+func currentClaims(ctx *gin.Context) *helpers.Claims {
+	return ctx.MustGet(middleware.ClaimsKey).(*helpers.Claims)
+}
+
+// UserChangePassword 用户验证当前密码后修改自己的密码，返回新的令牌
+// 使用临时密码登录后只能访问该接口，修改成功后使用新的令牌访问其他接口，其他会话全部失效
+func (c *Controller) UserChangePassword(ctx *gin.Context) {
+	var changeForm ChangePasswordForm
+	if err := ctx.ShouldBind(&changeForm); err != nil {
+		_ = ctx.Error(invalidParams(err))
+		return
+	}
+
+	claims := currentClaims(ctx)
+	user, err := c.repos.Users.ChangePassword(ctx,
+		claims.UserID,
+		claims.SessionID,
+		changeForm.CurrentPassword,
+		changeForm.NewPassword,
+		config.Get().Password.History,
+	)
+	if err != nil {
+		_ = ctx.Error(fmt.Errorf("failed to change password: %w", err))
+		return
+	}
+
+	data, err := c.reissueTokenData(ctx, user, toUserDTO(user, nil))
+	if err != nil {
+		_ = ctx.Error(err)
+		return
+	}
+	response := Response{
+		Code:    http.StatusOK,
+		Message: "Password changed",
+		Data:    data,
+	}
+	ctx.JSON(http.StatusOK, response)
+}
+
+// AdministratorResetPassword 系统管理员重置用户密码，生成的临时密码只在本次响应中返回，
+// 用户使用临时密码登录后必须先修改密码
+func (c *Controller) AdministratorResetPassword(ctx *gin.Context) {
+	var resetForm ResetPasswordForm
+	if err := ctx.ShouldBind(&resetForm); err != nil {
+		_ = ctx.Error(invalidParams(err))
+		return
+	}
+
+	temporaryPassword, err := helpers.GenerateTemporaryPassword(helpers.CurrentPasswordPolicy())
+	if err != nil {
+		_ = ctx.Error(fmt.Errorf("failed to generate temporary password: %w", err))
+		return
+	}
+	passwordConfig := config.Get().Password
+	user, err := c.repos.Users.ResetPassword(ctx,
+		currentClaims(ctx).UserID,
+		resetForm.UserID,
+		temporaryPassword,
+		time.Now().Add(passwordConfig.TemporaryLifetime),
+		passwordConfig.History,
+	)
+	if err != nil {
+		_ = ctx.Error(fmt.Errorf("failed to reset password: %w", err))
+		return
+	}
+
+	response := Response{
+		Code:    http.StatusOK,
+		Message: "Password reset",
+		Data: map[string]interface{}{
+			"user":               toUserDTO(user, nil),
+			"temporary_password": temporaryPassword,
+		},
+	}
+	ctx.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,68 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SaleFindCustomerByPhone 按电话查找客户（通过盲索引），用于新建客户前查重
+func (c *Controller) SaleFindCustomerByPhone(ctx *gin.Context) {
+	var findForm FindCustomerByPhoneForm
+	if err := ctx.ShouldBind(&findForm); err != nil {
+		_ = ctx.Error(invalidParams(err))
+		return
+	}
+
+	customer, err := c.repos.Customers.FindCustomerByPhone(ctx, currentClaims(ctx).UserID, findForm.CustomerPhone)
+	if err != nil {
+		_ = ctx.Error(fmt.Errorf("failed to find customer by phone: %w", err))
+		return
+	}
+
+	response := Response{
+		Code:    http.StatusOK,
+		Message: "Find customer successful",
+		Data:    toCustomerDTO(customer),
+	}
+	ctx.JSON(http.StatusOK, response)
+}
+
+// RevealCustomerPII 查看客户完整的电话、地址和身份证号码，每次查看都记录到系统日志
+func (c *Controller) RevealCustomerPII(ctx *gin.Context) {
+	var revealForm RevealCustomerPIIForm
+	if err := ctx.ShouldBind(&revealForm); err != nil {
+		_ = ctx.Error(invalidParams(err))
+		return
+	}
+
+	revealed, err := c.repos.Customers.RevealCustomerPII(ctx, currentClaims(ctx).UserID, revealForm.CustomerID, revealForm.Reason)
+	if err != nil {
+		_ = ctx.Error(fmt.Errorf("failed to reveal customer pii: %w", err))
+		return
+	}
+
+	response := Response{
+		Code:    http.StatusOK,
+		Message: "Reveal customer details successful",
+		Data:    toCustomerPIIDTO(revealed),
+	}
+	ctx.JSON(http.StatusOK, response)
+}
+
+// AdministratorRotatePIIKeys 用当前密钥重新加密全部敏感信息，PII_ENCRYPTION_KEYS 换了新密钥后执行
+func (c *Controller) AdministratorRotatePIIKeys(ctx *gin.Context) {
+	rotated, err := c.repos.Customers.RotatePIIKeys(ctx, currentClaims(ctx).UserID)
+	if err != nil {
+		_ = ctx.Error(fmt.Errorf("failed to rotate pii keys: %w", err))
+		return
+	}
+
+	response := Response{
+		Code:    http.StatusOK,
+		Message: "Rotate PII keys successful",
+		Data:    gin.H{"rotated": rotated},
+	}
+	ctx.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,121 @@
+package controllers
+
+import (
+	"fmt"
+	"gin-boilerplate/config"
+	"gin-boilerplate/models"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AccountantConfirmBankAmount 合同指定的会计确认银行实际金额，差额超过配置的容差时返回生成的对账差异
+func (c *Controller) AccountantConfirmBankAmount(ctx *gin.Context) {
+	var confirmForm ConfirmBankAmountForm
+	if err := ctx.ShouldBind(&confirmForm); err != nil {
+		_ = ctx.Error(invalidParams(err))
+		return
+	}
+
+	contract, item, err := c.repos.Reconciliation.ConfirmBankAmount(
+		ctx,
+		currentClaims(ctx).UserID,
+		confirmForm.ContractID,
+		confirmForm.BankAmount,
+		config.Get().Finance.Tolerance(),
+	)
+	if err != nil {
+		_ = ctx.Error(fmt.Errorf("failed to confirm bank amount: %w", err))
+		return
+	}
+
+	// 差额在容差以内且没有未处理的对账项时 item 为 nil
+	var itemDTO *ReconciliationItemDTO
+	if item != nil {
+		dto := toReconciliationItemDTO(item)
+		itemDTO = &dto
+	}
+	response := Response{
+		Code:    http.StatusOK,
+		Message: "Confirm bank amount successful",
+		Data: gin.H{
+			"contract":       toContractDTO(contract),
+			"reconciliation": itemDTO,
+		},
+	}
+	ctx.JSON(http.StatusOK, response)
+}
+
+func (c *Controller) AccountantGetReconciliationItems(ctx *gin.Context) {
+	var getForm GetReconciliationItemsForm
+	if err := ctx.ShouldBind(&getForm); err != nil {
+		_ = ctx.Error(invalidParams(err))
+		return
+	}
+
+	var status *models.ReconciliationStatus
+	if getForm.Status != "" {
+		s := models.ReconciliationStatusStrToEnumMap[getForm.Status]
+		status = &s
+	}
+	items, err := c.repos.Reconciliation.GetReconciliationItems(ctx, currentClaims(ctx).UserID, status)
+	if err != nil {
+		_ = ctx.Error(fmt.Errorf("failed to get reconciliation items: %w", err))
+		return
+	}
+
+	response := Response{
+		Code:    http.StatusOK,
+		Message: "Get reconciliation items successful",
+		Data:    toReconciliationItemDTOs(items),
+	}
+	ctx.JSON(http.StatusOK, response)
+}
+
+func (c *Controller) AccountantResolveReconciliationItem(ctx *gin.Context) {
+	var resolveForm ResolveReconciliationItemForm
+	if err := ctx.ShouldBind(&resolveForm); err != nil {
+		_ = ctx.Error(invalidParams(err))
+		return
+	}
+
+	item, err := c.repos.Reconciliation.ResolveReconciliationItem(
+		ctx,
+		currentClaims(ctx).UserID,
+		resolveForm.ItemID,
+		resolveForm.Resolution,
+	)
+	if err != nil {
+		_ = ctx.Error(fmt.Errorf("failed to resolve reconciliation item: %w", err))
+		return
+	}
+
+	response := Response{
+		Code:    http.StatusOK,
+		Message: "Resolve reconciliation item successful",
+		Data:    toReconciliationItemDTO(item),
+	}
+	ctx.JSON(http.StatusOK, response)
+}
+
+// GetContractAmountHistory 合同金额的全部版本，包括修改人和修改原因
+func (c *Controller) GetContractAmountHistory(ctx *gin.Context) {
+	var getForm GetContractAmountHistoryForm
+	if err := ctx.ShouldBind(&getForm); err != nil {
+		_ = ctx.Error(invalidParams(err))
+		return
+	}
+
+	versions, err := c.repos.Contracts.GetContractAmountHistory(ctx, currentClaims(ctx).UserID, getForm.ContractID)
+	if err != nil {
+		_ = ctx.Error(fmt.Errorf("failed to get contract amount history: %w", err))
+		return
+	}
+
+	response := Response{
+		Code:    http.StatusOK,
+		Message: "Get contract amount history successful",
+		Data:    toContractAmountVersionDTOs(versions),
+	}
+	ctx.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,214 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"gin-boilerplate/helpers"
+	"gin-boilerplate/repository"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 登录记录默认返回的条数
+const defaultLoginHistoryLimit = 50
+
+// RefreshToken 使用刷新令牌换取新的访问令牌和刷新令牌，原来的刷新令牌失效
+// 已经使用过的刷新令牌再次使用时撤销整个会话，需要重新登录
+func (c *Controller) RefreshToken(ctx *gin.Context) {
+	var refreshForm RefreshTokenForm
+	if err := ctx.ShouldBind(&refreshForm); err != nil {
+		_ = ctx.Error(invalidParams(err))
+		return
+	}
+	presented, err := helpers.ParseRefreshToken(refreshForm.RefreshToken)
+	if err != nil {
+		_ = ctx.Error(err)
+		return
+	}
+	refreshID, err := helpers.NewTokenID()
+	if err != nil {
+		_ = ctx.Error(fmt.Errorf("failed to generate refresh token id: %w", err))
+		return
+	}
+
+	expiresAt := time.Now().Add(helpers.RefreshTokenLifetime())
+	user, err := c.repos.Sessions.RefreshSession(ctx, presented.SessionID, presented.RefreshID, refreshID, expiresAt)
+	if err != nil {
+		_ = ctx.Error(fmt.Errorf("failed to refresh session: %w", err))
+		return
+	}
+	data, err := signedTokenData(user, toUserDTO(user, nil), helpers.TokenSession{SessionID: presented.SessionID, RefreshID: refreshID})
+	if err != nil {
+		_ = ctx.Error(err)
+		return
+	}
+
+	response := Response{
+		Code:    http.StatusOK,
+		Message: "Token refreshed",
+		Data:    data,
+	}
+	ctx.JSON(http.StatusOK, response)
+}
+
+// UserListSessions 当前用户有效的登录会话
+func (c *Controller) UserListSessions(ctx *gin.Context) {
+	claims := currentClaims(ctx)
+	sessions, err := c.repos.Sessions.ListSessions(ctx, claims.UserID)
+	if err != nil {
+		_ = ctx.Error(fmt.Errorf("failed to list sessions: %w", err))
+		return
+	}
+
+	response := Response{
+		Code:    http.StatusOK,
+		Message: "List sessions successful",
+		Data:    toSessionDTOs(sessions, claims.SessionID),
+	}
+	ctx.JSON(http.StatusOK, response)
+}
+
+// UserRevokeSession 撤销当前用户自己的会话，撤销当前会话即退出登录
+func (c *Controller) UserRevokeSession(ctx *gin.Context) {
+	var revokeForm RevokeSessionForm
+	if err := ctx.ShouldBind(&revokeForm); err != nil {
+		_ = ctx.Error(invalidParams(err))
+		return
+	}
+
+	if err := c.repos.Sessions.RevokeSession(ctx, currentClaims(ctx).UserID, revokeForm.SessionID); err != nil {
+		_ = ctx.Error(fmt.Errorf("failed to revoke session: %w", err))
+		return
+	}
+
+	response := Response{
+		Code:    http.StatusOK,
+		Message: "Session revoked",
+	}
+	ctx.JSON(http.StatusOK, response)
+}
+
+// UserRevokeOtherSessions 撤销当前会话以外的全部会话
+func (c *Controller) UserRevokeOtherSessions(ctx *gin.Context) {
+	claims := currentClaims(ctx)
+	revoked, err := c.repos.Sessions.RevokeOtherSessions(ctx, claims.UserID, claims.SessionID)
+	if err != nil {
+		_ = ctx.Error(fmt.Errorf("failed to revoke sessions: %w", err))
+		return
+	}
+
+	response := Response{
+		Code:    http.StatusOK,
+		Message: "Other sessions revoked",
+		Data:    gin.H{"revoked": revoked},
+	}
+	ctx.JSON(http.StatusOK, response)
+}
+
+// UserGetLoginHistory 当前用户的登录记录，最新的在前
+func (c *Controller) UserGetLoginHistory(ctx *gin.Context) {
+	var historyForm LoginHistoryForm
+	if err := ctx.ShouldBind(&historyForm); err != nil {
+		_ = ctx.Error(invalidParams(err))
+		return
+	}
+
+	userID := currentClaims(ctx).UserID
+	events, err := c.repos.Sessions.GetLoginHistory(ctx, repository.LoginHistoryFilter{
+		UserID: &userID,
+		Limit:  loginHistoryLimit(historyForm.Limit),
+	})
+	if err != nil {
+		_ = ctx.Error(fmt.Errorf("failed to get login history: %w", err))
+		return
+	}
+
+	response := Response{
+		Code:    http.StatusOK,
+		Message: "Get login history successful",
+		Data:    toLoginEventDTOs(events),
+	}
+	ctx.JSON(http.StatusOK, response)
+}
+
+// AdministratorListUserSessions 系统管理员查看用户的全部会话，包括已撤销和已过期的
+func (c *Controller) AdministratorListUserSessions(ctx *gin.Context) {
+	var listForm ListUserSessionsForm
+	if err := ctx.ShouldBind(&listForm); err != nil {
+		_ = ctx.Error(invalidParams(err))
+		return
+	}
+
+	sessions, err := c.repos.Sessions.GetUserSessions(ctx, currentClaims(ctx).UserID, listForm.UserID)
+	if err != nil {
+		_ = ctx.Error(fmt.Errorf("failed to list user sessions: %w", err))
+		return
+	}
+
+	response := Response{
+		Code:    http.StatusOK,
+		Message: "List user sessions successful",
+		Data:    toSessionDTOs(sessions, ""),
+	}
+	ctx.JSON(http.StatusOK, response)
+}
+
+// AdministratorRevokeUserSession 系统管理员撤销任意用户的会话，该会话的令牌立即失效
+func (c *Controller) AdministratorRevokeUserSession(ctx *gin.Context) {
+	var revokeForm RevokeUserSessionForm
+	if err := ctx.ShouldBind(&revokeForm); err != nil {
+		_ = ctx.Error(invalidParams(err))
+		return
+	}
+
+	session, err := c.repos.Sessions.RevokeUserSession(ctx, currentClaims(ctx).UserID, revokeForm.SessionID)
+	if err != nil {
+		_ = ctx.Error(fmt.Errorf("failed to revoke user session: %w", err))
+		return
+	}
+
+	response := Response{
+		Code:    http.StatusOK,
+		Message: "Session revoked",
+		Data:    toSessionDTO(session, ""),
+	}
+	ctx.JSON(http.StatusOK, response)
+}
+
+// AdministratorGetLoginHistory 系统管理员查看登录记录，可以只看来自新IP的登录
+func (c *Controller) AdministratorGetLoginHistory(ctx *gin.Context) {
+	var historyForm UserLoginHistoryForm
+	if err := ctx.ShouldBind(&historyForm); err != nil {
+		_ = ctx.Error(invalidParams(err))
+		return
+	}
+
+	filter := repository.LoginHistoryFilter{
+		NewIPOnly: historyForm.NewIPOnly,
+		Limit:     loginHistoryLimit(historyForm.Limit),
+	}
+	if historyForm.UserID != 0 {
+		filter.UserID = &historyForm.UserID
+	}
+	events, err := c.repos.Sessions.GetUserLoginHistory(ctx, currentClaims(ctx).UserID, filter)
+	if err != nil {
+		_ = ctx.Error(fmt.Errorf("failed to get login history: %w", err))
+		return
+	}
+
+	response := Response{
+		Code:    http.StatusOK,
+		Message: "Get login history successful",
+		Data:    toLoginEventDTOs(events),
+	}
+	ctx.JSON(http.StatusOK, response)
+}
+
+func loginHistoryLimit(limit int) int {
+	if limit == 0 {
+		return defaultLoginHistoryLimit
+	}
+	return limit
+}
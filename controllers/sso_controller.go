@@ -0,0 +1,190 @@
+package controllers
+
+import (
+	"fmt"
+	"gin-boilerplate/config"
+	"gin-boilerplate/helpers"
+	"gin-boilerplate/infra/apperror"
+	"gin-boilerplate/infra/logger"
+	"gin-boilerplate/infra/oidc"
+	"gin-boilerplate/models"
+	"gin-boilerplate/repository"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 单点登录的状态令牌保存在该 Cookie 中，只发送到 /api/v1/sso/ 下的接口
+const ssoStateCookie = "sso_state"
+
+// ssoProvider 配置中的身份提供方，端点和签名密钥在第一次登录时获取并缓存
+type ssoProvider struct {
+	config config.OIDCProvider
+	client *oidc.Provider
+}
+
+// newSSOProviders 按 OIDC_PROVIDERS_FILE 创建身份提供方，配置已在启动时校验
+func newSSOProviders() map[string]*ssoProvider {
+	configured, err := config.Get().OIDC.Providers()
+	if err != nil {
+		logger.Errorf("oidc providers: %s", err)
+	}
+	providers := map[string]*ssoProvider{}
+	for _, p := range configured {
+		providers[p.Name] = &ssoProvider{
+			config: p,
+			client: oidc.NewProvider(oidc.Config{
+				Issuer:       p.Issuer,
+				ClientID:     p.ClientID,
+				ClientSecret: p.ClientSecret,
+				RedirectURL:  p.RedirectURL,
+				Scopes:       p.Scopes,
+				GroupsClaim:  p.GroupsClaim,
+			}, nil),
+		}
+	}
+	return providers
+}
+
+// mappedRole 用户属于的第一个配置了角色的分组对应的角色，都不匹配时为 DEFAULT；没有配置分组映射时返回 nil，不同步角色
+func (p *ssoProvider) mappedRole(groups []string) *models.RoleID {
+	if len(p.config.RoleMapping) == 0 {
+		return nil
+	}
+	role := models.DEFAULT
+	for _, mapping := range p.config.RoleMapping {
+		for _, group := range groups {
+			if group == mapping.Group {
+				role = models.RoleStrToEnumMap[mapping.Role]
+				return &role
+			}
+		}
+	}
+	return &role
+}
+
+func (c *Controller) ssoProvider(ctx *gin.Context) (*ssoProvider, error) {
+	provider, ok := c.sso[ctx.Param("provider")]
+	if !ok {
+		return nil, apperror.New(apperror.CodeSSOProviderNotFound)
+	}
+	return provider, nil
+}
+
+// SSOLogin 开始单点登录，返回身份提供方的登录地址，state、nonce 和 PKCE code_verifier 保存在 Cookie 中
+func (c *Controller) SSOLogin(ctx *gin.Context) {
+	provider, err := c.ssoProvider(ctx)
+	if err != nil {
+		_ = ctx.Error(err)
+		return
+	}
+
+	var random [3]string
+	for i := range random {
+		if random[i], err = oidc.RandomString(); err != nil {
+			_ = ctx.Error(fmt.Errorf("failed to generate sso state: %w", err))
+			return
+		}
+	}
+	state, nonce, codeVerifier := random[0], random[1], random[2]
+	authorizationURL, err := provider.client.AuthCodeURL(ctx, state, nonce, codeVerifier)
+	if err != nil {
+		_ = ctx.Error(apperror.Wrap(apperror.CodeSSOFailed, err))
+		return
+	}
+	lifetime := config.Get().OIDC.StateLifetime
+	stateToken, err := helpers.GenerateSSOStateToken(provider.config.Name, state, nonce, codeVerifier, lifetime)
+	if err != nil {
+		_ = ctx.Error(fmt.Errorf("failed to generate sso state: %w", err))
+		return
+	}
+	ctx.SetSameSite(http.SameSiteLaxMode)
+	ctx.SetCookie(ssoStateCookie, stateToken, int(lifetime.Seconds()), "/api/v1/sso/", "", !config.Get().Server.Debug, true)
+
+	response := Response{
+		Code:    http.StatusOK,
+		Message: "Redirect to the identity provider",
+		Data:    map[string]interface{}{"authorization_url": authorizationURL},
+	}
+	ctx.JSON(http.StatusOK, response)
+}
+
+// SSOCallback 身份提供方登录后的回调，验证 state 和 ID 令牌后与密码登录一样返回令牌或两步验证的挑战令牌
+func (c *Controller) SSOCallback(ctx *gin.Context) {
+	provider, err := c.ssoProvider(ctx)
+	if err != nil {
+		_ = ctx.Error(err)
+		return
+	}
+	var callbackForm SSOCallbackForm
+	if err := ctx.ShouldBind(&callbackForm); err != nil {
+		_ = ctx.Error(invalidParams(err))
+		return
+	}
+	inc, err := parseIncludes(ctx, "profile")
+	if err != nil {
+		_ = ctx.Error(err)
+		return
+	}
+
+	// state 只能使用一次，无论成功与否都清除 Cookie
+	stateToken, _ := ctx.Cookie(ssoStateCookie)
+	ctx.SetSameSite(http.SameSiteLaxMode)
+	ctx.SetCookie(ssoStateCookie, "", -1, "/api/v1/sso/", "", !config.Get().Server.Debug, true)
+	state, err := helpers.ParseSSOStateToken(stateToken)
+	if err != nil {
+		_ = ctx.Error(err)
+		return
+	}
+	if state.Provider != provider.config.Name || state.State != callbackForm.State {
+		_ = ctx.Error(apperror.New(apperror.CodeSSOStateInvalid))
+		return
+	}
+	if callbackForm.Error != "" || callbackForm.Code == "" {
+		_ = ctx.Error(apperror.Wrap(apperror.CodeSSOFailed, fmt.Errorf("identity provider returned %q", callbackForm.Error)))
+		return
+	}
+
+	identity, err := provider.client.Exchange(ctx, callbackForm.Code, state.CodeVerifier, state.Nonce)
+	if err != nil {
+		_ = ctx.Error(apperror.Wrap(apperror.CodeSSOFailed, err))
+		return
+	}
+	role := provider.mappedRole(identity.Groups)
+	user, err := c.repos.Identities.SSOLogin(ctx, repository.SSOIdentity{
+		Provider:          provider.config.Name,
+		Issuer:            identity.Issuer,
+		Subject:           identity.Subject,
+		Email:             identity.Email,
+		PreferredUsername: identity.PreferredUsername,
+		LinkByUsername:    provider.config.LinkByUsername,
+		Role:              role,
+	}, loginPolicy())
+	if err != nil {
+		_ = ctx.Error(err)
+		return
+	}
+
+	// 开启了两步验证时与密码登录一样只返回挑战令牌
+	if user.TOTPEnabled {
+		c.respondLoginChallenge(ctx, user, provider.config.Name, role)
+		return
+	}
+
+	userDTO, err := c.userDTO(ctx, user, inc)
+	if err != nil {
+		_ = ctx.Error(err)
+		return
+	}
+	data, err := c.tokenData(ctx, user, userDTO, models.LoginMethodSSO)
+	if err != nil {
+		_ = ctx.Error(err)
+		return
+	}
+	response := Response{
+		Code:    http.StatusOK,
+		Message: "Login successful",
+		Data:    data,
+	}
+	ctx.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,221 @@
+package controllers
+
+import (
+	"fmt"
+	"gin-boilerplate/config"
+	"gin-boilerplate/helpers"
+	"gin-boilerplate/models"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// respondLoginChallenge 密码或单点登录验证通过后返回两步验证的挑战令牌，不返回访问令牌
+// 单点登录时 ssoProvider 和 ssoRole 保存在挑战令牌中，两步验证通过后再同步角色
+func (c *Controller) respondLoginChallenge(ctx *gin.Context, user *models.User, ssoProvider string, ssoRole *models.RoleID) {
+	lifetime := config.Get().TOTP.ChallengeLifetime
+	challenge, err := helpers.GenerateChallengeToken(*user, lifetime, ssoProvider, ssoRole)
+	if err != nil {
+		_ = ctx.Error(fmt.Errorf("failed to generate challenge token: %w", err))
+		return
+	}
+	response := Response{
+		Code:    http.StatusOK,
+		Message: "Two-factor authentication required",
+		Data: map[string]interface{}{
+			"mfa_required":    true,
+			"challenge_token": challenge,
+			"expires_in":      int(lifetime.Seconds()),
+		},
+	}
+	ctx.JSON(http.StatusOK, response)
+}
+
+// UserVerifyLoginTOTP 登录的第二步，使用挑战令牌和验证码（或恢复码）换取访问令牌
+func (c *Controller) UserVerifyLoginTOTP(ctx *gin.Context) {
+	var verifyForm VerifyLoginTOTPForm
+	if err := ctx.ShouldBind(&verifyForm); err != nil {
+		_ = ctx.Error(invalidParams(err))
+		return
+	}
+	inc, err := parseIncludes(ctx, "profile")
+	if err != nil {
+		_ = ctx.Error(err)
+		return
+	}
+	challenge, err := helpers.ParseChallengeToken(verifyForm.ChallengeToken)
+	if err != nil {
+		_ = ctx.Error(err)
+		return
+	}
+	if err := c.checkIPLoginFailures(ctx); err != nil {
+		_ = ctx.Error(err)
+		return
+	}
+
+	user, err := c.repos.TwoFactor.VerifyLoginTOTP(ctx, challenge.UserID, verifyForm.Code, config.Get().TOTP.Skew, loginPolicy())
+	if err != nil {
+		c.recordIPLoginFailure(ctx, err)
+		_ = ctx.Error(err)
+		return
+	}
+	if challenge.SSORole != nil {
+		if user, err = c.repos.Identities.SyncSSORole(ctx, user.ID, challenge.SSOProvider, *challenge.SSORole); err != nil {
+			_ = ctx.Error(err)
+			return
+		}
+	}
+
+	userDTO, err := c.userDTO(ctx, user, inc)
+	if err != nil {
+		_ = ctx.Error(err)
+		return
+	}
+	data, err := c.tokenData(ctx, user, userDTO, models.LoginMethodTOTP)
+	if err != nil {
+		_ = ctx.Error(err)
+		return
+	}
+	response := Response{
+		Code:    http.StatusOK,
+		Message: "Login successful",
+		Data:    data,
+	}
+	ctx.JSON(http.StatusOK, response)
+}
+
+// UserStartTOTPEnrollment 生成新的两步验证密钥，返回密钥和供验证器应用扫码的 otpauth 地址
+func (c *Controller) UserStartTOTPEnrollment(ctx *gin.Context) {
+	var enrollForm StartTOTPEnrollmentForm
+	if err := ctx.ShouldBind(&enrollForm); err != nil {
+		_ = ctx.Error(invalidParams(err))
+		return
+	}
+
+	secret, err := helpers.GenerateTOTPSecret()
+	if err != nil {
+		_ = ctx.Error(fmt.Errorf("failed to generate totp secret: %w", err))
+		return
+	}
+	user, err := c.repos.TwoFactor.StartTOTPEnrollment(ctx, currentClaims(ctx).UserID, enrollForm.Password, secret)
+	if err != nil {
+		_ = ctx.Error(fmt.Errorf("failed to start totp enrollment: %w", err))
+		return
+	}
+
+	response := Response{
+		Code:    http.StatusOK,
+		Message: "Scan the otpauth URI and confirm with a code",
+		Data: map[string]interface{}{
+			"secret":      secret,
+			"otpauth_uri": helpers.TOTPURI(config.Get().TOTP.Issuer, user.UserName, secret),
+		},
+	}
+	ctx.JSON(http.StatusOK, response)
+}
+
+// UserConfirmTOTPEnrollment 验证码正确后开启两步验证，恢复码只在本次响应中返回，同时返回新的令牌
+func (c *Controller) UserConfirmTOTPEnrollment(ctx *gin.Context) {
+	var confirmForm TOTPCodeForm
+	if err := ctx.ShouldBind(&confirmForm); err != nil {
+		_ = ctx.Error(invalidParams(err))
+		return
+	}
+
+	totpConfig := config.Get().TOTP
+	recoveryCodes, err := helpers.GenerateRecoveryCodes(totpConfig.RecoveryCodes)
+	if err != nil {
+		_ = ctx.Error(fmt.Errorf("failed to generate recovery codes: %w", err))
+		return
+	}
+	user, err := c.repos.TwoFactor.ConfirmTOTPEnrollment(ctx, currentClaims(ctx).UserID, confirmForm.Code, totpConfig.Skew, recoveryCodes)
+	if err != nil {
+		_ = ctx.Error(fmt.Errorf("failed to confirm totp enrollment: %w", err))
+		return
+	}
+
+	data, err := c.reissueTokenData(ctx, user, toUserDTO(user, nil))
+	if err != nil {
+		_ = ctx.Error(err)
+		return
+	}
+	data["recovery_codes"] = recoveryCodes
+	response := Response{
+		Code:    http.StatusOK,
+		Message: "Two-factor authentication enabled",
+		Data:    data,
+	}
+	ctx.JSON(http.StatusOK, response)
+}
+
+// UserDisableTOTP 验证当前密码和验证码后关闭两步验证，必须使用两步验证的角色不能关闭
+func (c *Controller) UserDisableTOTP(ctx *gin.Context) {
+	var disableForm DisableTOTPForm
+	if err := ctx.ShouldBind(&disableForm); err != nil {
+		_ = ctx.Error(invalidParams(err))
+		return
+	}
+	totpConfig := config.Get().TOTP
+	user, err := c.repos.TwoFactor.DisableTOTP(ctx, currentClaims(ctx).UserID, disableForm.Password, disableForm.Code, totpConfig.Skew, totpConfig.Roles())
+	if err != nil {
+		_ = ctx.Error(fmt.Errorf("failed to disable totp: %w", err))
+		return
+	}
+
+	response := Response{
+		Code:    http.StatusOK,
+		Message: "Two-factor authentication disabled",
+		Data:    toUserDTO(user, nil),
+	}
+	ctx.JSON(http.StatusOK, response)
+}
+
+// UserRegenerateRecoveryCodes 验证验证码后重新生成恢复码，原来的恢复码全部失效
+func (c *Controller) UserRegenerateRecoveryCodes(ctx *gin.Context) {
+	var regenerateForm TOTPCodeForm
+	if err := ctx.ShouldBind(&regenerateForm); err != nil {
+		_ = ctx.Error(invalidParams(err))
+		return
+	}
+
+	totpConfig := config.Get().TOTP
+	recoveryCodes, err := helpers.GenerateRecoveryCodes(totpConfig.RecoveryCodes)
+	if err != nil {
+		_ = ctx.Error(fmt.Errorf("failed to generate recovery codes: %w", err))
+		return
+	}
+	err = c.repos.TwoFactor.RegenerateRecoveryCodes(ctx, currentClaims(ctx).UserID, regenerateForm.Code, totpConfig.Skew, recoveryCodes)
+	if err != nil {
+		_ = ctx.Error(fmt.Errorf("failed to regenerate recovery codes: %w", err))
+		return
+	}
+
+	response := Response{
+		Code:    http.StatusOK,
+		Message: "Recovery codes regenerated",
+		Data:    map[string]interface{}{"recovery_codes": recoveryCodes},
+	}
+	ctx.JSON(http.StatusOK, response)
+}
+
+// AdministratorResetTOTP 系统管理员为丢失验证器和恢复码的用户关闭两步验证
+func (c *Controller) AdministratorResetTOTP(ctx *gin.Context) {
+	var resetForm ResetTOTPForm
+	if err := ctx.ShouldBind(&resetForm); err != nil {
+		_ = ctx.Error(invalidParams(err))
+		return
+	}
+
+	user, err := c.repos.TwoFactor.ResetTOTP(ctx, currentClaims(ctx).UserID, resetForm.UserID)
+	if err != nil {
+		_ = ctx.Error(fmt.Errorf("failed to reset totp: %w", err))
+		return
+	}
+
+	response := Response{
+		Code:    http.StatusOK,
+		Message: "Two-factor authentication reset",
+		Data:    toUserDTO(user, nil),
+	}
+	ctx.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,140 @@
+package controllers
+
+import (
+	"errors"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+
+	"gin-boilerplate/helpers"
+	"gin-boilerplate/infra/apperror"
+	"gin-boilerplate/models"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"github.com/shopspring/decimal"
+)
+
+/*
+表单校验
+
+forms.go 中的表单通过 binding 标签声明校验规则，除 validator 内置规则外还注册了：
+  - cnmobile：中国大陆手机号，11位，以1开头、第二位为3-9
+  - enum=role|gender|contract_status|repayment_method：取值必须是 models 中 *StrToEnumMap 的键
+  - money：金额必须大于0且最多两位小数，money=allowzero 允许为0，money=signed 允许任意正负
+  - rate：年利率，0 <= rate < 1，最多六位小数
+  - permissions：逗号分隔的权限名称，每个都必须是 models.PermissionRoles 的键
+  - username、password：与 helpers.IsValidUsername、helpers.IsValidPassword 规则一致，
+    password 校验失败时 param 为不满足的密码策略规则，例如 "min_length,classes"
+日期区间使用内置的 gtfield=StartDate，要求结束时间晚于开始时间
+*/
+
+// 枚举名称与 models 中映射表的对应关系
+var enumNames = map[string]func(string) bool{
+	"role":             func(s string) bool { _, ok := models.RoleStrToEnumMap[s]; return ok },
+	"gender":           func(s string) bool { _, ok := models.GenderStrToEnumMap[s]; return ok },
+	"contract_status":  func(s string) bool { _, ok := models.ContractStatusStrToEnumMap[s]; return ok },
+	"repayment_method": func(s string) bool { _, ok := models.RepaymentMethodStrToEnumMap[s]; return ok },
+	"marital_status":   func(s string) bool { _, ok := models.MaritalStatusStrToEnumMap[s]; return ok },
+	"reconciliation_status": func(s string) bool {
+		_, ok := models.ReconciliationStatusStrToEnumMap[s]
+		return ok
+	},
+}
+
+var cnMobileRegexp = regexp.MustCompile(`^1[3-9]\d{9}$`)
+
+var registerValidatorsOnce sync.Once
+
+// registerValidators 在 gin 默认的校验器上注册自定义规则，并使用 form 标签作为字段名
+func registerValidators() {
+	registerValidatorsOnce.Do(func() {
+		v, ok := binding.Validator.Engine().(*validator.Validate)
+		if !ok {
+			panic("unexpected gin validator engine")
+		}
+		v.RegisterTagNameFunc(func(field reflect.StructField) string {
+			name := strings.SplitN(field.Tag.Get("form"), ",", 2)[0]
+			if name == "" || name == "-" {
+				return field.Name
+			}
+			return name
+		})
+		mustRegister(v, "cnmobile", func(fl validator.FieldLevel) bool {
+			return cnMobileRegexp.MatchString(fl.Field().String())
+		})
+		mustRegister(v, "nationalid", func(fl validator.FieldLevel) bool {
+			return models.NationalID(fl.Field().String()).Valid()
+		})
+		mustRegister(v, "enum", func(fl validator.FieldLevel) bool {
+			isMember, ok := enumNames[fl.Param()]
+			if !ok {
+				panic("unknown enum in binding tag: " + fl.Param())
+			}
+			return isMember(fl.Field().String())
+		})
+		// 金额字段是 models.Money，校验时转换为字符串，避免在校验阶段引入浮点误差
+		v.RegisterCustomTypeFunc(func(field reflect.Value) interface{} {
+			return field.Interface().(models.Money).String()
+		}, models.Money{})
+		mustRegister(v, "money", func(fl validator.FieldLevel) bool {
+			amount, err := decimal.NewFromString(fl.Field().String())
+			if err != nil || !amount.Equal(amount.Round(models.MoneyScale)) {
+				return false
+			}
+			switch fl.Param() {
+			case "signed":
+				return true
+			case "allowzero":
+				return !amount.IsNegative()
+			default:
+				return amount.IsPositive()
+			}
+		})
+		mustRegister(v, "rate", func(fl validator.FieldLevel) bool {
+			rate, err := decimal.NewFromString(fl.Field().String())
+			return err == nil && rate.Equal(rate.Round(6)) && !rate.IsNegative() && rate.LessThan(decimal.NewFromInt(1))
+		})
+		mustRegister(v, "permissions", func(fl validator.FieldLevel) bool {
+			_, unknown := models.ParsePermissions(fl.Field().String())
+			return unknown == ""
+		})
+		mustRegister(v, "username", func(fl validator.FieldLevel) bool {
+			return helpers.IsValidUsername(fl.Field().String())
+		})
+		mustRegister(v, "password", func(fl validator.FieldLevel) bool {
+			return helpers.IsValidPassword(fl.Field().String())
+		})
+	})
+}
+
+func mustRegister(v *validator.Validate, tag string, fn validator.Func) {
+	if err := v.RegisterValidation(tag, fn); err != nil {
+		panic(err)
+	}
+}
+
+// FieldError 单个字段的校验错误，放在错误响应的 data 中返回
+type FieldError struct {
+	Field string `json:"field"`
+	Rule  string `json:"rule"`
+	Param string `json:"param,omitempty"`
+}
+
+// invalidParams 把绑定错误转换为 CodeInvalidParams，校验失败时附带字段级错误
+func invalidParams(err error) error {
+	var validationErrors validator.ValidationErrors
+	if !errors.As(err, &validationErrors) {
+		return apperror.Wrap(apperror.CodeInvalidParams, err)
+	}
+	fieldErrors := make([]FieldError, 0, len(validationErrors))
+	for _, fe := range validationErrors {
+		param := fe.Param()
+		if password, ok := fe.Value().(string); ok && fe.Tag() == "password" {
+			param = strings.Join(helpers.CurrentPasswordPolicy().Violations(password), ",")
+		}
+		fieldErrors = append(fieldErrors, FieldError{Field: fe.Field(), Rule: fe.Tag(), Param: param})
+	}
+	return apperror.Wrap(apperror.CodeInvalidParams, err).WithDetails(fieldErrors)
+}
@@ -0,0 +1,55 @@
+package helpers
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+)
+
+/*
+API 密钥
+
+密钥形如 gbk_<prefix>_<secret>：
+  - prefix 是12位十六进制数，明文保存，用于查找密钥和在列表中识别密钥
+  - secret 是256位随机数，只保存 SHA-256 哈希；随机数不需要像密码一样使用 bcrypt 防暴力破解，每次请求验证的开销也更小
+*/
+
+const apiKeyScheme = "gbk"
+
+// GenerateAPIKey 生成新的密钥，返回完整的密钥、prefix 和 secret 的哈希
+func GenerateAPIKey() (key, prefix, secretHash string, err error) {
+	prefixBytes := make([]byte, 6)
+	if _, err := rand.Read(prefixBytes); err != nil {
+		return "", "", "", err
+	}
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", "", err
+	}
+	prefix = hex.EncodeToString(prefixBytes)
+	encoded := base64.RawURLEncoding.EncodeToString(secret)
+	return apiKeyScheme + "_" + prefix + "_" + encoded, prefix, HashAPIKeySecret(encoded), nil
+}
+
+// ParseAPIKey 拆分密钥，格式不正确时 ok 为 false
+func ParseAPIKey(key string) (prefix, secret string, ok bool) {
+	parts := strings.SplitN(key, "_", 3)
+	if len(parts) != 3 || parts[0] != apiKeyScheme || len(parts[1]) != 12 || parts[2] == "" {
+		return "", "", false
+	}
+	return parts[1], parts[2], true
+}
+
+// HashAPIKeySecret secret 的哈希
+func HashAPIKeySecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// CheckAPIKeySecret secret 是否与哈希一致
+func CheckAPIKeySecret(secret, secretHash string) bool {
+	return subtle.ConstantTimeCompare([]byte(HashAPIKeySecret(secret)), []byte(secretHash)) == 1
+}
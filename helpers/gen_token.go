@@ -1,9 +1,14 @@
 package helpers
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"time"
 
 	"gin-boilerplate/config"
+	"gin-boilerplate/infra/apperror"
+	"gin-boilerplate/infra/jwtkeys"
 	"gin-boilerplate/models"
 
 	"github.com/golang-jwt/jwt"
@@ -11,42 +16,235 @@ import (
 
 // 含有客户信息的JWT声明
 type Claims struct {
+	UserID   uint   `json:"user_id"`
 	UserName string `json:"username"`
 	UserRole string `json:"user_role"`
+	// 使用临时密码登录时为 true，只能访问 /me 接口修改密码
+	MustChangePassword bool `json:"must_change_password,omitempty"`
+	// 角色必须使用两步验证但还没有绑定时为 true，只能访问 /me 接口绑定两步验证
+	MFAEnrollmentRequired bool `json:"mfa_enrollment_required,omitempty"`
+	// 令牌所属的登录会话（models.Session.Family），撤销会话后令牌失效
+	SessionID string `json:"sid,omitempty"`
+	// 系统管理员代登录时为代登录记录ID（models.Impersonation），代登录结束后令牌失效
+	ImpersonationID uint `json:"imp,omitempty"`
+	// 通过 API 密钥访问时由鉴权中间件设置，不会出现在令牌中
+	APIKeyID     uint               `json:"-"`
+	APIKeyScopes models.Permissions `json:"-"`
 	jwt.StandardClaims
 }
 
+// TokenSession 令牌所属的会话：SessionID 写入两个令牌的 sid，RefreshID 是刷新令牌的 jti
+// 访问令牌必须属于会话，撤销会话后立即失效；只有代登录令牌不属于会话
+type TokenSession struct {
+	SessionID string
+	RefreshID string
+}
+
 // GenerateToken 生成JWT令牌
-func GenerateToken(user models.User) (string, string, error) {
-	JWT_SECRET, JWT_ALGORITHM, JWT_ACCESS_TOKEN_EXPIRE_MINUTES, JWT_REFRESH_TOKEN_EXPIRE_MINUTES := config.JWTConfiguration()
+func GenerateToken(user models.User, session TokenSession) (string, string, error) {
+	return generateToken(user, session, false)
+}
+
+// GenerateMFAEnrollmentToken 生成只能用于绑定两步验证的JWT令牌
+func GenerateMFAEnrollmentToken(user models.User, session TokenSession) (string, string, error) {
+	return generateToken(user, session, true)
+}
+
+func generateToken(user models.User, session TokenSession, mfaEnrollmentRequired bool) (string, string, error) {
+	if session.SessionID == "" || session.RefreshID == "" {
+		return "", "", errors.New("token session is required")
+	}
+	jwtConfig := config.Get().JWT
 
 	// 创建访问令牌
-	accessTokenClaims := &Claims{
-		UserName: user.UserName,
-		UserRole: models.RoleNameMap[user.RoleID],
-		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: time.Now().Add(time.Minute * time.Duration(JWT_ACCESS_TOKEN_EXPIRE_MINUTES)).Unix(),
-		},
+	accessTokenString, err := SignToken(&Claims{
+		UserID:                user.ID,
+		UserName:              user.UserName,
+		UserRole:              models.RoleNameMap[user.RoleID],
+		MustChangePassword:    user.MustChangePassword,
+		MFAEnrollmentRequired: mfaEnrollmentRequired,
+		SessionID:             session.SessionID,
+		StandardClaims:        standardClaims(time.Minute * time.Duration(jwtConfig.AccessTokenExpireMinutes)),
+	})
+	if err != nil {
+		return "", "", err
 	}
 
-	accessToken := jwt.NewWithClaims(jwt.GetSigningMethod(JWT_ALGORITHM), accessTokenClaims)
-	accessTokenString, err := accessToken.SignedString([]byte(JWT_SECRET))
+	// 创建刷新令牌，不含角色，不能用于访问接口
+	refreshClaims := standardClaims(RefreshTokenLifetime())
+	refreshClaims.Id = session.RefreshID
+	refreshTokenString, err := SignToken(&Claims{
+		SessionID:      session.SessionID,
+		StandardClaims: refreshClaims,
+	})
 	if err != nil {
 		return "", "", err
 	}
 
-	// 创建刷新令牌
-	refreshTokenClaims := &Claims{
-		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: time.Now().Add(time.Minute * time.Duration(JWT_REFRESH_TOKEN_EXPIRE_MINUTES)).Unix(),
-		},
+	return accessTokenString, refreshTokenString, nil
+}
+
+// GenerateImpersonationToken 生成系统管理员代登录的访问令牌，到 expiresAt 失效，没有刷新令牌
+func GenerateImpersonationToken(user models.User, impersonationID uint, expiresAt time.Time) (string, error) {
+	return SignToken(&Claims{
+		UserID:          user.ID,
+		UserName:        user.UserName,
+		UserRole:        models.RoleNameMap[user.RoleID],
+		ImpersonationID: impersonationID,
+		StandardClaims:  standardClaims(time.Until(expiresAt)),
+	})
+}
+
+// RefreshTokenLifetime 刷新令牌的有效期，也是会话不刷新时的最长有效期
+func RefreshTokenLifetime() time.Duration {
+	return time.Minute * time.Duration(config.Get().JWT.RefreshTokenExpireMinutes)
+}
+
+// ParseRefreshToken 验证刷新令牌，返回其中的会话和 jti
+// 访问令牌和不属于会话的刷新令牌返回 CodeUnauthorized
+func ParseRefreshToken(tokenString string) (TokenSession, error) {
+	claims := &Claims{}
+	if err := ParseToken(tokenString, claims); err != nil {
+		return TokenSession{}, err
 	}
+	if claims.UserRole != "" || claims.SessionID == "" || claims.Id == "" {
+		return TokenSession{}, apperror.New(apperror.CodeUnauthorized)
+	}
+	return TokenSession{SessionID: claims.SessionID, RefreshID: claims.Id}, nil
+}
+
+// NewTokenID 随机生成的会话ID或令牌ID
+func NewTokenID() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
+}
 
-	refreshToken := jwt.NewWithClaims(jwt.GetSigningMethod(JWT_ALGORITHM), refreshTokenClaims)
-	refreshTokenString, err := refreshToken.SignedString([]byte(JWT_SECRET))
+// standardClaims 本服务签发的令牌共用的声明，有效期为 lifetime
+func standardClaims(lifetime time.Duration) jwt.StandardClaims {
+	jwtConfig := config.Get().JWT
+	return jwt.StandardClaims{
+		Issuer:    jwtConfig.Issuer,
+		Audience:  jwtConfig.Audience,
+		ExpiresAt: time.Now().Add(lifetime).Unix(),
+	}
+}
+
+// SignToken 使用当前的签名密钥签发令牌，非对称密钥的令牌头中带有 kid
+func SignToken(claims jwt.Claims) (string, error) {
+	keyring, err := jwtkeys.Current()
 	if err != nil {
-		return "", "", err
+		return "", err
+	}
+	kid, key := keyring.SigningKey()
+	token := jwt.NewWithClaims(jwt.GetSigningMethod(keyring.Algorithm()), claims)
+	if kid != "" {
+		token.Header["kid"] = kid
 	}
+	return token.SignedString(key)
+}
 
-	return accessTokenString, refreshTokenString, nil
+// ParseToken 验证令牌并把声明解析到 claims（必须内嵌 jwt.StandardClaims）
+// 只接受配置的签名算法，并检查签名、有效期、iss 和 aud；过期时返回 CodeTokenExpired，其他错误返回 CodeUnauthorized
+func ParseToken(tokenString string, claims jwt.Claims) error {
+	keyring, err := jwtkeys.Current()
+	if err != nil {
+		return err
+	}
+	parser := &jwt.Parser{ValidMethods: []string{keyring.Algorithm()}}
+	token, err := parser.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return keyring.VerificationKey(kid)
+	})
+	if err != nil {
+		if ve, ok := err.(*jwt.ValidationError); ok && ve.Errors&jwt.ValidationErrorExpired != 0 {
+			return apperror.Wrap(apperror.CodeTokenExpired, err)
+		}
+		return apperror.Wrap(apperror.CodeUnauthorized, err)
+	}
+	registered, ok := claims.(interface {
+		VerifyIssuer(string, bool) bool
+		VerifyAudience(string, bool) bool
+	})
+	jwtConfig := config.Get().JWT
+	if !token.Valid || !ok || !registered.VerifyIssuer(jwtConfig.Issuer, true) || !registered.VerifyAudience(jwtConfig.Audience, true) {
+		return apperror.New(apperror.CodeUnauthorized)
+	}
+	return nil
+}
+
+// 两步验证的挑战令牌只用于 /login/verify，不含角色，不能访问其他接口
+const challengePurpose = "login_mfa"
+
+// ChallengeClaims 密码验证通过、等待两步验证时的JWT声明
+type ChallengeClaims struct {
+	UserID  uint   `json:"user_id"`
+	Purpose string `json:"purpose"`
+	// 单点登录时身份提供方的名称和按分组映射的角色，两步验证通过后才同步角色
+	SSOProvider string         `json:"sso_provider,omitempty"`
+	SSORole     *models.RoleID `json:"sso_role,omitempty"`
+	jwt.StandardClaims
+}
+
+// GenerateChallengeToken 生成两步验证的挑战令牌，有效期为 lifetime
+// 单点登录时 ssoProvider 和 ssoRole 是身份提供方的名称和映射的角色，密码登录时为空
+func GenerateChallengeToken(user models.User, lifetime time.Duration, ssoProvider string, ssoRole *models.RoleID) (string, error) {
+	return SignToken(&ChallengeClaims{
+		UserID:         user.ID,
+		Purpose:        challengePurpose,
+		SSOProvider:    ssoProvider,
+		SSORole:        ssoRole,
+		StandardClaims: standardClaims(lifetime),
+	})
+}
+
+// ParseChallengeToken 验证挑战令牌，返回其中的声明
+func ParseChallengeToken(tokenString string) (*ChallengeClaims, error) {
+	claims := &ChallengeClaims{}
+	if err := ParseToken(tokenString, claims); err != nil {
+		return nil, err
+	}
+	if claims.Purpose != challengePurpose {
+		return nil, apperror.New(apperror.CodeUnauthorized)
+	}
+	return claims, nil
+}
+
+// 单点登录跳转前保存在 Cookie 中的状态，回调时验证，不能访问其他接口
+const ssoStatePurpose = "sso_state"
+
+// SSOStateClaims 单点登录跳转到身份提供方前生成的 state、nonce 和 PKCE code_verifier
+type SSOStateClaims struct {
+	Provider     string `json:"provider"`
+	State        string `json:"state"`
+	Nonce        string `json:"nonce"`
+	CodeVerifier string `json:"code_verifier"`
+	Purpose      string `json:"purpose"`
+	jwt.StandardClaims
+}
+
+// GenerateSSOStateToken 生成单点登录的状态令牌，有效期为 lifetime
+func GenerateSSOStateToken(provider, state, nonce, codeVerifier string, lifetime time.Duration) (string, error) {
+	return SignToken(&SSOStateClaims{
+		Provider:       provider,
+		State:          state,
+		Nonce:          nonce,
+		CodeVerifier:   codeVerifier,
+		Purpose:        ssoStatePurpose,
+		StandardClaims: standardClaims(lifetime),
+	})
+}
+
+// ParseSSOStateToken 验证单点登录的状态令牌，过期或无效时返回 CodeSSOStateInvalid
+func ParseSSOStateToken(tokenString string) (*SSOStateClaims, error) {
+	claims := &SSOStateClaims{}
+	if err := ParseToken(tokenString, claims); err != nil {
+		return nil, apperror.Wrap(apperror.CodeSSOStateInvalid, err)
+	}
+	if claims.Purpose != ssoStatePurpose {
+		return nil, apperror.New(apperror.CodeSSOStateInvalid)
+	}
+	return claims, nil
 }
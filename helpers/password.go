@@ -0,0 +1,174 @@
+package helpers
+
+import (
+	"bufio"
+	"crypto/rand"
+	"math/big"
+	"os"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"gin-boilerplate/config"
+)
+
+/*密码策略：长度、字符种类和常见密码，规则由 PASSWORD_* 配置*/
+
+// 密码不满足策略时返回的规则名称，作为参数错误的 param 返回给前端
+const (
+	PasswordTooShort     = "min_length"
+	PasswordTooLong      = "max_length"
+	PasswordTooFewClass  = "classes"
+	PasswordTooCommon    = "common"
+	PasswordInvalidChars = "invalid_characters"
+)
+
+// 内置的常见密码，比较时不区分大小写
+var commonPasswords = []string{
+	"password", "password1", "password12", "password123", "passw0rd", "p@ssw0rd", "p@ssword",
+	"12345678", "123456789", "1234567890", "87654321", "11111111", "00000000", "88888888", "66666666",
+	"12341234", "123123123", "11223344", "1q2w3e4r", "1qaz2wsx", "qwerty123", "qwertyuiop", "qwer1234",
+	"asdf1234", "zxcvbnm123", "abc12345", "abcd1234", "a1234567", "aa123456", "admin123", "admin1234",
+	"root1234", "test1234", "welcome1", "letmein1", "iloveyou", "iloveyou1", "woaini1314", "woaini520",
+}
+
+// PasswordPolicy 密码策略
+type PasswordPolicy struct {
+	MinLength  int             // 最少字符数
+	MaxLength  int             // 最多字节数
+	MinClasses int             // 至少包含的字符种类数：小写字母、大写字母、数字、其他字符（包括空格和中文）
+	Blacklist  map[string]bool // 常见密码，小写
+}
+
+// Violations 返回密码不满足的规则，全部满足时返回 nil
+// 允许空格和中文等非ASCII字符，不允许控制字符和无效的 UTF-8 编码
+func (p PasswordPolicy) Violations(password string) []string {
+	var violations []string
+	if utf8.RuneCountInString(password) < p.MinLength {
+		violations = append(violations, PasswordTooShort)
+	}
+	if len(password) > p.MaxLength {
+		violations = append(violations, PasswordTooLong)
+	}
+	if !utf8.ValidString(password) || strings.IndexFunc(password, unicode.IsControl) >= 0 {
+		violations = append(violations, PasswordInvalidChars)
+	}
+	if passwordClasses(password) < p.MinClasses {
+		violations = append(violations, PasswordTooFewClass)
+	}
+	if p.Blacklist[strings.ToLower(password)] {
+		violations = append(violations, PasswordTooCommon)
+	}
+	return violations
+}
+
+func passwordClasses(password string) int {
+	var lower, upper, digit, other int
+	for _, char := range password {
+		switch {
+		case char >= 'a' && char <= 'z':
+			lower = 1
+		case char >= 'A' && char <= 'Z':
+			upper = 1
+		case char >= '0' && char <= '9':
+			digit = 1
+		default:
+			other = 1
+		}
+	}
+	return lower + upper + digit + other
+}
+
+var (
+	blacklistMu   sync.Mutex
+	blacklistFile string
+	blacklist     map[string]bool
+)
+
+// CurrentPasswordPolicy 根据配置返回密码策略，常见密码文件只在第一次使用（或配置的文件变化）时读取
+func CurrentPasswordPolicy() PasswordPolicy {
+	passwordConfig := config.Get().Password
+	return PasswordPolicy{
+		MinLength:  passwordConfig.MinLength,
+		MaxLength:  passwordConfig.MaxLength,
+		MinClasses: passwordConfig.MinClasses,
+		Blacklist:  loadBlacklist(passwordConfig.BlacklistFile),
+	}
+}
+
+// loadBlacklist 合并内置列表和配置的文件，文件在启动时已校验过，读取失败时只使用内置列表
+func loadBlacklist(file string) map[string]bool {
+	blacklistMu.Lock()
+	defer blacklistMu.Unlock()
+	if blacklist != nil && blacklistFile == file {
+		return blacklist
+	}
+	words := make(map[string]bool, len(commonPasswords))
+	for _, word := range commonPasswords {
+		words[word] = true
+	}
+	if file != "" {
+		if f, err := os.Open(file); err == nil {
+			scanner := bufio.NewScanner(f)
+			for scanner.Scan() {
+				if word := strings.TrimSpace(scanner.Text()); word != "" {
+					words[strings.ToLower(word)] = true
+				}
+			}
+			f.Close()
+		}
+	}
+	blacklist, blacklistFile = words, file
+	return blacklist
+}
+
+// 临时密码使用的字符，去掉了容易混淆的 0/O、1/l/I
+const (
+	temporaryLower  = "abcdefghijkmnopqrstuvwxyz"
+	temporaryUpper  = "ABCDEFGHJKLMNPQRSTUVWXYZ"
+	temporaryDigits = "23456789"
+	temporaryOther  = "!@#$%*-_+="
+)
+
+// GenerateTemporaryPassword 生成满足密码策略的随机临时密码，包含全部四种字符
+func GenerateTemporaryPassword(policy PasswordPolicy) (string, error) {
+	length := 16
+	if length < policy.MinLength {
+		length = policy.MinLength
+	}
+	if length > policy.MaxLength {
+		length = policy.MaxLength
+	}
+	classes := []string{temporaryLower, temporaryUpper, temporaryDigits, temporaryOther}
+	all := strings.Join(classes, "")
+	password := make([]byte, 0, length)
+	for i := 0; i < length; i++ {
+		alphabet := all
+		if i < len(classes) {
+			alphabet = classes[i]
+		}
+		char, err := randomChar(alphabet)
+		if err != nil {
+			return "", err
+		}
+		password = append(password, char)
+	}
+	// 打乱顺序，避免前四位的字符种类固定
+	for i := len(password) - 1; i > 0; i-- {
+		j, err := rand.Int(rand.Reader, big.NewInt(int64(i+1)))
+		if err != nil {
+			return "", err
+		}
+		password[i], password[j.Int64()] = password[j.Int64()], password[i]
+	}
+	return string(password), nil
+}
+
+func randomChar(alphabet string) (byte, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(int64(len(alphabet))))
+	if err != nil {
+		return 0, err
+	}
+	return alphabet[n.Int64()], nil
+}
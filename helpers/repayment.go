@@ -0,0 +1,87 @@
+package helpers
+
+import (
+	"gin-boilerplate/models"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// 计算月供时中间结果保留的小数位数，最终金额四舍五入到分
+const ratePrecision = 20
+
+var twelve = decimal.NewFromInt(12)
+
+// GenerateRepaymentSchedule 根据本金、年利率、期数和还款方式生成还款计划
+// 第 i 期的应还日期为放款日期之后第 i 个月的同一天（该月没有这一天时为月末），利息按剩余本金 * 月利率计算并四舍五入到分，
+// 最后一期还清剩余本金，保证各期本金之和等于放款金额
+func GenerateRepaymentSchedule(principal, annualRate models.Money, termMonths int,
+	method models.RepaymentMethod, disbursedAt time.Time) []models.RepaymentInstallment {
+	monthlyRate := annualRate.DivRound(twelve, ratePrecision)
+	remaining := principal.Round(models.MoneyScale)
+	terms := decimal.NewFromInt(int64(termMonths))
+
+	// 等额本息每期还款额固定，等额本金每期本金固定
+	var payment, fixedPrincipal models.Money
+	switch method {
+	case models.EQUAL_PRINCIPAL:
+		fixedPrincipal = remaining.DivRound(terms, models.MoneyScale)
+	default:
+		payment = equalInstallmentPayment(remaining, monthlyRate, termMonths)
+	}
+
+	installments := make([]models.RepaymentInstallment, 0, termMonths)
+	for period := 1; period <= termMonths; period++ {
+		interest := remaining.Mul(monthlyRate).Round(models.MoneyScale)
+		var periodPrincipal models.Money
+		switch {
+		case period == termMonths:
+			periodPrincipal = remaining
+		case method == models.EQUAL_PRINCIPAL:
+			periodPrincipal = fixedPrincipal
+		default:
+			periodPrincipal = payment.Sub(interest)
+		}
+		if periodPrincipal.GreaterThan(remaining) {
+			periodPrincipal = remaining
+		}
+		remaining = remaining.Sub(periodPrincipal)
+
+		installments = append(installments, models.RepaymentInstallment{
+			Period:     period,
+			DueDate:    addMonthsClamped(disbursedAt, period),
+			Principal:  periodPrincipal,
+			Interest:   interest,
+			Amount:     periodPrincipal.Add(interest),
+			PaidAmount: decimal.Zero,
+			Status:     models.UNPAID,
+		})
+	}
+	return installments
+}
+
+// addMonthsClamped 返回 t 之后第 months 个月的同一天，目标月份没有这一天时取该月最后一天，
+// 例如1月31日之后一个月为2月28日（闰年为29日），而不是 AddDate 溢出得到的3月3日
+func addMonthsClamped(t time.Time, months int) time.Time {
+	first := time.Date(t.Year(), t.Month()+time.Month(months), 1,
+		t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+	day := t.Day()
+	if lastDay := first.AddDate(0, 1, -1).Day(); day > lastDay {
+		day = lastDay
+	}
+	return first.AddDate(0, 0, day-1)
+}
+
+// equalInstallmentPayment 等额本息月供 = P * r * (1+r)^n / ((1+r)^n - 1)，利率为0时为 P / n
+func equalInstallmentPayment(principal, monthlyRate models.Money, termMonths int) models.Money {
+	if monthlyRate.IsZero() {
+		return principal.DivRound(decimal.NewFromInt(int64(termMonths)), models.MoneyScale)
+	}
+	growth := decimal.NewFromInt(1)
+	base := growth.Add(monthlyRate)
+	for i := 0; i < termMonths; i++ {
+		growth = growth.Mul(base).Round(ratePrecision)
+	}
+	return principal.Mul(monthlyRate).Mul(growth).
+		DivRound(growth.Sub(decimal.NewFromInt(1)), models.MoneyScale)
+}
@@ -14,18 +14,9 @@ func IsValidUsername(username string) bool {
 	return true
 }
 
+// IsValidPassword 密码是否满足当前配置的密码策略，见 CurrentPasswordPolicy
 func IsValidPassword(password string) bool {
-	if len(password) < 8 || len(password) > 16 {
-		return false
-	}
-
-	for _, char := range password {
-		if !isAlphanumeric(char) && !isPunctuation(char) {
-			return false
-		}
-	}
-
-	return true
+	return len(CurrentPasswordPolicy().Violations(password)) == 0
 }
 
 func isAlphanumeric(char rune) bool {
@@ -38,12 +29,19 @@ func isChinese(char rune) bool {
 	return (char >= '\u4e00' && char <= '\u9fff')
 }
 
-func isPunctuation(char rune) bool {
-	punctuations := []rune{'!', '@', '#', '$', '%', '^', '&', '*', '(', ')', '_', '+', '-', '=', '[', ']', '{', '}', '|', '\\', ';', ':', '\'', '"', '<', '>', ',', '.', '/', '?'}
-	for _, p := range punctuations {
-		if char == p {
-			return true
+// SanitizeUsername 去掉 candidate 中用户名不允许的字符，并截断到 maxLen 字节以内，结果可能为空
+func SanitizeUsername(candidate string, maxLen int) string {
+	var b []rune
+	size := 0
+	for _, char := range candidate {
+		if !isAlphanumeric(char) && !isChinese(char) {
+			continue
+		}
+		if size+len(string(char)) > maxLen {
+			break
 		}
+		b = append(b, char)
+		size += len(string(char))
 	}
-	return false
+	return string(b)
 }
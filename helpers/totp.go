@@ -0,0 +1,125 @@
+package helpers
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+/*两步验证：基于时间的一次性密码（RFC 6238，HMAC-SHA1、6位数字、30秒一个周期），兼容常见的验证器应用*/
+
+const (
+	totpPeriod = 30
+	totpDigits = 6
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateTOTPSecret 生成160位的随机密钥，返回 base32 编码
+func GenerateTOTPSecret() (string, error) {
+	secret := make([]byte, 20)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return totpEncoding.EncodeToString(secret), nil
+}
+
+// TOTPURI 验证器应用扫码绑定使用的 otpauth:// 地址
+func TOTPURI(issuer, account, secret string) string {
+	params := url.Values{
+		"secret":    {secret},
+		"issuer":    {issuer},
+		"algorithm": {"SHA1"},
+		"digits":    {fmt.Sprint(totpDigits)},
+		"period":    {fmt.Sprint(totpPeriod)},
+	}
+	return "otpauth://totp/" + url.PathEscape(issuer+":"+account) + "?" + params.Encode()
+}
+
+// TOTPStep 时间所在的周期
+func TOTPStep(t time.Time) int64 {
+	return t.Unix() / totpPeriod
+}
+
+// TOTPCode 密钥在指定周期的验证码
+func TOTPCode(secret string, step int64) (string, error) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", err
+	}
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(step))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, value%1000000), nil
+}
+
+// IsTOTPCode 是否是6位数字的验证码（否则按恢复码处理）
+func IsTOTPCode(code string) bool {
+	if len(code) != totpDigits {
+		return false
+	}
+	for _, char := range code {
+		if char < '0' || char > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// VerifyTOTP 在当前周期前后 skew 个周期内查找匹配的验证码，返回匹配的周期
+// 周期不大于 lastStep 的验证码已经使用过，不能再用
+func VerifyTOTP(secret, code string, now time.Time, skew int, lastStep int64) (int64, bool) {
+	current := TOTPStep(now)
+	for step := current - int64(skew); step <= current+int64(skew); step++ {
+		if step <= lastStep {
+			continue
+		}
+		expected, err := TOTPCode(secret, step)
+		if err != nil {
+			return 0, false
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// 恢复码使用小写字母和数字，去掉了容易混淆的 0/o、1/l
+const recoveryCodeAlphabet = "abcdefghijkmnpqrstuvwxyz23456789"
+
+// GenerateRecoveryCodes 生成 n 个形如 abcde-23456 的恢复码
+func GenerateRecoveryCodes(n int) ([]string, error) {
+	codes := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		code := make([]byte, 0, 11)
+		for j := 0; j < 10; j++ {
+			if j == 5 {
+				code = append(code, '-')
+			}
+			char, err := randomChar(recoveryCodeAlphabet)
+			if err != nil {
+				return nil, err
+			}
+			code = append(code, char)
+		}
+		codes = append(codes, string(code))
+	}
+	return codes, nil
+}
+
+// NormalizeRecoveryCode 去掉空格和连字符并转为小写，用户输入时不区分格式
+func NormalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+}
@@ -0,0 +1,261 @@
+package apperror
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"gorm.io/gorm"
+)
+
+/*
+应用错误
+
+每个错误码对应固定的 HTTP 状态码和中英文提示，错误码一经发布不再修改含义：
+  - 1xxxx 通用错误（参数、鉴权、资源不存在等）
+  - 2xxxx 用户与组织架构
+  - 3xxxx 客户
+  - 4xxxx 合同
+  - 5xxxx 提成
+控制器通过 ctx.Error(err) 交给 middleware.ErrorMiddleware 统一输出，原始错误只写日志，不返回给客户端
+*/
+
+type Code int
+
+const (
+	CodeInternal        Code = 10000 // 服务器内部错误
+	CodeInvalidParams   Code = 10001 // 请求参数错误
+	CodeUnauthorized    Code = 10002 // 未携带令牌或令牌无效
+	CodeTokenExpired    Code = 10003 // 令牌已过期
+	CodeForbidden       Code = 10004 // 当前角色无权访问
+	CodeNotFound        Code = 10005 // 资源不存在
+	CodeConflict        Code = 10006 // 资源已存在
+	CodeRouteNotFound   Code = 10007 // 路由不存在
+	CodeTooManyRequests Code = 10008 // 请求过于频繁
+	CodeActorMismatch   Code = 10009 // 请求中的操作人与令牌不一致
+
+	CodeInvalidCredentials Code = 20001 // 用户名或密码错误
+	// 20002、20003 曾用于用户名、密码格式错误，现在统一由表单校验返回 CodeInvalidParams
+	CodeUserNotAssigned Code = 20004 // 用户未分配部门或战区
+	CodeLoginThrottled  Code = 20005 // 登录失败次数过多，需要等待后重试
+	CodeAccountLocked   Code = 20006 // 账户已被临时锁定
+
+	CodeWrongCurrentPassword     Code = 20007 // 当前密码错误
+	CodePasswordReused           Code = 20008 // 新密码与最近使用过的密码相同
+	CodePasswordChangeRequired   Code = 20009 // 需要先修改密码
+	CodeTemporaryPasswordExpired Code = 20010 // 临时密码已过期
+	CodeMFAEnrollmentRequired    Code = 20011 // 需要先绑定两步验证
+	CodeInvalidTOTPCode          Code = 20012 // 两步验证码或恢复码错误
+	CodeTOTPNotEnrolled          Code = 20013 // 尚未开始绑定或未开启两步验证
+	CodeTOTPAlreadyEnabled       Code = 20014 // 已经开启两步验证
+	CodeTOTPRequired             Code = 20015 // 当前角色必须使用两步验证
+	CodeSSOProviderNotFound      Code = 20016 // 单点登录的身份提供方不存在
+	CodeSSOStateInvalid          Code = 20017 // 单点登录回调的 state 无效或已过期
+	CodeSSOFailed                Code = 20018 // 身份提供方登录失败或 ID 令牌无效
+	CodeIdentityAlreadyLinked    Code = 20019 // 身份提供方的账户已关联其他用户
+	CodeAPIKeyInvalid            Code = 20020 // API 密钥无效、已过期或已撤销
+	CodeAPIKeyNotFound           Code = 20021 // API 密钥不存在
+	CodeAPIKeyScopeNotAllowed    Code = 20022 // 密钥所属用户的角色没有该权限
+	CodeSessionRevoked           Code = 20023 // 会话已撤销或已过期，需要重新登录
+	CodeSessionNotFound          Code = 20024 // 会话不存在
+	CodeImpersonationReadOnly    Code = 20025 // 只读的代登录不能修改数据
+	CodeImpersonationEnded       Code = 20026 // 代登录已结束或已过期
+	CodeImpersonationNotAllowed  Code = 20027 // 不能代登录系统管理员或自己
+	CodeImpersonationNotFound    Code = 20028 // 代登录记录不存在
+	CodeIdentityLinkNotAllowed   Code = 20029 // 同名用户不能自动关联单点登录身份
+
+	CodeCustomerListForbidden    Code = 30001 // 无权查看客户列表
+	CodeCustomerMigrateForbidden Code = 30002 // 无权迁移客户
+	CodeCustomerKYCForbidden     Code = 30003 // 无权查看或修改客户的KYC资料
+	CodeCustomerKYCNotVerified   Code = 30004 // 客户的KYC资料未认证
+	CodeCustomerPhoneExists      Code = 30005 // 客户电话已存在
+	CodeCustomerAccessForbidden  Code = 30006 // 无权查看该客户的完整信息
+
+	CodeContractListForbidden       Code = 40001 // 无权查看合同列表
+	CodeContractNotApproved         Code = 40002 // 合同未批准，不能放款
+	CodeContractAlreadyDisbursed    Code = 40003 // 合同已放款
+	CodeContractNotDisbursed        Code = 40004 // 合同尚未放款
+	CodeRepaymentExceedsOutstanding Code = 40005 // 还款金额超过剩余应还金额
+	CodeFinancialProductNotFound    Code = 40006 // 合同的金融产品不存在
+	CodeContractAmountForbidden     Code = 40007 // 无权修改合同金额
+	CodeReconciliationForbidden     Code = 40008 // 不是合同指定的会计
+	CodeReconciliationResolved      Code = 40009 // 对账差异已处理
+	CodeDelegationNotAllowed        Code = 40010 // 委托人或被委托人的角色不能委托
+	CodeDelegationNotFound          Code = 40011 // 委托不存在
+	CodeContractStatusForbidden     Code = 40012 // 无权修改合同状态
+	CodeContractAccessForbidden     Code = 40013 // 无权查看该合同
+
+	CodeStatementLocked Code = 50001 // 提成单已锁定
+)
+
+type definition struct {
+	status int
+	zh, en string
+}
+
+var definitions = map[Code]definition{
+	CodeInternal:        {http.StatusInternalServerError, "服务器内部错误", "Internal server error"},
+	CodeInvalidParams:   {http.StatusBadRequest, "请求参数错误", "Invalid request parameters"},
+	CodeUnauthorized:    {http.StatusUnauthorized, "未登录或令牌无效", "Missing or invalid token"},
+	CodeTokenExpired:    {http.StatusUnauthorized, "令牌已过期", "Token expired"},
+	CodeForbidden:       {http.StatusForbidden, "当前角色无权访问", "Your role is not allowed to access this resource"},
+	CodeNotFound:        {http.StatusNotFound, "资源不存在", "Resource not found"},
+	CodeConflict:        {http.StatusConflict, "资源已存在", "Resource already exists"},
+	CodeRouteNotFound:   {http.StatusNotFound, "路由不存在", "Route not found"},
+	CodeTooManyRequests: {http.StatusTooManyRequests, "请求过于频繁，请稍后再试", "Too many requests, please retry later"},
+	CodeActorMismatch:   {http.StatusForbidden, "请求中的操作人与令牌不一致", "The acting user in the request does not match the token"},
+
+	CodeInvalidCredentials: {http.StatusUnauthorized, "用户名或密码错误", "Invalid username or password"},
+	CodeUserNotAssigned:    {http.StatusBadRequest, "用户未分配部门或战区", "User is not assigned to a department or zone"},
+	CodeLoginThrottled:     {http.StatusTooManyRequests, "登录失败次数过多，请稍后再试", "Too many failed login attempts, please retry later"},
+	CodeAccountLocked:      {http.StatusLocked, "账户已被临时锁定，请稍后再试或联系系统管理员", "Account is temporarily locked, retry later or contact an administrator"},
+
+	CodeWrongCurrentPassword:     {http.StatusBadRequest, "当前密码错误", "Current password is incorrect"},
+	CodePasswordReused:           {http.StatusBadRequest, "新密码不能与最近使用过的密码相同", "New password must differ from recently used passwords"},
+	CodePasswordChangeRequired:   {http.StatusForbidden, "请先修改密码", "Password must be changed before continuing"},
+	CodeTemporaryPasswordExpired: {http.StatusUnauthorized, "临时密码已过期，请联系系统管理员重置", "Temporary password has expired, ask an administrator to reset it"},
+	CodeMFAEnrollmentRequired:    {http.StatusForbidden, "请先绑定两步验证", "Two-factor authentication must be set up before continuing"},
+	CodeInvalidTOTPCode:          {http.StatusUnauthorized, "两步验证码或恢复码错误", "Invalid two-factor code or recovery code"},
+	CodeTOTPNotEnrolled:          {http.StatusConflict, "尚未开启两步验证", "Two-factor authentication is not set up"},
+	CodeTOTPAlreadyEnabled:       {http.StatusConflict, "已经开启两步验证", "Two-factor authentication is already enabled"},
+	CodeTOTPRequired:             {http.StatusForbidden, "当前角色必须使用两步验证，不能关闭", "Two-factor authentication is mandatory for your role"},
+	CodeSSOProviderNotFound:      {http.StatusNotFound, "单点登录的身份提供方不存在", "Single sign-on provider not found"},
+	CodeSSOStateInvalid:          {http.StatusBadRequest, "单点登录已过期，请重新登录", "Single sign-on session is invalid or expired, please sign in again"},
+	CodeSSOFailed:                {http.StatusUnauthorized, "单点登录失败", "Single sign-on failed"},
+	CodeIdentityAlreadyLinked:    {http.StatusConflict, "该身份提供方账户已关联其他用户", "This identity is already linked to another user"},
+	CodeAPIKeyInvalid:            {http.StatusUnauthorized, "API 密钥无效或已过期", "API key is invalid, expired or revoked"},
+	CodeAPIKeyNotFound:           {http.StatusNotFound, "API 密钥不存在", "API key not found"},
+	CodeAPIKeyScopeNotAllowed:    {http.StatusBadRequest, "密钥所属用户的角色没有该权限", "The key owner's role does not have this scope"},
+	CodeSessionRevoked:           {http.StatusUnauthorized, "登录已失效，请重新登录", "Session has been signed out or expired, please log in again"},
+	CodeSessionNotFound:          {http.StatusNotFound, "会话不存在", "Session not found"},
+	CodeImpersonationReadOnly:    {http.StatusForbidden, "只读的代登录不能修改数据", "Read-only impersonation cannot modify data"},
+	CodeImpersonationEnded:       {http.StatusUnauthorized, "代登录已结束", "Impersonation has ended or expired"},
+	CodeImpersonationNotAllowed:  {http.StatusBadRequest, "不能代登录系统管理员或自己", "System managers and yourself cannot be impersonated"},
+	CodeImpersonationNotFound:    {http.StatusNotFound, "代登录记录不存在", "Impersonation not found"},
+	CodeIdentityLinkNotAllowed:   {http.StatusForbidden, "该用户不能自动关联单点登录身份", "This account cannot be linked to single sign-on automatically"},
+
+	CodeCustomerListForbidden:    {http.StatusForbidden, "无权限查看客户列表", "Not allowed to list customers"},
+	CodeCustomerMigrateForbidden: {http.StatusForbidden, "无权限迁移客户", "Not allowed to migrate this customer"},
+	CodeCustomerKYCForbidden:     {http.StatusForbidden, "无权限查看或修改该客户的KYC资料", "Not allowed to access the KYC profile of this customer"},
+	CodeCustomerKYCNotVerified:   {http.StatusConflict, "客户的KYC资料未认证，不能批准合同", "Customer KYC is not verified"},
+	CodeCustomerPhoneExists:      {http.StatusConflict, "该电话号码的客户已存在", "A customer with this phone number already exists"},
+	CodeCustomerAccessForbidden:  {http.StatusForbidden, "无权限查看该客户的完整信息", "Not allowed to reveal the details of this customer"},
+
+	CodeContractListForbidden:       {http.StatusForbidden, "无权限查看合同列表", "Not allowed to list contracts"},
+	CodeContractNotApproved:         {http.StatusConflict, "合同尚未批准，不能放款", "Contract is not approved"},
+	CodeContractAlreadyDisbursed:    {http.StatusConflict, "合同已放款", "Contract has already been disbursed"},
+	CodeContractNotDisbursed:        {http.StatusConflict, "合同尚未放款", "Contract has not been disbursed"},
+	CodeRepaymentExceedsOutstanding: {http.StatusBadRequest, "还款金额超过剩余应还金额", "Repayment exceeds the outstanding amount"},
+	CodeFinancialProductNotFound:    {http.StatusBadRequest, "合同的金融产品不存在", "Financial product of the contract does not exist"},
+	CodeContractAmountForbidden:     {http.StatusForbidden, "无权限修改合同金额", "Not allowed to change the contract amount"},
+	CodeReconciliationForbidden:     {http.StatusForbidden, "只有合同指定的会计可以对账", "Only the accountant assigned to the contract can reconcile it"},
+	CodeReconciliationResolved:      {http.StatusConflict, "对账差异已处理", "Reconciliation item is already resolved"},
+	CodeDelegationNotAllowed:        {http.StatusBadRequest, "不能委托给该用户", "Approval rights cannot be delegated to this user"},
+	CodeDelegationNotFound:          {http.StatusNotFound, "委托不存在", "Delegation not found"},
+	CodeContractStatusForbidden:     {http.StatusForbidden, "无权限修改合同状态", "Not allowed to change the contract status"},
+	CodeContractAccessForbidden:     {http.StatusForbidden, "无权限查看该合同", "Not allowed to view this contract"},
+
+	CodeStatementLocked: {http.StatusConflict, "提成单已锁定", "Commission statement is locked"},
+}
+
+// Status 返回错误码对应的 HTTP 状态码
+func (c Code) Status() int {
+	if def, ok := definitions[c]; ok {
+		return def.status
+	}
+	return http.StatusInternalServerError
+}
+
+// Message 返回错误码对应语言的提示，lang 为 LangZH 或 LangEN
+func (c Code) Message(lang string) string {
+	def, ok := definitions[c]
+	if !ok {
+		def = definitions[CodeInternal]
+	}
+	if lang == LangEN {
+		return def.en
+	}
+	return def.zh
+}
+
+// Error 应用错误，Details 会原样返回给客户端（例如字段校验错误），cause 只用于日志
+// RetryAfter 大于0时通过 Retry-After 响应头告诉客户端多久之后重试
+type Error struct {
+	Code       Code
+	Details    interface{}
+	RetryAfter time.Duration
+	cause      error
+}
+
+func New(code Code) *Error {
+	return &Error{Code: code}
+}
+
+// Wrap 用错误码包装底层错误
+func Wrap(code Code, cause error) *Error {
+	return &Error{Code: code, cause: cause}
+}
+
+// WithDetails 附加返回给客户端的详细信息
+func (e *Error) WithDetails(details interface{}) *Error {
+	e.Details = details
+	return e
+}
+
+// WithRetryAfter 附加重试等待时间，同时在 data 中返回 retry_after（秒，向上取整）
+func (e *Error) WithRetryAfter(wait time.Duration) *Error {
+	e.RetryAfter = wait
+	e.Details = map[string]int64{"retry_after": e.RetryAfterSeconds()}
+	return e
+}
+
+// RetryAfterSeconds 重试等待的秒数，至少为1
+func (e *Error) RetryAfterSeconds() int64 {
+	seconds := int64((e.RetryAfter + time.Second - 1) / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+	return seconds
+}
+
+func (e *Error) Error() string {
+	if e.cause != nil {
+		return fmt.Sprintf("%d %s: %s", e.Code, e.Code.Message(LangEN), e.cause)
+	}
+	return fmt.Sprintf("%d %s", e.Code, e.Code.Message(LangEN))
+}
+
+func (e *Error) Unwrap() error {
+	return e.cause
+}
+
+// From 把任意错误转换为应用错误：
+// 已经是应用错误的直接返回，gorm.ErrRecordNotFound 对应404，唯一约束冲突对应409，其余都是500
+func From(err error) *Error {
+	var appErr *Error
+	switch {
+	case errors.As(err, &appErr):
+		return appErr
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return Wrap(CodeNotFound, err)
+	case IsUniqueViolation(err):
+		return Wrap(CodeConflict, err)
+	default:
+		return Wrap(CodeInternal, err)
+	}
+}
+
+// Postgres 唯一约束冲突的 SQLSTATE
+const pgUniqueViolation = "23505"
+
+// IsUniqueViolation 判断是否是唯一约束冲突，支持 Postgres 和 SQLite
+func IsUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code == pgUniqueViolation
+	}
+	return err != nil && strings.Contains(err.Error(), "UNIQUE constraint failed")
+}
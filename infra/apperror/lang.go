@@ -0,0 +1,48 @@
+package apperror
+
+import (
+	"strconv"
+	"strings"
+)
+
+const (
+	LangZH = "zh"
+	LangEN = "en"
+)
+
+// Language 根据 Accept-Language 请求头选择提示语言，按 q 值取最优先的中文或英文，都没有时使用中文
+func Language(acceptLanguage string) string {
+	lang, best := LangZH, -1.0
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, q := parseLanguageRange(part)
+		var candidate string
+		switch {
+		case tag == "zh" || strings.HasPrefix(tag, "zh-"):
+			candidate = LangZH
+		case tag == "en" || strings.HasPrefix(tag, "en-"):
+			candidate = LangEN
+		default:
+			continue
+		}
+		if q > best {
+			lang, best = candidate, q
+		}
+	}
+	return lang
+}
+
+// 解析 "en-US;q=0.8" 这样的语言范围，未指定 q 时为1
+func parseLanguageRange(part string) (string, float64) {
+	fields := strings.Split(part, ";")
+	tag := strings.ToLower(strings.TrimSpace(fields[0]))
+	q := 1.0
+	for _, param := range fields[1:] {
+		param = strings.TrimSpace(param)
+		if strings.HasPrefix(param, "q=") {
+			if value, err := strconv.ParseFloat(param[2:], 64); err == nil {
+				q = value
+			}
+		}
+	}
+	return tag, q
+}
@@ -2,21 +2,23 @@ package database
 
 import (
 	"fmt"
-	"log"
 
-	"github.com/spf13/viper"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
-	"gorm.io/gorm/logger"
-	"gorm.io/plugin/dbresolver"
+	gormlogger "gorm.io/gorm/logger"
 
 	"gin-boilerplate/config"
+	"gin-boilerplate/infra/logger"
+	"gin-boilerplate/infra/metrics"
 )
 
 // 单例模式，保存数据库连接
 var (
 	DB  *gorm.DB
 	err error
+	// 从数据库连接，与 dbresolver 共享连接池，用于健康检查
+	Replicas []*gorm.DB
+	replicas *replicaSet
 )
 
 func GetDB() *gorm.DB {
@@ -24,51 +26,105 @@ func GetDB() *gorm.DB {
 }
 
 // DbConnection create database connection
-func DbConnection(defaultDSN, masterDSN, replicaDSN config.DSN) error {
+func DbConnection(defaultDSN, masterDSN config.DSN, replicaDSNs []config.DSN) error {
 	var db = DB
 
-	logMode := viper.GetBool("DB_LOG_MODE")
-	debug := viper.GetBool("DEBUG")
+	dbConfig := config.Get().Database
 
-	loglevel := logger.Silent
-	if logMode {
-		loglevel = logger.Info
+	loglevel := gormlogger.Warn
+	if dbConfig.LogMode {
+		loglevel = gormlogger.Info
 	}
 
-	// 连接默认数据库以检查目标数据库是否存在, 如果目标数据库不存在则创建它
-	default_db, default_err := gorm.Open(postgres.Open(defaultDSN.DSN), &gorm.Config{
-		Logger: logger.Default.LogMode(loglevel),
-	})
-	if default_err != nil {
-		fmt.Println(default_err)
-	}
-	var count int64
-	default_db.Raw("SELECT COUNT(*) FROM pg_database WHERE datname = ?", masterDSN.Dbname).Scan(&count)
-	if count == 0 {
-		default_db.Exec(fmt.Sprintf("CREATE DATABASE %s;", masterDSN.Dbname))
-		log.Printf("已成功创建空数据库并链接")
+	if err := ensureDatabase(defaultDSN, masterDSN.Dbname, loglevel); err != nil {
+		return err
 	}
 
 	// 连接主数据库
 	db, err = gorm.Open(postgres.Open(masterDSN.DSN), &gorm.Config{
-		Logger: logger.Default.LogMode(loglevel),
+		Logger: logger.NewGormLogger(loglevel),
 	})
-	if !debug {
-		db.Use(dbresolver.Register(dbresolver.Config{
-			Replicas: []gorm.Dialector{
-				postgres.Open(replicaDSN.DSN),
-			},
-			Policy: dbresolver.RandomPolicy{},
-		}))
-	}
 	if err != nil {
-		log.Fatalf("Db connection error for DSN=[" + masterDSN.DSN + "]")
+		return fmt.Errorf("db connection error for database %s: %w", masterDSN.Dbname, err)
+	}
+	if err := setupPool(db, dbConfig); err != nil {
+		return err
+	}
+
+	// 连接从数据库，连接失败的从库先标记为不健康，由健康检查恢复
+	if len(replicaDSNs) > 0 {
+		var dialectors []gorm.Dialector
+		var replicaDBs []*gorm.DB
+		for i, replicaDSN := range replicaDSNs {
+			replicaDB, err := gorm.Open(postgres.Open(replicaDSN.DSN), &gorm.Config{
+				Logger: logger.NewGormLogger(loglevel),
+			})
+			if err != nil {
+				return fmt.Errorf("db connection error for replica %d %s: %w", i, replicaDSN.Dbname, err)
+			}
+			if err := setupPool(replicaDB, dbConfig); err != nil {
+				return err
+			}
+			replicaConn, err := replicaDB.DB()
+			if err != nil {
+				return err
+			}
+			dialectors = append(dialectors, postgres.New(postgres.Config{Conn: replicaConn}))
+			replicaDBs = append(replicaDBs, replicaDB)
+		}
+		if err := UseReplicas(db, replicaDBs, dialectors, dbConfig.ReplicaHealthCheckInterval); err != nil {
+			return err
+		}
+	}
+	// 统计 SQL 耗时和连接池指标，业务指标由 main 使用仓储注册
+	if err := db.Use(metrics.GormPlugin{}); err != nil {
+		return err
+	}
+	if err := metrics.RegisterDB(db, masterDSN.Dbname); err != nil {
 		return err
 	}
 	DB = db
 	return nil
 }
 
+// 连接默认数据库以检查目标数据库是否存在, 如果目标数据库不存在则创建它
+func ensureDatabase(defaultDSN config.DSN, dbname string, loglevel gormlogger.LogLevel) error {
+	defaultDB, err := gorm.Open(postgres.Open(defaultDSN.DSN), &gorm.Config{
+		Logger: logger.NewGormLogger(loglevel),
+	})
+	if err != nil {
+		return fmt.Errorf("db connection error for database %s: %w", defaultDSN.Dbname, err)
+	}
+	if sqlDB, err := defaultDB.DB(); err == nil {
+		defer sqlDB.Close()
+	}
+
+	var count int64
+	if err := defaultDB.Raw("SELECT COUNT(*) FROM pg_database WHERE datname = ?", dbname).Scan(&count).Error; err != nil {
+		return fmt.Errorf("check database %s error: %w", dbname, err)
+	}
+	if count == 0 {
+		if err := defaultDB.Exec(fmt.Sprintf("CREATE DATABASE %q;", dbname)).Error; err != nil {
+			return fmt.Errorf("create database %s error: %w", dbname, err)
+		}
+		logger.Infof("已成功创建空数据库 %s", dbname)
+	}
+	return nil
+}
+
+// 设置连接池大小和连接存活时间
+func setupPool(db *gorm.DB, dbConfig config.DatabaseConfiguration) error {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	sqlDB.SetMaxOpenConns(dbConfig.MaxOpenConns)
+	sqlDB.SetMaxIdleConns(dbConfig.MaxIdleConns)
+	sqlDB.SetConnMaxLifetime(dbConfig.ConnMaxLifetime)
+	sqlDB.SetConnMaxIdleTime(dbConfig.ConnMaxIdleTime)
+	return nil
+}
+
 // /*数据库操作*/
 
 // /**
@@ -0,0 +1,269 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/plugin/dbresolver"
+
+	"gin-boilerplate/infra/logger"
+	"gin-boilerplate/infra/metrics"
+)
+
+// UseReplicas 在主库连接上注册从库，dialectors 与 replicaDBs 一一对应并共享连接池：
+// 读请求随机路由到健康的从库，没有健康的从库或当前请求已经写入时走主库，每 interval 检查一次从库
+func UseReplicas(db *gorm.DB, replicaDBs []*gorm.DB, dialectors []gorm.Dialector, interval time.Duration) error {
+	replicaList := make([]*replica, 0, len(replicaDBs))
+	for i, replicaDB := range replicaDBs {
+		sqlDB, err := replicaDB.DB()
+		if err != nil {
+			return err
+		}
+		replicaList = append(replicaList, &replica{name: fmt.Sprintf("replica_%d", i), sqlDB: sqlDB})
+	}
+	set := newReplicaSet(db.ConnPool, replicaList)
+	if err := db.Use(dbresolver.Register(dbresolver.Config{
+		Replicas: dialectors,
+		Policy:   dbresolver.RandomPolicy{},
+	})); err != nil {
+		return err
+	}
+	if err := db.Use(replicaRouter{set: set}); err != nil {
+		return err
+	}
+	StopReplicaHealthCheck()
+	set.startHealthCheck(interval)
+	Replicas, replicas = replicaDBs, set
+	return nil
+}
+
+// StopReplicaHealthCheck 停止从库健康检查
+func StopReplicaHealthCheck() {
+	if replicas != nil {
+		replicas.stopHealthCheck()
+	}
+}
+
+// replica 从库连接及其健康状态，连接池与 dbresolver 共享
+type replica struct {
+	name    string
+	sqlDB   *sql.DB
+	healthy int32
+}
+
+func (r *replica) isHealthy() bool {
+	return atomic.LoadInt32(&r.healthy) == 1
+}
+
+func (r *replica) setHealthy(healthy bool) {
+	var value int32
+	if healthy {
+		value = 1
+	}
+	if old := atomic.SwapInt32(&r.healthy, value); old != value {
+		if healthy {
+			logger.Infof("replica %s is healthy again", r.name)
+		} else {
+			logger.Warnf("replica %s is unhealthy, reads fall back to other replicas or master", r.name)
+		}
+	}
+}
+
+// replicaSet 全部从库，读请求只会路由到健康的从库，全部不健康时回退到主库
+type replicaSet struct {
+	master   gorm.ConnPool
+	replicas []*replica
+	byPool   map[gorm.ConnPool]*replica
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+func newReplicaSet(master gorm.ConnPool, replicas []*replica) *replicaSet {
+	set := &replicaSet{
+		master:   master,
+		replicas: replicas,
+		byPool:   make(map[gorm.ConnPool]*replica, len(replicas)),
+		stop:     make(chan struct{}),
+	}
+	for _, r := range replicas {
+		set.byPool[r.sqlDB] = r
+	}
+	return set
+}
+
+// healthyPool 随机返回一个健康的从库，没有健康的从库时返回主库
+func (s *replicaSet) healthyPool() gorm.ConnPool {
+	var healthy []*replica
+	for _, r := range s.replicas {
+		if r.isHealthy() {
+			healthy = append(healthy, r)
+		}
+	}
+	if len(healthy) == 0 {
+		return s.master
+	}
+	return healthy[rand.Intn(len(healthy))].sqlDB
+}
+
+func (s *replicaSet) checkAll(timeout time.Duration) {
+	var wg sync.WaitGroup
+	for _, r := range s.replicas {
+		wg.Add(1)
+		go func(r *replica) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+			err := r.sqlDB.PingContext(ctx)
+			if err != nil {
+				logger.Debugf("replica %s ping error: %s", r.name, err)
+			}
+			r.setHealthy(err == nil)
+		}(r)
+	}
+	wg.Wait()
+}
+
+// startHealthCheck 定时检查从库是否可用
+func (s *replicaSet) startHealthCheck(interval time.Duration) {
+	s.checkAll(interval)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				s.checkAll(interval)
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+}
+
+func (s *replicaSet) stopHealthCheck() {
+	s.stopOnce.Do(func() { close(s.stop) })
+}
+
+// ReplicaStatus 从库健康状态，用于就绪检查
+type ReplicaStatus struct {
+	Name    string `json:"name"`
+	Healthy bool   `json:"healthy"`
+}
+
+// GetReplicaStatus 返回每个从库最近一次健康检查的结果
+func GetReplicaStatus() []ReplicaStatus {
+	if replicas == nil {
+		return nil
+	}
+	status := make([]ReplicaStatus, 0, len(replicas.replicas))
+	for _, r := range replicas.replicas {
+		status = append(status, ReplicaStatus{Name: r.name, Healthy: r.isHealthy()})
+	}
+	return status
+}
+
+/*读写一致性*/
+
+type readYourWritesKey struct{}
+
+type writeTracker struct {
+	wrote int32
+}
+
+// WithReadYourWrites 返回带写入标记的 context，同一个 context 写入数据之后的读请求都走主库，
+// 避免刚写入的数据因主从延迟在从库上读不到
+func WithReadYourWrites(ctx context.Context) context.Context {
+	if tracker, _ := ctx.Value(readYourWritesKey{}).(*writeTracker); tracker != nil {
+		return ctx
+	}
+	return context.WithValue(ctx, readYourWritesKey{}, &writeTracker{})
+}
+
+// HasWritten 返回该 context 是否已经写入过数据
+func HasWritten(ctx context.Context) bool {
+	tracker, _ := ctx.Value(readYourWritesKey{}).(*writeTracker)
+	return tracker != nil && atomic.LoadInt32(&tracker.wrote) == 1
+}
+
+func markWritten(ctx context.Context) {
+	if tracker, _ := ctx.Value(readYourWritesKey{}).(*writeTracker); tracker != nil {
+		atomic.StoreInt32(&tracker.wrote, 1)
+	}
+}
+
+const (
+	queryRead  = "read"
+	queryWrite = "write"
+)
+
+// replicaRouter 在 dbresolver 选择连接之后、执行 SQL 之前执行：
+// 写操作记录写入标记；读操作在从库不健康或当前请求已写入时改为其他健康从库或主库。
+// 读写按操作类型判断，在主库上执行的读操作（事务中、指定 dbresolver.Write）不算写入
+type replicaRouter struct {
+	set *replicaSet
+}
+
+func (replicaRouter) Name() string {
+	return "replica_router"
+}
+
+func (r replicaRouter) Initialize(db *gorm.DB) error {
+	type register func(name string, fn func(*gorm.DB)) error
+	cb := db.Callback()
+	hooks := []struct {
+		register register
+		kind     func(*gorm.DB) string
+	}{
+		{cb.Create().After("gorm:db_resolver").Before("gorm:create").Register, fixedKind(queryWrite)},
+		{cb.Query().After("gorm:db_resolver").Before("gorm:query").Register, fixedKind(queryRead)},
+		{cb.Update().After("gorm:db_resolver").Before("gorm:update").Register, fixedKind(queryWrite)},
+		{cb.Delete().After("gorm:db_resolver").Before("gorm:delete").Register, fixedKind(queryWrite)},
+		{cb.Row().After("gorm:db_resolver").Before("gorm:row").Register, fixedKind(queryRead)},
+		{cb.Raw().After("gorm:db_resolver").Before("gorm:raw").Register, rawKind},
+	}
+	for _, hook := range hooks {
+		kind := hook.kind
+		if err := hook.register("replica_router", func(db *gorm.DB) { r.route(db, kind(db)) }); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func fixedKind(kind string) func(*gorm.DB) string {
+	return func(*gorm.DB) string { return kind }
+}
+
+// rawKind Exec 执行的 SQL 与 dbresolver 的判断一致，只有不加锁的 SELECT 算读操作
+func rawKind(db *gorm.DB) string {
+	sql := strings.ToUpper(strings.TrimSpace(db.Statement.SQL.String()))
+	if strings.HasPrefix(sql, "SELECT") && !strings.HasSuffix(sql, "FOR UPDATE") {
+		return queryRead
+	}
+	return queryWrite
+}
+
+func (r replicaRouter) route(db *gorm.DB, kind string) {
+	ctx := db.Statement.Context
+	if kind == queryWrite {
+		markWritten(ctx)
+	} else if chosen, isReplica := r.set.byPool[db.Statement.ConnPool]; isReplica {
+		if HasWritten(ctx) {
+			db.Statement.ConnPool = r.set.master
+		} else if !chosen.isHealthy() {
+			db.Statement.ConnPool = r.set.healthyPool()
+		}
+	}
+	target := "master"
+	if _, isReplica := r.set.byPool[db.Statement.ConnPool]; isReplica {
+		target = "replica"
+	}
+	metrics.ObserveDBRoute(target, kind)
+}
@@ -0,0 +1,32 @@
+package database
+
+import (
+	"fmt"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+
+	"gin-boilerplate/infra/logger"
+)
+
+// SQLiteConnection 打开 SQLite 数据库（纯 Go 实现，不依赖 cgo 和外部数据库），用于端到端测试和本地体验，
+// dsn 可以是文件路径，也可以是 "file::memory:?cache=shared" 这样的内存数据库
+func SQLiteConnection(dsn string) (*gorm.DB, error) {
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{
+		Logger: logger.NewGormLogger(gormlogger.Warn),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("sqlite connection error for %s: %w", dsn, err)
+	}
+	if err := db.Exec("PRAGMA foreign_keys = ON").Error; err != nil {
+		return nil, err
+	}
+	// SQLite 同一时间只允许一个写连接，使用单连接避免 database is locked
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	sqlDB.SetMaxOpenConns(1)
+	return db, nil
+}
@@ -0,0 +1,329 @@
+package jwtkeys
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+JWT 签名密钥
+
+  - HS256/HS384/HS512 使用 JWT_SECRET，只有一个密钥，令牌不带 kid
+  - RS256 和 EdDSA 使用 JWT_KEYS_DIR 中的私钥，每个文件 <kid>.pem 是一个 PKCS#8 私钥，
+    kid 按字典序最大的密钥用于签名，其余只用于验证，轮换后旧令牌在过期前仍然有效
+  - GenerateKey 生成的 kid 是创建时间（20060102T150405Z），Prune 据此删除已经没有有效令牌的旧密钥
+  - 验证时遇到未知的 kid 会重新读取目录（最多每 10 秒一次），签名前每分钟重新读取一次，其他实例轮换后不需要重启
+*/
+
+// kid 使用的时间格式，按字典序排序即按创建时间排序
+const kidLayout = "20060102T150405Z"
+
+// reloadInterval 遇到未知 kid 时重新读取目录的最短间隔
+const reloadInterval = 10 * time.Second
+
+// signingRefreshInterval 签名前重新读取目录的间隔，轮换后各实例在该时间内改用新密钥签名
+const signingRefreshInterval = time.Minute
+
+// ErrNotConfigured 未调用 Setup 就签发或验证令牌
+var ErrNotConfigured = errors.New("jwtkeys: signing keys are not configured")
+
+// ErrUnknownKey 令牌的 kid 不在密钥目录中
+var ErrUnknownKey = errors.New("jwtkeys: unknown key id")
+
+// IsAsymmetric 算法是否使用 JWT_KEYS_DIR 中的公私钥
+func IsAsymmetric(algorithm string) bool {
+	return algorithm == "RS256" || algorithm == "EdDSA"
+}
+
+// Keyring 签名密钥和验证密钥
+type Keyring struct {
+	algorithm string
+	dir       string
+
+	mu       sync.RWMutex
+	active   string
+	signing  interface{}
+	verify   map[string]interface{}
+	loadedAt time.Time
+}
+
+// NewHMAC 使用共享密钥的密钥环
+func NewHMAC(algorithm string, secret []byte) *Keyring {
+	return &Keyring{
+		algorithm: algorithm,
+		signing:   secret,
+		verify:    map[string]interface{}{"": secret},
+	}
+}
+
+// LoadDir 读取 dir 中的私钥，密钥类型必须与 algorithm 一致
+func LoadDir(algorithm, dir string) (*Keyring, error) {
+	k := &Keyring{algorithm: algorithm, dir: dir}
+	if err := k.Reload(); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// Algorithm 签名算法，验证时只接受该算法
+func (k *Keyring) Algorithm() string {
+	return k.algorithm
+}
+
+// SigningKey 签名使用的 kid 和私钥，共享密钥时 kid 为空
+// 重新读取目录失败时（例如正在写入新密钥）继续使用原来的密钥
+func (k *Keyring) SigningKey() (string, interface{}) {
+	k.mu.RLock()
+	stale := k.dir != "" && time.Since(k.loadedAt) > signingRefreshInterval
+	k.mu.RUnlock()
+	if stale {
+		_ = k.Reload()
+	}
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.active, k.signing
+}
+
+// VerificationKey kid 对应的验证密钥，找不到时重新读取目录
+func (k *Keyring) VerificationKey(kid string) (interface{}, error) {
+	k.mu.RLock()
+	key, ok := k.verify[kid]
+	stale := k.dir != "" && time.Since(k.loadedAt) > reloadInterval
+	k.mu.RUnlock()
+	if ok {
+		return key, nil
+	}
+	if stale {
+		if err := k.Reload(); err != nil {
+			return nil, err
+		}
+		k.mu.RLock()
+		key, ok = k.verify[kid]
+		k.mu.RUnlock()
+		if ok {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("%w %q", ErrUnknownKey, kid)
+}
+
+// Reload 重新读取密钥目录，共享密钥时什么都不做
+func (k *Keyring) Reload() error {
+	if k.dir == "" {
+		return nil
+	}
+	private, err := readDir(k.dir)
+	if err != nil {
+		return err
+	}
+	if len(private) == 0 {
+		return fmt.Errorf("jwtkeys: no *.pem keys in %s, run \"main jwt rotate\" to create one", k.dir)
+	}
+	verify := make(map[string]interface{}, len(private))
+	kids := make([]string, 0, len(private))
+	for kid, key := range private {
+		public, err := publicKey(k.algorithm, key)
+		if err != nil {
+			return fmt.Errorf("jwtkeys: key %q: %w", kid, err)
+		}
+		verify[kid] = public
+		kids = append(kids, kid)
+	}
+	sort.Strings(kids)
+	active := kids[len(kids)-1]
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.active, k.signing, k.verify, k.loadedAt = active, private[active], verify, time.Now()
+	return nil
+}
+
+// JSONWebKey 公钥的 JWK 表示
+type JSONWebKey struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// JSONWebKeySet /.well-known/jwks.json 的内容
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+// JWKS 全部验证公钥，共享密钥不能公开，返回空列表
+func (k *Keyring) JWKS() JSONWebKeySet {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	set := JSONWebKeySet{Keys: []JSONWebKey{}}
+	for kid, key := range k.verify {
+		jwk := JSONWebKey{Use: "sig", Alg: k.algorithm, Kid: kid}
+		switch public := key.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(public)
+		default:
+			continue
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	sort.Slice(set.Keys, func(i, j int) bool { return set.Keys[i].Kid > set.Keys[j].Kid })
+	return set
+}
+
+// GenerateKey 在 dir 中生成新的私钥并返回 kid，重新读取目录后新密钥用于签名
+func GenerateKey(algorithm, dir string, now time.Time) (string, error) {
+	var key crypto.PrivateKey
+	var err error
+	switch algorithm {
+	case "RS256":
+		key, err = rsa.GenerateKey(rand.Reader, 2048)
+	case "EdDSA":
+		_, key, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return "", fmt.Errorf("jwtkeys: %s does not use key files", algorithm)
+	}
+	if err != nil {
+		return "", err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", err
+	}
+	kid := now.UTC().Format(kidLayout)
+	// 同一秒内多次轮换时 kid 仍然递增
+	for i := 1; ; i++ {
+		if _, err := os.Stat(filepath.Join(dir, kid+".pem")); os.IsNotExist(err) {
+			break
+		}
+		kid = fmt.Sprintf("%s-%d", now.UTC().Format(kidLayout), i)
+	}
+	// 先写入临时文件再改名，其他实例不会读到写了一半的密钥
+	content := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	path := filepath.Join(dir, kid+".pem")
+	if err := os.WriteFile(path+".tmp", content, 0o600); err != nil {
+		return "", err
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return "", err
+	}
+	return kid, nil
+}
+
+// Prune 删除在 retention 之前就被新密钥替换的旧密钥，返回删除的 kid
+// retention 应不小于刷新令牌的有效期，kid 不是 GenerateKey 生成的密钥不会被删除
+func Prune(dir string, retention time.Duration, now time.Time) ([]string, error) {
+	private, err := readDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	kids := make([]string, 0, len(private))
+	for kid := range private {
+		kids = append(kids, kid)
+	}
+	sort.Strings(kids)
+	var pruned []string
+	for i := 0; i < len(kids)-1; i++ {
+		// 下一个密钥的创建时间就是该密钥停止签名的时间
+		replacedAt, err := time.Parse(kidLayout, strings.SplitN(kids[i+1], "-", 2)[0])
+		if err != nil || now.Sub(replacedAt) < retention {
+			continue
+		}
+		if _, err := time.Parse(kidLayout, strings.SplitN(kids[i], "-", 2)[0]); err != nil {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dir, kids[i]+".pem")); err != nil {
+			return pruned, err
+		}
+		pruned = append(pruned, kids[i])
+	}
+	return pruned, nil
+}
+
+// readDir 读取 dir 中全部 *.pem 私钥，文件名（不含扩展名）为 kid
+func readDir(dir string) (map[string]crypto.PrivateKey, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+	keys := make(map[string]crypto.PrivateKey, len(files))
+	for _, file := range files {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("jwtkeys: %w", err)
+		}
+		block, _ := pem.Decode(content)
+		if block == nil || block.Type != "PRIVATE KEY" {
+			return nil, fmt.Errorf("jwtkeys: %s is not a PKCS#8 private key", file)
+		}
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("jwtkeys: %s: %w", file, err)
+		}
+		keys[strings.TrimSuffix(filepath.Base(file), ".pem")] = key
+	}
+	return keys, nil
+}
+
+// publicKey 私钥对应的公钥，私钥类型必须与算法一致
+func publicKey(algorithm string, key crypto.PrivateKey) (interface{}, error) {
+	switch private := key.(type) {
+	case *rsa.PrivateKey:
+		if algorithm == "RS256" {
+			return &private.PublicKey, nil
+		}
+	case ed25519.PrivateKey:
+		if algorithm == "EdDSA" {
+			return private.Public(), nil
+		}
+	}
+	return nil, fmt.Errorf("%T cannot be used with %s", key, algorithm)
+}
+
+var (
+	mu      sync.RWMutex
+	current *Keyring
+)
+
+// Setup 设置签发和验证令牌使用的密钥环
+func Setup(k *Keyring) {
+	mu.Lock()
+	defer mu.Unlock()
+	current = k
+}
+
+// Current 当前的密钥环，未调用 Setup 时返回 ErrNotConfigured
+func Current() (*Keyring, error) {
+	mu.RLock()
+	defer mu.RUnlock()
+	if current == nil {
+		return nil, ErrNotConfigured
+	}
+	return current, nil
+}
@@ -0,0 +1,66 @@
+package logger
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+// 超过该耗时的SQL按慢查询记录
+const slowQueryThreshold = 200 * time.Millisecond
+
+// gormLogger 将 gorm 的日志转发到本包，SQL 日志会带上 context 中的请求ID
+type gormLogger struct {
+	level gormlogger.LogLevel
+}
+
+// NewGormLogger returns a gorm logger writing through the standard logger.
+func NewGormLogger(level gormlogger.LogLevel) gormlogger.Interface {
+	return &gormLogger{level: level}
+}
+
+func (l *gormLogger) LogMode(level gormlogger.LogLevel) gormlogger.Interface {
+	return &gormLogger{level: level}
+}
+
+func (l *gormLogger) Info(ctx context.Context, msg string, args ...interface{}) {
+	if l.level >= gormlogger.Info {
+		FromContext(ctx).Infof(msg, args...)
+	}
+}
+
+func (l *gormLogger) Warn(ctx context.Context, msg string, args ...interface{}) {
+	if l.level >= gormlogger.Warn {
+		FromContext(ctx).Warnf(msg, args...)
+	}
+}
+
+func (l *gormLogger) Error(ctx context.Context, msg string, args ...interface{}) {
+	if l.level >= gormlogger.Error {
+		FromContext(ctx).Errorf(msg, args...)
+	}
+}
+
+func (l *gormLogger) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
+	if l.level <= gormlogger.Silent {
+		return
+	}
+	elapsed := time.Since(begin)
+	sql, rows := fc()
+	entry := FromContext(ctx).WithFields(logrus.Fields{
+		"sql":        sql,
+		"rows":       rows,
+		"latency_ms": float64(elapsed.Microseconds()) / 1000,
+	})
+	switch {
+	case err != nil && l.level >= gormlogger.Error && !errors.Is(err, gormlogger.ErrRecordNotFound):
+		entry.WithError(err).Error("sql error")
+	case elapsed > slowQueryThreshold && l.level >= gormlogger.Warn:
+		entry.Warn("slow sql")
+	case l.level >= gormlogger.Info:
+		entry.Info("sql")
+	}
+}
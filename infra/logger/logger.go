@@ -2,9 +2,15 @@ package logger
 
 import (
 	"bytes"
-	"github.com/sirupsen/logrus"
+	"context"
+	"fmt"
+	"io"
+	"runtime"
+	"sort"
 	"strings"
 	"time"
+
+	"github.com/sirupsen/logrus"
 )
 
 var logger = logrus.New()
@@ -12,8 +18,26 @@ var logger = logrus.New()
 func init() {
 	logger.Level = logrus.InfoLevel
 	logger.Formatter = &formatter{}
+	// logrus 自带的 caller 会指向本包的封装函数，这里改用 hook 记录真正的调用位置
+	logger.AddHook(callerHook{})
+}
 
-	logger.SetReportCaller(true)
+// Setup 根据配置设置日志级别和输出格式，format 可选 json 或 console
+func Setup(level, format string) error {
+	lvl, err := logrus.ParseLevel(level)
+	if err != nil {
+		return err
+	}
+	switch format {
+	case "json":
+		logger.Formatter = &logrus.JSONFormatter{TimestampFormat: time.RFC3339}
+	case "console", "":
+		logger.Formatter = &formatter{}
+	default:
+		return fmt.Errorf("unknown log format %q", format)
+	}
+	logger.Level = lvl
+	return nil
 }
 
 func SetLogLevel(level logrus.Level) {
@@ -22,46 +46,125 @@ func SetLogLevel(level logrus.Level) {
 
 type Fields logrus.Fields
 
+type requestIDKey struct{}
+
+// ContextWithRequestID 将请求ID写入 context，之后通过 FromContext 打印的日志都会带上该ID
+func ContextWithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, requestID)
+}
+
+// RequestIDFromContext 读取 context 中的请求ID，不存在时返回空字符串
+func RequestIDFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	requestID, _ := ctx.Value(requestIDKey{}).(string)
+	return requestID
+}
+
+// WithFields returns an entry with the given fields on the standard logger.
+func WithFields(fields Fields) *logrus.Entry {
+	return logger.WithFields(logrus.Fields(fields))
+}
+
+// FromContext returns an entry carrying the request ID stored in ctx, if any.
+func FromContext(ctx context.Context) *logrus.Entry {
+	entry := logrus.NewEntry(logger)
+	if requestID := RequestIDFromContext(ctx); requestID != "" {
+		entry = entry.WithField("request_id", requestID)
+	}
+	return entry
+}
+
+// DebugWriter returns a writer whose lines are logged at level Debug, used to
+// redirect output of third-party libraries (gin, cron) through this package.
+func DebugWriter() io.Writer {
+	return logger.WriterLevel(logrus.DebugLevel)
+}
+
+// ErrorWriter returns a writer whose lines are logged at level Error.
+func ErrorWriter() io.Writer {
+	return logger.WriterLevel(logrus.ErrorLevel)
+}
+
 // Debugf logs a message at level Debug on the standard logger.
 func Debugf(format string, args ...interface{}) {
-	if logger.Level >= logrus.DebugLevel {
-		entry := logger.WithFields(logrus.Fields{})
-		entry.Debugf(format, args...)
-	}
+	logger.Debugf(format, args...)
 }
 
 // Infof logs a message at level Info on the standard logger.
 func Infof(format string, args ...interface{}) {
-	if logger.Level >= logrus.InfoLevel {
-		entry := logger.WithFields(logrus.Fields{})
-		entry.Infof(format, args...)
-	}
+	logger.Infof(format, args...)
 }
 
 // Warnf logs a message at level Warn on the standard logger.
 func Warnf(format string, args ...interface{}) {
-	if logger.Level >= logrus.WarnLevel {
-		entry := logger.WithFields(logrus.Fields{})
-		entry.Warnf(format, args...)
-	}
+	logger.Warnf(format, args...)
 }
 
 // Errorf logs a message at level Error on the standard logger.
 func Errorf(format string, args ...interface{}) {
-	if logger.Level >= logrus.ErrorLevel {
-		entry := logger.WithFields(logrus.Fields{})
-		entry.Errorf(format, args...)
-	}
+	logger.Errorf(format, args...)
 }
 
 // Fatalf logs a message at level Fatal on the standard logger.
 func Fatalf(format string, args ...interface{}) {
-	if logger.Level >= logrus.FatalLevel {
-		entry := logger.WithFields(logrus.Fields{})
-		entry.Fatalf(format, args...)
+	logger.Fatalf(format, args...)
+}
+
+// 这些包中的调用栈帧在查找 caller 时被跳过，gorm 的 SQL 日志因此会指向 repository 中的调用位置
+var callerSkipPrefixes = []string{
+	"github.com/sirupsen/logrus",
+	"gin-boilerplate/infra/logger.",
+	"gorm.io/",
+	"runtime.",
+}
+
+// callerHook 记录第一个不属于 callerSkipPrefixes 的调用位置
+type callerHook struct{}
+
+func (callerHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (callerHook) Fire(entry *logrus.Entry) error {
+	pcs := make([]uintptr, 32)
+	n := runtime.Callers(4, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+	for {
+		frame, more := frames.Next()
+		if !hasAnyPrefix(frame.Function, callerSkipPrefixes) {
+			entry.Data["caller"] = fmt.Sprintf("%s:%d", trimPath(frame.File), frame.Line)
+			return nil
+		}
+		if !more {
+			return nil
+		}
 	}
 }
 
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// 只保留文件路径的最后两级，例如 repository/inc_repo.go
+func trimPath(file string) string {
+	idx := strings.LastIndexByte(file, '/')
+	if idx == -1 {
+		return file
+	}
+	idx = strings.LastIndexByte(file[:idx], '/')
+	if idx == -1 {
+		return file
+	}
+	return file[idx+1:]
+}
+
 // Formatter implements logrus.Formatter interface.
 type formatter struct {
 	prefix string
@@ -78,5 +181,15 @@ func (f *formatter) Format(entry *logrus.Entry) ([]byte, error) {
 	sb.WriteString(f.prefix)
 	sb.WriteString(entry.Message)
 
+	keys := make([]string, 0, len(entry.Data))
+	for key := range entry.Data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		sb.WriteString(fmt.Sprintf(" %s=%v", key, entry.Data[key]))
+	}
+	sb.WriteByte('\n')
+
 	return sb.Bytes(), nil
 }
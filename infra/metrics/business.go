@@ -0,0 +1,78 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"gin-boilerplate/models"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// 采集业务指标时查询数据库的超时时间
+const businessQueryTimeout = 5 * time.Second
+
+var (
+	publicSeaCustomersDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "business", "public_sea_customers"),
+		"公海客户数量", nil, nil,
+	)
+	contractsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "business", "contracts"),
+		"各状态的合同数量", []string{"status"}, nil,
+	)
+	newCustomersTodayDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "business", "new_customers_today"),
+		"当天新建的客户数量", nil, nil,
+	)
+)
+
+// BusinessStats 业务指标的数据来源，由 repository.StatsRepo 实现
+type BusinessStats interface {
+	CountPublicSeaCustomers(ctx context.Context) (int64, error)
+	CountContractsByStatus(ctx context.Context) (map[models.ContractStatus]int64, error)
+	CountCustomersCreatedSince(ctx context.Context, since time.Time) (int64, error)
+}
+
+// businessCollector 在每次抓取时查询业务指标
+type businessCollector struct {
+	stats BusinessStats
+}
+
+// RegisterBusiness 注册业务指标，重复调用时替换之前注册的数据来源
+func RegisterBusiness(stats BusinessStats) error {
+	return register("business", &businessCollector{stats: stats})
+}
+
+func (c *businessCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- publicSeaCustomersDesc
+	ch <- contractsDesc
+	ch <- newCustomersTodayDesc
+}
+
+func (c *businessCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), businessQueryTimeout)
+	defer cancel()
+
+	if count, err := c.stats.CountPublicSeaCustomers(ctx); err != nil {
+		ch <- prometheus.NewInvalidMetric(publicSeaCustomersDesc, err)
+	} else {
+		ch <- prometheus.MustNewConstMetric(publicSeaCustomersDesc, prometheus.GaugeValue, float64(count))
+	}
+
+	if counts, err := c.stats.CountContractsByStatus(ctx); err != nil {
+		ch <- prometheus.NewInvalidMetric(contractsDesc, err)
+	} else {
+		for status, count := range counts {
+			ch <- prometheus.MustNewConstMetric(contractsDesc, prometheus.GaugeValue, float64(count), models.ContractStatusNameMap[status])
+		}
+	}
+
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+	if count, err := c.stats.CountCustomersCreatedSince(ctx, today); err != nil {
+		ch <- prometheus.NewInvalidMetric(newCustomersTodayDesc, err)
+	} else {
+		ch <- prometheus.MustNewConstMetric(newCustomersTodayDesc, prometheus.GaugeValue, float64(count))
+	}
+}
@@ -0,0 +1,137 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "gin_backend"
+
+// Registry 全部指标注册在该 registry 上，由 /metrics 路由暴露
+var Registry = prometheus.NewRegistry()
+
+var (
+	httpRequestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP 请求数，按路由模板和状态码统计",
+	}, []string{"method", "route", "status"})
+
+	httpRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP 请求耗时",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	dbQueryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "db_query_duration_seconds",
+		Help:      "gorm 查询耗时，按操作类型和数据表统计",
+		Buckets:   []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"operation", "table"})
+
+	dbQueryErrorsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "db_query_errors_total",
+		Help:      "gorm 查询错误数（不含记录不存在）",
+	}, []string{"operation", "table"})
+
+	dbRoutedQueriesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "db_routed_queries_total",
+		Help:      "配置从库时实际执行 SQL 的数据库（master/replica）和读写类型",
+	}, []string{"target", "kind"})
+
+	cronJobDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "cron_job_duration_seconds",
+		Help:      "定时任务执行耗时",
+		Buckets:   []float64{.01, .05, .1, .5, 1, 5, 10, 30, 60, 300},
+	}, []string{"job"})
+
+	cronJobFailuresTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cron_job_failures_total",
+		Help:      "定时任务失败次数",
+	}, []string{"job"})
+
+	cronJobLastSuccess = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "cron_job_last_success_timestamp_seconds",
+		Help:      "定时任务最近一次成功执行的时间",
+	}, []string{"job"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpRequestsTotal,
+		httpRequestDuration,
+		dbQueryDuration,
+		dbQueryErrorsTotal,
+		dbRoutedQueriesTotal,
+		cronJobDuration,
+		cronJobFailuresTotal,
+		cronJobLastSuccess,
+	)
+}
+
+var (
+	collectorsMu sync.Mutex
+	// 运行时注册的 collector，按名称记录以便重复注册时先注销旧的
+	registered = map[string]prometheus.Collector{}
+)
+
+// register 注册运行时创建的 collector，同名的 collector 已经注册时先注销，
+// 避免重复注册返回 AlreadyRegisteredError 或继续采集已经关闭的连接
+func register(name string, collector prometheus.Collector) error {
+	collectorsMu.Lock()
+	defer collectorsMu.Unlock()
+	if old, ok := registered[name]; ok {
+		Registry.Unregister(old)
+		delete(registered, name)
+	}
+	if err := Registry.Register(collector); err != nil {
+		return err
+	}
+	registered[name] = collector
+	return nil
+}
+
+// Handler 返回 /metrics 的 http.Handler；某个指标采集失败（例如业务指标查询数据库出错）时仍然返回其他指标
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{ErrorHandling: promhttp.ContinueOnError})
+}
+
+// ObserveHTTPRequest 记录一次 HTTP 请求，route 必须是路由模板而不是实际路径，以免标签基数失控
+func ObserveHTTPRequest(method, route string, status int, duration time.Duration) {
+	code := strconv.Itoa(status)
+	httpRequestsTotal.WithLabelValues(method, route, code).Inc()
+	httpRequestDuration.WithLabelValues(method, route, code).Observe(duration.Seconds())
+}
+
+// ObserveDBRoute 记录一条 SQL 最终使用的数据库，target 为 master 或 replica，kind 为 read 或 write
+func ObserveDBRoute(target, kind string) {
+	dbRoutedQueriesTotal.WithLabelValues(target, kind).Inc()
+}
+
+// ObserveJob 执行定时任务并记录耗时和失败次数
+func ObserveJob(job string, fn func() error) error {
+	start := time.Now()
+	err := fn()
+	cronJobDuration.WithLabelValues(job).Observe(time.Since(start).Seconds())
+	if err != nil {
+		cronJobFailuresTotal.WithLabelValues(job).Inc()
+		return err
+	}
+	cronJobLastSuccess.WithLabelValues(job).SetToCurrentTime()
+	return nil
+}
@@ -0,0 +1,143 @@
+package pii
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+/*
+客户敏感信息（电话、地址、身份证号码等）的字段级加密
+
+  - 使用 AES-256-GCM 加密，密文格式为 "enc:<密钥ID>:<base64(nonce+密文)>"，密钥ID用于轮换时找到解密密钥
+  - 没有 "enc:" 前缀的值视为加密上线前写入的明文，原样返回，执行密钥轮换时会被加密
+  - 加密后无法按值查询，需要查询或去重的字段另外保存盲索引（HMAC-SHA256）
+*/
+
+const prefix = "enc:"
+
+type keyring struct {
+	active   string
+	aeads    map[string]cipher.AEAD
+	indexKey []byte
+}
+
+var (
+	mu      sync.RWMutex
+	current *keyring
+)
+
+// ErrNotConfigured 未调用 Setup 就加密或解密
+var ErrNotConfigured = errors.New("pii: encryption keys are not configured")
+
+// Setup 设置加密密钥，active 为加密新数据使用的密钥ID，keys 中的其他密钥只用于解密
+func Setup(active string, keys map[string][]byte, indexKey []byte) error {
+	if _, ok := keys[active]; !ok {
+		return fmt.Errorf("pii: active key %q is not in the keyring", active)
+	}
+	aeads := make(map[string]cipher.AEAD, len(keys))
+	for id, key := range keys {
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return fmt.Errorf("pii: key %q: %w", id, err)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return fmt.Errorf("pii: key %q: %w", id, err)
+		}
+		aeads[id] = aead
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	current = &keyring{active: active, aeads: aeads, indexKey: indexKey}
+	return nil
+}
+
+func get() (*keyring, error) {
+	mu.RLock()
+	defer mu.RUnlock()
+	if current == nil {
+		return nil, ErrNotConfigured
+	}
+	return current, nil
+}
+
+// Encrypt 使用当前密钥加密，空字符串不加密
+func Encrypt(plaintext string) (string, error) {
+	if plaintext == "" {
+		return "", nil
+	}
+	ring, err := get()
+	if err != nil {
+		return "", err
+	}
+	aead := ring.aeads[ring.active]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(plaintext), []byte(ring.active))
+	return prefix + ring.active + ":" + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt 解密 Encrypt 的结果，明文（没有前缀）原样返回
+func Decrypt(value string) (string, error) {
+	if !strings.HasPrefix(value, prefix) {
+		return value, nil
+	}
+	ring, err := get()
+	if err != nil {
+		return "", err
+	}
+	parts := strings.SplitN(strings.TrimPrefix(value, prefix), ":", 2)
+	if len(parts) != 2 {
+		return "", errors.New("pii: malformed ciphertext")
+	}
+	aead, ok := ring.aeads[parts[0]]
+	if !ok {
+		return "", fmt.Errorf("pii: unknown key %q", parts[0])
+	}
+	sealed, err := base64.StdEncoding.DecodeString(parts[1])
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return "", errors.New("pii: malformed ciphertext")
+	}
+	plaintext, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(parts[0]))
+	if err != nil {
+		return "", fmt.Errorf("pii: decrypt with key %q: %w", parts[0], err)
+	}
+	return string(plaintext), nil
+}
+
+// NeedsRotation 值是明文或者不是用当前密钥加密的
+func NeedsRotation(value string) bool {
+	if value == "" {
+		return false
+	}
+	ring, err := get()
+	if err != nil {
+		return false
+	}
+	return !strings.HasPrefix(value, prefix+ring.active+":")
+}
+
+// BlindIndex 用于按值查询加密字段，相同的值得到相同的索引，空字符串的索引为空
+func BlindIndex(value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+	ring, err := get()
+	if err != nil {
+		return "", err
+	}
+	mac := hmac.New(sha256.New, ring.indexKey)
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
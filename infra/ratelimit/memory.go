@@ -0,0 +1,71 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// 过期计数的清理间隔
+const sweepInterval = time.Minute
+
+type memoryEntry struct {
+	count   int64
+	expires time.Time
+}
+
+// MemoryStore 进程内的计数存储，重启后计数清零，多实例之间不共享
+type MemoryStore struct {
+	mu        sync.Mutex
+	entries   map[string]*memoryEntry
+	lastSweep time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: map[string]*memoryEntry{}, lastSweep: time.Now()}
+}
+
+func (s *MemoryStore) Incr(_ context.Context, key string, window time.Duration) (int64, time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	s.sweep(now)
+	entry, ok := s.entries[key]
+	if !ok || !now.Before(entry.expires) {
+		entry = &memoryEntry{expires: now.Add(window)}
+		s.entries[key] = entry
+	}
+	entry.count++
+	return entry.count, entry.expires.Sub(now), nil
+}
+
+func (s *MemoryStore) Get(_ context.Context, key string) (int64, time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	entry, ok := s.entries[key]
+	if !ok || !now.Before(entry.expires) {
+		return 0, 0, nil
+	}
+	return entry.count, entry.expires.Sub(now), nil
+}
+
+func (s *MemoryStore) Reset(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, key)
+	return nil
+}
+
+// sweep 定期删除过期的计数，避免按IP计数的键无限增长，调用方持有锁
+func (s *MemoryStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < sweepInterval {
+		return
+	}
+	for key, entry := range s.entries {
+		if !now.Before(entry.expires) {
+			delete(s.entries, key)
+		}
+	}
+	s.lastSweep = now
+}
@@ -0,0 +1,24 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+)
+
+/*
+限流计数
+
+  - 使用固定窗口计数：窗口从某个键第一次计数开始，窗口结束后计数清零
+  - 单实例部署使用内存存储（NewMemoryStore），多实例部署使用 Redis（NewRedisStore）共享计数
+  - 调用方通过键区分用途，例如按路由和客户端IP限流、按客户端IP统计登录失败次数
+*/
+
+// Store 计数存储
+type Store interface {
+	// Incr 计数加1，返回当前窗口内的计数和窗口剩余时间
+	Incr(ctx context.Context, key string, window time.Duration) (count int64, ttl time.Duration, err error)
+	// Get 返回当前窗口内的计数和窗口剩余时间，键不存在或已过期时计数为0
+	Get(ctx context.Context, key string) (count int64, ttl time.Duration, err error)
+	// Reset 清除计数
+	Reset(ctx context.Context, key string) error
+}
@@ -0,0 +1,73 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Redis 中计数键的前缀
+const redisKeyPrefix = "ratelimit:"
+
+// 计数加1，第一次计数时设置窗口过期时间，返回计数和剩余毫秒数
+var incrScript = redis.NewScript(`
+local count = redis.call('INCR', KEYS[1])
+if count == 1 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[1])
+end
+return {count, redis.call('PTTL', KEYS[1])}
+`)
+
+// RedisStore 保存在 Redis 中的计数存储，多个实例共享计数
+type RedisStore struct {
+	client *redis.Client
+}
+
+// NewRedisStore 连接 Redis，连接是惰性建立的，Redis 不可用时在计数时返回错误
+func NewRedisStore(addr, password string, db int) *RedisStore {
+	return &RedisStore{client: redis.NewClient(&redis.Options{
+		Addr:     addr,
+		Password: password,
+		DB:       db,
+	})}
+}
+
+// Ping 检查 Redis 是否可用
+func (s *RedisStore) Ping(ctx context.Context) error {
+	return s.client.Ping(ctx).Err()
+}
+
+func (s *RedisStore) Incr(ctx context.Context, key string, window time.Duration) (int64, time.Duration, error) {
+	result, err := incrScript.Run(ctx, s.client, []string{redisKeyPrefix + key}, window.Milliseconds()).Int64Slice()
+	if err != nil {
+		return 0, 0, err
+	}
+	return result[0], time.Duration(result[1]) * time.Millisecond, nil
+}
+
+func (s *RedisStore) Get(ctx context.Context, key string) (int64, time.Duration, error) {
+	pipe := s.client.Pipeline()
+	get := pipe.Get(ctx, redisKeyPrefix+key)
+	ttl := pipe.PTTL(ctx, redisKeyPrefix+key)
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+		return 0, 0, err
+	}
+	count, err := get.Int64()
+	if errors.Is(err, redis.Nil) {
+		return 0, 0, nil
+	} else if err != nil {
+		return 0, 0, err
+	}
+	return count, ttl.Val(), nil
+}
+
+func (s *RedisStore) Reset(ctx context.Context, key string) error {
+	return s.client.Del(ctx, redisKeyPrefix+key).Err()
+}
+
+// Close 关闭 Redis 连接
+func (s *RedisStore) Close() error {
+	return s.client.Close()
+}
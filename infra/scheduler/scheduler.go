@@ -0,0 +1,112 @@
+package scheduler
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"gin-boilerplate/infra/logger"
+	"gin-boilerplate/infra/metrics"
+
+	"github.com/robfig/cron"
+)
+
+// 单例模式，保存定时任务调度器
+var (
+	c       *cron.Cron
+	mu      sync.Mutex
+	running bool
+)
+
+// 首次使用时才创建调度器，保证使用的是 main 中设置后的 time.Local
+func getCron() *cron.Cron {
+	mu.Lock()
+	defer mu.Unlock()
+	if c == nil {
+		c = cron.NewWithLocation(time.Local)
+		c.ErrorLog = log.New(logger.ErrorWriter(), "cron: ", 0)
+	}
+	return c
+}
+
+// namedJob 带名称的定时任务，执行结果会记录到日志和 metrics
+type namedJob struct {
+	name string
+	fn   func() error
+
+	mu        sync.Mutex
+	lastRun   time.Time
+	lastError string
+}
+
+func (j *namedJob) Run() {
+	logger.Infof("cron job %s started", j.name)
+	err := metrics.ObserveJob(j.name, j.fn)
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.lastRun = time.Now()
+	j.lastError = ""
+	if err != nil {
+		j.lastError = err.Error()
+		logger.Errorf("cron job %s failed: %s", j.name, err)
+		return
+	}
+	logger.Infof("cron job %s finished", j.name)
+}
+
+// AddJob 注册定时任务，spec 为 cron 表达式（例如 "@daily"），必须在 Start 之前调用
+func AddJob(spec, name string, fn func() error) error {
+	return getCron().AddJob(spec, &namedJob{name: name, fn: fn})
+}
+
+// Start 启动调度器
+func Start() {
+	getCron().Start()
+	mu.Lock()
+	defer mu.Unlock()
+	running = true
+}
+
+// Stop 停止调度器
+func Stop() {
+	getCron().Stop()
+	mu.Lock()
+	defer mu.Unlock()
+	running = false
+}
+
+type JobStatus struct {
+	Name      string     `json:"name"`
+	Next      time.Time  `json:"next_run"`
+	LastRun   *time.Time `json:"last_run,omitempty"`
+	LastError string     `json:"last_error,omitempty"`
+}
+
+type Status struct {
+	Running bool        `json:"running"`
+	Jobs    []JobStatus `json:"jobs"`
+}
+
+// GetStatus 返回调度器是否在运行以及每个任务的下次执行时间和上次执行结果
+func GetStatus() Status {
+	mu.Lock()
+	status := Status{Running: running, Jobs: []JobStatus{}}
+	mu.Unlock()
+
+	for _, entry := range getCron().Entries() {
+		job, ok := entry.Job.(*namedJob)
+		if !ok {
+			continue
+		}
+		job.mu.Lock()
+		jobStatus := JobStatus{Name: job.name, Next: entry.Next, LastError: job.lastError}
+		if !job.lastRun.IsZero() {
+			lastRun := job.lastRun
+			jobStatus.LastRun = &lastRun
+		}
+		job.mu.Unlock()
+		status.Jobs = append(status.Jobs, jobStatus)
+	}
+	return status
+}
@@ -1,57 +1,200 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"gin-boilerplate/config"
+	"gin-boilerplate/controllers"
 	"gin-boilerplate/infra/database"
+	"gin-boilerplate/infra/jwtkeys"
 	"gin-boilerplate/infra/logger"
+	"gin-boilerplate/infra/metrics"
+	"gin-boilerplate/infra/pii"
+	"gin-boilerplate/infra/scheduler"
 	"gin-boilerplate/migrations"
 	"gin-boilerplate/repository"
 	"gin-boilerplate/routers"
+	"os"
 	"time"
-
-	"github.com/robfig/cron"
-	"github.com/spf13/viper"
 )
 
-var c *cron.Cron
-
-func myTask() {
+func myTask() error {
     // 这里执行定时任务的代码
-    fmt.Println("Automatically update customer loan intent")
-	repository.AutoUpdateCustomerLoanIntent(database.DB)
-	fmt.Println("Migrate customer with 0 loan intent to public sea")
-	repository.AutoMigrateCustomerToPublicSea(database.DB)
+	// 迁移公海前需要读到刚更新的贷款意向，两步都走主库
+	db := database.DB.WithContext(database.WithReadYourWrites(context.Background()))
+	logger.Infof("Automatically update customer loan intent")
+	if err := repository.AutoUpdateCustomerLoanIntent(db); err != nil {
+		return fmt.Errorf("AutoUpdateCustomerLoanIntent error: %w", err)
+	}
+	logger.Infof("Migrate customer with 0 loan intent to public sea")
+	if err := repository.AutoMigrateCustomerToPublicSea(db); err != nil {
+		return fmt.Errorf("AutoMigrateCustomerToPublicSea error: %w", err)
+	}
+	return nil
+}
+
+// 每日把到期未还的分期标记为逾期
+func overdueTask() error {
+	logger.Infof("Flag overdue repayment installments")
+	if err := repository.AutoFlagOverdueInstallments(database.DB); err != nil {
+		return fmt.Errorf("AutoFlagOverdueInstallments error: %w", err)
+	}
+	return nil
+}
+
+// 每月初结算上个月的提成
+func commissionTask() error {
+	logger.Infof("Settle commissions of last month")
+	if err := repository.AutoSettleCommissions(database.DB); err != nil {
+		return fmt.Errorf("AutoSettleCommissions error: %w", err)
+	}
+	return nil
+}
+
+// 删除过期或撤销超过30天的登录会话，登录记录保留
+func sessionPurgeTask() error {
+	logger.Infof("Purge expired sessions")
+	if err := repository.AutoPurgeSessions(database.DB); err != nil {
+		return fmt.Errorf("AutoPurgeSessions error: %w", err)
+	}
+	return nil
+}
+
+// setupPII 加载敏感信息的加密密钥和盲索引密钥
+func setupPII() error {
+	piiConfig := config.Get().PII
+	active, keys, err := piiConfig.Keys()
+	if err != nil {
+		return err
+	}
+	return pii.Setup(active, keys, []byte(piiConfig.BlindIndexKey))
+}
+
+// setupJWTKeys 加载签发和验证令牌的密钥
+func setupJWTKeys() error {
+	keyring, err := config.Get().JWT.Keyring()
+	if err != nil {
+		return err
+	}
+	jwtkeys.Setup(keyring)
+	return nil
 }
 
-func setupCron() {
-    c = cron.New()
-    c.AddFunc("@every 1d", myTask) // 这里的"@every 1d"表示每天执行一次
-    c.Start()
+func setupCron() error {
+	// "@daily"表示每天零点执行一次（"@every 1d"不是合法的时间间隔，任务从未被注册）
+	if err := scheduler.AddJob("@daily", "customer_loan_intent", myTask); err != nil {
+		return err
+	}
+	if err := scheduler.AddJob("@daily", "loan_overdue", overdueTask); err != nil {
+		return err
+	}
+	if err := scheduler.AddJob("@monthly", "commission_settlement", commissionTask); err != nil {
+		return err
+	}
+	if err := scheduler.AddJob("@daily", "session_purge", sessionPurgeTask); err != nil {
+		return err
+	}
+	scheduler.Start()
+	return nil
 }
 
 func main() {
+	args := os.Args[1:]
+	if len(args) >= 2 && args[0] == "config" && args[1] == "check" {
+		os.Exit(configCheck(args[2:]))
+	}
+	if len(args) >= 2 && args[0] == "jwt" && args[1] == "rotate" {
+		os.Exit(jwtRotate(args[2:]))
+	}
+
+	// 配置不合法时拒绝启动
+	if err := config.SetupConfig(args); err != nil {
+		logger.Fatalf("config SetupConfig() error: %s", err)
+	}
+	if err := logger.Setup(config.Get().Log.Level, config.Get().Log.Format); err != nil {
+		logger.Fatalf("logger Setup() error: %s", err)
+	}
+	if err := setupPII(); err != nil {
+		logger.Fatalf("pii Setup() error: %s", err)
+	}
+	if err := setupJWTKeys(); err != nil {
+		logger.Fatalf("jwt keys Setup() error: %s", err)
+	}
 
 	//set timezone
-	viper.SetDefault("SERVER_TIMEZONE", "Asia/Shanghai")
-	loc, _ := time.LoadLocation(viper.GetString("SERVER_TIMEZONE"))
+	loc, _ := time.LoadLocation(config.Get().Server.Timezone)
 	time.Local = loc
 
-	if err := config.SetupConfig(); err != nil {
-		logger.Fatalf("config SetupConfig() error: %s", err)
-	}
-	defaultDSN, masterDSN, replicaDSN := config.DbConfiguration()
+	defaultDSN, masterDSN, replicaDSNs := config.DbConfiguration()
 
-	if err := database.DbConnection(defaultDSN, masterDSN, replicaDSN); err != nil {
+	if err := database.DbConnection(defaultDSN, masterDSN, replicaDSNs); err != nil {
 		logger.Fatalf("database DbConnection error: %s", err)
 	}
 	//later separate migration
-	migrations.Migrate()
+	if err := migrations.Migrate(database.DB); err != nil {
+		logger.Fatalf("migrations Migrate error: %s", err)
+	}
+	controllers.CheckMigrations(database.DB)
 
-	router := routers.SetupRoute()
+	repos := repository.NewGormRepositories(database.DB)
+	if err := metrics.RegisterBusiness(repos.Stats); err != nil {
+		logger.Fatalf("metrics RegisterBusiness error: %s", err)
+	}
+	router := routers.SetupRoute(repos)
 
-	setupCron()
+	if err := setupCron(); err != nil {
+		logger.Fatalf("setupCron error: %s", err)
+	}
 
 	logger.Fatalf("%v", router.Run(config.ServerConfig()))
 
 }
+
+// configCheck 打印生效的配置（隐藏密钥）并校验，配置不合法时返回非0退出码
+// 用法: ./main config check [--config path] [--server-port 8000 ...]
+func configCheck(args []string) int {
+	cfg, err := config.Load(args)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Print(cfg.Redacted())
+	if err := cfg.Validate(); err != nil {
+		fmt.Fprintln(os.Stderr, "\n"+err.Error())
+		return 1
+	}
+	fmt.Println("\nconfiguration OK")
+	return 0
+}
+
+// jwtRotate 在 JWT_KEYS_DIR 中生成新的签名密钥，并删除替换时间超过刷新令牌有效期的旧密钥
+// 运行中的实例在一分钟内改用新密钥签名，旧密钥签发的令牌在过期前仍然有效
+// 用法: ./main jwt rotate [--config path]
+func jwtRotate(args []string) int {
+	if err := config.SetupConfig(args); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	jwtConfig := config.Get().JWT
+	if !jwtkeys.IsAsymmetric(jwtConfig.Algorithm) {
+		fmt.Fprintf(os.Stderr, "JWT_ALGORITHM %s uses JWT_SECRET, set it to RS256 or EdDSA to use rotating keys\n", jwtConfig.Algorithm)
+		return 1
+	}
+	now := time.Now()
+	kid, err := jwtkeys.GenerateKey(jwtConfig.Algorithm, jwtConfig.KeysDir, now)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Printf("new %s signing key: %s\n", jwtConfig.Algorithm, kid)
+	retention := time.Minute * time.Duration(jwtConfig.RefreshTokenExpireMinutes)
+	pruned, err := jwtkeys.Prune(jwtConfig.KeysDir, retention, now)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	for _, old := range pruned {
+		fmt.Printf("removed retired key: %s\n", old)
+	}
+	return 0
+}
@@ -1,25 +1,71 @@
 package migrations
 
 import (
-	"gin-boilerplate/infra/database"
 	"gin-boilerplate/models"
+
+	"gorm.io/gorm"
 )
 
+var migrationModels = []interface{}{
+	&models.Zone{},       // 创建没有外键依赖的表
+	&models.Department{}, // 依赖Zone
+	&models.User{},       // 可能依赖其他表，如Department
+	&models.UserProfile{},
+	&models.WorkLog{},
+	&models.Customer{},
+	&models.KYCProfile{},
+	&models.KYCDocument{},
+	&models.Contract{},
+	&models.SystemLog{},
+	&models.FinancialProduct{},
+	&models.Disbursement{},
+	&models.RepaymentInstallment{},
+	&models.Repayment{},
+	&models.CommissionPlan{},
+	&models.CommissionTier{},
+	&models.CommissionStatement{},
+	&models.CommissionLine{},
+	&models.ContractAmountVersion{},
+	&models.ReconciliationItem{},
+	&models.PasswordHistory{},
+	&models.RecoveryCode{},
+	&models.UserIdentity{},
+	&models.APIKey{},
+	&models.Session{},
+	&models.LoginEvent{},
+	&models.Impersonation{},
+	&models.Notification{},
+	&models.Delegation{},
+}
+
 // Migrate Add list of model add for migrations
 // TODO later separate migration each models
-func Migrate() {
-	var migrationModels = []interface{}{
-		&models.Zone{},       // 创建没有外键依赖的表
-		&models.Department{}, // 依赖Zone
-		&models.User{},       // 可能依赖其他表，如Department
-		&models.UserProfile{},
-		&models.WorkLog{},
-		&models.Customer{},
-		&models.Contract{},
-		&models.SystemLog{},
+func Migrate(db *gorm.DB) error {
+	if err := db.AutoMigrate(migrationModels...); err != nil {
+		return err
 	}
-	err := database.DB.AutoMigrate(migrationModels...)
-	if err != nil {
-		return
+	return backfillCustomerPII(db)
+}
+
+// Pending 返回尚未迁移的表或字段（形如 "customers" 或 "customers.phone"），为空表示数据库结构是最新的
+func Pending(db *gorm.DB) ([]string, error) {
+	pending := []string{}
+	migrator := db.Migrator()
+	for _, model := range migrationModels {
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(model); err != nil {
+			return nil, err
+		}
+		table := stmt.Schema.Table
+		if !migrator.HasTable(table) {
+			pending = append(pending, table)
+			continue
+		}
+		for _, field := range stmt.Schema.Fields {
+			if field.DBName != "" && !migrator.HasColumn(model, field.DBName) {
+				pending = append(pending, table+"."+field.DBName)
+			}
+		}
 	}
+	return pending, nil
 }
@@ -0,0 +1,86 @@
+package migrations
+
+import (
+	"database/sql"
+	"fmt"
+	"gin-boilerplate/infra/pii"
+	"gin-boilerplate/models"
+
+	"gorm.io/gorm"
+)
+
+// 补齐客户敏感信息时每批处理的行数，每批单独提交
+const backfillBatchSize = 500
+
+// backfillCustomerPII 加密上线前写入的客户电话和地址是明文，也没有盲索引，在第一次轮换密钥前按电话去重和查找都找不到这些客户
+// 迁移时加密这些字段并补齐 phone_index；按主键分批处理，已经有盲索引的行不再读取，重复迁移不会重复更新
+func backfillCustomerPII(db *gorm.DB) error {
+	var afterID uint
+	for {
+		updates, lastID, err := customerBackfillUpdates(db, afterID)
+		if err != nil {
+			return err
+		}
+		if lastID == 0 {
+			return nil
+		}
+		err = db.Transaction(func(tx *gorm.DB) error {
+			for id, values := range updates {
+				if err := tx.Table("customers").Where("id = ?", id).UpdateColumns(values).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		afterID = lastID
+	}
+}
+
+// customerBackfillUpdates 读出主键大于 afterID、没有盲索引的一批客户，返回需要更新的字段和这批最后一行的主键，没有更多行时返回 0
+func customerBackfillUpdates(db *gorm.DB, afterID uint) (map[uint]map[string]interface{}, uint, error) {
+	rows, err := db.Table("customers").Select("id", "phone", "address").
+		Where("id > ? AND (phone_index IS NULL OR phone_index = '')", afterID).
+		Order("id").Limit(backfillBatchSize).Rows()
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var lastID uint
+	updates := map[uint]map[string]interface{}{}
+	for rows.Next() {
+		var id uint
+		var phone, address sql.NullString
+		if err := rows.Scan(&id, &phone, &address); err != nil {
+			return nil, 0, err
+		}
+		lastID = id
+		changed := map[string]interface{}{}
+		for column, value := range map[string]string{"phone": phone.String, "address": address.String} {
+			if !pii.NeedsRotation(value) {
+				continue
+			}
+			plaintext, err := pii.Decrypt(value)
+			if err != nil {
+				return nil, 0, fmt.Errorf("customers %d %s: %w", id, column, err)
+			}
+			changed[column] = models.EncryptedString(plaintext)
+		}
+		plainPhone, err := pii.Decrypt(phone.String)
+		if err != nil {
+			return nil, 0, fmt.Errorf("customers %d phone: %w", id, err)
+		}
+		if plainPhone != "" {
+			if changed["phone_index"], err = pii.BlindIndex(plainPhone); err != nil {
+				return nil, 0, err
+			}
+		}
+		if len(changed) > 0 {
+			updates[id] = changed
+		}
+	}
+	return updates, lastID, rows.Err()
+}
@@ -0,0 +1,23 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 系统管理员为脚本创建的 API 密钥，以所属用户的身份访问 Scopes 中的接口
+// 密钥只在创建时返回一次，数据库中只保存 Prefix（用于查找）和其余部分的哈希
+type APIKey struct {
+	gorm.Model
+	Name       string      `gorm:"not null"`
+	UserID     uint        `gorm:"not null;index"` // 密钥所属的用户，接口按该用户的身份和角色处理请求
+	CreatedBy  uint        `gorm:"not null"`       // 创建密钥的系统管理员
+	Prefix     string      `gorm:"not null;uniqueIndex"`
+	SecretHash string      `gorm:"not null"`
+	Scopes     Permissions `gorm:"type:text;not null"`
+	RateLimit  int64       `gorm:"not null"` // 每个限流周期内允许的请求数，0 表示使用默认值
+	ExpiresAt  *time.Time  // 为 nil 表示不过期
+	LastUsedAt *time.Time
+	RevokedAt  *time.Time
+}
@@ -0,0 +1,86 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+/*服务费提成*/
+
+// 提成周期的格式，例如 "2024-05"
+const CommissionPeriodLayout = "2006-01"
+
+// 提成方案，每个角色同时只有一个生效的方案，新建方案时旧方案自动失效
+//   - 本人签单：服务费 * 费率，当月签单金额达到阶梯门槛时使用该阶梯的费率，否则使用 BaseRate
+//   - 管理提成：销售经理按 OverrideRate 提取本部门其他人签单的服务费，销售总监同理提取本战区的
+type CommissionPlan struct {
+	gorm.Model
+	Name         string           `gorm:"unique;not null"`
+	RoleID       RoleID           `gorm:"not null;index"`             // 适用的角色
+	BaseRate     Money            `gorm:"type:numeric(9,6);not null"` // 本人签单的基础费率
+	OverrideRate Money            `gorm:"type:numeric(9,6);not null"` // 管理提成费率
+	Active       bool             `gorm:"not null"`
+	Tiers        []CommissionTier `gorm:"foreignKey:PlanID"`
+}
+
+// 按当月签单金额的提成阶梯
+type CommissionTier struct {
+	gorm.Model
+	PlanID    uint  `gorm:"index;not null"`
+	MinVolume Money `gorm:"type:numeric(18,2);not null"` // 当月签单金额不低于该值时适用
+	Rate      Money `gorm:"type:numeric(9,6);not null"`
+}
+
+type StatementStatus uint
+
+// 定义提成单的状态
+const (
+	STATEMENT_DRAFT  StatementStatus = iota // 待审核，重新结算会覆盖
+	STATEMENT_LOCKED                        // 已锁定，不再变化
+)
+
+var StatementStatusNameMap = map[StatementStatus]string{
+	STATEMENT_DRAFT:  "待审核",
+	STATEMENT_LOCKED: "已锁定",
+}
+
+// 每人每月一张提成单
+type CommissionStatement struct {
+	gorm.Model
+	UserID             uint            `gorm:"not null;uniqueIndex:idx_statement_user_period"`
+	Period             string          `gorm:"type:char(7);not null;uniqueIndex:idx_statement_user_period"`
+	Volume             Money           `gorm:"type:numeric(18,2);not null"` // 当月本人签单金额
+	OwnCommission      Money           `gorm:"type:numeric(18,2);not null"` // 本人签单提成
+	OverrideCommission Money           `gorm:"type:numeric(18,2);not null"` // 管理提成
+	Adjustment         Money           `gorm:"type:numeric(18,2);not null"` // 会计调整金额，可以为负
+	AdjustmentNote     string          // 调整说明
+	Total              Money           `gorm:"type:numeric(18,2);not null"`
+	Status             StatementStatus `gorm:"not null"`
+	LockedBy           *uint
+	LockedAt           *time.Time
+	Lines              []CommissionLine `gorm:"foreignKey:StatementID"`
+}
+
+type CommissionKind uint
+
+const (
+	COMMISSION_OWN      CommissionKind = iota // 本人签单
+	COMMISSION_OVERRIDE                       // 管理提成
+)
+
+var CommissionKindNameMap = map[CommissionKind]string{
+	COMMISSION_OWN:      "本人签单",
+	COMMISSION_OVERRIDE: "管理提成",
+}
+
+// 提成单明细，每个合同一行
+type CommissionLine struct {
+	gorm.Model
+	StatementID uint           `gorm:"index;not null"`
+	ContractID  uint           `gorm:"not null"`
+	Kind        CommissionKind `gorm:"not null"`
+	ServiceFee  Money          `gorm:"type:numeric(18,2);not null"`
+	Rate        Money          `gorm:"type:numeric(9,6);not null"`
+	Amount      Money          `gorm:"type:numeric(18,2);not null"`
+}
@@ -0,0 +1,44 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 委托人休假期间，被委托人代理委托人的审批和合同访问权限
+// 有效期为 [StartsAt, EndsAt)，到期后自动失效，不需要撤销
+type Delegation struct {
+	gorm.Model
+	PrincipalID uint      `gorm:"not null;index"` // 委托人
+	DelegateID  uint      `gorm:"not null;index"` // 被委托人
+	CreatedBy   uint      `gorm:"not null"`       // 创建委托的用户，委托人本人或系统管理员
+	Reason      string    `gorm:"type:text"`
+	StartsAt    time.Time `gorm:"not null"`
+	EndsAt      time.Time `gorm:"not null;index"`
+	RevokedAt   *time.Time
+}
+
+// Active 委托在 now 是否有效
+func (d Delegation) Active(now time.Time) bool {
+	return d.RevokedAt == nil && !now.Before(d.StartsAt) && now.Before(d.EndsAt)
+}
+
+// 可以委托的角色到可以作为被委托人的角色的映射
+// 只有按人分配的权限需要委托：合同的销售代表、金融专员（FinanceID）和会计（AccountantID）；其他角色按角色访问全部数据
+var DelegableRoles = map[RoleID][]RoleID{
+	SALES_REPRESENTATIVE: {SALES_REPRESENTATIVE},
+	FINANCE_SPECIALIST:   {FINANCE_SPECIALIST, FINANCE_MANAGER},
+	FINANCE_MANAGER:      {FINANCE_SPECIALIST, FINANCE_MANAGER},
+	ACCOUNTANT:           {ACCOUNTANT},
+}
+
+// CanDelegate principal 角色的用户是否可以委托给 delegate 角色的用户
+func CanDelegate(principal, delegate RoleID) bool {
+	for _, role := range DelegableRoles[principal] {
+		if role == delegate {
+			return true
+		}
+	}
+	return false
+}
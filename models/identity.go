@@ -0,0 +1,29 @@
+package models
+
+import "gorm.io/gorm"
+
+// 单点登录的外部身份，同一个身份提供方（Issuer）中的用户（Subject）只能关联一个用户
+type UserIdentity struct {
+	gorm.Model
+	UserID   uint   `gorm:"not null;index"`
+	Provider string `gorm:"not null"` // 配置中身份提供方的名称
+	Issuer   string `gorm:"not null;uniqueIndex:idx_identity_subject"`
+	Subject  string `gorm:"not null;uniqueIndex:idx_identity_subject"`
+	Email    string
+}
+
+// 不能按用户名自动关联单点登录身份的角色：控制身份提供方用户名的人不能借此登录这些账户
+var NonLinkableRoles = []RoleID{SYSTEM_ADMINISTRATOR, GENERAL_MANAGER, FINANCE_MANAGER}
+
+// AutoLinkable 按用户名自动关联时，该用户是否可以关联：特权角色和开启了两步验证的用户不能自动关联
+func (u *User) AutoLinkable() bool {
+	if u.TOTPEnabled {
+		return false
+	}
+	for _, role := range NonLinkableRoles {
+		if u.RoleID == role {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,24 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 系统管理员以其他用户的身份登录（代登录），用于排查用户看到的数据
+// 代登录令牌中的 imp 是该记录的ID，到期或结束后令牌立即失效；AllowWrite 为 false 时只能访问只读接口
+type Impersonation struct {
+	gorm.Model
+	AdminID    uint      `gorm:"not null;index"` // 发起代登录的系统管理员
+	UserID     uint      `gorm:"not null;index"` // 被代登录的用户
+	Reason     string    `gorm:"type:text;not null"`
+	AllowWrite bool      `gorm:"not null;default:false"`
+	ExpiresAt  time.Time `gorm:"not null"`
+	EndedAt    *time.Time
+}
+
+// Active 代登录在 now 是否仍然有效
+func (i Impersonation) Active(now time.Time) bool {
+	return i.EndedAt == nil && now.Before(i.ExpiresAt)
+}
@@ -3,6 +3,7 @@ package models
 import (
 	"time"
 
+	"github.com/shopspring/decimal"
 	"gorm.io/gorm"
 )
 
@@ -77,17 +78,34 @@ type User struct {
 	DepartmentID *uint       // 所属部门ID
 	ZoneID       *uint       // 所属战区ID
 	WorkLogs     []WorkLog   //工作日志
+
+	// 登录保护：连续密码错误次数、最后一次密码错误的时间和账户锁定截止时间，登录成功或管理员解锁后清零
+	FailedLogins      int `gorm:"not null;default:0"`
+	LastFailedLoginAt *time.Time
+	LockedUntil       *time.Time
+
+	// 系统管理员重置密码后 MustChangePassword 为 true，用户修改密码前只能访问 /me 接口，
+	// 临时密码在 PasswordExpiresAt 之后不能再登录
+	MustChangePassword bool `gorm:"not null;default:false"`
+	PasswordExpiresAt  *time.Time
+	PasswordChangedAt  *time.Time
+
+	// 两步验证：密钥加密存储，绑定时验证过一次验证码后 TOTPEnabled 才为 true，
+	// TOTPLastStep 是最后一次使用的验证码所在的周期，同一个验证码不能重复使用
+	TOTPSecret   EncryptedString
+	TOTPEnabled  bool  `gorm:"not null;default:false"`
+	TOTPLastStep int64 `gorm:"not null;default:0"`
 }
 
 // 用户详细信息
 type UserProfile struct {
 	gorm.Model
-	UserID  uint   `gorm:"not null"`
-	Name    string // 姓名
-	Age     uint   // 年龄
-	Gender  Gender // 性别
-	Address string // 地址
-	Phone   string // 电话
+	UserID  uint            `gorm:"not null"`
+	Name    string          // 姓名
+	Age     uint            // 年龄
+	Gender  Gender          // 性别
+	Address EncryptedString // 地址，加密存储
+	Phone   EncryptedString // 电话，加密存储
 }
 
 // 销售部门
@@ -121,11 +139,13 @@ type WorkLog struct {
 // 贷款客户
 type Customer struct {
 	gorm.Model
-	Name    string `gorm:"not null"` // 姓名
-	Phone   string `gorm:"not null"` // 电话
-	Age     uint   // 年龄
-	Gender  Gender // 性别
-	Address string // 地址
+	Name    string          `gorm:"not null"` // 姓名
+	Phone   EncryptedString `gorm:"not null"` // 电话，加密存储
+	Age     uint            // 年龄
+	Gender  Gender          // 性别
+	Address EncryptedString // 地址，加密存储
+	// 电话的盲索引，用于按电话查询和去重
+	PhoneIndex string `gorm:"index" json:"-"`
 	// 贷款意向，起始为10，每天减1，为0时表示不再有贷款意向，需要移入客户公海
 	// 如果用户贷款，将其设置为100
 	LoanIntent    int        `gorm:"not null"`
@@ -161,17 +181,30 @@ var ContractStatusStrToEnumMap = map[string]ContractStatus{
 	"已拒绝":   REJECTED,
 }
 
+// 默认币种，目前只支持人民币
+const DefaultCurrency = "CNY"
+
+// 金额精确到分，数据库中使用 numeric(18,2)，JSON 中以字符串输出，避免浮点误差
+type Money = decimal.Decimal
+
+// 金额保留的小数位数
+const MoneyScale = 2
+
 // 贷款详情
 type Contract struct {
 	gorm.Model
 	// 贷款信息
-	Amount           float64        // 贷款金额
-	ServiceFee       float64        // 服务费
+	Amount           Money          `gorm:"type:numeric(18,2);not null;default:0"` // 贷款金额
+	ServiceFee       Money          `gorm:"type:numeric(18,2);not null;default:0"` // 服务费
+	Currency         string         `gorm:"type:char(3);not null;default:'CNY'"`   // 币种(ISO 4217)
 	Status           ContractStatus // 贷款状态
+	ApprovedAt       *time.Time     // 批准时间，提成按批准时间所在月份结算
 	ContractDocument string         // 合同文档
 	FinancialProduct string         // 金融产品
 	BankDocuments    string         // 银行文件
-	BankAmount       float64        // 银行金额(实际金额)
+	BankAmount       Money          `gorm:"type:numeric(18,2);not null;default:0"` // 银行金额(实际金额)
+	BankConfirmedBy  *uint          // 确认银行金额的会计ID
+	BankConfirmedAt  *time.Time     // 会计确认银行金额的时间
 	Image            []byte         // 合同图片
 	// 相关人员
 	CustomerID   uint // 贷款客户ID
@@ -185,6 +218,12 @@ type Contract struct {
 // 系统日志
 type SystemLog struct {
 	gorm.Model
-	UserID uint   `gorm:"not null"`           // 关联的用户ID
-	Action string `gorm:"type:text;not null"` // 日志动作或消息
+	UserID   uint   `gorm:"not null"`           // 关联的用户ID
+	APIKeyID *uint  `gorm:"index"`              // 通过 API 密钥访问时为密钥ID
+	Action   string `gorm:"type:text;not null"` // 日志动作或消息
+	// 系统管理员代登录时为代登录记录ID和发起的系统管理员，UserID 是被代登录的用户
+	ImpersonationID *uint `gorm:"index"`
+	ImpersonatorID  *uint
+	// 被委托人代理委托人操作时为委托人，UserID 是被委托人
+	OnBehalfOfID *uint `gorm:"index"`
 }
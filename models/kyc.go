@@ -0,0 +1,124 @@
+package models
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+/*客户KYC资料和征信信息*/
+
+// 居民身份证号码（GB 11643-1999），加密存储，JSON 输出时脱敏
+type NationalID string
+
+// 身份证号码前17位的加权因子和校验码
+var (
+	nationalIDWeights    = [17]int{7, 9, 10, 5, 8, 4, 2, 1, 6, 3, 7, 9, 10, 5, 8, 4, 2}
+	nationalIDCheckCodes = "10X98765432"
+)
+
+// Valid 检查18位身份证号码的出生日期和校验码，末位的 x 视为 X
+func (id NationalID) Valid() bool {
+	s := strings.ToUpper(string(id))
+	if len(s) != 18 {
+		return false
+	}
+	sum := 0
+	for i := 0; i < 17; i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+		sum += int(s[i]-'0') * nationalIDWeights[i]
+	}
+	if s[17] != nationalIDCheckCodes[sum%11] {
+		return false
+	}
+	birth, err := time.Parse("20060102", s[6:14])
+	return err == nil && birth.Before(time.Now())
+}
+
+// Masked 只保留前6位（地区码）和后4位，例如 110105********123X
+func (id NationalID) Masked() string {
+	s := string(id)
+	if len(s) <= 10 {
+		return strings.Repeat("*", len(s))
+	}
+	return s[:6] + strings.Repeat("*", len(s)-10) + s[len(s)-4:]
+}
+
+func (id NationalID) MarshalJSON() ([]byte, error) {
+	return json.Marshal(id.Masked())
+}
+
+type MaritalStatus uint
+
+// 定义婚姻状况的枚举值
+const (
+	UNMARRIED MaritalStatus = iota // 未婚
+	MARRIED                        // 已婚
+	DIVORCED                       // 离异
+	WIDOWED                        // 丧偶
+)
+
+var MaritalStatusNameMap = map[MaritalStatus]string{
+	UNMARRIED: "未婚",
+	MARRIED:   "已婚",
+	DIVORCED:  "离异",
+	WIDOWED:   "丧偶",
+}
+
+var MaritalStatusStrToEnumMap = map[string]MaritalStatus{
+	"未婚": UNMARRIED,
+	"已婚": MARRIED,
+	"离异": DIVORCED,
+	"丧偶": WIDOWED,
+}
+
+type KYCStatus uint
+
+// 定义KYC审核状态，合同批准前客户的KYC必须已认证
+const (
+	KYC_PENDING  KYCStatus = iota // 待审核
+	KYC_VERIFIED                  // 已认证
+	KYC_REJECTED                  // 已拒绝
+)
+
+var KYCStatusNameMap = map[KYCStatus]string{
+	KYC_PENDING:  "待审核",
+	KYC_VERIFIED: "已认证",
+	KYC_REJECTED: "已拒绝",
+}
+
+var KYCStatusStrToEnumMap = map[string]KYCStatus{
+	"待审核": KYC_PENDING,
+	"已认证": KYC_VERIFIED,
+	"已拒绝": KYC_REJECTED,
+}
+
+// 客户的KYC资料，每个客户一份，销售修改后需要金融专员/经理重新审核
+type KYCProfile struct {
+	gorm.Model
+	CustomerID    uint          `gorm:"uniqueIndex;not null"`
+	NationalID    NationalID    `gorm:"not null"`                    // 身份证号码，加密存储
+	Occupation    string        `gorm:"not null"`                    // 职业
+	MonthlyIncome Money         `gorm:"type:numeric(18,2);not null"` // 月收入
+	Assets        Money         `gorm:"type:numeric(18,2);not null"` // 资产总额
+	ExistingDebts Money         `gorm:"type:numeric(18,2);not null"` // 现有负债
+	MaritalStatus MaritalStatus `gorm:"not null"`                    // 婚姻状况
+	Status        KYCStatus     `gorm:"not null"`
+	ReviewedBy    *uint         // 审核的金融专员/经理ID
+	ReviewedAt    *time.Time
+	ReviewNote    string        // 审核意见
+	Documents     []KYCDocument `gorm:"foreignKey:CustomerID;references:CustomerID"`
+}
+
+// KYC附件，例如身份证、收入证明、征信报告，File 与合同附件一样保存文件路径
+type KYCDocument struct {
+	gorm.Model
+	CustomerID uint   `gorm:"index;not null"`
+	Kind       string `gorm:"not null"` // 附件类型
+	File       string `gorm:"not null"` // 文件路径
+	UploadedBy uint   `gorm:"not null"` // 上传的销售人员ID
+}
@@ -0,0 +1,85 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+/*贷后管理：金融产品、放款和还款计划*/
+
+type RepaymentMethod uint
+
+// 定义还款方式的枚举值
+const (
+	EQUAL_INSTALLMENT RepaymentMethod = iota // 等额本息
+	EQUAL_PRINCIPAL                          // 等额本金
+)
+
+var RepaymentMethodNameMap = map[RepaymentMethod]string{
+	EQUAL_INSTALLMENT: "等额本息",
+	EQUAL_PRINCIPAL:   "等额本金",
+}
+
+var RepaymentMethodStrToEnumMap = map[string]RepaymentMethod{
+	"等额本息": EQUAL_INSTALLMENT,
+	"等额本金": EQUAL_PRINCIPAL,
+}
+
+// 金融产品，合同的 FinancialProduct 字段保存产品名称
+type FinancialProduct struct {
+	gorm.Model
+	Name            string          `gorm:"unique;not null"`            // 产品名称
+	TermMonths      int             `gorm:"not null"`                   // 贷款期限(月)
+	AnnualRate      Money           `gorm:"type:numeric(9,6);not null"` // 年利率，例如 0.0435 表示 4.35%
+	RepaymentMethod RepaymentMethod `gorm:"not null"`                   // 还款方式
+}
+
+// 放款记录，每个已批准的合同只能放款一次
+type Disbursement struct {
+	gorm.Model
+	ContractID     uint      `gorm:"uniqueIndex;not null"`
+	Bank           string    `gorm:"not null"`                    // 放款银行
+	Amount         Money     `gorm:"type:numeric(18,2);not null"` // 实际放款金额
+	ExpectedAmount Money     `gorm:"type:numeric(18,2);not null"` // 放款时合同的银行金额
+	DisbursedAt    time.Time `gorm:"not null"`                    // 放款日期
+	RecordedBy     uint      `gorm:"not null"`                    // 录入的金融专员/经理ID
+}
+
+type InstallmentStatus uint
+
+// 定义每期还款的状态
+const (
+	UNPAID  InstallmentStatus = iota // 待还款
+	PAID                             // 已还清
+	OVERDUE                          // 已逾期
+)
+
+var InstallmentStatusNameMap = map[InstallmentStatus]string{
+	UNPAID:  "待还款",
+	PAID:    "已还清",
+	OVERDUE: "已逾期",
+}
+
+// 还款计划中的一期，放款时根据金融产品生成
+type RepaymentInstallment struct {
+	gorm.Model
+	ContractID uint              `gorm:"index;not null"`
+	Period     int               `gorm:"not null"`                    // 期数，从1开始
+	DueDate    time.Time         `gorm:"not null"`                    // 应还日期
+	Principal  Money             `gorm:"type:numeric(18,2);not null"` // 应还本金
+	Interest   Money             `gorm:"type:numeric(18,2);not null"` // 应还利息
+	Amount     Money             `gorm:"type:numeric(18,2);not null"` // 应还总额
+	PaidAmount Money             `gorm:"type:numeric(18,2);not null"` // 已还金额
+	PaidAt     *time.Time        // 还清日期
+	Status     InstallmentStatus `gorm:"not null"`
+}
+
+// 还款记录，一笔还款按期数顺序冲抵尚未还清的分期
+type Repayment struct {
+	gorm.Model
+	ContractID uint      `gorm:"index;not null"`
+	Amount     Money     `gorm:"type:numeric(18,2);not null"` // 还款金额
+	PaidAt     time.Time `gorm:"not null"`                    // 还款日期
+	RecordedBy uint      `gorm:"not null"`                    // 录入的金融专员/经理ID
+}
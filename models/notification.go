@@ -0,0 +1,22 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 通知类型
+const (
+	NotificationImpersonation = "impersonation" // 系统管理员以该用户的身份登录
+	NotificationDelegation    = "delegation"    // 其他用户委托该用户代理审批
+)
+
+// 发给用户的站内通知，用户通过 /me/notifications 查看
+type Notification struct {
+	gorm.Model
+	UserID  uint   `gorm:"not null;index"`
+	Kind    string `gorm:"not null"`
+	Message string `gorm:"type:text;not null"`
+	ReadAt  *time.Time
+}
@@ -0,0 +1,10 @@
+package models
+
+import "gorm.io/gorm"
+
+// 用户使用过的密码，修改密码时新密码不能与最近 PASSWORD_HISTORY 次的密码相同
+type PasswordHistory struct {
+	gorm.Model
+	UserID       uint   `gorm:"not null;index"`
+	PasswordHash string `gorm:"not null"`
+}
@@ -0,0 +1,82 @@
+package models
+
+import (
+	"sort"
+	"strings"
+)
+
+// Permission 一组接口的访问权限，对应 /api/v1 下的一个路由分组
+// 用户按角色获得权限，API 密钥的 scopes 只能是密钥所属用户拥有的权限
+type Permission string
+
+const (
+	PermissionAdmin          Permission = "admin"          // /admin 系统管理
+	PermissionSale           Permission = "sale"           // /sale 客户、工作日志和提交合同
+	PermissionFinance        Permission = "finance"        // /finance 合同审核、放款和还款
+	PermissionCommission     Permission = "commission"     // /commission 提成方案和提成单
+	PermissionReconciliation Permission = "reconciliation" // /reconciliation 银行对账
+	PermissionContract       Permission = "contract"       // /contract 查看合同和还款计划
+)
+
+// 权限到拥有该权限的角色名称的映射
+var PermissionRoles = map[Permission][]string{
+	PermissionAdmin:          {"系统管理员"},
+	PermissionSale:           {"销售代表", "销售经理", "销售总监"},
+	PermissionFinance:        {"金融专员", "金融经理"},
+	PermissionCommission:     {"会计"},
+	PermissionReconciliation: {"会计"},
+	PermissionContract:       {"销售代表", "销售经理", "销售总监", "总经理", "金融经理", "会计"},
+}
+
+// Granted 角色是否拥有该权限
+func (p Permission) Granted(role string) bool {
+	for _, allowed := range PermissionRoles[p] {
+		if allowed == role {
+			return true
+		}
+	}
+	return false
+}
+
+// Permissions 以逗号分隔保存的权限集合
+type Permissions string
+
+// ParsePermissions 解析逗号分隔的权限名称，去重并排序，遇到未知权限时返回该名称
+func ParsePermissions(value string) (Permissions, string) {
+	seen := map[string]bool{}
+	var names []string
+	for _, name := range strings.Split(value, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" || seen[name] {
+			continue
+		}
+		if _, ok := PermissionRoles[Permission(name)]; !ok {
+			return "", name
+		}
+		seen[name] = true
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return Permissions(strings.Join(names, ",")), ""
+}
+
+// List 全部权限
+func (p Permissions) List() []Permission {
+	var list []Permission
+	for _, name := range strings.Split(string(p), ",") {
+		if name != "" {
+			list = append(list, Permission(name))
+		}
+	}
+	return list
+}
+
+// Has 集合中是否包含该权限
+func (p Permissions) Has(permission Permission) bool {
+	for _, granted := range p.List() {
+		if granted == permission {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,101 @@
+package models
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"gin-boilerplate/infra/pii"
+	"strings"
+)
+
+/*敏感信息：加密存储和脱敏显示*/
+
+// 加密存储的字符串，读写数据库时自动加解密，在 Go 代码中就是明文
+// 不能直接按值查询，需要查询的字段另外保存盲索引（见 Customer.PhoneIndex）
+type EncryptedString string
+
+func (s EncryptedString) Value() (driver.Value, error) {
+	return pii.Encrypt(string(s))
+}
+
+func (s *EncryptedString) Scan(value interface{}) error {
+	plaintext, err := scanEncrypted(value)
+	*s = EncryptedString(plaintext)
+	return err
+}
+
+func (id NationalID) Value() (driver.Value, error) {
+	return pii.Encrypt(string(id))
+}
+
+func (id *NationalID) Scan(value interface{}) error {
+	plaintext, err := scanEncrypted(value)
+	*id = NationalID(plaintext)
+	return err
+}
+
+func scanEncrypted(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return pii.Decrypt(v)
+	case []byte:
+		return pii.Decrypt(string(v))
+	}
+	return "", fmt.Errorf("cannot scan %T into an encrypted field", value)
+}
+
+// MaskPhone 保留前3位和后4位，例如 138****1234
+func MaskPhone(phone string) string {
+	runes := []rune(phone)
+	if len(runes) <= 7 {
+		return strings.Repeat("*", len(runes))
+	}
+	return string(runes[:3]) + strings.Repeat("*", len(runes)-7) + string(runes[len(runes)-4:])
+}
+
+// MaskAddress 只保留前6个字（通常是省市区），例如 上海市浦东新****
+func MaskAddress(address string) string {
+	runes := []rune(address)
+	if len(runes) == 0 {
+		return ""
+	}
+	if len(runes) <= 6 {
+		return string(runes[:len(runes)/2]) + "****"
+	}
+	return string(runes[:6]) + "****"
+}
+
+// 需要完整客户电话和地址的角色：销售代表要联系自己的客户
+// 其他角色看到脱敏后的信息，需要时通过“查看完整信息”操作查看
+var FullPIIRoles = []RoleID{SALES_REPRESENTATIVE}
+
+// SeesFullPII 角色是否需要完整的客户电话和地址
+func SeesFullPII(role RoleID) bool {
+	for _, allowed := range FullPIIRoles {
+		if allowed == role {
+			return true
+		}
+	}
+	return false
+}
+
+// MaskPII 把客户的电话和地址替换为脱敏后的值，只用于返回给不需要完整信息的角色
+func (c *Customer) MaskPII() {
+	c.Phone = EncryptedString(MaskPhone(string(c.Phone)))
+	c.Address = EncryptedString(MaskAddress(string(c.Address)))
+}
+
+// MaskPII 把员工的电话和地址替换为脱敏后的值
+func (p *UserProfile) MaskPII() {
+	p.Phone = EncryptedString(MaskPhone(string(p.Phone)))
+	p.Address = EncryptedString(MaskAddress(string(p.Address)))
+}
+
+// 客户完整的敏感信息，只由审计过的“查看完整信息”操作返回
+type CustomerPII struct {
+	CustomerID uint
+	Phone      string
+	Address    string
+	NationalID string // 没有KYC资料时为空
+}
@@ -0,0 +1,53 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+/*合同金额版本和会计对账*/
+
+// 合同金额的一个版本，提交合同时生成第1版，之后每次修改金额都新增一版
+type ContractAmountVersion struct {
+	gorm.Model
+	ContractID uint   `gorm:"not null;uniqueIndex:idx_contract_amount_version"`
+	Version    int    `gorm:"not null;uniqueIndex:idx_contract_amount_version"`
+	Amount     Money  `gorm:"type:numeric(18,2);not null"`
+	ServiceFee Money  `gorm:"type:numeric(18,2);not null"`
+	BankAmount Money  `gorm:"type:numeric(18,2);not null"`
+	ChangedBy  uint   `gorm:"not null"` // 修改人ID
+	Reason     string `gorm:"not null"` // 修改原因
+}
+
+type ReconciliationStatus uint
+
+// 定义对账差异的状态
+const (
+	RECONCILIATION_OPEN     ReconciliationStatus = iota // 待处理
+	RECONCILIATION_RESOLVED                             // 已处理
+)
+
+var ReconciliationStatusNameMap = map[ReconciliationStatus]string{
+	RECONCILIATION_OPEN:     "待处理",
+	RECONCILIATION_RESOLVED: "已处理",
+}
+
+var ReconciliationStatusStrToEnumMap = map[string]ReconciliationStatus{
+	"待处理": RECONCILIATION_OPEN,
+	"已处理": RECONCILIATION_RESOLVED,
+}
+
+// 对账差异：会计确认的银行金额与合同金额之差超过容差时生成，每个合同同时最多一条待处理的差异
+type ReconciliationItem struct {
+	gorm.Model
+	ContractID   uint                 `gorm:"index;not null"`
+	AccountantID uint                 `gorm:"index;not null"`              // 负责处理的会计，即合同的 AccountantID
+	Amount       Money                `gorm:"type:numeric(18,2);not null"` // 合同金额
+	BankAmount   Money                `gorm:"type:numeric(18,2);not null"` // 会计确认的银行金额
+	Difference   Money                `gorm:"type:numeric(18,2);not null"` // 合同金额 - 银行金额
+	Status       ReconciliationStatus `gorm:"not null"`
+	ResolvedBy   *uint
+	ResolvedAt   *time.Time
+	Resolution   string // 处理说明
+}
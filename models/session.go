@@ -0,0 +1,48 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 登录方式，记录在会话和登录记录中
+const (
+	LoginMethodPassword       = "password"
+	LoginMethodTOTP           = "totp"
+	LoginMethodSSO            = "sso"
+	LoginMethodRegister       = "register"
+)
+
+// 登录会话，每次登录创建一个，对应一组轮换的刷新令牌
+// 令牌中的 sid 是 Family；刷新时签发新的刷新令牌并替换 RefreshID，旧的刷新令牌再次使用时撤销整个会话
+type Session struct {
+	gorm.Model
+	UserID        uint      `gorm:"not null;index"`
+	Family        string    `gorm:"not null;uniqueIndex"`
+	RefreshID     string    `gorm:"not null"` // 当前有效的刷新令牌的 jti
+	Method        string    `gorm:"not null"` // 登录方式，LoginMethod*
+	UserAgent     string    `gorm:"type:text"`
+	IP            string    // 登录时的客户端IP
+	LastSeenAt    time.Time `gorm:"not null"`
+	ExpiresAt     time.Time `gorm:"not null;index"` // 刷新令牌过期后会话结束，每次刷新后延长
+	RevokedAt     *time.Time
+	RevokedReason string
+}
+
+// Active 会话在 now 是否仍然有效
+func (s Session) Active(now time.Time) bool {
+	return s.RevokedAt == nil && now.Before(s.ExpiresAt)
+}
+
+// 登录成功的记录，会话删除后仍然保留
+// NewIP 表示用户以前登录成功过，但没有从这个IP登录过
+type LoginEvent struct {
+	gorm.Model
+	UserID    uint   `gorm:"not null;index"`
+	SessionID uint   `gorm:"not null"`
+	Method    string `gorm:"not null"`
+	IP        string `gorm:"index"`
+	UserAgent string `gorm:"type:text"`
+	NewIP     bool   `gorm:"not null;default:false"`
+}
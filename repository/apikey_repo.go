@@ -0,0 +1,155 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gin-boilerplate/helpers"
+	"gin-boilerplate/infra/apperror"
+	"gin-boilerplate/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+/*API 密钥：系统管理员为脚本创建密钥，脚本以密钥所属用户的身份访问 scopes 中的接口*/
+
+// lastUsedInterval 记录密钥最近使用时间的最小间隔，避免每个请求都写数据库
+const lastUsedInterval = time.Minute
+
+type apiKeyContextKey struct{}
+
+// ContextWithAPIKey 返回带有 API 密钥ID的 context，使用该 context 写入的系统日志会记录密钥ID
+func ContextWithAPIKey(ctx context.Context, keyID uint) context.Context {
+	return context.WithValue(ctx, apiKeyContextKey{}, keyID)
+}
+
+// apiKeyFromContext 请求使用的 API 密钥ID，不是通过密钥访问时返回 nil
+func apiKeyFromContext(ctx context.Context) *uint {
+	if ctx == nil {
+		return nil
+	}
+	if keyID, ok := ctx.Value(apiKeyContextKey{}).(uint); ok {
+		return &keyID
+	}
+	return nil
+}
+
+// NewAPIKey 新建密钥的参数，Prefix 和 SecretHash 由 helpers.GenerateAPIKey 生成
+type NewAPIKey struct {
+	UserID     uint
+	Name       string
+	Scopes     models.Permissions
+	RateLimit  int64
+	ExpiresAt  time.Time
+	Prefix     string
+	SecretHash string
+}
+
+// CreateAPIKey 系统管理员为用户创建 API 密钥，scopes 必须都是该用户的角色拥有的权限
+func CreateAPIKey(db *gorm.DB, systemManagerID uint, key NewAPIKey) (*models.APIKey, error) {
+	owner, err := GetUserByID(db, key.UserID)
+	if err != nil {
+		return nil, err
+	}
+	role := models.RoleNameMap[owner.RoleID]
+	for _, scope := range key.Scopes.List() {
+		if !scope.Granted(role) {
+			return nil, apperror.New(apperror.CodeAPIKeyScopeNotAllowed).WithDetails(map[string]string{
+				"scope": string(scope),
+				"role":  role,
+			})
+		}
+	}
+	expiresAt := key.ExpiresAt
+	apiKey := models.APIKey{
+		Name:       key.Name,
+		UserID:     key.UserID,
+		CreatedBy:  systemManagerID,
+		Prefix:     key.Prefix,
+		SecretHash: key.SecretHash,
+		Scopes:     key.Scopes,
+		RateLimit:  key.RateLimit,
+		ExpiresAt:  &expiresAt,
+	}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&apiKey).Error; err != nil {
+			return err
+		}
+		return logAction(tx, systemManagerID, fmt.Sprintf("为用户: %d 创建API密钥: %s（%s）", key.UserID, key.Prefix, key.Scopes))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &apiKey, nil
+}
+
+// ListAPIKeys 系统管理员查看全部 API 密钥，包括已过期和已撤销的
+func ListAPIKeys(db *gorm.DB, systemManagerID uint) ([]models.APIKey, error) {
+	var keys []models.APIKey
+	if err := db.Order("id").Find(&keys).Error; err != nil {
+		return nil, err
+	}
+	logAction(db, systemManagerID, "查看API密钥列表")
+	return keys, nil
+}
+
+// RevokeAPIKey 系统管理员撤销 API 密钥，撤销后立即失效，重复撤销不会修改撤销时间
+func RevokeAPIKey(db *gorm.DB, systemManagerID, keyID uint) (*models.APIKey, error) {
+	var key models.APIKey
+	if err := db.First(&key, keyID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, apperror.New(apperror.CodeAPIKeyNotFound)
+		}
+		return nil, err
+	}
+	if key.RevokedAt != nil {
+		return &key, nil
+	}
+	now := time.Now()
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&key).UpdateColumn("revoked_at", now).Error; err != nil {
+			return err
+		}
+		return logAction(tx, systemManagerID, fmt.Sprintf("撤销API密钥: %s", key.Prefix))
+	})
+	if err != nil {
+		return nil, err
+	}
+	key.RevokedAt = &now
+	return &key, nil
+}
+
+// AuthenticateAPIKey 验证完整的密钥，返回密钥和所属用户
+// 密钥格式错误、不存在、已撤销或已过期时返回 CodeAPIKeyInvalid，验证通过时更新最近使用时间
+func AuthenticateAPIKey(db *gorm.DB, plaintext string, now time.Time) (*models.APIKey, *models.User, error) {
+	prefix, secret, ok := helpers.ParseAPIKey(plaintext)
+	if !ok {
+		return nil, nil, apperror.New(apperror.CodeAPIKeyInvalid)
+	}
+	var key models.APIKey
+	if err := db.Where("prefix = ?", prefix).First(&key).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, apperror.New(apperror.CodeAPIKeyInvalid)
+		}
+		return nil, nil, err
+	}
+	if !helpers.CheckAPIKeySecret(secret, key.SecretHash) || key.RevokedAt != nil ||
+		(key.ExpiresAt != nil && !now.Before(*key.ExpiresAt)) {
+		return nil, nil, apperror.New(apperror.CodeAPIKeyInvalid)
+	}
+	owner, err := GetUserByID(db, key.UserID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, apperror.New(apperror.CodeAPIKeyInvalid)
+		}
+		return nil, nil, err
+	}
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= lastUsedInterval {
+		if err := db.Model(&key).UpdateColumn("last_used_at", now).Error; err != nil {
+			return nil, nil, err
+		}
+		key.LastUsedAt = &now
+	}
+	return &key, owner, nil
+}
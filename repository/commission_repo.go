@@ -0,0 +1,321 @@
+package repository
+
+import (
+	"fmt"
+	"gin-boilerplate/infra/apperror"
+	"gin-boilerplate/models"
+	"sort"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+/*服务费提成：提成方案、月度结算和提成单审核*/
+
+// CreateCommissionPlan 为角色创建新的提成方案，该角色原有的方案失效
+func CreateCommissionPlan(db *gorm.DB, userID uint, name string, roleID models.RoleID,
+	baseRate, overrideRate models.Money, tiers []models.CommissionTier) (*models.CommissionPlan, error) {
+	plan := models.CommissionPlan{
+		Name:         name,
+		RoleID:       roleID,
+		BaseRate:     baseRate,
+		OverrideRate: overrideRate,
+		Active:       true,
+		Tiers:        tiers,
+	}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.CommissionPlan{}).
+			Where("role_id = ? AND active = ?", roleID, true).
+			Update("active", false).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(&plan).Error; err != nil {
+			return err
+		}
+		return logAction(tx, userID, fmt.Sprintf("创建了%s的提成方案: %s", models.RoleNameMap[roleID], name))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &plan, nil
+}
+
+// GetCommissionPlans 提成方案列表，包括已失效的方案
+func GetCommissionPlans(db *gorm.DB) ([]models.CommissionPlan, error) {
+	var plans []models.CommissionPlan
+	if err := db.Preload("Tiers", func(db *gorm.DB) *gorm.DB {
+		return db.Order("min_volume")
+	}).Order("id").Find(&plans).Error; err != nil {
+		return nil, err
+	}
+	return plans, nil
+}
+
+// ownRate 本人签单的费率：取当月签单金额达到的最高阶梯，没有达到任何阶梯时使用基础费率
+func ownRate(plan models.CommissionPlan, volume models.Money) models.Money {
+	rate := plan.BaseRate
+	best := decimal.Zero
+	for _, tier := range plan.Tiers {
+		if volume.GreaterThanOrEqual(tier.MinVolume) && tier.MinVolume.GreaterThanOrEqual(best) {
+			rate, best = tier.Rate, tier.MinVolume
+		}
+	}
+	return rate
+}
+
+// SettleCommissions 结算 period（格式 2006-01）月份内批准的合同，为每个有提成的人生成或更新提成单
+// 已锁定的提成单不会变化；待审核的提成单重新计算明细，会计的调整金额保留
+// userID 为0表示由定时任务触发
+func SettleCommissions(db *gorm.DB, userID uint, period string) ([]models.CommissionStatement, error) {
+	start, err := time.ParseInLocation(models.CommissionPeriodLayout, period, time.Local)
+	if err != nil {
+		return nil, apperror.Wrap(apperror.CodeInvalidParams, err)
+	}
+	end := start.AddDate(0, 1, 0)
+
+	var statements []models.CommissionStatement
+	err = db.Transaction(func(tx *gorm.DB) error {
+		var plans []models.CommissionPlan
+		if err := tx.Preload("Tiers").Where("active = ?", true).Find(&plans).Error; err != nil {
+			return err
+		}
+		planByRole := map[models.RoleID]models.CommissionPlan{}
+		for _, plan := range plans {
+			planByRole[plan.RoleID] = plan
+		}
+
+		var contracts []models.Contract
+		if err := tx.Where("status = ? AND currency = ? AND approved_at >= ? AND approved_at < ?",
+			models.APPROVED, models.DefaultCurrency, start, end).
+			Order("id").Find(&contracts).Error; err != nil {
+			return err
+		}
+
+		// 当月每个销售人员的签单金额，决定适用的阶梯
+		volumes := map[uint]models.Money{}
+		for _, contract := range contracts {
+			volumes[contract.SalerID] = volumes[contract.SalerID].Add(contract.Amount)
+		}
+
+		roles, err := userRoles(tx)
+		if err != nil {
+			return err
+		}
+		managers, directors, err := orgLeaders(tx)
+		if err != nil {
+			return err
+		}
+
+		lines := map[uint][]models.CommissionLine{}
+		addLine := func(beneficiary uint, contract models.Contract, kind models.CommissionKind, rate models.Money) {
+			if !rate.IsPositive() {
+				return
+			}
+			lines[beneficiary] = append(lines[beneficiary], models.CommissionLine{
+				ContractID: contract.ID,
+				Kind:       kind,
+				ServiceFee: contract.ServiceFee,
+				Rate:       rate,
+				Amount:     contract.ServiceFee.Mul(rate).Round(models.MoneyScale),
+			})
+		}
+		for _, contract := range contracts {
+			if plan, ok := planByRole[roles[contract.SalerID]]; ok {
+				addLine(contract.SalerID, contract, models.COMMISSION_OWN, ownRate(plan, volumes[contract.SalerID]))
+			}
+			// 经理、总监不从自己签的单中提取管理提成
+			for _, leader := range []*uint{managers[contract.DepartmentID], directors[contract.ZoneID]} {
+				if leader == nil || *leader == contract.SalerID {
+					continue
+				}
+				if plan, ok := planByRole[roles[*leader]]; ok {
+					addLine(*leader, contract, models.COMMISSION_OVERRIDE, plan.OverrideRate)
+				}
+			}
+		}
+
+		// 之前结算过、这次没有明细的待审核提成单也要重新计算（例如合同状态被修改）
+		var existing []models.CommissionStatement
+		if err := tx.Where("period = ?", period).Find(&existing).Error; err != nil {
+			return err
+		}
+		byUser := map[uint]models.CommissionStatement{}
+		for _, statement := range existing {
+			byUser[statement.UserID] = statement
+			if _, ok := lines[statement.UserID]; !ok {
+				lines[statement.UserID] = nil
+			}
+		}
+
+		userIDs := make([]uint, 0, len(lines))
+		for id := range lines {
+			userIDs = append(userIDs, id)
+		}
+		sort.Slice(userIDs, func(i, j int) bool { return userIDs[i] < userIDs[j] })
+
+		for _, id := range userIDs {
+			statement, ok := byUser[id]
+			if ok && statement.Status == models.STATEMENT_LOCKED {
+				continue
+			}
+			if !ok {
+				statement = models.CommissionStatement{UserID: id, Period: period, Adjustment: decimal.Zero}
+			}
+			statement.Volume = volumes[id]
+			statement.OwnCommission, statement.OverrideCommission = decimal.Zero, decimal.Zero
+			for _, line := range lines[id] {
+				if line.Kind == models.COMMISSION_OWN {
+					statement.OwnCommission = statement.OwnCommission.Add(line.Amount)
+				} else {
+					statement.OverrideCommission = statement.OverrideCommission.Add(line.Amount)
+				}
+			}
+			statement.Total = statement.OwnCommission.Add(statement.OverrideCommission).Add(statement.Adjustment)
+			statement.Status = models.STATEMENT_DRAFT
+			statement.Lines = nil
+			if err := tx.Save(&statement).Error; err != nil {
+				return err
+			}
+			if err := tx.Unscoped().Where("statement_id = ?", statement.ID).Delete(&models.CommissionLine{}).Error; err != nil {
+				return err
+			}
+			statement.Lines = lines[id]
+			for i := range statement.Lines {
+				statement.Lines[i].StatementID = statement.ID
+			}
+			if len(statement.Lines) > 0 {
+				if err := tx.Create(&statement.Lines).Error; err != nil {
+					return err
+				}
+			}
+			statements = append(statements, statement)
+		}
+		return logAction(tx, userID, fmt.Sprintf("结算了 %s 的提成，生成或更新了 %d 张提成单", period, len(statements)))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return statements, nil
+}
+
+// userRoles 所有用户的角色
+func userRoles(db *gorm.DB) (map[uint]models.RoleID, error) {
+	var users []models.User
+	if err := db.Select("id", "role_id").Find(&users).Error; err != nil {
+		return nil, err
+	}
+	roles := make(map[uint]models.RoleID, len(users))
+	for _, user := range users {
+		roles[user.ID] = user.RoleID
+	}
+	return roles, nil
+}
+
+// orgLeaders 部门经理和战区总监
+func orgLeaders(db *gorm.DB) (managers, directors map[uint]*uint, err error) {
+	var departments []models.Department
+	if err := db.Find(&departments).Error; err != nil {
+		return nil, nil, err
+	}
+	var zones []models.Zone
+	if err := db.Find(&zones).Error; err != nil {
+		return nil, nil, err
+	}
+	managers = make(map[uint]*uint, len(departments))
+	for _, department := range departments {
+		managers[department.ID] = department.ManagerID
+	}
+	directors = make(map[uint]*uint, len(zones))
+	for _, zone := range zones {
+		directors[zone.ID] = zone.DirectorID
+	}
+	return managers, directors, nil
+}
+
+// GetCommissionStatements 查询某月的提成单
+func GetCommissionStatements(db *gorm.DB, userID uint, period string) ([]models.CommissionStatement, error) {
+	var statements []models.CommissionStatement
+	if err := db.Where("period = ?", period).Order("user_id").Find(&statements).Error; err != nil {
+		return nil, err
+	}
+	logAction(db, userID, fmt.Sprintf("查看了 %s 的提成单", period))
+	return statements, nil
+}
+
+// GetCommissionStatement 查询提成单和明细
+func GetCommissionStatement(db *gorm.DB, userID, statementID uint) (*models.CommissionStatement, error) {
+	var statement models.CommissionStatement
+	if err := db.Preload("Lines", func(db *gorm.DB) *gorm.DB {
+		return db.Order("id")
+	}).First(&statement, statementID).Error; err != nil {
+		return nil, err
+	}
+	logAction(db, userID, fmt.Sprintf("查看了提成单: %d", statementID))
+	return &statement, nil
+}
+
+// AdjustCommissionStatement 会计调整提成单金额，adjustment 可以为负，已锁定的提成单不能调整
+func AdjustCommissionStatement(db *gorm.DB, userID, statementID uint, adjustment models.Money, note string) (*models.CommissionStatement, error) {
+	var statement models.CommissionStatement
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&statement, statementID).Error; err != nil {
+			return err
+		}
+		if statement.Status == models.STATEMENT_LOCKED {
+			return apperror.New(apperror.CodeStatementLocked)
+		}
+		statement.Adjustment = adjustment.Round(models.MoneyScale)
+		statement.AdjustmentNote = note
+		statement.Total = statement.OwnCommission.Add(statement.OverrideCommission).Add(statement.Adjustment)
+		if err := tx.Model(&statement).Updates(map[string]interface{}{
+			"adjustment":      statement.Adjustment,
+			"adjustment_note": note,
+			"total":           statement.Total,
+		}).Error; err != nil {
+			return err
+		}
+		return logAction(tx, userID, fmt.Sprintf("调整了提成单: %d，调整金额: %s", statementID, statement.Adjustment))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &statement, nil
+}
+
+// LockCommissionStatement 会计锁定提成单，锁定后不再被结算或调整
+func LockCommissionStatement(db *gorm.DB, userID, statementID uint) (*models.CommissionStatement, error) {
+	var statement models.CommissionStatement
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&statement, statementID).Error; err != nil {
+			return err
+		}
+		if statement.Status == models.STATEMENT_LOCKED {
+			return apperror.New(apperror.CodeStatementLocked)
+		}
+		now := time.Now()
+		statement.Status = models.STATEMENT_LOCKED
+		statement.LockedBy = &userID
+		statement.LockedAt = &now
+		if err := tx.Model(&statement).Updates(map[string]interface{}{
+			"status":    models.STATEMENT_LOCKED,
+			"locked_by": userID,
+			"locked_at": now,
+		}).Error; err != nil {
+			return err
+		}
+		return logAction(tx, userID, fmt.Sprintf("锁定了提成单: %d", statementID))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &statement, nil
+}
+
+// AutoSettleCommissions 每月初结算上个月的提成
+func AutoSettleCommissions(db *gorm.DB) error {
+	now := time.Now()
+	lastMonth := now.AddDate(0, 0, -now.Day()).Format(models.CommissionPeriodLayout)
+	_, err := SettleCommissions(db, 0, lastMonth)
+	return err
+}
@@ -0,0 +1,145 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"gin-boilerplate/infra/apperror"
+	"gin-boilerplate/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+/*审批委托：委托人休假期间，被委托人可以处理指派给委托人的合同，操作日志同时记录被委托人和委托人*/
+
+// NewDelegation 新建委托的参数，有效期为 [StartsAt, EndsAt)
+type NewDelegation struct {
+	PrincipalID uint
+	DelegateID  uint
+	Reason      string
+	StartsAt    time.Time
+	EndsAt      time.Time
+}
+
+// CreateDelegation 委托人本人或系统管理员（operatorID）创建委托，并通知被委托人
+// 被委托人必须是 models.DelegableRoles 中委托人的角色可以委托的角色
+func CreateDelegation(db *gorm.DB, operatorID uint, params NewDelegation) (*models.Delegation, error) {
+	principal, err := GetUserByID(db, params.PrincipalID)
+	if err != nil {
+		return nil, err
+	}
+	delegate, err := GetUserByID(db, params.DelegateID)
+	if err != nil {
+		return nil, err
+	}
+	if principal.ID == delegate.ID || !models.CanDelegate(principal.RoleID, delegate.RoleID) {
+		return nil, apperror.New(apperror.CodeDelegationNotAllowed).WithDetails(map[string]string{
+			"principal_role": models.RoleNameMap[principal.RoleID],
+			"delegate_role":  models.RoleNameMap[delegate.RoleID],
+		})
+	}
+
+	delegation := models.Delegation{
+		PrincipalID: principal.ID,
+		DelegateID:  delegate.ID,
+		CreatedBy:   operatorID,
+		Reason:      params.Reason,
+		StartsAt:    params.StartsAt,
+		EndsAt:      params.EndsAt,
+	}
+	period := fmt.Sprintf("%s 至 %s", params.StartsAt.Format("2006-01-02 15:04"), params.EndsAt.Format("2006-01-02 15:04"))
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&delegation).Error; err != nil {
+			return err
+		}
+		if err := createNotification(tx, delegate.ID, models.NotificationDelegation, fmt.Sprintf(
+			"%s 委托你在 %s 期间代理审批和合同访问，原因：%s", principal.UserName, period, params.Reason,
+		)); err != nil {
+			return err
+		}
+		return logAction(tx, operatorID, fmt.Sprintf("创建委托: %d 用户: %d 委托用户: %d（%s）", delegation.ID, principal.ID, delegate.ID, period))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &delegation, nil
+}
+
+// ListDelegations 用户作为委托人或被委托人的全部委托，最新的在前
+func ListDelegations(db *gorm.DB, userID uint) ([]models.Delegation, error) {
+	var delegations []models.Delegation
+	if err := db.Where("principal_id = ? OR delegate_id = ?", userID, userID).Order("id DESC").Find(&delegations).Error; err != nil {
+		return nil, err
+	}
+	return delegations, nil
+}
+
+// GetAllDelegations 系统管理员查看全部委托
+func GetAllDelegations(db *gorm.DB, systemManagerID uint) ([]models.Delegation, error) {
+	var delegations []models.Delegation
+	if err := db.Order("id DESC").Find(&delegations).Error; err != nil {
+		return nil, err
+	}
+	logAction(db, systemManagerID, "查看委托列表")
+	return delegations, nil
+}
+
+// RevokeDelegation 提前结束委托，principalID 不为 nil 时只能撤销该委托人的委托
+func RevokeDelegation(db *gorm.DB, operatorID, delegationID uint, principalID *uint) (*models.Delegation, error) {
+	query := db.Where("id = ?", delegationID)
+	if principalID != nil {
+		query = query.Where("principal_id = ?", *principalID)
+	}
+	var delegation models.Delegation
+	if err := query.First(&delegation).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, apperror.New(apperror.CodeDelegationNotFound)
+		}
+		return nil, err
+	}
+	if delegation.RevokedAt != nil {
+		return &delegation, nil
+	}
+	now := time.Now()
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&delegation).UpdateColumn("revoked_at", now).Error; err != nil {
+			return err
+		}
+		return logAction(tx, operatorID, fmt.Sprintf("撤销委托: %d", delegation.ID))
+	})
+	if err != nil {
+		return nil, err
+	}
+	delegation.RevokedAt = &now
+	return &delegation, nil
+}
+
+// delegatedPrincipals 在 now 委托给 delegateID 的委托人
+func delegatedPrincipals(db *gorm.DB, delegateID uint, now time.Time) ([]uint, error) {
+	var principals []uint
+	err := db.Model(&models.Delegation{}).
+		Where("delegate_id = ? AND revoked_at IS NULL AND starts_at <= ? AND ends_at > ?", delegateID, now, now).
+		Distinct().Pluck("principal_id", &principals).Error
+	if err != nil {
+		return nil, err
+	}
+	return principals, nil
+}
+
+// actingFor 检查 userID 是否可以处理指派给 assigneeID 的数据：本人，或者 assigneeID 当前委托给了 userID
+// 代理委托人时返回委托人ID，本人时返回 nil
+func actingFor(db *gorm.DB, userID, assigneeID uint) (principalID *uint, ok bool, err error) {
+	if userID == assigneeID {
+		return nil, true, nil
+	}
+	principals, err := delegatedPrincipals(db, userID, time.Now())
+	if err != nil {
+		return nil, false, err
+	}
+	for _, principal := range principals {
+		if principal == assigneeID {
+			return &assigneeID, true, nil
+		}
+	}
+	return nil, false, nil
+}
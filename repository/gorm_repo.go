@@ -0,0 +1,501 @@
+package repository
+
+import (
+	"context"
+	"gin-boilerplate/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// gormRepository 基于 gorm 的仓储实现，同时实现全部仓储接口，
+// 每次调用都把请求 context 传给 gorm，数据库方言由传入的 *gorm.DB 决定（Postgres 或 SQLite）
+type gormRepository struct {
+	db *gorm.DB
+}
+
+// NewGormRepositories 使用给定的数据库连接创建全部仓储
+func NewGormRepositories(db *gorm.DB) *Repositories {
+	repo := &gormRepository{db: db}
+	return &Repositories{
+		Users:          repo,
+		TwoFactor:      repo,
+		Identities:     repo,
+		APIKeys:        repo,
+		Sessions:       repo,
+		Impersonations: repo,
+		Notifications:  repo,
+		Delegations:    repo,
+		Org:            repo,
+		SystemLogs:     repo,
+		Customers:      repo,
+		WorkLogs:       repo,
+		Contracts:      repo,
+		Loans:          repo,
+		Commission:     repo,
+		Reconciliation: repo,
+		Stats:          repo,
+	}
+}
+
+func (r *gormRepository) conn(ctx context.Context) *gorm.DB {
+	return r.db.WithContext(ctx)
+}
+
+/*UserRepo*/
+
+func (r *gormRepository) CreateUser(ctx context.Context, userName, password string) (*models.User, error) {
+	return CreateUser(r.conn(ctx), userName, password)
+}
+
+func (r *gormRepository) CreateSystemManager(ctx context.Context, userName, password string) (*models.User, error) {
+	return CreateSystemManager(r.conn(ctx), userName, password)
+}
+
+func (r *gormRepository) DeleteUser(ctx context.Context, systemManagerID, userID uint) error {
+	return DeleteUser(r.conn(ctx), systemManagerID, userID)
+}
+
+func (r *gormRepository) Login(ctx context.Context, userName, password string, policy LoginPolicy) (*models.User, error) {
+	return Login(r.conn(ctx), userName, password, policy)
+}
+
+func (r *gormRepository) UnlockUser(ctx context.Context, systemManagerID, userID uint) (*models.User, error) {
+	return UnlockUser(r.conn(ctx), systemManagerID, userID)
+}
+
+func (r *gormRepository) GetUserByUserName(ctx context.Context, userName string) (*models.User, error) {
+	return GetUserByUserName(r.conn(ctx), userName)
+}
+
+func (r *gormRepository) GetUserByID(ctx context.Context, userID uint) (*models.User, error) {
+	return GetUserByID(r.conn(ctx), userID)
+}
+
+func (r *gormRepository) UpdateUserNameOrPassword(ctx context.Context, systemManagerID, userID uint, userName, password string, history int) (*models.User, error) {
+	return UpdateUserNameOrPassword(r.conn(ctx), systemManagerID, userID, userName, password, history)
+}
+
+func (r *gormRepository) ChangePassword(ctx context.Context, userID uint, currentFamily, currentPassword, newPassword string, history int) (*models.User, error) {
+	return ChangePassword(r.conn(ctx), userID, currentFamily, currentPassword, newPassword, history)
+}
+
+func (r *gormRepository) ResetPassword(ctx context.Context, systemManagerID, userID uint, temporaryPassword string, expiresAt time.Time, history int) (*models.User, error) {
+	return ResetPassword(r.conn(ctx), systemManagerID, userID, temporaryPassword, expiresAt, history)
+}
+
+func (r *gormRepository) UpdateUserRole(ctx context.Context, systemManagerID, userID uint, roleID models.RoleID) (*models.User, error) {
+	return UpdateUserRole(r.conn(ctx), systemManagerID, userID, roleID)
+}
+
+func (r *gormRepository) UpdateUserProfile(ctx context.Context, userID uint, name string, age uint, gender models.Gender, address, phone string) (*models.User, error) {
+	return UpdateUserProfile(r.conn(ctx), userID, name, age, gender, address, phone)
+}
+
+func (r *gormRepository) GetUserList(ctx context.Context, systemManagerID uint) ([]models.User, error) {
+	return GetUserList(r.conn(ctx), systemManagerID)
+}
+
+/*TwoFactorRepo*/
+
+func (r *gormRepository) StartTOTPEnrollment(ctx context.Context, userID uint, password, secret string) (*models.User, error) {
+	return StartTOTPEnrollment(r.conn(ctx), userID, password, secret)
+}
+
+func (r *gormRepository) ConfirmTOTPEnrollment(ctx context.Context, userID uint, code string, skew int, recoveryCodes []string) (*models.User, error) {
+	return ConfirmTOTPEnrollment(r.conn(ctx), userID, code, skew, recoveryCodes)
+}
+
+func (r *gormRepository) VerifyLoginTOTP(ctx context.Context, userID uint, code string, skew int, policy LoginPolicy) (*models.User, error) {
+	return VerifyLoginTOTP(r.conn(ctx), userID, code, skew, policy)
+}
+
+func (r *gormRepository) DisableTOTP(ctx context.Context, userID uint, password, code string, skew int, requiredRoles []string) (*models.User, error) {
+	return DisableTOTP(r.conn(ctx), userID, password, code, skew, requiredRoles)
+}
+
+func (r *gormRepository) RegenerateRecoveryCodes(ctx context.Context, userID uint, code string, skew int, recoveryCodes []string) error {
+	return RegenerateRecoveryCodes(r.conn(ctx), userID, code, skew, recoveryCodes)
+}
+
+func (r *gormRepository) ResetTOTP(ctx context.Context, systemManagerID, userID uint) (*models.User, error) {
+	return ResetTOTP(r.conn(ctx), systemManagerID, userID)
+}
+
+/*IdentityRepo*/
+
+func (r *gormRepository) SSOLogin(ctx context.Context, identity SSOIdentity, policy LoginPolicy) (*models.User, error) {
+	return SSOLogin(r.conn(ctx), identity, policy)
+}
+
+func (r *gormRepository) SyncSSORole(ctx context.Context, userID uint, provider string, role models.RoleID) (*models.User, error) {
+	return SyncSSORole(r.conn(ctx), userID, provider, role)
+}
+
+/*APIKeyRepo*/
+
+func (r *gormRepository) CreateAPIKey(ctx context.Context, systemManagerID uint, key NewAPIKey) (*models.APIKey, error) {
+	return CreateAPIKey(r.conn(ctx), systemManagerID, key)
+}
+
+func (r *gormRepository) ListAPIKeys(ctx context.Context, systemManagerID uint) ([]models.APIKey, error) {
+	return ListAPIKeys(r.conn(ctx), systemManagerID)
+}
+
+func (r *gormRepository) RevokeAPIKey(ctx context.Context, systemManagerID, keyID uint) (*models.APIKey, error) {
+	return RevokeAPIKey(r.conn(ctx), systemManagerID, keyID)
+}
+
+func (r *gormRepository) AuthenticateAPIKey(ctx context.Context, plaintext string, now time.Time) (*models.APIKey, *models.User, error) {
+	return AuthenticateAPIKey(r.conn(ctx), plaintext, now)
+}
+
+/*SessionRepo*/
+
+func (r *gormRepository) CreateSession(ctx context.Context, session NewSession) (*models.Session, error) {
+	return CreateSession(r.conn(ctx), session)
+}
+
+func (r *gormRepository) TouchSession(ctx context.Context, family string, now time.Time) error {
+	return TouchSession(r.conn(ctx), family, now)
+}
+
+func (r *gormRepository) RotateRefreshToken(ctx context.Context, family, refreshID string, expiresAt time.Time) error {
+	return RotateRefreshToken(r.conn(ctx), family, refreshID, expiresAt)
+}
+
+func (r *gormRepository) RefreshSession(ctx context.Context, family, presentedID, newRefreshID string, expiresAt time.Time) (*models.User, error) {
+	return RefreshSession(r.conn(ctx), family, presentedID, newRefreshID, expiresAt)
+}
+
+func (r *gormRepository) ListSessions(ctx context.Context, userID uint) ([]models.Session, error) {
+	return ListSessions(r.conn(ctx), userID)
+}
+
+func (r *gormRepository) RevokeSession(ctx context.Context, userID, sessionID uint) error {
+	return RevokeSession(r.conn(ctx), userID, sessionID)
+}
+
+func (r *gormRepository) RevokeOtherSessions(ctx context.Context, userID uint, currentFamily string) (int64, error) {
+	return RevokeOtherSessions(r.conn(ctx), userID, currentFamily)
+}
+
+func (r *gormRepository) GetUserSessions(ctx context.Context, systemManagerID, userID uint) ([]models.Session, error) {
+	return GetUserSessions(r.conn(ctx), systemManagerID, userID)
+}
+
+func (r *gormRepository) RevokeUserSession(ctx context.Context, systemManagerID, sessionID uint) (*models.Session, error) {
+	return RevokeUserSession(r.conn(ctx), systemManagerID, sessionID)
+}
+
+func (r *gormRepository) GetLoginHistory(ctx context.Context, filter LoginHistoryFilter) ([]models.LoginEvent, error) {
+	return GetLoginHistory(r.conn(ctx), filter)
+}
+
+func (r *gormRepository) GetUserLoginHistory(ctx context.Context, systemManagerID uint, filter LoginHistoryFilter) ([]models.LoginEvent, error) {
+	return GetUserLoginHistory(r.conn(ctx), systemManagerID, filter)
+}
+
+/*OrgRepo*/
+
+func (r *gormRepository) CreateZone(ctx context.Context, systemManagerID uint, name string) (*models.Zone, error) {
+	return CreateZone(r.conn(ctx), systemManagerID, name)
+}
+
+func (r *gormRepository) CreateSalesDepartment(ctx context.Context, systemManagerID uint, name string, zoneID *uint) (*models.Department, error) {
+	return CreateSalesDepartment(r.conn(ctx), systemManagerID, name, zoneID)
+}
+
+func (r *gormRepository) CreateFinanceDepartment(ctx context.Context, systemManagerID uint, name string) (*models.Department, error) {
+	return CreateFinanceDepartment(r.conn(ctx), systemManagerID, name)
+}
+
+func (r *gormRepository) AssignDepartmentToZone(ctx context.Context, systemManagerID, departmentID, zoneID uint) error {
+	return AssignDepartmentToZone(r.conn(ctx), systemManagerID, departmentID, zoneID)
+}
+
+func (r *gormRepository) AssignUserToDepartment(ctx context.Context, systemManagerID, userID, departmentID uint) error {
+	return AssignUserToDepartment(r.conn(ctx), systemManagerID, userID, departmentID)
+}
+
+func (r *gormRepository) AssignUserToZone(ctx context.Context, systemManagerID, userID, zoneID uint) error {
+	return AssignUserToZone(r.conn(ctx), systemManagerID, userID, zoneID)
+}
+
+func (r *gormRepository) AssignDirectorToZone(ctx context.Context, systemManagerID, userID, zoneID uint) error {
+	return AssignDirectorToZone(r.conn(ctx), systemManagerID, userID, zoneID)
+}
+
+func (r *gormRepository) AssignManagerToDepartment(ctx context.Context, systemManagerID, userID, departmentID uint) error {
+	return AssignManagerToDepartment(r.conn(ctx), systemManagerID, userID, departmentID)
+}
+
+func (r *gormRepository) GetZones(ctx context.Context, withDepartments bool) ([]models.Zone, error) {
+	return GetZones(r.conn(ctx), withDepartments)
+}
+
+func (r *gormRepository) GetZoneByID(ctx context.Context, zoneID uint, withDepartments bool) (models.Zone, error) {
+	return GetZoneByID(r.conn(ctx), zoneID, withDepartments)
+}
+
+func (r *gormRepository) GetDepartments(ctx context.Context, withUsers bool) ([]models.Department, error) {
+	return GetDepartments(r.conn(ctx), withUsers)
+}
+
+func (r *gormRepository) GetDepartmentByID(ctx context.Context, departmentID uint, withUsers bool) (models.Department, error) {
+	return GetDepartmentByID(r.conn(ctx), departmentID, withUsers)
+}
+
+/*SystemLogRepo*/
+
+func (r *gormRepository) GetSystemLogList(ctx context.Context, systemManagerID uint) ([]models.SystemLog, error) {
+	return GetSystemLogList(r.conn(ctx), systemManagerID)
+}
+
+/*CustomerRepo*/
+
+func (r *gormRepository) CreateCustomer(ctx context.Context, userID uint, name, phone string) (*models.Customer, error) {
+	return CreateCustomer(r.conn(ctx), userID, name, phone)
+}
+
+func (r *gormRepository) GetCustomerByID(ctx context.Context, customerID uint) (*models.Customer, error) {
+	return GetCustomerByID(r.conn(ctx), customerID)
+}
+
+func (r *gormRepository) UpdateCustomer(ctx context.Context, userID, customerID uint, name, phone string, age uint, gender models.Gender, address string) (*models.Customer, error) {
+	return UpdateCustomer(r.conn(ctx), userID, customerID, name, phone, age, gender, address)
+}
+
+func (r *gormRepository) ListCustomer(ctx context.Context, userID uint) (*[]models.Customer, error) {
+	return ListCustomer(r.conn(ctx), userID)
+}
+
+func (r *gormRepository) GetPublicSeaCustomerList(ctx context.Context, userID uint) ([]models.Customer, error) {
+	return GetPublicSeaCustomerList(r.conn(ctx), userID)
+}
+
+func (r *gormRepository) MigrateCustomer(ctx context.Context, userID, newSalerID, customerID uint) (*models.Customer, error) {
+	return MigrateCustomer(r.conn(ctx), userID, newSalerID, customerID)
+}
+
+func (r *gormRepository) AutoUpdateCustomerLoanIntent(ctx context.Context) error {
+	return AutoUpdateCustomerLoanIntent(r.conn(ctx))
+}
+
+func (r *gormRepository) AutoMigrateCustomerToPublicSea(ctx context.Context) error {
+	return AutoMigrateCustomerToPublicSea(r.conn(ctx))
+}
+
+func (r *gormRepository) UpdateCustomerKYC(ctx context.Context, userID, customerID uint, nationalID models.NationalID, occupation string, monthlyIncome, assets, existingDebts models.Money, maritalStatus models.MaritalStatus) (*models.KYCProfile, error) {
+	return UpdateCustomerKYC(r.conn(ctx), userID, customerID, nationalID, occupation, monthlyIncome, assets, existingDebts, maritalStatus)
+}
+
+func (r *gormRepository) AddKYCDocument(ctx context.Context, userID, customerID uint, kind, file string) (*models.KYCProfile, error) {
+	return AddKYCDocument(r.conn(ctx), userID, customerID, kind, file)
+}
+
+func (r *gormRepository) ReviewCustomerKYC(ctx context.Context, userID, customerID uint, status models.KYCStatus, note string) (*models.KYCProfile, error) {
+	return ReviewCustomerKYC(r.conn(ctx), userID, customerID, status, note)
+}
+
+func (r *gormRepository) GetCustomerKYC(ctx context.Context, userID, customerID uint) (*models.KYCProfile, error) {
+	return GetCustomerKYC(r.conn(ctx), userID, customerID)
+}
+
+func (r *gormRepository) FindCustomerByPhone(ctx context.Context, userID uint, phone string) (*models.Customer, error) {
+	return FindCustomerByPhone(r.conn(ctx), userID, phone)
+}
+
+func (r *gormRepository) RevealCustomerPII(ctx context.Context, userID, customerID uint, reason string) (*models.CustomerPII, error) {
+	return RevealCustomerPII(r.conn(ctx), userID, customerID, reason)
+}
+
+func (r *gormRepository) RotatePIIKeys(ctx context.Context, systemManagerID uint) (int, error) {
+	return RotatePIIKeys(r.conn(ctx), systemManagerID)
+}
+
+/*WorkLogRepo*/
+
+func (r *gormRepository) CreateWorkLog(ctx context.Context, userID uint, calls, validCalls, visits, contracts int, date time.Time) (*models.WorkLog, error) {
+	return CreateWorkLog(r.conn(ctx), userID, calls, validCalls, visits, contracts, date)
+}
+
+/*ContractRepo*/
+
+func (r *gormRepository) GetContractByID(ctx context.Context, contractID uint) (*models.Contract, error) {
+	return GetContractByID(r.conn(ctx), contractID)
+}
+
+func (r *gormRepository) SubmitContract(ctx context.Context, salerID, customerID, finanaceID, accountantID uint, amount, serviceFee, bankAmount models.Money, financialProduct, contractDocument, bankDocuments string) (*models.Contract, error) {
+	return SubmitContract(r.conn(ctx), salerID, customerID, finanaceID, accountantID, amount, serviceFee, bankAmount, financialProduct, contractDocument, bankDocuments)
+}
+
+func (r *gormRepository) UpdateContractStatus(ctx context.Context, userID, contractID uint, status models.ContractStatus) (*models.Contract, error) {
+	return UpdateContractStatus(r.conn(ctx), userID, contractID, status)
+}
+
+func (r *gormRepository) UpdateContractAmount(ctx context.Context, userID, contractID uint, amount, serviceFee, bankAmount, tolerance models.Money, reason string) (*models.Contract, error) {
+	return UpdateContractAmount(r.conn(ctx), userID, contractID, amount, serviceFee, bankAmount, tolerance, reason)
+}
+
+func (r *gormRepository) GetContractAmountHistory(ctx context.Context, userID, contractID uint) ([]models.ContractAmountVersion, error) {
+	return GetContractAmountHistory(r.conn(ctx), userID, contractID)
+}
+
+func (r *gormRepository) GetContractListByUser(ctx context.Context, userID uint) (*[]models.Contract, error) {
+	return GetContractListByUser(r.conn(ctx), userID)
+}
+
+func (r *gormRepository) GetContract(ctx context.Context, userID, contractID uint) (models.Contract, error) {
+	return GetContract(r.conn(ctx), userID, contractID)
+}
+
+/*LoanRepo*/
+
+func (r *gormRepository) CreateFinancialProduct(ctx context.Context, userID uint, name string, termMonths int, annualRate models.Money, method models.RepaymentMethod) (*models.FinancialProduct, error) {
+	return CreateFinancialProduct(r.conn(ctx), userID, name, termMonths, annualRate, method)
+}
+
+func (r *gormRepository) GetFinancialProducts(ctx context.Context) ([]models.FinancialProduct, error) {
+	return GetFinancialProducts(r.conn(ctx))
+}
+
+func (r *gormRepository) RecordDisbursement(ctx context.Context, userID, contractID uint, bank string, amount models.Money, disbursedAt time.Time) (*models.Disbursement, []models.RepaymentInstallment, error) {
+	return RecordDisbursement(r.conn(ctx), userID, contractID, bank, amount, disbursedAt)
+}
+
+func (r *gormRepository) GetRepaymentSchedule(ctx context.Context, userID, contractID uint) (*models.Disbursement, []models.RepaymentInstallment, error) {
+	return GetRepaymentSchedule(r.conn(ctx), userID, contractID)
+}
+
+func (r *gormRepository) RecordRepayment(ctx context.Context, userID, contractID uint, amount models.Money, paidAt time.Time) (*models.Repayment, []models.RepaymentInstallment, error) {
+	return RecordRepayment(r.conn(ctx), userID, contractID, amount, paidAt)
+}
+
+func (r *gormRepository) AutoFlagOverdueInstallments(ctx context.Context) error {
+	return AutoFlagOverdueInstallments(r.conn(ctx))
+}
+
+/*CommissionRepo*/
+
+func (r *gormRepository) CreateCommissionPlan(ctx context.Context, userID uint, name string, roleID models.RoleID, baseRate, overrideRate models.Money, tiers []models.CommissionTier) (*models.CommissionPlan, error) {
+	return CreateCommissionPlan(r.conn(ctx), userID, name, roleID, baseRate, overrideRate, tiers)
+}
+
+func (r *gormRepository) GetCommissionPlans(ctx context.Context) ([]models.CommissionPlan, error) {
+	return GetCommissionPlans(r.conn(ctx))
+}
+
+func (r *gormRepository) SettleCommissions(ctx context.Context, userID uint, period string) ([]models.CommissionStatement, error) {
+	return SettleCommissions(r.conn(ctx), userID, period)
+}
+
+func (r *gormRepository) GetCommissionStatements(ctx context.Context, userID uint, period string) ([]models.CommissionStatement, error) {
+	return GetCommissionStatements(r.conn(ctx), userID, period)
+}
+
+func (r *gormRepository) GetCommissionStatement(ctx context.Context, userID, statementID uint) (*models.CommissionStatement, error) {
+	return GetCommissionStatement(r.conn(ctx), userID, statementID)
+}
+
+func (r *gormRepository) AdjustCommissionStatement(ctx context.Context, userID, statementID uint, adjustment models.Money, note string) (*models.CommissionStatement, error) {
+	return AdjustCommissionStatement(r.conn(ctx), userID, statementID, adjustment, note)
+}
+
+func (r *gormRepository) LockCommissionStatement(ctx context.Context, userID, statementID uint) (*models.CommissionStatement, error) {
+	return LockCommissionStatement(r.conn(ctx), userID, statementID)
+}
+
+/*ReconciliationRepo*/
+
+func (r *gormRepository) ConfirmBankAmount(ctx context.Context, userID, contractID uint, bankAmount, tolerance models.Money) (*models.Contract, *models.ReconciliationItem, error) {
+	return ConfirmBankAmount(r.conn(ctx), userID, contractID, bankAmount, tolerance)
+}
+
+func (r *gormRepository) GetReconciliationItems(ctx context.Context, userID uint, status *models.ReconciliationStatus) ([]models.ReconciliationItem, error) {
+	return GetReconciliationItems(r.conn(ctx), userID, status)
+}
+
+func (r *gormRepository) ResolveReconciliationItem(ctx context.Context, userID, itemID uint, resolution string) (*models.ReconciliationItem, error) {
+	return ResolveReconciliationItem(r.conn(ctx), userID, itemID, resolution)
+}
+
+/*StatsRepo*/
+
+func (r *gormRepository) GetSalerPerformance(ctx context.Context, userID, salerID uint, startDate, endDate time.Time) (models.Money, error) {
+	return GetSalerPerformance(r.conn(ctx), userID, salerID, startDate, endDate)
+}
+
+func (r *gormRepository) GetDepartmentPerformance(ctx context.Context, userID, departmentID uint, startDate, endDate time.Time) (models.Money, error) {
+	return GetDepartmentPerformance(r.conn(ctx), userID, departmentID, startDate, endDate)
+}
+
+func (r *gormRepository) GetZonePerformance(ctx context.Context, userID, zoneID uint, startDate, endDate time.Time) (models.Money, error) {
+	return GetZonePerformance(r.conn(ctx), userID, zoneID, startDate, endDate)
+}
+
+func (r *gormRepository) LoanAnalysis(ctx context.Context, userID uint) (models.Money, int, models.Money, error) {
+	return LoanAnalysis(r.conn(ctx), userID)
+}
+
+func (r *gormRepository) CountPublicSeaCustomers(ctx context.Context) (int64, error) {
+	return CountPublicSeaCustomers(r.conn(ctx))
+}
+
+func (r *gormRepository) CountContractsByStatus(ctx context.Context) (map[models.ContractStatus]int64, error) {
+	return CountContractsByStatus(r.conn(ctx))
+}
+
+func (r *gormRepository) CountCustomersCreatedSince(ctx context.Context, since time.Time) (int64, error) {
+	return CountCustomersCreatedSince(r.conn(ctx), since)
+}
+
+/*ImpersonationRepo*/
+
+func (r *gormRepository) StartImpersonation(ctx context.Context, systemManagerID uint, params NewImpersonation) (*models.Impersonation, *models.User, error) {
+	return StartImpersonation(r.conn(ctx), systemManagerID, params)
+}
+
+func (r *gormRepository) ActiveImpersonation(ctx context.Context, impersonationID uint, now time.Time) (*models.Impersonation, error) {
+	return ActiveImpersonation(r.conn(ctx), impersonationID, now)
+}
+
+func (r *gormRepository) EndImpersonation(ctx context.Context, systemManagerID, impersonationID uint) (*models.Impersonation, error) {
+	return EndImpersonation(r.conn(ctx), systemManagerID, impersonationID)
+}
+
+func (r *gormRepository) ListImpersonations(ctx context.Context, systemManagerID uint) ([]models.Impersonation, error) {
+	return ListImpersonations(r.conn(ctx), systemManagerID)
+}
+
+func (r *gormRepository) RecordImpersonatedRequest(ctx context.Context, impersonation *models.Impersonation, request string, status int) error {
+	return RecordImpersonatedRequest(r.conn(ctx), impersonation, request, status)
+}
+
+/*NotificationRepo*/
+
+func (r *gormRepository) ListNotifications(ctx context.Context, userID uint, unreadOnly bool) ([]models.Notification, error) {
+	return ListNotifications(r.conn(ctx), userID, unreadOnly)
+}
+
+func (r *gormRepository) ReadNotifications(ctx context.Context, userID uint) (int64, error) {
+	return ReadNotifications(r.conn(ctx), userID)
+}
+
+/*DelegationRepo*/
+
+func (r *gormRepository) CreateDelegation(ctx context.Context, operatorID uint, params NewDelegation) (*models.Delegation, error) {
+	return CreateDelegation(r.conn(ctx), operatorID, params)
+}
+
+func (r *gormRepository) ListDelegations(ctx context.Context, userID uint) ([]models.Delegation, error) {
+	return ListDelegations(r.conn(ctx), userID)
+}
+
+func (r *gormRepository) GetAllDelegations(ctx context.Context, systemManagerID uint) ([]models.Delegation, error) {
+	return GetAllDelegations(r.conn(ctx), systemManagerID)
+}
+
+func (r *gormRepository) RevokeDelegation(ctx context.Context, operatorID, delegationID uint, principalID *uint) (*models.Delegation, error) {
+	return RevokeDelegation(r.conn(ctx), operatorID, delegationID, principalID)
+}
@@ -0,0 +1,138 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gin-boilerplate/infra/apperror"
+	"gin-boilerplate/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+/*代登录：系统管理员以其他用户的身份访问接口，代登录期间写入的系统日志都记录代登录ID和系统管理员*/
+
+type impersonationContextKey struct{}
+
+// ContextWithImpersonation 返回带有代登录记录的 context，使用该 context 写入的系统日志会标记为代登录
+func ContextWithImpersonation(ctx context.Context, impersonation *models.Impersonation) context.Context {
+	return context.WithValue(ctx, impersonationContextKey{}, impersonation)
+}
+
+// impersonationFromContext 请求所属的代登录，不是代登录时返回 nil
+func impersonationFromContext(ctx context.Context) *models.Impersonation {
+	if ctx == nil {
+		return nil
+	}
+	impersonation, _ := ctx.Value(impersonationContextKey{}).(*models.Impersonation)
+	return impersonation
+}
+
+// NewImpersonation 发起代登录的参数
+type NewImpersonation struct {
+	UserID     uint
+	Reason     string
+	AllowWrite bool
+	ExpiresAt  time.Time
+}
+
+// StartImpersonation 系统管理员发起代登录，返回代登录记录和被代登录的用户，同时通知被代登录的用户
+// 不能代登录系统管理员（包括自己）
+func StartImpersonation(db *gorm.DB, systemManagerID uint, params NewImpersonation) (*models.Impersonation, *models.User, error) {
+	user, err := GetUserByID(db, params.UserID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if user.ID == systemManagerID || user.RoleID == models.SYSTEM_ADMINISTRATOR {
+		return nil, nil, apperror.New(apperror.CodeImpersonationNotAllowed)
+	}
+	admin, err := GetUserByID(db, systemManagerID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	impersonation := models.Impersonation{
+		AdminID:    systemManagerID,
+		UserID:     params.UserID,
+		Reason:     params.Reason,
+		AllowWrite: params.AllowWrite,
+		ExpiresAt:  params.ExpiresAt,
+	}
+	mode := "只读"
+	if params.AllowWrite {
+		mode = "可修改数据"
+	}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&impersonation).Error; err != nil {
+			return err
+		}
+		if err := createNotification(tx, user.ID, models.NotificationImpersonation, fmt.Sprintf(
+			"系统管理员 %s 以你的身份登录（%s），有效期至 %s，原因：%s",
+			admin.UserName, mode, params.ExpiresAt.Format("2006-01-02 15:04"), params.Reason,
+		)); err != nil {
+			return err
+		}
+		return logAction(tx, systemManagerID, fmt.Sprintf("代登录用户: %d（%s）代登录: %d 原因: %s", user.ID, mode, impersonation.ID, params.Reason))
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return &impersonation, user, nil
+}
+
+// ActiveImpersonation 有效的代登录记录，不存在、已结束或已过期时返回 CodeImpersonationEnded
+func ActiveImpersonation(db *gorm.DB, impersonationID uint, now time.Time) (*models.Impersonation, error) {
+	var impersonation models.Impersonation
+	if err := db.First(&impersonation, impersonationID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, apperror.New(apperror.CodeImpersonationEnded)
+		}
+		return nil, err
+	}
+	if !impersonation.Active(now) {
+		return nil, apperror.New(apperror.CodeImpersonationEnded)
+	}
+	return &impersonation, nil
+}
+
+// EndImpersonation 系统管理员提前结束代登录，代登录令牌立即失效，重复结束不会修改结束时间
+func EndImpersonation(db *gorm.DB, systemManagerID, impersonationID uint) (*models.Impersonation, error) {
+	var impersonation models.Impersonation
+	if err := db.First(&impersonation, impersonationID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, apperror.New(apperror.CodeImpersonationNotFound)
+		}
+		return nil, err
+	}
+	if impersonation.EndedAt != nil {
+		return &impersonation, nil
+	}
+	now := time.Now()
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&impersonation).UpdateColumn("ended_at", now).Error; err != nil {
+			return err
+		}
+		return logAction(tx, systemManagerID, fmt.Sprintf("结束代登录: %d", impersonation.ID))
+	})
+	if err != nil {
+		return nil, err
+	}
+	impersonation.EndedAt = &now
+	return &impersonation, nil
+}
+
+// ListImpersonations 系统管理员查看代登录记录，最新的在前
+func ListImpersonations(db *gorm.DB, systemManagerID uint) ([]models.Impersonation, error) {
+	var impersonations []models.Impersonation
+	if err := db.Order("id DESC").Find(&impersonations).Error; err != nil {
+		return nil, err
+	}
+	logAction(db, systemManagerID, "查看代登录记录")
+	return impersonations, nil
+}
+
+// RecordImpersonatedRequest 记录代登录期间的每个请求，包括不写系统日志的查询
+func RecordImpersonatedRequest(db *gorm.DB, impersonation *models.Impersonation, request string, status int) error {
+	return logAction(db, impersonation.UserID, fmt.Sprintf("代登录请求: %s（%d）", request, status))
+}
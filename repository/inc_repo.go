@@ -4,9 +4,11 @@ import (
 	"errors"
 	"fmt"
 	"gin-boilerplate/helpers"
+	"gin-boilerplate/infra/apperror"
 	"gin-boilerplate/models"
 	"time"
 
+	"github.com/shopspring/decimal"
 	"gorm.io/gorm"
 )
 
@@ -38,16 +40,36 @@ func DeleteUser(db *gorm.DB, systemManagerID, userID uint) error {
 }
 
 // Login User用户登录，验证用户名和密码
-func Login(db *gorm.DB, userName, password string) (*models.User, error) {
+// 按 policy 处理连续密码错误：需要等待时返回 CodeLoginThrottled，账户锁定时返回 CodeAccountLocked
+// 用户开启了两步验证时，返回的用户还需要通过 VerifyLoginTOTP 才算登录成功
+func Login(db *gorm.DB, userName, password string, policy LoginPolicy) (*models.User, error) {
 	var user models.User
 	err := db.Where("user_name = ?", userName).First(&user).Error
-	if err != nil {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
 		logAction(db, 0, fmt.Sprintf("用户名: %s 错误，登录失败", userName))
+		return nil, apperror.Wrap(apperror.CodeInvalidCredentials, err)
+	} else if err != nil {
 		return nil, err
 	}
-	err = helpers.CheckPasswordHash(password, user.PasswordHash)
-	if err != nil {
-		logAction(db, user.ID, "密码错误，登录失败")
+	now := time.Now()
+	if err := checkLoginAllowed(&user, policy, now); err != nil {
+		logAction(db, user.ID, "账户锁定或重试过快，登录被拒绝")
+		return nil, err
+	}
+	if err := helpers.CheckPasswordHash(password, user.PasswordHash); err != nil {
+		return nil, recordLoginFailure(db, &user, policy, now)
+	}
+	// 临时密码过期后不能再登录，需要系统管理员重新重置
+	if user.MustChangePassword && user.PasswordExpiresAt != nil && now.After(*user.PasswordExpiresAt) {
+		logAction(db, user.ID, "临时密码已过期，登录被拒绝")
+		return nil, apperror.New(apperror.CodeTemporaryPasswordExpired)
+	}
+	// 开启两步验证时，验证码通过后才清除错误次数，否则可以交替输入正确密码和猜测验证码绕过锁定
+	if user.TOTPEnabled {
+		logAction(db, user.ID, "密码验证通过，等待两步验证")
+		return &user, nil
+	}
+	if err := resetLoginFailures(db, &user); err != nil {
 		return nil, err
 	}
 	logAction(db, user.ID, fmt.Sprintf("用户名: %s, 角色%s, 登录成功", userName, models.RoleNameMap[user.RoleID]))
@@ -77,15 +99,32 @@ func GetUserByID(db *gorm.DB, userID uint) (*models.User, error) {
 
 // UpdateUser 更新User账户信息
 // 系统管理员或用户修改用户名或密码（用户修改账户信息传入systemManagerID=0）
-func UpdateUserNameOrPassword(db *gorm.DB, systemManagerID, userID uint, userName, password string) (*models.User, error) {
-	passwordHash, err := helpers.HashPassword(password)
+func UpdateUserNameOrPassword(db *gorm.DB, systemManagerID, userID uint, userName, password string, history int) (*models.User, error) {
+	user, err := GetUserByID(db, userID)
 	if err != nil {
 		return nil, err
 	}
-	err = db.Model(&models.User{}).Where("id = ?", userID).Updates(models.User{
-		UserName:     userName,
-		PasswordHash: passwordHash,
-	}).Error
+	// 只更新传入的字段，用户名和密码可以分开修改
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if userName != "" {
+			if err := tx.Model(user).Update("user_name", userName).Error; err != nil {
+				return err
+			}
+		}
+		if password != "" {
+			if err := checkPasswordReuse(tx, user, password, history); err != nil {
+				return err
+			}
+			if err := setPassword(tx, user, password, history, map[string]interface{}{
+				"must_change_password": false,
+				"password_expires_at":  nil,
+				"password_changed_at":  time.Now(),
+			}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -117,8 +156,8 @@ func UpdateUserProfile(db *gorm.DB, userID uint, name string, age uint,
 		Name:    name,
 		Age:     age,
 		Gender:  gender,
-		Address: address,
-		Phone:   phone,
+		Address: models.EncryptedString(address),
+		Phone:   models.EncryptedString(phone),
 	}).FirstOrCreate(&models.UserProfile{}).Error
 	if err != nil {
 		return nil, err
@@ -153,6 +192,10 @@ func GetUserList(db *gorm.DB, systemManagerID uint) ([]models.User, error) {
 	if err != nil {
 		return nil, err
 	}
+	// 系统管理员不需要员工的完整电话和地址
+	for i := range users {
+		users[i].UserProfile.MaskPII()
+	}
 	logAction(db, systemManagerID, "查看用户列表")
 	return users, nil
 }
@@ -208,51 +251,51 @@ func CreateFinanceDepartment(db *gorm.DB, systemManagerID uint, name string) (*m
 // AssignDepartmentToZone 分配部门到战区
 // 系统管理员可以分配部门到战区
 func AssignDepartmentToZone(db *gorm.DB, systemManagerID, departmentID, zoneID uint) error {
-    //获取部门
-    var department models.Department
-    if err := db.Where("id = ?", departmentID).First(&department).Error; err != nil {
-        return err
-    }
-    //获取战区
-    var zone models.Zone
-    if err := db.Where("id = ?", zoneID).First(&zone).Error; err != nil {
-        return err
-    }
-    // 更新部门所属战区
-    if err := db.Model(&models.Department{}).Where("id = ?", departmentID).Update("zone_id", zoneID).Error; err != nil {
-        return err
-    }
-    // 更新战区内包含的部门
-    if err := db.Model(&zone).Update("Departments", append(zone.Departments, department)).Error; err != nil {
-        return err
-    }
-    logAction(db, systemManagerID, fmt.Sprintf("分配部门: %d 到战区: %d", departmentID, zoneID))
-    return nil
+	//获取部门
+	var department models.Department
+	if err := db.Where("id = ?", departmentID).First(&department).Error; err != nil {
+		return err
+	}
+	//获取战区
+	var zone models.Zone
+	if err := db.Where("id = ?", zoneID).First(&zone).Error; err != nil {
+		return err
+	}
+	// 更新部门所属战区
+	if err := db.Model(&models.Department{}).Where("id = ?", departmentID).Update("zone_id", zoneID).Error; err != nil {
+		return err
+	}
+	// 更新战区内包含的部门
+	if err := db.Model(&zone).Update("Departments", append(zone.Departments, department)).Error; err != nil {
+		return err
+	}
+	logAction(db, systemManagerID, fmt.Sprintf("分配部门: %d 到战区: %d", departmentID, zoneID))
+	return nil
 }
 
 // AssignUserToDepartment 分配用户到部门
 // 系统管理员可以分配用户到部门
 func AssignUserToDepartment(db *gorm.DB, systemManagerID, userID, departmentID uint) error {
-    //获取用户
-    var user models.User
-    if err := db.Where("id = ?", userID).First(&user).Error; err != nil {
-        return err
-    }
-    //获取部门
-    var department models.Department
-    if err := db.Where("id = ?", departmentID).First(&department).Error; err != nil {
-        return err
-    }
-    //更新用户所属部门
-    if err := db.Model(&models.User{}).Where("id = ?", userID).Update("department_id", departmentID).Error; err != nil {
-        return err
-    }
-    // 更新部门内包含的用户
-    if err := db.Model(&department).Update("Users", append(department.Users, user)).Error; err != nil {
-        return err
-    }
-    logAction(db, systemManagerID, fmt.Sprintf("分配用户: %d 到部门: %d", userID, departmentID))
-    return nil
+	//获取用户
+	var user models.User
+	if err := db.Where("id = ?", userID).First(&user).Error; err != nil {
+		return err
+	}
+	//获取部门
+	var department models.Department
+	if err := db.Where("id = ?", departmentID).First(&department).Error; err != nil {
+		return err
+	}
+	//更新用户所属部门
+	if err := db.Model(&models.User{}).Where("id = ?", userID).Update("department_id", departmentID).Error; err != nil {
+		return err
+	}
+	// 更新部门内包含的用户
+	if err := db.Model(&department).Update("Users", append(department.Users, user)).Error; err != nil {
+		return err
+	}
+	logAction(db, systemManagerID, fmt.Sprintf("分配用户: %d 到部门: %d", userID, departmentID))
+	return nil
 }
 
 // AssignUserToZone 分配用户到战区
@@ -337,13 +380,18 @@ func CreateCustomer(db *gorm.DB, userID uint, name, phone string) (*models.Custo
 		return nil, err
 	}
 	if saler.DepartmentID == nil {
-		return nil, errors.New("用户未分配部门")
+		return nil, apperror.New(apperror.CodeUserNotAssigned)
 	} else if saler.ZoneID == nil {
-	    return nil, errors.New("用户未分配到战区")
+		return nil, apperror.New(apperror.CodeUserNotAssigned)
 	}
-	customer := models.Customer{Name: name, Phone: phone, LoanIntent: 10, IsInPublicSea: false,
-		SalerID: &userID, DepartmentID: saler.DepartmentID, ZoneID: saler.ZoneID}
-	err := db.Create(&customer).Error
+	// 电话加密存储，通过盲索引去重
+	phoneIndex, err := checkCustomerPhone(db, phone, 0)
+	if err != nil {
+		return nil, err
+	}
+	customer := models.Customer{Name: name, Phone: models.EncryptedString(phone), PhoneIndex: phoneIndex,
+		LoanIntent: 10, IsInPublicSea: false, SalerID: &userID, DepartmentID: saler.DepartmentID, ZoneID: saler.ZoneID}
+	err = db.Create(&customer).Error
 	if err != nil {
 		return nil, err
 	}
@@ -361,14 +409,31 @@ func GetCustomerByID(db *gorm.DB, customerID uint) (*models.Customer, error) {
 	return &customer, nil
 }
 
-// UpdateCustomer 销售人员更新客户基本信息
+// UpdateCustomer 销售人员更新客户基本信息，权限范围与查看客户相同（见 canAccessCustomer）
 func UpdateCustomer(db *gorm.DB, userID, customerID uint, name, phone string, age uint, gender models.Gender, address string) (*models.Customer, error) {
-	err := db.Model(&models.Customer{}).Where("id = ?", customerID).Updates(models.Customer{
-		Name:    name,
-		Phone:   phone,
-		Age:     age,
-		Gender:  gender,
-		Address: address,
+	curUser, err := GetUserByID(db, userID)
+	if err != nil {
+		return nil, err
+	}
+	customer, err := GetCustomerByID(db, customerID)
+	if err != nil {
+		return nil, err
+	}
+	if !canAccessCustomer(curUser, customer) {
+		logAction(db, userID, fmt.Sprintf("尝试更新客户: %d 信息被拒绝", customerID))
+		return nil, apperror.New(apperror.CodeCustomerAccessForbidden)
+	}
+	phoneIndex, err := checkCustomerPhone(db, phone, customerID)
+	if err != nil {
+		return nil, err
+	}
+	err = db.Model(&models.Customer{}).Where("id = ?", customerID).Updates(models.Customer{
+		Name:       name,
+		Phone:      models.EncryptedString(phone),
+		PhoneIndex: phoneIndex,
+		Age:        age,
+		Gender:     gender,
+		Address:    models.EncryptedString(address),
 	}).Error
 	if err != nil {
 		return nil, err
@@ -378,6 +443,7 @@ func UpdateCustomer(db *gorm.DB, userID, customerID uint, name, phone string, ag
 	if err != nil {
 		return nil, err
 	}
+	maskCustomer(curUser, updated_customer)
 	return updated_customer, nil
 }
 
@@ -416,8 +482,9 @@ func ListCustomer(db *gorm.DB, userID uint) (*[]models.Customer, error) {
 		}
 	} else {
 		logAction(db, userID, "尝试查看客户列表失败")
-		return nil, errors.New("无权限查看客户列表")
+		return nil, apperror.New(apperror.CodeCustomerListForbidden)
 	}
+	maskCustomersFor(cur_user, customers)
 	logAction(db, userID, "查看客户列表")
 	return &customers, nil
 }
@@ -425,11 +492,16 @@ func ListCustomer(db *gorm.DB, userID uint) (*[]models.Customer, error) {
 // GetPublicSeaCustomerList 查询公海客户列表
 // 所有人可以查看公海客户列表
 func GetPublicSeaCustomerList(db *gorm.DB, userID uint) ([]models.Customer, error) {
+	curUser, err := GetUserByID(db, userID)
+	if err != nil {
+		return nil, err
+	}
 	var customers []models.Customer
-	err := db.Where("is_in_public_sea = ?", true).Find(&customers).Error
+	err = db.Where("is_in_public_sea = ?", true).Find(&customers).Error
 	if err != nil {
 		return nil, err
 	}
+	maskCustomersFor(curUser, customers)
 	logAction(db, userID, "查看公海客户列表")
 	return customers, nil
 }
@@ -455,28 +527,26 @@ func MigrateCustomer(db *gorm.DB, userID, newSalerID, customerID uint) (*models.
 		auth = true
 	} else if cur_user.RoleID == models.SALES_DIRECTOR {
 		// 销售总监可以战区内迁移，判断三者战区是否一致
-		if cur_user.ZoneID == newSaler.ZoneID && cur_user.ZoneID == customer.ZoneID {
+		if sameID(cur_user.ZoneID, newSaler.ZoneID) && sameID(cur_user.ZoneID, customer.ZoneID) {
 			auth = true
 		}
 	} else if cur_user.RoleID == models.SALES_MANAGER {
 		// 销售部长可以部门内迁移，判断三者部门是否一致
-		if cur_user.DepartmentID == newSaler.DepartmentID && cur_user.DepartmentID == customer.DepartmentID {
+		if sameID(cur_user.DepartmentID, newSaler.DepartmentID) && sameID(cur_user.DepartmentID, customer.DepartmentID) {
 			auth = true
 		}
-	} else {
-		auth = false
+	}
+	if !auth {
 		logAction(db, userID, "尝试迁移客户失败")
-		return nil, errors.New("无权限迁移客户")
+		return nil, apperror.New(apperror.CodeCustomerMigrateForbidden)
 	}
 	//迁移客户
-	if auth {
-		if err := db.Model(&models.Customer{}).Where("id = ?", customerID).Assign(models.Customer{
-			SalerID:      &newSalerID,
-			DepartmentID: newSaler.DepartmentID,
-			ZoneID:       newSaler.ZoneID,
-		}).Error; err != nil {
-			return nil, err
-		}
+	if err := db.Model(&models.Customer{}).Where("id = ?", customerID).Updates(map[string]interface{}{
+		"saler_id":      newSalerID,
+		"department_id": newSaler.DepartmentID,
+		"zone_id":       newSaler.ZoneID,
+	}).Error; err != nil {
+		return nil, err
 	}
 	// 记录迁移操作
 	logAction(db, userID, fmt.Sprintf("迁移了客户：%d 到销售人员：%d", customerID, newSalerID))
@@ -484,9 +554,15 @@ func MigrateCustomer(db *gorm.DB, userID, newSalerID, customerID uint) (*models.
 	if err != nil {
 		return nil, err
 	}
+	maskCustomer(cur_user, updated_customer)
 	return updated_customer, nil
 }
 
+// sameID 比较两个可空ID是否指向同一个战区/部门，未分配（nil）的ID不与任何ID相等
+func sameID(a, b *uint) bool {
+	return a != nil && b != nil && *a == *b
+}
+
 // AutoUpdateCustomerLoanIntent 系统每天自动更新客户贷款意向
 func AutoUpdateCustomerLoanIntent(db *gorm.DB) error {
 	// 使用事务确保整个操作的一致性
@@ -500,7 +576,7 @@ func AutoUpdateCustomerLoanIntent(db *gorm.DB) error {
 		}
 		// 记录操作影响的行数
 		if result.RowsAffected > 0 {
-			logAction(db, 0, fmt.Sprintf("自动更新了 %d 个客户的贷款意向", result.RowsAffected))
+			logAction(tx, 0, fmt.Sprintf("自动更新了 %d 个客户的贷款意向", result.RowsAffected))
 		}
 		return nil
 	})
@@ -511,18 +587,19 @@ func AutoMigrateCustomerToPublicSea(db *gorm.DB) error {
 	// 使用事务确保更新操作的原子性
 	return db.Transaction(func(tx *gorm.DB) error {
 		// 将贷款意向为0的客户移入公海，同时更新SalerID为nil
-		result := tx.Model(&models.Customer{}).Where("loan_intent = 0").Assign(models.Customer{
-			IsInPublicSea: true,
-			SalerID:       nil,
-			DepartmentID:  nil,
-			ZoneID:        nil,
+		// 用 map 更新才会把字段置为 NULL，结构体中的零值会被 gorm 忽略
+		result := tx.Model(&models.Customer{}).Where("loan_intent = 0 AND is_in_public_sea = ?", false).Updates(map[string]interface{}{
+			"is_in_public_sea": true,
+			"saler_id":         nil,
+			"department_id":    nil,
+			"zone_id":          nil,
 		})
 		if result.Error != nil {
 			return result.Error
 		}
 		// 记录迁移操作的日志
 		if result.RowsAffected > 0 {
-			logAction(db, 0, fmt.Sprintf("自动迁移了 %d 个客户到公海", result.RowsAffected))
+			logAction(tx, 0, fmt.Sprintf("自动迁移了 %d 个客户到公海", result.RowsAffected))
 		}
 		return nil
 	})
@@ -555,21 +632,32 @@ func GetContractByID(db *gorm.DB, contractID uint) (*models.Contract, error) {
 
 // SubmitContract 销售人员提交合同
 func SubmitContract(db *gorm.DB, salerID, customerID, finanaceID, accountantID uint,
-	amount, serviceFee, bankAmount float64,
+	amount, serviceFee, bankAmount models.Money,
 	financialProduct, contractDocument, bankDocuments string) (*models.Contract, error) {
 	// 获取销售人员信息
 	var saler models.User
 	if err := db.Where("id = ?", salerID).First(&saler).Error; err != nil {
 		return nil, err
 	}
+	if saler.DepartmentID == nil || saler.ZoneID == nil {
+		return nil, apperror.New(apperror.CodeUserNotAssigned)
+	}
+	// 合同指定的金融专员和会计必须是对应角色，会计负责后续对账
+	if err := checkAssignee(db, "finance_id", finanaceID, models.FINANCE_SPECIALIST, models.FINANCE_MANAGER); err != nil {
+		return nil, err
+	}
+	if err := checkAssignee(db, "accountant_id", accountantID, models.ACCOUNTANT); err != nil {
+		return nil, err
+	}
 	contract := models.Contract{
-		Amount:           amount,
-		ServiceFee:       serviceFee,
+		Amount:           amount.Round(models.MoneyScale),
+		ServiceFee:       serviceFee.Round(models.MoneyScale),
+		Currency:         models.DefaultCurrency,
 		Status:           models.NEW,
 		ContractDocument: contractDocument,
 		FinancialProduct: financialProduct,
 		BankDocuments:    bankDocuments,
-		BankAmount:       bankAmount,
+		BankAmount:       bankAmount.Round(models.MoneyScale),
 		CustomerID:       customerID,
 		SalerID:          salerID,
 		FinanceID:        finanaceID,
@@ -577,21 +665,76 @@ func SubmitContract(db *gorm.DB, salerID, customerID, finanaceID, accountantID u
 		DepartmentID:     *(saler.DepartmentID),
 		ZoneID:           *(saler.ZoneID),
 	}
-	if err := db.Create(&contract).Error; err != nil {
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&contract).Error; err != nil {
+			return err
+		}
+		if err := recordAmountVersion(tx, &contract, salerID, "提交合同"); err != nil {
+			return err
+		}
+		return logAction(tx, salerID, fmt.Sprintf("提交合同: %d", contract.ID))
+	})
+	if err != nil {
 		return nil, err
 	}
-	logAction(db, salerID, fmt.Sprintf("提交合同: %d", contract.ID))
 	return &contract, nil
 }
 
+// checkAssignee 检查合同指定的人员是否是给定角色之一
+func checkAssignee(db *gorm.DB, field string, userID uint, roles ...models.RoleID) error {
+	var user models.User
+	if err := db.Select("id", "role_id").First(&user, userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return apperror.Wrap(apperror.CodeInvalidParams, err).WithDetails(map[string]string{"field": field})
+		}
+		return err
+	}
+	for _, role := range roles {
+		if user.RoleID == role {
+			return nil
+		}
+	}
+	return apperror.New(apperror.CodeInvalidParams).WithDetails(map[string]string{"field": field})
+}
+
 // UpdateContractStatus 更新合同状态
-// 金融专员/经理可以更新合同状态为审批中，审批通过或审批拒绝
+// 金融经理和合同指定的金融专员（或其被委托人）可以更新合同状态为审批中，审批通过或审批拒绝
 func UpdateContractStatus(db *gorm.DB, userID, contractID uint, status models.ContractStatus) (*models.Contract, error) {
-	// 更新合同状态
-	if err := db.Model(&models.Contract{}).Where("id = ?", contractID).Update("status", status).Error; err != nil {
+	err := db.Transaction(func(tx *gorm.DB) error {
+		contract, err := GetContractByID(tx, contractID)
+		if err != nil {
+			return err
+		}
+		curUser, err := GetUserByID(tx, userID)
+		if err != nil {
+			return err
+		}
+		var principalID *uint
+		if curUser.RoleID != models.FINANCE_MANAGER {
+			var allowed bool
+			if principalID, allowed, err = actingFor(tx, userID, contract.FinanceID); err != nil {
+				return err
+			}
+			if !allowed {
+				return apperror.New(apperror.CodeContractStatusForbidden)
+			}
+		}
+		// 更新合同状态，批准时记录批准时间，批准前客户的KYC资料必须已认证
+		updates := map[string]interface{}{"status": status}
+		if status == models.APPROVED {
+			if err := checkCustomerKYCVerified(tx, contract.CustomerID); err != nil {
+				return err
+			}
+			updates["approved_at"] = time.Now()
+		}
+		if err := tx.Model(&models.Contract{}).Where("id = ?", contractID).Updates(updates).Error; err != nil {
+			return err
+		}
+		return logActionOnBehalf(tx, userID, principalID, fmt.Sprintf("更新了合同: %d 状态为: %d", contractID, status))
+	})
+	if err != nil {
 		return nil, err
 	}
-	logAction(db, userID, fmt.Sprintf("更新了合同: %d 状态为: %d", contractID, status))
 	updated_contract, err := GetContractByID(db, contractID)
 	if err != nil {
 		return nil, err
@@ -600,22 +743,57 @@ func UpdateContractStatus(db *gorm.DB, userID, contractID uint, status models.Co
 }
 
 // UpdateContractAmount 更新合同金额信息
-// 会计可以更新合同金额信息
-func UpdateContractAmount(db *gorm.DB, userID, contractID uint, amount, serviceFee, bankAmount float64) (*models.Contract, error) {
-	// 更新合同金额信息
-	if err := db.Model(&models.Contract{}).Where("id = ?", contractID).Updates(models.Contract{
-		Amount:     amount,
-		ServiceFee: serviceFee,
-		BankAmount: bankAmount,
-	}).Error; err != nil {
-		return nil, err
-	}
-	logAction(db, userID, fmt.Sprintf("更新了合同: %d 金额信息", contractID))
-	updated_contract, err := GetContractByID(db, contractID)
+// 金融经理和合同指定的金融专员（或其被委托人）可以更新合同金额，修改前的金额保留在金额版本中；
+// 银行金额被修改时会计之前的确认失效，需要会计重新确认，并与 ConfirmBankAmount 一样按 tolerance 检查对账差异
+func UpdateContractAmount(db *gorm.DB, userID, contractID uint, amount, serviceFee, bankAmount, tolerance models.Money, reason string) (*models.Contract, error) {
+	var contract models.Contract
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&contract, contractID).Error; err != nil {
+			return err
+		}
+		curUser, err := GetUserByID(tx, userID)
+		if err != nil {
+			return err
+		}
+		var principalID *uint
+		if curUser.RoleID != models.FINANCE_MANAGER {
+			var allowed bool
+			if principalID, allowed, err = actingFor(tx, userID, contract.FinanceID); err != nil {
+				return err
+			}
+			if !allowed {
+				return apperror.New(apperror.CodeContractAmountForbidden)
+			}
+		}
+		// 服务费允许改为0，所以用 map 而不是结构体
+		bankAmount = bankAmount.Round(models.MoneyScale)
+		updates := map[string]interface{}{
+			"amount":      amount.Round(models.MoneyScale),
+			"service_fee": serviceFee.Round(models.MoneyScale),
+			"bank_amount": bankAmount,
+		}
+		if !bankAmount.Equal(contract.BankAmount) {
+			updates["bank_confirmed_by"] = nil
+			updates["bank_confirmed_at"] = nil
+		}
+		if err := tx.Model(&contract).Updates(updates).Error; err != nil {
+			return err
+		}
+		if err := tx.First(&contract, contractID).Error; err != nil {
+			return err
+		}
+		if err := recordAmountVersion(tx, &contract, userID, reason); err != nil {
+			return err
+		}
+		if _, err := reconcileAmounts(tx, &contract, userID, tolerance, "修改金额后差额在容差内"); err != nil {
+			return err
+		}
+		return logActionOnBehalf(tx, userID, principalID, fmt.Sprintf("更新了合同: %d 金额信息，原因: %s", contractID, reason))
+	})
 	if err != nil {
 		return nil, err
 	}
-	return updated_contract, nil
+	return GetContractByID(db, contractID)
 }
 
 // // GetContractListBySalerID 查询销售人员的合同列表
@@ -662,62 +840,68 @@ func UpdateContractAmount(db *gorm.DB, userID, contractID uint, amount, serviceF
 // 	return contracts, nil
 // }
 
+// contractScope 用户可以查看的合同范围：销售代表是自己的合同以及委托给自己的销售代表的合同，
+// 销售经理是部门内的合同，销售总监是战区内的合同，总经理、金融经理、会计是全部合同，其他角色无权查看
+func contractScope(db *gorm.DB, user *models.User) (*gorm.DB, error) {
+	switch user.RoleID {
+	case models.SALES_REPRESENTATIVE:
+		principals, err := delegatedPrincipals(db, user.ID, time.Now())
+		if err != nil {
+			return nil, err
+		}
+		return db.Where("saler_id IN ?", append(principals, user.ID)), nil
+	case models.SALES_MANAGER:
+		return db.Where("department_id = ?", user.DepartmentID), nil
+	case models.SALES_DIRECTOR:
+		return db.Where("zone_id = ?", user.ZoneID), nil
+	case models.GENERAL_MANAGER, models.FINANCE_MANAGER, models.ACCOUNTANT:
+		return db, nil
+	default:
+		return nil, apperror.New(apperror.CodeContractListForbidden)
+	}
+}
+
+// GetContractListByUser 查询用户可以查看的合同列表，范围见 contractScope
 func GetContractListByUser(db *gorm.DB, userID uint) (*[]models.Contract, error) {
-    // 获取当前用户信息
-    curUser, err := GetUserByID(db, userID)
-    if err != nil {
-        return nil, err
-    }
-
-    var contracts []models.Contract
-
-    // 根据用户角色决定查询条件
-    switch curUser.RoleID {
-    case models.SALES_REPRESENTATIVE:
-        // 销售人员只能查看自己的合同列表
-        err := db.Where("saler_id = ?", userID).Find(&contracts).Error
-        if err != nil {
-            return nil, err
-        }
-    case models.SALES_MANAGER:
-        // 销售经理可以查看部门内的合同列表
-        err := db.Where("department_id = ?", curUser.DepartmentID).Find(&contracts).Error
-        if err != nil {
-            return nil, err
-        }
-    case models.SALES_DIRECTOR:
-        // 销售总监可以查看战区内的合同列表
-        err := db.Where("zone_id = ?", curUser.ZoneID).Find(&contracts).Error
-        if err != nil {
-            return nil, err
-        }
-    case models.GENERAL_MANAGER, models.FINANCE_MANAGER, models.ACCOUNTANT:
-        // 总经理、金融经理、会计可以查看所有合同列表
-        err := db.Find(&contracts).Error
-        if err != nil {
-            return nil, err
-        }
-    default:
-        // 如果不是以上角色，则无权限查看合同列表
-        logAction(db, userID, "尝试查看合同列表失败")
-        return nil, errors.New("无权限查看合同列表")
-    }
-
-    // 记录操作日志
-    logAction(db, userID, "查看了合同列表")
-    return &contracts, nil
-}
-
-
-// GetContract 查询合同信息
-// 销售人员/金融专员可以查看自己的合同信息，销售经理可以查看部门内的合同信息，
-// 销售总监可以查看战区内的合同信息，总经理/金融经理/会计可以查看所有合同信息
+	curUser, err := GetUserByID(db, userID)
+	if err != nil {
+		return nil, err
+	}
+	scope, err := contractScope(db, curUser)
+	if err != nil {
+		logAction(db, userID, "尝试查看合同列表失败")
+		return nil, err
+	}
+	var contracts []models.Contract
+	if err := scope.Find(&contracts).Error; err != nil {
+		return nil, err
+	}
+	logAction(db, userID, "查看了合同列表")
+	return &contracts, nil
+}
+
+// GetContract 查询合同信息，只能查看 contractScope 范围内的合同
 func GetContract(db *gorm.DB, userID, contractID uint) (models.Contract, error) {
-	// 获取contractID的合同信息
 	var contract models.Contract
 	if err := db.Where("id = ?", contractID).First(&contract).Error; err != nil {
 		return models.Contract{}, err
 	}
+	curUser, err := GetUserByID(db, userID)
+	if err != nil {
+		return models.Contract{}, err
+	}
+	scope, err := contractScope(db, curUser)
+	if err != nil {
+		return models.Contract{}, err
+	}
+	var visible int64
+	if err := scope.Model(&models.Contract{}).Where("id = ?", contractID).Count(&visible).Error; err != nil {
+		return models.Contract{}, err
+	}
+	if visible == 0 {
+		logAction(db, userID, fmt.Sprintf("尝试查看合同: %d 信息失败", contractID))
+		return models.Contract{}, apperror.New(apperror.CodeContractAccessForbidden)
+	}
 	logAction(db, userID, fmt.Sprintf("查看了合同: %d 信息", contractID))
 	return contract, nil
 }
@@ -725,73 +909,94 @@ func GetContract(db *gorm.DB, userID, contractID uint) (models.Contract, error)
 /*业绩与报表*/
 
 // GetSalerPerformance 销售代表业绩查询
-func GetSalerPerformance(db *gorm.DB, userID, salerID uint, startDate, endDate time.Time) (float64, error) {
-	var totalAmount float64
+func GetSalerPerformance(db *gorm.DB, userID, salerID uint, startDate, endDate time.Time) (models.Money, error) {
+	var totalAmount models.Money
 	// 累加指定销售代表、指定时间范围内的合同金额
 	err := db.Model(&models.Contract{}).
-		Where("saler_id = ? AND created_at >= ? AND created_at <= ?", salerID, startDate, endDate).
-		Select("sum(amount) as total_amount").
+		Where("saler_id = ? AND currency = ? AND created_at >= ? AND created_at <= ?", salerID, models.DefaultCurrency, startDate, endDate).
+		Select("coalesce(sum(amount), 0) as total_amount").
 		Row().Scan(&totalAmount)
 	if err != nil {
-		return 0, err
+		return decimal.Zero, err
 	}
 	logAction(db, userID, fmt.Sprintf("查看了销售人员: %d 的业绩", salerID))
 
-	return totalAmount, nil
+	return totalAmount.Round(models.MoneyScale), nil
 }
 
 // GetDepartmentPerformance 销售部门业绩查询
-func GetDepartmentPerformance(db *gorm.DB, userID, departmentID uint, startDate, endDate time.Time) (float64, error) {
-	var totalAmount float64
+func GetDepartmentPerformance(db *gorm.DB, userID, departmentID uint, startDate, endDate time.Time) (models.Money, error) {
+	var totalAmount models.Money
 	// 累加指定销售部门、指定时间范围内的合同金额
 	err := db.Model(&models.Contract{}).
-		Where("department_id = ? AND created_at >= ? AND created_at <= ?", departmentID, startDate, endDate).
-		Select("sum(amount) as total_amount").
+		Where("department_id = ? AND currency = ? AND created_at >= ? AND created_at <= ?", departmentID, models.DefaultCurrency, startDate, endDate).
+		Select("coalesce(sum(amount), 0) as total_amount").
 		Row().Scan(&totalAmount)
 	if err != nil {
-		return 0, err
+		return decimal.Zero, err
 	}
 	logAction(db, userID, fmt.Sprintf("查看了部门: %d 的业绩", departmentID))
-	return totalAmount, nil
+	return totalAmount.Round(models.MoneyScale), nil
 }
 
 // GetZonePerformance 销售战区业绩查询
-func GetZonePerformance(db *gorm.DB, userID, zoneID uint, startDate, endDate time.Time) (float64, error) {
-	var totalAmount float64
+func GetZonePerformance(db *gorm.DB, userID, zoneID uint, startDate, endDate time.Time) (models.Money, error) {
+	var totalAmount models.Money
 	// 累加指定销售战区、指定时间范围内的合同金额
 	err := db.Model(&models.Contract{}).
-		Where("zone_id = ? AND created_at >= ? AND created_at <= ?", zoneID, startDate, endDate).
-		Select("sum(amount) as total_amount").
+		Where("zone_id = ? AND currency = ? AND created_at >= ? AND created_at <= ?", zoneID, models.DefaultCurrency, startDate, endDate).
+		Select("coalesce(sum(amount), 0) as total_amount").
 		Row().Scan(&totalAmount)
 	if err != nil {
-		return 0, err
+		return decimal.Zero, err
 	}
 	logAction(db, userID, fmt.Sprintf("查看了战区: %d 的业绩", zoneID))
-	return totalAmount, nil
+	return totalAmount.Round(models.MoneyScale), nil
 }
 
-// LoanAnalysis 贷款业务分析，返回总贷款额，贷款产品数量，平均贷款额
-func LoanAnalysis(db *gorm.DB, userID uint) (float64, int, float64, error) {
-	var totalAmount float64
+// LoanAnalysis 贷款业务分析，返回总贷款额，贷款产品数量，平均贷款额（四舍五入到分，没有合同时为0）
+func LoanAnalysis(db *gorm.DB, userID uint) (models.Money, int, models.Money, error) {
+	var totalAmount models.Money
 	var count int
 	// 查询总贷款额
-	err := db.Model(&models.Contract{}).Select("sum(amount) as total_amount, count(*) as count").
+	err := db.Model(&models.Contract{}).
+		Where("currency = ?", models.DefaultCurrency).
+		Select("coalesce(sum(amount), 0) as total_amount, count(*) as count").
 		Row().Scan(&totalAmount, &count)
 	if err != nil {
-		return 0, 0, 0, err
+		return decimal.Zero, 0, decimal.Zero, err
 	}
+	// SQLite 中 sum 的结果是浮点数，统一保留到分
+	totalAmount = totalAmount.Round(models.MoneyScale)
 	// 计算平均贷款额
-	averageAmount := totalAmount / float64(count)
+	averageAmount := decimal.Zero
+	if count > 0 {
+		averageAmount = totalAmount.DivRound(decimal.NewFromInt(int64(count)), models.MoneyScale)
+	}
 	logAction(db, userID, "查看了贷款业务分析")
 	return totalAmount, count, averageAmount, nil
 }
 
 // logAction 记录系统日志
 func logAction(db *gorm.DB, userID uint, action string) error {
-	// 创建SystemLog实例
+	return logActionOnBehalf(db, userID, nil, action)
+}
+
+// logActionOnBehalf 记录操作日志，被委托人代理委托人操作时 principalID 为委托人
+func logActionOnBehalf(db *gorm.DB, userID uint, principalID *uint, action string) error {
+	// 创建SystemLog实例，通过 API 密钥访问时同时记录密钥ID，代登录时记录代登录ID和系统管理员
 	logEntry := models.SystemLog{
-		UserID: userID,
-		Action: action,
+		UserID:       userID,
+		APIKeyID:     apiKeyFromContext(db.Statement.Context),
+		OnBehalfOfID: principalID,
+		Action:       action,
+	}
+	if principalID != nil {
+		logEntry.Action = fmt.Sprintf("%s（代理用户: %d）", action, *principalID)
+	}
+	if impersonation := impersonationFromContext(db.Statement.Context); impersonation != nil {
+		logEntry.ImpersonationID = &impersonation.ID
+		logEntry.ImpersonatorID = &impersonation.AdminID
 	}
 	// 保存到数据库
 	if err := db.Create(&logEntry).Error; err != nil {
@@ -800,36 +1005,87 @@ func logAction(db *gorm.DB, userID uint, action string) error {
 	return nil
 }
 
-// 战区列表查询
-func GetZones(db *gorm.DB) ([]models.Zone, error) {
-    var zones []models.Zone
-    if err := db.Find(&zones).Error; err != nil {
-        return nil, err
-    }
-    return zones, nil
+// 战区列表查询，withDepartments 为 true 时同时查询战区下的部门
+func GetZones(db *gorm.DB, withDepartments bool) ([]models.Zone, error) {
+	var zones []models.Zone
+	if withDepartments {
+		db = db.Preload("Departments")
+	}
+	if err := db.Find(&zones).Error; err != nil {
+		return nil, err
+	}
+	return zones, nil
+}
+
+func GetZoneByID(db *gorm.DB, zoneID uint, withDepartments bool) (models.Zone, error) {
+	var zone models.Zone
+	if withDepartments {
+		db = db.Preload("Departments")
+	}
+	if err := db.First(&zone, zoneID).Error; err != nil {
+		return models.Zone{}, err
+	}
+	return zone, nil
+}
+
+// 部门列表查询，withUsers 为 true 时同时查询部门下的人员
+func GetDepartments(db *gorm.DB, withUsers bool) ([]models.Department, error) {
+	var departments []models.Department
+	if withUsers {
+		db = db.Preload("Users")
+	}
+	if err := db.Find(&departments).Error; err != nil {
+		return nil, err
+	}
+	return departments, nil
+}
+
+func GetDepartmentByID(db *gorm.DB, departmentID uint, withUsers bool) (models.Department, error) {
+	var department models.Department
+	if withUsers {
+		db = db.Preload("Users")
+	}
+	if err := db.First(&department, departmentID).Error; err != nil {
+		return models.Department{}, err
+	}
+	return department, nil
 }
 
-func GetZoneByID(db *gorm.DB, zoneID uint) (models.Zone, error) {
-    var zone models.Zone
-    if err := db.First(&zone, zoneID).Error; err != nil {
-        return models.Zone{}, err
-    }
-    return zone, nil
+/*运营指标*/
+
+// CountPublicSeaCustomers 统计公海客户数量
+func CountPublicSeaCustomers(db *gorm.DB) (int64, error) {
+	var count int64
+	if err := db.Model(&models.Customer{}).Where("is_in_public_sea = ?", true).Count(&count).Error; err != nil {
+		return 0, err
+	}
+	return count, nil
 }
 
-// 部门列表查询
-func GetDepartments(db *gorm.DB) ([]models.Department, error) {
-    var departments []models.Department
-    if err := db.Find(&departments).Error; err != nil {
-        return nil, err
-    }
-    return departments, nil
+// CountContractsByStatus 统计各状态的合同数量，没有合同的状态计为0
+func CountContractsByStatus(db *gorm.DB) (map[models.ContractStatus]int64, error) {
+	var rows []struct {
+		Status models.ContractStatus
+		Count  int64
+	}
+	if err := db.Model(&models.Contract{}).Select("status, count(*) as count").Group("status").Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	counts := make(map[models.ContractStatus]int64, len(models.ContractStatusNameMap))
+	for status := range models.ContractStatusNameMap {
+		counts[status] = 0
+	}
+	for _, row := range rows {
+		counts[row.Status] = row.Count
+	}
+	return counts, nil
 }
 
-func GetDepartmentByID(db *gorm.DB, departmentID uint) (models.Department, error) {
-    var department models.Department
-    if err := db.First(&department, departmentID).Error; err != nil {
-        return models.Department{}, err
-    }
-    return department, nil
-}
\ No newline at end of file
+// CountCustomersCreatedSince 统计指定时间之后新建的客户数量
+func CountCustomersCreatedSince(db *gorm.DB, since time.Time) (int64, error) {
+	var count int64
+	if err := db.Model(&models.Customer{}).Where("created_at >= ?", since).Count(&count).Error; err != nil {
+		return 0, err
+	}
+	return count, nil
+}
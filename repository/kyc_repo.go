@@ -0,0 +1,171 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"gin-boilerplate/infra/apperror"
+	"gin-boilerplate/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+/*客户KYC资料*/
+
+// canAccessCustomer 销售代表只能访问自己的客户，销售部长、总监分别限于本部门、本战区，其他角色不限
+func canAccessCustomer(user *models.User, customer *models.Customer) bool {
+	switch user.RoleID {
+	case models.SALES_REPRESENTATIVE:
+		return customer.SalerID != nil && *customer.SalerID == user.ID
+	case models.SALES_MANAGER:
+		return sameID(user.DepartmentID, customer.DepartmentID)
+	case models.SALES_DIRECTOR:
+		return sameID(user.ZoneID, customer.ZoneID)
+	}
+	return true
+}
+
+// UpdateCustomerKYC 客户当前的销售人员填写或修改KYC资料，修改后状态重置为待审核
+func UpdateCustomerKYC(db *gorm.DB, userID, customerID uint, nationalID models.NationalID, occupation string,
+	monthlyIncome, assets, existingDebts models.Money, maritalStatus models.MaritalStatus) (*models.KYCProfile, error) {
+	customer, err := GetCustomerByID(db, customerID)
+	if err != nil {
+		return nil, err
+	}
+	if customer.SalerID == nil || *customer.SalerID != userID {
+		return nil, apperror.New(apperror.CodeCustomerKYCForbidden)
+	}
+
+	var profile models.KYCProfile
+	err = db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("customer_id = ?", customerID).First(&profile).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		profile.CustomerID = customerID
+		profile.NationalID = nationalID
+		profile.Occupation = occupation
+		profile.MonthlyIncome = monthlyIncome.Round(models.MoneyScale)
+		profile.Assets = assets.Round(models.MoneyScale)
+		profile.ExistingDebts = existingDebts.Round(models.MoneyScale)
+		profile.MaritalStatus = maritalStatus
+		profile.Status = models.KYC_PENDING
+		profile.ReviewedBy = nil
+		profile.ReviewedAt = nil
+		profile.ReviewNote = ""
+		if err := tx.Save(&profile).Error; err != nil {
+			return err
+		}
+		// 日志中的身份证号码同样脱敏
+		return logAction(tx, userID, fmt.Sprintf("更新了客户: %d 的KYC资料，身份证号码: %s", customerID, nationalID.Masked()))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return getKYCProfile(db, customerID)
+}
+
+// AddKYCDocument 客户当前的销售人员上传KYC附件，资料需要重新审核
+func AddKYCDocument(db *gorm.DB, userID, customerID uint, kind, file string) (*models.KYCProfile, error) {
+	customer, err := GetCustomerByID(db, customerID)
+	if err != nil {
+		return nil, err
+	}
+	if customer.SalerID == nil || *customer.SalerID != userID {
+		return nil, apperror.New(apperror.CodeCustomerKYCForbidden)
+	}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		var profile models.KYCProfile
+		if err := tx.Where("customer_id = ?", customerID).First(&profile).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(&models.KYCDocument{
+			CustomerID: customerID,
+			Kind:       kind,
+			File:       file,
+			UploadedBy: userID,
+		}).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&profile).Updates(map[string]interface{}{
+			"status":      models.KYC_PENDING,
+			"reviewed_by": nil,
+			"reviewed_at": nil,
+			"review_note": "",
+		}).Error; err != nil {
+			return err
+		}
+		return logAction(tx, userID, fmt.Sprintf("上传了客户: %d 的KYC附件: %s", customerID, kind))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return getKYCProfile(db, customerID)
+}
+
+// ReviewCustomerKYC 金融专员/经理审核KYC资料，status 只能是已认证或已拒绝
+func ReviewCustomerKYC(db *gorm.DB, userID, customerID uint, status models.KYCStatus, note string) (*models.KYCProfile, error) {
+	if status == models.KYC_PENDING {
+		return nil, apperror.New(apperror.CodeInvalidParams).WithDetails(map[string]string{"field": "status"})
+	}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var profile models.KYCProfile
+		if err := tx.Where("customer_id = ?", customerID).First(&profile).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&profile).Updates(map[string]interface{}{
+			"status":      status,
+			"reviewed_by": userID,
+			"reviewed_at": time.Now(),
+			"review_note": note,
+		}).Error; err != nil {
+			return err
+		}
+		return logAction(tx, userID, fmt.Sprintf("审核了客户: %d 的KYC资料，结果: %s", customerID, models.KYCStatusNameMap[status]))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return getKYCProfile(db, customerID)
+}
+
+// GetCustomerKYC 查看客户的KYC资料和附件，销售人员只能查看权限范围内的客户
+func GetCustomerKYC(db *gorm.DB, userID, customerID uint) (*models.KYCProfile, error) {
+	curUser, err := GetUserByID(db, userID)
+	if err != nil {
+		return nil, err
+	}
+	customer, err := GetCustomerByID(db, customerID)
+	if err != nil {
+		return nil, err
+	}
+	if !canAccessCustomer(curUser, customer) {
+		return nil, apperror.New(apperror.CodeCustomerKYCForbidden)
+	}
+	profile, err := getKYCProfile(db, customerID)
+	if err != nil {
+		return nil, err
+	}
+	logAction(db, userID, fmt.Sprintf("查看了客户: %d 的KYC资料", customerID))
+	return profile, nil
+}
+
+func getKYCProfile(db *gorm.DB, customerID uint) (*models.KYCProfile, error) {
+	var profile models.KYCProfile
+	if err := db.Preload("Documents", func(db *gorm.DB) *gorm.DB {
+		return db.Order("id")
+	}).Where("customer_id = ?", customerID).First(&profile).Error; err != nil {
+		return nil, err
+	}
+	return &profile, nil
+}
+
+// checkCustomerKYCVerified 合同批准前检查客户的KYC资料已认证
+func checkCustomerKYCVerified(db *gorm.DB, customerID uint) error {
+	var profile models.KYCProfile
+	err := db.Select("id", "status").Where("customer_id = ?", customerID).First(&profile).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && profile.Status != models.KYC_VERIFIED) {
+		return apperror.New(apperror.CodeCustomerKYCNotVerified)
+	}
+	return err
+}
@@ -0,0 +1,194 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"gin-boilerplate/helpers"
+	"gin-boilerplate/infra/apperror"
+	"gin-boilerplate/models"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+/*贷后管理：金融产品、放款、还款计划和还款*/
+
+// CreateFinancialProduct 创建金融产品，只有金融经理可以操作
+func CreateFinancialProduct(db *gorm.DB, userID uint, name string, termMonths int,
+	annualRate models.Money, method models.RepaymentMethod) (*models.FinancialProduct, error) {
+	curUser, err := GetUserByID(db, userID)
+	if err != nil {
+		return nil, err
+	}
+	if curUser.RoleID != models.FINANCE_MANAGER {
+		return nil, apperror.New(apperror.CodeForbidden)
+	}
+	product := models.FinancialProduct{
+		Name:            name,
+		TermMonths:      termMonths,
+		AnnualRate:      annualRate,
+		RepaymentMethod: method,
+	}
+	if err := db.Create(&product).Error; err != nil {
+		return nil, err
+	}
+	logAction(db, userID, fmt.Sprintf("创建了金融产品: %s", name))
+	return &product, nil
+}
+
+// GetFinancialProducts 金融产品列表
+func GetFinancialProducts(db *gorm.DB) ([]models.FinancialProduct, error) {
+	var products []models.FinancialProduct
+	if err := db.Order("id").Find(&products).Error; err != nil {
+		return nil, err
+	}
+	return products, nil
+}
+
+// RecordDisbursement 金融专员/经理录入已批准合同的放款信息，并按金融产品生成还款计划
+// 还款计划的本金是实际放款金额，而不是合同的银行金额
+func RecordDisbursement(db *gorm.DB, userID, contractID uint, bank string, amount models.Money,
+	disbursedAt time.Time) (*models.Disbursement, []models.RepaymentInstallment, error) {
+	var disbursement models.Disbursement
+	var installments []models.RepaymentInstallment
+	err := db.Transaction(func(tx *gorm.DB) error {
+		contract, err := GetContractByID(tx, contractID)
+		if err != nil {
+			return err
+		}
+		if contract.Status != models.APPROVED {
+			return apperror.New(apperror.CodeContractNotApproved)
+		}
+		var count int64
+		if err := tx.Model(&models.Disbursement{}).Where("contract_id = ?", contractID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return apperror.New(apperror.CodeContractAlreadyDisbursed)
+		}
+		var product models.FinancialProduct
+		if err := tx.Where("name = ?", contract.FinancialProduct).First(&product).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return apperror.Wrap(apperror.CodeFinancialProductNotFound, err).
+					WithDetails(map[string]string{"financial_product": contract.FinancialProduct})
+			}
+			return err
+		}
+
+		disbursement = models.Disbursement{
+			ContractID:     contractID,
+			Bank:           bank,
+			Amount:         amount.Round(models.MoneyScale),
+			ExpectedAmount: contract.BankAmount,
+			DisbursedAt:    disbursedAt,
+			RecordedBy:     userID,
+		}
+		if err := tx.Create(&disbursement).Error; err != nil {
+			return err
+		}
+		installments = helpers.GenerateRepaymentSchedule(disbursement.Amount, product.AnnualRate,
+			product.TermMonths, product.RepaymentMethod, disbursedAt)
+		for i := range installments {
+			installments[i].ContractID = contractID
+		}
+		if err := tx.Create(&installments).Error; err != nil {
+			return err
+		}
+		return logAction(tx, userID, fmt.Sprintf("录入了合同: %d 的放款，金额: %s", contractID, disbursement.Amount))
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return &disbursement, installments, nil
+}
+
+// GetRepaymentSchedule 查询合同的放款信息和还款计划
+func GetRepaymentSchedule(db *gorm.DB, userID, contractID uint) (*models.Disbursement, []models.RepaymentInstallment, error) {
+	if _, err := GetContractByID(db, contractID); err != nil {
+		return nil, nil, err
+	}
+	var disbursement models.Disbursement
+	if err := db.Where("contract_id = ?", contractID).First(&disbursement).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, apperror.New(apperror.CodeContractNotDisbursed)
+		}
+		return nil, nil, err
+	}
+	var installments []models.RepaymentInstallment
+	if err := db.Where("contract_id = ?", contractID).Order("period").Find(&installments).Error; err != nil {
+		return nil, nil, err
+	}
+	logAction(db, userID, fmt.Sprintf("查看了合同: %d 的还款计划", contractID))
+	return &disbursement, installments, nil
+}
+
+// RecordRepayment 金融专员/经理录入一笔还款，按期数顺序冲抵尚未还清的分期，
+// 还款金额不能超过剩余应还总额
+func RecordRepayment(db *gorm.DB, userID, contractID uint, amount models.Money,
+	paidAt time.Time) (*models.Repayment, []models.RepaymentInstallment, error) {
+	var repayment models.Repayment
+	var installments []models.RepaymentInstallment
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("contract_id = ?", contractID).Order("period").Find(&installments).Error; err != nil {
+			return err
+		}
+		if len(installments) == 0 {
+			return apperror.New(apperror.CodeContractNotDisbursed)
+		}
+		outstanding := decimal.Zero
+		for _, installment := range installments {
+			outstanding = outstanding.Add(installment.Amount.Sub(installment.PaidAmount))
+		}
+		if amount.GreaterThan(outstanding) {
+			return apperror.New(apperror.CodeRepaymentExceedsOutstanding).
+				WithDetails(map[string]models.Money{"outstanding": outstanding})
+		}
+
+		left := amount.Round(models.MoneyScale)
+		for i := range installments {
+			installment := &installments[i]
+			due := installment.Amount.Sub(installment.PaidAmount)
+			if left.IsZero() || !due.IsPositive() {
+				continue
+			}
+			paid := decimal.Min(left, due)
+			left = left.Sub(paid)
+			installment.PaidAmount = installment.PaidAmount.Add(paid)
+			updates := map[string]interface{}{"paid_amount": installment.PaidAmount}
+			if installment.PaidAmount.Equal(installment.Amount) {
+				installment.Status = models.PAID
+				installment.PaidAt = &paidAt
+				updates["status"] = models.PAID
+				updates["paid_at"] = paidAt
+			}
+			if err := tx.Model(installment).Updates(updates).Error; err != nil {
+				return err
+			}
+		}
+
+		repayment = models.Repayment{
+			ContractID: contractID,
+			Amount:     amount.Round(models.MoneyScale),
+			PaidAt:     paidAt,
+			RecordedBy: userID,
+		}
+		if err := tx.Create(&repayment).Error; err != nil {
+			return err
+		}
+		return logAction(tx, userID, fmt.Sprintf("录入了合同: %d 的还款，金额: %s", contractID, repayment.Amount))
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return &repayment, installments, nil
+}
+
+// AutoFlagOverdueInstallments 把应还日期在今天之前且尚未还清的分期标记为逾期，每日执行
+func AutoFlagOverdueInstallments(db *gorm.DB) error {
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	return db.Model(&models.RepaymentInstallment{}).
+		Where("status = ? AND due_date < ?", models.UNPAID, today).
+		Update("status", models.OVERDUE).Error
+}
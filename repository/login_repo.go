@@ -0,0 +1,114 @@
+package repository
+
+import (
+	"fmt"
+	"gin-boilerplate/infra/apperror"
+	"gin-boilerplate/models"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+/*登录保护：按用户名统计连续密码错误次数，逐次加倍等待时间，达到次数后临时锁定账户*/
+
+// LoginPolicy 登录保护策略，由控制器根据配置传入
+type LoginPolicy struct {
+	DelayAfter      int           // 连续错误达到该次数后，重试前需要等待
+	DelayBase       time.Duration // 第一次等待的时间，之后每次错误加倍
+	DelayMax        time.Duration // 等待时间上限
+	LockoutAfter    int           // 连续错误达到该次数后锁定账户
+	LockoutDuration time.Duration // 锁定时长
+}
+
+// delay 连续错误 failures 次后，下一次尝试前需要等待的时间
+func (p LoginPolicy) delay(failures int) time.Duration {
+	if failures < p.DelayAfter {
+		return 0
+	}
+	wait := p.DelayBase
+	for i := p.DelayAfter; i < failures && wait < p.DelayMax; i++ {
+		wait *= 2
+	}
+	if wait > p.DelayMax {
+		wait = p.DelayMax
+	}
+	return wait
+}
+
+// checkLoginAllowed 账户锁定或者还在等待时间内时拒绝登录，不计入错误次数
+func checkLoginAllowed(user *models.User, policy LoginPolicy, now time.Time) error {
+	if user.LockedUntil != nil && now.Before(*user.LockedUntil) {
+		return apperror.New(apperror.CodeAccountLocked).WithRetryAfter(user.LockedUntil.Sub(now))
+	}
+	if user.LastFailedLoginAt != nil {
+		allowedAt := user.LastFailedLoginAt.Add(policy.delay(user.FailedLogins))
+		if now.Before(allowedAt) {
+			return apperror.New(apperror.CodeLoginThrottled).WithRetryAfter(allowedAt.Sub(now))
+		}
+	}
+	return nil
+}
+
+// recordLoginFailure 记录一次密码错误，达到次数后锁定账户并清零错误次数
+// 错误次数在数据库中原子地加一，并以数据库返回的次数判断是否锁定，并发的登录请求不会互相覆盖
+func recordLoginFailure(db *gorm.DB, user *models.User, policy LoginPolicy, now time.Time) error {
+	var counted models.User
+	if err := db.Model(&counted).
+		Clauses(clause.Returning{Columns: []clause.Column{{Name: "failed_logins"}}}).
+		Where("id = ?", user.ID).
+		UpdateColumns(map[string]interface{}{
+			"failed_logins":        gorm.Expr("failed_logins + 1"),
+			"last_failed_login_at": now,
+		}).Error; err != nil {
+		return err
+	}
+	failures := counted.FailedLogins
+	if failures >= policy.LockoutAfter {
+		// 只锁定一次：同时达到次数的其他请求看到次数已经清零，不会重复锁定
+		lockedUntil := now.Add(policy.LockoutDuration)
+		result := db.Model(&models.User{}).
+			Where("id = ? AND failed_logins >= ?", user.ID, policy.LockoutAfter).
+			UpdateColumns(map[string]interface{}{
+				"failed_logins":        0,
+				"last_failed_login_at": nil,
+				"locked_until":         lockedUntil,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected > 0 {
+			logAction(db, user.ID, fmt.Sprintf("连续 %d 次密码错误，账户锁定至 %s", failures, lockedUntil.Format(time.RFC3339)))
+		}
+		return apperror.New(apperror.CodeAccountLocked).WithRetryAfter(policy.LockoutDuration)
+	}
+	logAction(db, user.ID, fmt.Sprintf("密码错误，登录失败（连续 %d 次）", failures))
+	return apperror.New(apperror.CodeInvalidCredentials)
+}
+
+// resetLoginFailures 登录成功后清除错误次数和锁定状态
+func resetLoginFailures(db *gorm.DB, user *models.User) error {
+	if user.FailedLogins == 0 && user.LastFailedLoginAt == nil && user.LockedUntil == nil {
+		return nil
+	}
+	return db.Model(user).UpdateColumns(map[string]interface{}{
+		"failed_logins":        0,
+		"last_failed_login_at": nil,
+		"locked_until":         nil,
+	}).Error
+}
+
+// UnlockUser 系统管理员解锁账户，同时清除连续密码错误次数
+func UnlockUser(db *gorm.DB, systemManagerID, userID uint) (*models.User, error) {
+	user, err := GetUserByID(db, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := resetLoginFailures(db, user); err != nil {
+		return nil, err
+	}
+	if err := logAction(db, systemManagerID, fmt.Sprintf("解锁用户: %d", userID)); err != nil {
+		return nil, err
+	}
+	return GetUserByID(db, userID)
+}
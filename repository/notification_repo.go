@@ -0,0 +1,38 @@
+package repository
+
+import (
+	"gin-boilerplate/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+/*站内通知*/
+
+func createNotification(db *gorm.DB, userID uint, kind, message string) error {
+	return db.Create(&models.Notification{UserID: userID, Kind: kind, Message: message}).Error
+}
+
+// ListNotifications 用户的通知，最新的在前，unreadOnly 为 true 时只返回未读的
+func ListNotifications(db *gorm.DB, userID uint, unreadOnly bool) ([]models.Notification, error) {
+	query := db.Where("user_id = ?", userID).Order("id DESC")
+	if unreadOnly {
+		query = query.Where("read_at IS NULL")
+	}
+	var notifications []models.Notification
+	if err := query.Find(&notifications).Error; err != nil {
+		return nil, err
+	}
+	return notifications, nil
+}
+
+// ReadNotifications 把用户的全部未读通知标记为已读，返回标记的数量
+func ReadNotifications(db *gorm.DB, userID uint) (int64, error) {
+	result := db.Model(&models.Notification{}).
+		Where("user_id = ? AND read_at IS NULL", userID).
+		UpdateColumn("read_at", time.Now())
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	return result.RowsAffected, nil
+}
@@ -0,0 +1,128 @@
+package repository
+
+import (
+	"fmt"
+	"gin-boilerplate/helpers"
+	"gin-boilerplate/infra/apperror"
+	"gin-boilerplate/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+/*修改和重置密码：保存最近使用过的密码，系统管理员重置后生成临时密码，用户下次登录后必须修改*/
+
+// checkPasswordReuse 新密码与当前密码或最近 history 次使用过的密码相同时返回 CodePasswordReused
+// 临时密码不算用户使用过的密码，不参与检查
+func checkPasswordReuse(db *gorm.DB, user *models.User, password string, history int) error {
+	reused := apperror.New(apperror.CodePasswordReused).WithDetails(map[string]interface{}{"history": history})
+	if !user.MustChangePassword && helpers.CheckPasswordHash(password, user.PasswordHash) == nil {
+		return reused
+	}
+	if history == 0 {
+		return nil
+	}
+	var previous []models.PasswordHistory
+	if err := db.Where("user_id = ?", user.ID).Order("id DESC").Limit(history).Find(&previous).Error; err != nil {
+		return err
+	}
+	for _, p := range previous {
+		if helpers.CheckPasswordHash(password, p.PasswordHash) == nil {
+			return reused
+		}
+	}
+	return nil
+}
+
+// setPassword 保存新密码，原来的密码（临时密码除外）写入历史，历史只保留最近 history 条
+// updates 中可以同时更新其他字段
+func setPassword(tx *gorm.DB, user *models.User, password string, history int, updates map[string]interface{}) error {
+	passwordHash, err := helpers.HashPassword(password)
+	if err != nil {
+		return err
+	}
+	if !user.MustChangePassword && history > 0 {
+		if err := tx.Create(&models.PasswordHistory{UserID: user.ID, PasswordHash: user.PasswordHash}).Error; err != nil {
+			return err
+		}
+		var expired []uint
+		if err := tx.Model(&models.PasswordHistory{}).Where("user_id = ?", user.ID).
+			Order("id DESC").Offset(history).Pluck("id", &expired).Error; err != nil {
+			return err
+		}
+		if len(expired) > 0 {
+			if err := tx.Unscoped().Delete(&models.PasswordHistory{}, expired).Error; err != nil {
+				return err
+			}
+		}
+	}
+	updates["password_hash"] = passwordHash
+	return tx.Model(user).UpdateColumns(updates).Error
+}
+
+// ChangePassword 用户修改自己的密码，需要验证当前密码，修改后不再需要强制修改密码
+// 当前会话 currentFamily 保留，其他会话全部撤销
+func ChangePassword(db *gorm.DB, userID uint, currentFamily, currentPassword, newPassword string, history int) (*models.User, error) {
+	user, err := GetUserByID(db, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := helpers.CheckPasswordHash(currentPassword, user.PasswordHash); err != nil {
+		logAction(db, userID, "当前密码错误，修改密码失败")
+		return nil, apperror.Wrap(apperror.CodeWrongCurrentPassword, err)
+	}
+	now := time.Now()
+	if user.MustChangePassword && user.PasswordExpiresAt != nil && now.After(*user.PasswordExpiresAt) {
+		return nil, apperror.New(apperror.CodeTemporaryPasswordExpired)
+	}
+	if err := checkPasswordReuse(db, user, newPassword, history); err != nil {
+		return nil, err
+	}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := setPassword(tx, user, newPassword, history, map[string]interface{}{
+			"must_change_password": false,
+			"password_expires_at":  nil,
+			"password_changed_at":  now,
+		}); err != nil {
+			return err
+		}
+		revoked, err := revokeUserSessions(tx, userID, currentFamily, SessionRevokedPasswordChanged)
+		if err != nil {
+			return err
+		}
+		return logAction(tx, userID, fmt.Sprintf("修改密码，撤销其他 %d 个会话", revoked))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return GetUserByID(db, userID)
+}
+
+// ResetPassword 系统管理员把用户密码重置为临时密码，临时密码在 expiresAt 之前有效，
+// 用户使用临时密码登录后必须先修改密码，重置同时解除账户锁定并撤销用户的全部会话
+func ResetPassword(db *gorm.DB, systemManagerID, userID uint, temporaryPassword string, expiresAt time.Time, history int) (*models.User, error) {
+	user, err := GetUserByID(db, userID)
+	if err != nil {
+		return nil, err
+	}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := setPassword(tx, user, temporaryPassword, history, map[string]interface{}{
+			"must_change_password": true,
+			"password_expires_at":  expiresAt,
+			"failed_logins":        0,
+			"last_failed_login_at": nil,
+			"locked_until":         nil,
+		}); err != nil {
+			return err
+		}
+		revoked, err := revokeUserSessions(tx, userID, "", SessionRevokedPasswordReset)
+		if err != nil {
+			return err
+		}
+		return logAction(tx, systemManagerID, fmt.Sprintf("重置用户: %d 的密码，临时密码有效期至 %s，撤销 %d 个会话", userID, expiresAt.Format(time.RFC3339), revoked))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return GetUserByID(db, userID)
+}
@@ -0,0 +1,202 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"gin-boilerplate/infra/apperror"
+	"gin-boilerplate/infra/pii"
+	"gin-boilerplate/models"
+
+	"gorm.io/gorm"
+)
+
+/*客户敏感信息：去重、脱敏、查看完整信息和密钥轮换*/
+
+// checkCustomerPhone 计算电话的盲索引，并检查没有其他客户（excludeID 以外）使用该电话，phone 为空时返回空索引
+func checkCustomerPhone(db *gorm.DB, phone string, excludeID uint) (string, error) {
+	phoneIndex, err := pii.BlindIndex(phone)
+	if err != nil || phoneIndex == "" {
+		return phoneIndex, err
+	}
+	var count int64
+	if err := db.Model(&models.Customer{}).
+		Where("phone_index = ? AND id <> ?", phoneIndex, excludeID).
+		Count(&count).Error; err != nil {
+		return "", err
+	}
+	if count > 0 {
+		return "", apperror.New(apperror.CodeCustomerPhoneExists)
+	}
+	return phoneIndex, nil
+}
+
+// customerPIIVisible 按角色决定是否返回完整的电话和地址（见 models.FullPIIRoles），并且客户必须在用户的权限范围内，
+// 例如销售代表看不到公海客户的完整信息；其他情况需要时通过 RevealCustomerPII 查看
+func customerPIIVisible(user *models.User, customer *models.Customer) bool {
+	return models.SeesFullPII(user.RoleID) && canAccessCustomer(user, customer)
+}
+
+// maskCustomer 对不需要完整信息的用户脱敏
+func maskCustomer(user *models.User, customer *models.Customer) {
+	if !customerPIIVisible(user, customer) {
+		customer.MaskPII()
+	}
+}
+
+func maskCustomersFor(user *models.User, customers []models.Customer) {
+	for i := range customers {
+		maskCustomer(user, &customers[i])
+	}
+}
+
+// FindCustomerByPhone 按电话查找客户，只能找到权限范围内或者在公海中的客户
+func FindCustomerByPhone(db *gorm.DB, userID uint, phone string) (*models.Customer, error) {
+	curUser, err := GetUserByID(db, userID)
+	if err != nil {
+		return nil, err
+	}
+	phoneIndex, err := pii.BlindIndex(phone)
+	if err != nil {
+		return nil, err
+	}
+	var customer models.Customer
+	if err := db.Where("phone_index = ?", phoneIndex).First(&customer).Error; err != nil {
+		return nil, err
+	}
+	if !customer.IsInPublicSea && !canAccessCustomer(curUser, &customer) {
+		return nil, apperror.New(apperror.CodeCustomerAccessForbidden)
+	}
+	maskCustomer(curUser, &customer)
+	logAction(db, userID, fmt.Sprintf("按电话查找了客户: %d", customer.ID))
+	return &customer, nil
+}
+
+// RevealCustomerPII 查看客户完整的电话、地址和身份证号码，必须填写原因，每次查看都记录到系统日志
+func RevealCustomerPII(db *gorm.DB, userID, customerID uint, reason string) (*models.CustomerPII, error) {
+	curUser, err := GetUserByID(db, userID)
+	if err != nil {
+		return nil, err
+	}
+	customer, err := GetCustomerByID(db, customerID)
+	if err != nil {
+		return nil, err
+	}
+	if !canAccessCustomer(curUser, customer) {
+		logAction(db, userID, fmt.Sprintf("尝试查看客户: %d 的完整信息被拒绝", customerID))
+		return nil, apperror.New(apperror.CodeCustomerAccessForbidden)
+	}
+	revealed := models.CustomerPII{
+		CustomerID: customer.ID,
+		Phone:      string(customer.Phone),
+		Address:    string(customer.Address),
+	}
+	var profile models.KYCProfile
+	err = db.Select("id", "national_id").Where("customer_id = ?", customerID).Limit(1).Find(&profile).Error
+	if err != nil {
+		return nil, err
+	}
+	revealed.NationalID = string(profile.NationalID)
+	if err := logAction(db, userID, fmt.Sprintf("查看了客户: %d 的完整电话、地址和身份证号码，原因: %s", customerID, reason)); err != nil {
+		return nil, err
+	}
+	return &revealed, nil
+}
+
+// 加密存储的字段，按表列出
+var encryptedColumns = []struct {
+	table   string
+	columns []string
+}{
+	{"customers", []string{"phone", "address"}},
+	{"user_profiles", []string{"phone", "address"}},
+	{"kyc_profiles", []string{"national_id"}},
+	{"users", []string{"totp_secret"}},
+}
+
+// 轮换密钥时每批处理的行数，每批单独提交
+const rotationBatchSize = 500
+
+// RotatePIIKeys 用当前密钥重新加密所有不是用当前密钥加密的字段（包括加密上线前的明文），并补齐客户电话的盲索引
+// 按主键分批读取和更新，每批一个事务，中途失败时已提交的批次不回滚，重新调用会从未轮换的行继续
+// 返回更新的行数；轮换完成后才能从配置中删除旧密钥
+func RotatePIIKeys(db *gorm.DB, systemManagerID uint) (int, error) {
+	rotated := 0
+	for _, target := range encryptedColumns {
+		var afterID uint
+		for {
+			updates, lastID, err := rotationUpdates(db, target.table, target.columns, afterID)
+			if err != nil {
+				return 0, err
+			}
+			if lastID == 0 {
+				break
+			}
+			err = db.Transaction(func(tx *gorm.DB) error {
+				for id, values := range updates {
+					if err := tx.Table(target.table).Where("id = ?", id).UpdateColumns(values).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				return 0, err
+			}
+			rotated += len(updates)
+			afterID = lastID
+		}
+	}
+	if err := logAction(db, systemManagerID, fmt.Sprintf("轮换了敏感信息加密密钥，重新加密了 %d 行", rotated)); err != nil {
+		return 0, err
+	}
+	return rotated, nil
+}
+
+// rotationUpdates 读出主键大于 afterID 的一批行中需要重新加密的字段，返回这批最后一行的主键，没有更多行时返回 0
+// 先读完再更新，避免 SQLite 单连接时读写互相等待
+func rotationUpdates(db *gorm.DB, table string, columns []string, afterID uint) (map[uint]map[string]interface{}, uint, error) {
+	selected := append([]string{"id"}, columns...)
+	if table == "customers" {
+		selected = append(selected, "phone_index")
+	}
+	rows, err := db.Table(table).Select(selected).Where("id > ?", afterID).Order("id").Limit(rotationBatchSize).Rows()
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var lastID uint
+	updates := map[uint]map[string]interface{}{}
+	for rows.Next() {
+		var id uint
+		values := make([]sql.NullString, len(selected)-1)
+		dest := []interface{}{&id}
+		for i := range values {
+			dest = append(dest, &values[i])
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, 0, err
+		}
+		lastID = id
+		changed := map[string]interface{}{}
+		for i, column := range columns {
+			if !pii.NeedsRotation(values[i].String) {
+				continue
+			}
+			plaintext, err := pii.Decrypt(values[i].String)
+			if err != nil {
+				return nil, 0, fmt.Errorf("%s %d %s: %w", table, id, column, err)
+			}
+			changed[column] = models.EncryptedString(plaintext)
+			if table == "customers" && column == "phone" && values[len(values)-1].String == "" {
+				if changed["phone_index"], err = pii.BlindIndex(plaintext); err != nil {
+					return nil, 0, err
+				}
+			}
+		}
+		if len(changed) > 0 {
+			updates[id] = changed
+		}
+	}
+	return updates, lastID, rows.Err()
+}
@@ -0,0 +1,188 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"gin-boilerplate/infra/apperror"
+	"gin-boilerplate/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+/*合同金额版本和会计对账*/
+
+// recordAmountVersion 记录合同当前金额为新的版本，必须在修改金额的同一事务中调用
+func recordAmountVersion(tx *gorm.DB, contract *models.Contract, userID uint, reason string) error {
+	var latest int
+	if err := tx.Model(&models.ContractAmountVersion{}).
+		Where("contract_id = ?", contract.ID).
+		Select("coalesce(max(version), 0)").
+		Row().Scan(&latest); err != nil {
+		return err
+	}
+	return tx.Create(&models.ContractAmountVersion{
+		ContractID: contract.ID,
+		Version:    latest + 1,
+		Amount:     contract.Amount,
+		ServiceFee: contract.ServiceFee,
+		BankAmount: contract.BankAmount,
+		ChangedBy:  userID,
+		Reason:     reason,
+	}).Error
+}
+
+// GetContractAmountHistory 合同金额的全部版本，按版本号升序
+func GetContractAmountHistory(db *gorm.DB, userID, contractID uint) ([]models.ContractAmountVersion, error) {
+	if _, err := GetContractByID(db, contractID); err != nil {
+		return nil, err
+	}
+	var versions []models.ContractAmountVersion
+	if err := db.Where("contract_id = ?", contractID).Order("version").Find(&versions).Error; err != nil {
+		return nil, err
+	}
+	logAction(db, userID, fmt.Sprintf("查看了合同: %d 的金额历史", contractID))
+	return versions, nil
+}
+
+// ConfirmBankAmount 合同指定的会计（或其被委托人）确认银行实际金额
+// 合同金额与银行金额之差的绝对值超过 tolerance 时生成（或更新）待处理的对账差异，
+// 不超过时自动处理掉该合同已有的待处理差异；没有差异时返回的 item 为 nil
+func ConfirmBankAmount(db *gorm.DB, userID, contractID uint, bankAmount, tolerance models.Money) (*models.Contract, *models.ReconciliationItem, error) {
+	var contract models.Contract
+	var item *models.ReconciliationItem
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&contract, contractID).Error; err != nil {
+			return err
+		}
+		principalID, allowed, err := actingFor(tx, userID, contract.AccountantID)
+		if err != nil {
+			return err
+		}
+		if !allowed {
+			return apperror.New(apperror.CodeReconciliationForbidden)
+		}
+
+		now := time.Now()
+		bankAmount = bankAmount.Round(models.MoneyScale)
+		bankChanged := !bankAmount.Equal(contract.BankAmount)
+		contract.BankAmount = bankAmount
+		contract.BankConfirmedBy = &userID
+		contract.BankConfirmedAt = &now
+		if err := tx.Model(&contract).Updates(map[string]interface{}{
+			"bank_amount":       bankAmount,
+			"bank_confirmed_by": userID,
+			"bank_confirmed_at": now,
+		}).Error; err != nil {
+			return err
+		}
+		if bankChanged {
+			if err := recordAmountVersion(tx, &contract, userID, "会计确认银行金额"); err != nil {
+				return err
+			}
+		}
+
+		if item, err = reconcileAmounts(tx, &contract, userID, tolerance, "重新确认后差额在容差内"); err != nil {
+			return err
+		}
+		if item != nil {
+			return logActionOnBehalf(tx, userID, principalID, fmt.Sprintf("确认了合同: %d 的银行金额 %s，差额 %s 超过容差", contractID, bankAmount, item.Difference))
+		}
+		return logActionOnBehalf(tx, userID, principalID, fmt.Sprintf("确认了合同: %d 的银行金额 %s", contractID, bankAmount))
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return &contract, item, nil
+}
+
+// reconcileAmounts 比较合同金额与银行金额：差额的绝对值超过 tolerance 时生成（或更新）待处理的对账差异并返回，
+// 不超过时以 resolution 处理掉该合同已有的待处理差异并返回 nil，必须在修改金额的同一事务中调用
+func reconcileAmounts(tx *gorm.DB, contract *models.Contract, userID uint, tolerance models.Money, resolution string) (*models.ReconciliationItem, error) {
+	var open models.ReconciliationItem
+	err := tx.Where("contract_id = ? AND status = ?", contract.ID, models.RECONCILIATION_OPEN).First(&open).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	hasOpen := err == nil
+
+	difference := contract.Amount.Sub(contract.BankAmount)
+	if difference.Abs().GreaterThan(tolerance) {
+		open.ContractID = contract.ID
+		open.AccountantID = contract.AccountantID
+		open.Amount = contract.Amount
+		open.BankAmount = contract.BankAmount
+		open.Difference = difference
+		open.Status = models.RECONCILIATION_OPEN
+		if err := tx.Save(&open).Error; err != nil {
+			return nil, err
+		}
+		return &open, nil
+	}
+	if hasOpen {
+		if err := resolveItem(tx, &open, userID, resolution); err != nil {
+			return nil, err
+		}
+	}
+	return nil, nil
+}
+
+// GetReconciliationItems 会计查看自己负责的和委托给自己的会计负责的对账差异，status 为 nil 时返回全部
+func GetReconciliationItems(db *gorm.DB, userID uint, status *models.ReconciliationStatus) ([]models.ReconciliationItem, error) {
+	principals, err := delegatedPrincipals(db, userID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	query := db.Where("accountant_id IN ?", append(principals, userID))
+	if status != nil {
+		query = query.Where("status = ?", *status)
+	}
+	var items []models.ReconciliationItem
+	if err := query.Order("id").Find(&items).Error; err != nil {
+		return nil, err
+	}
+	logAction(db, userID, "查看了对账差异列表")
+	return items, nil
+}
+
+// ResolveReconciliationItem 负责的会计（或其被委托人）填写处理说明并关闭对账差异
+func ResolveReconciliationItem(db *gorm.DB, userID, itemID uint, resolution string) (*models.ReconciliationItem, error) {
+	var item models.ReconciliationItem
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&item, itemID).Error; err != nil {
+			return err
+		}
+		principalID, allowed, err := actingFor(tx, userID, item.AccountantID)
+		if err != nil {
+			return err
+		}
+		if !allowed {
+			return apperror.New(apperror.CodeReconciliationForbidden)
+		}
+		if item.Status != models.RECONCILIATION_OPEN {
+			return apperror.New(apperror.CodeReconciliationResolved)
+		}
+		if err := resolveItem(tx, &item, userID, resolution); err != nil {
+			return err
+		}
+		return logActionOnBehalf(tx, userID, principalID, fmt.Sprintf("处理了合同: %d 的对账差异: %s", item.ContractID, resolution))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+func resolveItem(tx *gorm.DB, item *models.ReconciliationItem, userID uint, resolution string) error {
+	now := time.Now()
+	item.Status = models.RECONCILIATION_RESOLVED
+	item.ResolvedBy = &userID
+	item.ResolvedAt = &now
+	item.Resolution = resolution
+	return tx.Model(item).Updates(map[string]interface{}{
+		"status":      models.RECONCILIATION_RESOLVED,
+		"resolved_by": userID,
+		"resolved_at": now,
+		"resolution":  resolution,
+	}).Error
+}
@@ -0,0 +1,213 @@
+package repository
+
+import (
+	"context"
+	"gin-boilerplate/models"
+	"time"
+)
+
+/*
+仓储接口
+
+权限检查、状态变化和系统日志等业务规则由仓储函数实现，没有单独的 service 层，
+控制器只依赖这些接口，通过 controllers.NewController 注入具体实现：
+  - 生产环境使用 NewGormRepositories(database.DB)，连接 Postgres
+  - 测试使用 NewGormRepositories(db)，db 由 database.SQLiteConnection 打开，不依赖外部数据库
+*/
+
+// UserRepo 用户账户和个人信息
+type UserRepo interface {
+	CreateUser(ctx context.Context, userName, password string) (*models.User, error)
+	CreateSystemManager(ctx context.Context, userName, password string) (*models.User, error)
+	DeleteUser(ctx context.Context, systemManagerID, userID uint) error
+	Login(ctx context.Context, userName, password string, policy LoginPolicy) (*models.User, error)
+	UnlockUser(ctx context.Context, systemManagerID, userID uint) (*models.User, error)
+	GetUserByUserName(ctx context.Context, userName string) (*models.User, error)
+	GetUserByID(ctx context.Context, userID uint) (*models.User, error)
+	UpdateUserNameOrPassword(ctx context.Context, systemManagerID, userID uint, userName, password string, history int) (*models.User, error)
+	ChangePassword(ctx context.Context, userID uint, currentFamily, currentPassword, newPassword string, history int) (*models.User, error)
+	ResetPassword(ctx context.Context, systemManagerID, userID uint, temporaryPassword string, expiresAt time.Time, history int) (*models.User, error)
+	UpdateUserRole(ctx context.Context, systemManagerID, userID uint, roleID models.RoleID) (*models.User, error)
+	UpdateUserProfile(ctx context.Context, userID uint, name string, age uint, gender models.Gender, address, phone string) (*models.User, error)
+	GetUserList(ctx context.Context, systemManagerID uint) ([]models.User, error)
+}
+
+// TwoFactorRepo 两步验证的绑定、验证、关闭和重置
+type TwoFactorRepo interface {
+	StartTOTPEnrollment(ctx context.Context, userID uint, password, secret string) (*models.User, error)
+	ConfirmTOTPEnrollment(ctx context.Context, userID uint, code string, skew int, recoveryCodes []string) (*models.User, error)
+	VerifyLoginTOTP(ctx context.Context, userID uint, code string, skew int, policy LoginPolicy) (*models.User, error)
+	DisableTOTP(ctx context.Context, userID uint, password, code string, skew int, requiredRoles []string) (*models.User, error)
+	RegenerateRecoveryCodes(ctx context.Context, userID uint, code string, skew int, recoveryCodes []string) error
+	ResetTOTP(ctx context.Context, systemManagerID, userID uint) (*models.User, error)
+}
+
+// IdentityRepo 单点登录的外部身份
+type IdentityRepo interface {
+	SSOLogin(ctx context.Context, identity SSOIdentity, policy LoginPolicy) (*models.User, error)
+	SyncSSORole(ctx context.Context, userID uint, provider string, role models.RoleID) (*models.User, error)
+}
+
+// APIKeyRepo 系统管理员管理的 API 密钥
+type APIKeyRepo interface {
+	CreateAPIKey(ctx context.Context, systemManagerID uint, key NewAPIKey) (*models.APIKey, error)
+	ListAPIKeys(ctx context.Context, systemManagerID uint) ([]models.APIKey, error)
+	RevokeAPIKey(ctx context.Context, systemManagerID, keyID uint) (*models.APIKey, error)
+	AuthenticateAPIKey(ctx context.Context, plaintext string, now time.Time) (*models.APIKey, *models.User, error)
+}
+
+// ImpersonationRepo 系统管理员代登录
+type ImpersonationRepo interface {
+	StartImpersonation(ctx context.Context, systemManagerID uint, params NewImpersonation) (*models.Impersonation, *models.User, error)
+	ActiveImpersonation(ctx context.Context, impersonationID uint, now time.Time) (*models.Impersonation, error)
+	EndImpersonation(ctx context.Context, systemManagerID, impersonationID uint) (*models.Impersonation, error)
+	ListImpersonations(ctx context.Context, systemManagerID uint) ([]models.Impersonation, error)
+	RecordImpersonatedRequest(ctx context.Context, impersonation *models.Impersonation, request string, status int) error
+}
+
+// DelegationRepo 审批委托
+type DelegationRepo interface {
+	CreateDelegation(ctx context.Context, operatorID uint, params NewDelegation) (*models.Delegation, error)
+	ListDelegations(ctx context.Context, userID uint) ([]models.Delegation, error)
+	GetAllDelegations(ctx context.Context, systemManagerID uint) ([]models.Delegation, error)
+	RevokeDelegation(ctx context.Context, operatorID, delegationID uint, principalID *uint) (*models.Delegation, error)
+}
+
+// NotificationRepo 站内通知
+type NotificationRepo interface {
+	ListNotifications(ctx context.Context, userID uint, unreadOnly bool) ([]models.Notification, error)
+	ReadNotifications(ctx context.Context, userID uint) (int64, error)
+}
+
+// SessionRepo 登录会话和登录记录
+type SessionRepo interface {
+	CreateSession(ctx context.Context, session NewSession) (*models.Session, error)
+	TouchSession(ctx context.Context, family string, now time.Time) error
+	RotateRefreshToken(ctx context.Context, family, refreshID string, expiresAt time.Time) error
+	RefreshSession(ctx context.Context, family, presentedID, newRefreshID string, expiresAt time.Time) (*models.User, error)
+	ListSessions(ctx context.Context, userID uint) ([]models.Session, error)
+	RevokeSession(ctx context.Context, userID, sessionID uint) error
+	RevokeOtherSessions(ctx context.Context, userID uint, currentFamily string) (int64, error)
+	GetUserSessions(ctx context.Context, systemManagerID, userID uint) ([]models.Session, error)
+	RevokeUserSession(ctx context.Context, systemManagerID, sessionID uint) (*models.Session, error)
+	GetLoginHistory(ctx context.Context, filter LoginHistoryFilter) ([]models.LoginEvent, error)
+	GetUserLoginHistory(ctx context.Context, systemManagerID uint, filter LoginHistoryFilter) ([]models.LoginEvent, error)
+}
+
+// OrgRepo 战区、部门以及人员分配
+type OrgRepo interface {
+	CreateZone(ctx context.Context, systemManagerID uint, name string) (*models.Zone, error)
+	CreateSalesDepartment(ctx context.Context, systemManagerID uint, name string, zoneID *uint) (*models.Department, error)
+	CreateFinanceDepartment(ctx context.Context, systemManagerID uint, name string) (*models.Department, error)
+	AssignDepartmentToZone(ctx context.Context, systemManagerID, departmentID, zoneID uint) error
+	AssignUserToDepartment(ctx context.Context, systemManagerID, userID, departmentID uint) error
+	AssignUserToZone(ctx context.Context, systemManagerID, userID, zoneID uint) error
+	AssignDirectorToZone(ctx context.Context, systemManagerID, userID, zoneID uint) error
+	AssignManagerToDepartment(ctx context.Context, systemManagerID, userID, departmentID uint) error
+	GetZones(ctx context.Context, withDepartments bool) ([]models.Zone, error)
+	GetZoneByID(ctx context.Context, zoneID uint, withDepartments bool) (models.Zone, error)
+	GetDepartments(ctx context.Context, withUsers bool) ([]models.Department, error)
+	GetDepartmentByID(ctx context.Context, departmentID uint, withUsers bool) (models.Department, error)
+}
+
+// SystemLogRepo 系统操作日志
+type SystemLogRepo interface {
+	GetSystemLogList(ctx context.Context, systemManagerID uint) ([]models.SystemLog, error)
+}
+
+// CustomerRepo 客户、公海和客户的KYC资料
+type CustomerRepo interface {
+	CreateCustomer(ctx context.Context, userID uint, name, phone string) (*models.Customer, error)
+	GetCustomerByID(ctx context.Context, customerID uint) (*models.Customer, error)
+	UpdateCustomer(ctx context.Context, userID, customerID uint, name, phone string, age uint, gender models.Gender, address string) (*models.Customer, error)
+	ListCustomer(ctx context.Context, userID uint) (*[]models.Customer, error)
+	GetPublicSeaCustomerList(ctx context.Context, userID uint) ([]models.Customer, error)
+	MigrateCustomer(ctx context.Context, userID, newSalerID, customerID uint) (*models.Customer, error)
+	AutoUpdateCustomerLoanIntent(ctx context.Context) error
+	AutoMigrateCustomerToPublicSea(ctx context.Context) error
+	UpdateCustomerKYC(ctx context.Context, userID, customerID uint, nationalID models.NationalID, occupation string, monthlyIncome, assets, existingDebts models.Money, maritalStatus models.MaritalStatus) (*models.KYCProfile, error)
+	AddKYCDocument(ctx context.Context, userID, customerID uint, kind, file string) (*models.KYCProfile, error)
+	ReviewCustomerKYC(ctx context.Context, userID, customerID uint, status models.KYCStatus, note string) (*models.KYCProfile, error)
+	GetCustomerKYC(ctx context.Context, userID, customerID uint) (*models.KYCProfile, error)
+	FindCustomerByPhone(ctx context.Context, userID uint, phone string) (*models.Customer, error)
+	RevealCustomerPII(ctx context.Context, userID, customerID uint, reason string) (*models.CustomerPII, error)
+	RotatePIIKeys(ctx context.Context, systemManagerID uint) (int, error)
+}
+
+// WorkLogRepo 销售工作日志
+type WorkLogRepo interface {
+	CreateWorkLog(ctx context.Context, userID uint, calls, validCalls, visits, contracts int, date time.Time) (*models.WorkLog, error)
+}
+
+// ContractRepo 合同
+type ContractRepo interface {
+	GetContractByID(ctx context.Context, contractID uint) (*models.Contract, error)
+	SubmitContract(ctx context.Context, salerID, customerID, finanaceID, accountantID uint,
+		amount, serviceFee, bankAmount models.Money,
+		financialProduct, contractDocument, bankDocuments string) (*models.Contract, error)
+	UpdateContractStatus(ctx context.Context, userID, contractID uint, status models.ContractStatus) (*models.Contract, error)
+	UpdateContractAmount(ctx context.Context, userID, contractID uint, amount, serviceFee, bankAmount, tolerance models.Money, reason string) (*models.Contract, error)
+	GetContractAmountHistory(ctx context.Context, userID, contractID uint) ([]models.ContractAmountVersion, error)
+	GetContractListByUser(ctx context.Context, userID uint) (*[]models.Contract, error)
+	GetContract(ctx context.Context, userID, contractID uint) (models.Contract, error)
+}
+
+// LoanRepo 金融产品、放款和还款
+type LoanRepo interface {
+	CreateFinancialProduct(ctx context.Context, userID uint, name string, termMonths int, annualRate models.Money, method models.RepaymentMethod) (*models.FinancialProduct, error)
+	GetFinancialProducts(ctx context.Context) ([]models.FinancialProduct, error)
+	RecordDisbursement(ctx context.Context, userID, contractID uint, bank string, amount models.Money, disbursedAt time.Time) (*models.Disbursement, []models.RepaymentInstallment, error)
+	GetRepaymentSchedule(ctx context.Context, userID, contractID uint) (*models.Disbursement, []models.RepaymentInstallment, error)
+	RecordRepayment(ctx context.Context, userID, contractID uint, amount models.Money, paidAt time.Time) (*models.Repayment, []models.RepaymentInstallment, error)
+	AutoFlagOverdueInstallments(ctx context.Context) error
+}
+
+// CommissionRepo 提成方案和提成单
+type CommissionRepo interface {
+	CreateCommissionPlan(ctx context.Context, userID uint, name string, roleID models.RoleID, baseRate, overrideRate models.Money, tiers []models.CommissionTier) (*models.CommissionPlan, error)
+	GetCommissionPlans(ctx context.Context) ([]models.CommissionPlan, error)
+	SettleCommissions(ctx context.Context, userID uint, period string) ([]models.CommissionStatement, error)
+	GetCommissionStatements(ctx context.Context, userID uint, period string) ([]models.CommissionStatement, error)
+	GetCommissionStatement(ctx context.Context, userID, statementID uint) (*models.CommissionStatement, error)
+	AdjustCommissionStatement(ctx context.Context, userID, statementID uint, adjustment models.Money, note string) (*models.CommissionStatement, error)
+	LockCommissionStatement(ctx context.Context, userID, statementID uint) (*models.CommissionStatement, error)
+}
+
+// ReconciliationRepo 会计核对合同金额与银行金额
+type ReconciliationRepo interface {
+	ConfirmBankAmount(ctx context.Context, userID, contractID uint, bankAmount, tolerance models.Money) (*models.Contract, *models.ReconciliationItem, error)
+	GetReconciliationItems(ctx context.Context, userID uint, status *models.ReconciliationStatus) ([]models.ReconciliationItem, error)
+	ResolveReconciliationItem(ctx context.Context, userID, itemID uint, resolution string) (*models.ReconciliationItem, error)
+}
+
+// StatsRepo 业绩统计和运营指标
+type StatsRepo interface {
+	GetSalerPerformance(ctx context.Context, userID, salerID uint, startDate, endDate time.Time) (models.Money, error)
+	GetDepartmentPerformance(ctx context.Context, userID, departmentID uint, startDate, endDate time.Time) (models.Money, error)
+	GetZonePerformance(ctx context.Context, userID, zoneID uint, startDate, endDate time.Time) (models.Money, error)
+	LoanAnalysis(ctx context.Context, userID uint) (models.Money, int, models.Money, error)
+	CountPublicSeaCustomers(ctx context.Context) (int64, error)
+	CountContractsByStatus(ctx context.Context) (map[models.ContractStatus]int64, error)
+	CountCustomersCreatedSince(ctx context.Context, since time.Time) (int64, error)
+}
+
+// Repositories 控制器依赖的全部仓储
+type Repositories struct {
+	Users          UserRepo
+	TwoFactor      TwoFactorRepo
+	Identities     IdentityRepo
+	APIKeys        APIKeyRepo
+	Sessions       SessionRepo
+	Impersonations ImpersonationRepo
+	Notifications  NotificationRepo
+	Delegations    DelegationRepo
+	Org            OrgRepo
+	SystemLogs     SystemLogRepo
+	Customers      CustomerRepo
+	WorkLogs       WorkLogRepo
+	Contracts      ContractRepo
+	Loans          LoanRepo
+	Commission     CommissionRepo
+	Reconciliation ReconciliationRepo
+	Stats          StatsRepo
+}
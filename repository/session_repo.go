@@ -0,0 +1,290 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"gin-boilerplate/infra/apperror"
+	"gin-boilerplate/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+/*登录会话和登录记录：每次登录创建一个会话，刷新令牌在会话内轮换，撤销会话后该会话的令牌立即失效*/
+
+// lastSeenInterval 记录会话最近访问时间的最小间隔，避免每个请求都写数据库
+const lastSeenInterval = time.Minute
+
+// sessionRetention 会话过期或撤销后保留的时间，之后由定时任务删除，登录记录不删除
+const sessionRetention = 30 * 24 * time.Hour
+
+// 撤销会话的原因
+const (
+	SessionRevokedByUser      = "user"
+	SessionRevokedByAdmin     = "admin"
+	SessionRevokedTokenReused = "refresh_token_reused"
+	// 修改或重置密码、重置两步验证后，用旧凭据登录的会话失效
+	SessionRevokedPasswordChanged = "password_changed"
+	SessionRevokedPasswordReset   = "password_reset"
+	SessionRevokedTOTPReset       = "totp_reset"
+)
+
+// NewSession 新建会话的参数，Family 和 RefreshID 是令牌中的 sid 和刷新令牌的 jti
+type NewSession struct {
+	UserID    uint
+	Family    string
+	RefreshID string
+	Method    string
+	IP        string
+	UserAgent string
+	ExpiresAt time.Time
+}
+
+// CreateSession 登录成功后创建会话并记录登录
+// 用户以前登录成功过、但没有从这个IP登录过时，登录记录标记为新IP
+func CreateSession(db *gorm.DB, session NewSession) (*models.Session, error) {
+	now := time.Now()
+	created := models.Session{
+		UserID:     session.UserID,
+		Family:     session.Family,
+		RefreshID:  session.RefreshID,
+		Method:     session.Method,
+		IP:         session.IP,
+		UserAgent:  session.UserAgent,
+		LastSeenAt: now,
+		ExpiresAt:  session.ExpiresAt,
+	}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var previous, fromIP int64
+		if err := tx.Model(&models.LoginEvent{}).Where("user_id = ?", session.UserID).Count(&previous).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.LoginEvent{}).Where("user_id = ? AND ip = ?", session.UserID, session.IP).Count(&fromIP).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(&created).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.LoginEvent{
+			UserID:    session.UserID,
+			SessionID: created.ID,
+			Method:    session.Method,
+			IP:        session.IP,
+			UserAgent: session.UserAgent,
+			NewIP:     previous > 0 && fromIP == 0,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+// activeSession 按 Family 查找有效的会话，不存在、已撤销或已过期时返回 CodeSessionRevoked
+func activeSession(db *gorm.DB, family string, now time.Time) (*models.Session, error) {
+	var session models.Session
+	if err := db.Where("family = ?", family).First(&session).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, apperror.New(apperror.CodeSessionRevoked)
+		}
+		return nil, err
+	}
+	if !session.Active(now) {
+		return nil, apperror.New(apperror.CodeSessionRevoked)
+	}
+	return &session, nil
+}
+
+// TouchSession 访问令牌所属的会话必须有效，同时更新会话的最近访问时间
+func TouchSession(db *gorm.DB, family string, now time.Time) error {
+	session, err := activeSession(db, family, now)
+	if err != nil {
+		return err
+	}
+	if now.Sub(session.LastSeenAt) < lastSeenInterval {
+		return nil
+	}
+	return db.Model(session).UpdateColumn("last_seen_at", now).Error
+}
+
+// RotateRefreshToken 已登录用户重新签发令牌（修改密码、绑定两步验证）时沿用会话，原来的刷新令牌失效
+func RotateRefreshToken(db *gorm.DB, family, refreshID string, expiresAt time.Time) error {
+	session, err := activeSession(db, family, time.Now())
+	if err != nil {
+		return err
+	}
+	return db.Model(session).UpdateColumns(map[string]interface{}{
+		"refresh_id": refreshID,
+		"expires_at": expiresAt,
+	}).Error
+}
+
+// RefreshSession 使用刷新令牌换取新令牌，返回会话所属的用户
+// presentedID 必须是会话当前的刷新令牌，否则说明刷新令牌被重复使用（可能已泄露），撤销整个会话
+func RefreshSession(db *gorm.DB, family, presentedID, newRefreshID string, expiresAt time.Time) (*models.User, error) {
+	now := time.Now()
+	session, err := activeSession(db, family, now)
+	if err != nil {
+		return nil, err
+	}
+	// 同时使用同一个刷新令牌的请求只有一个能更新成功
+	result := db.Model(&models.Session{}).
+		Where("id = ? AND refresh_id = ?", session.ID, presentedID).
+		UpdateColumns(map[string]interface{}{
+			"refresh_id":   newRefreshID,
+			"expires_at":   expiresAt,
+			"last_seen_at": now,
+		})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		if err := revokeSession(db, session, session.UserID, SessionRevokedTokenReused); err != nil {
+			return nil, err
+		}
+		return nil, apperror.New(apperror.CodeSessionRevoked)
+	}
+	user, err := GetUserByID(db, session.UserID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, apperror.New(apperror.CodeSessionRevoked)
+		}
+		return nil, err
+	}
+	return user, nil
+}
+
+func revokeSession(db *gorm.DB, session *models.Session, operatorID uint, reason string) error {
+	now := time.Now()
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(session).UpdateColumns(map[string]interface{}{
+			"revoked_at":     now,
+			"revoked_reason": reason,
+		}).Error; err != nil {
+			return err
+		}
+		session.RevokedAt, session.RevokedReason = &now, reason
+		return logAction(tx, operatorID, fmt.Sprintf("撤销用户: %d 的会话: %d（%s）", session.UserID, session.ID, reason))
+	})
+}
+
+// ListSessions 用户有效的会话，最近访问的在前
+func ListSessions(db *gorm.DB, userID uint) ([]models.Session, error) {
+	var sessions []models.Session
+	err := db.Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Order("last_seen_at DESC").Find(&sessions).Error
+	if err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// RevokeSession 用户撤销自己的会话，会话不属于该用户时返回 CodeSessionNotFound
+func RevokeSession(db *gorm.DB, userID, sessionID uint) error {
+	var session models.Session
+	if err := db.Where("id = ? AND user_id = ?", sessionID, userID).First(&session).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return apperror.New(apperror.CodeSessionNotFound)
+		}
+		return err
+	}
+	if session.RevokedAt != nil {
+		return nil
+	}
+	return revokeSession(db, &session, userID, SessionRevokedByUser)
+}
+
+// revokeUserSessions 撤销用户 exceptFamily 以外的全部有效会话，exceptFamily 为空时全部撤销，返回撤销的数量
+func revokeUserSessions(db *gorm.DB, userID uint, exceptFamily, reason string) (int64, error) {
+	result := db.Model(&models.Session{}).
+		Where("user_id = ? AND family <> ? AND revoked_at IS NULL", userID, exceptFamily).
+		UpdateColumns(map[string]interface{}{
+			"revoked_at":     time.Now(),
+			"revoked_reason": reason,
+		})
+	return result.RowsAffected, result.Error
+}
+
+// RevokeOtherSessions 用户撤销当前会话以外的全部会话，返回撤销的数量
+func RevokeOtherSessions(db *gorm.DB, userID uint, currentFamily string) (int64, error) {
+	var revoked int64
+	err := db.Transaction(func(tx *gorm.DB) (err error) {
+		if revoked, err = revokeUserSessions(tx, userID, currentFamily, SessionRevokedByUser); err != nil {
+			return err
+		}
+		return logAction(tx, userID, fmt.Sprintf("撤销其他 %d 个会话", revoked))
+	})
+	if err != nil {
+		return 0, err
+	}
+	return revoked, nil
+}
+
+// GetUserSessions 系统管理员查看用户的全部会话，包括已撤销和已过期的
+func GetUserSessions(db *gorm.DB, systemManagerID, userID uint) ([]models.Session, error) {
+	if _, err := GetUserByID(db, userID); err != nil {
+		return nil, err
+	}
+	var sessions []models.Session
+	if err := db.Where("user_id = ?", userID).Order("id DESC").Find(&sessions).Error; err != nil {
+		return nil, err
+	}
+	logAction(db, systemManagerID, fmt.Sprintf("查看用户: %d 的会话", userID))
+	return sessions, nil
+}
+
+// RevokeUserSession 系统管理员撤销任意用户的会话
+func RevokeUserSession(db *gorm.DB, systemManagerID, sessionID uint) (*models.Session, error) {
+	var session models.Session
+	if err := db.First(&session, sessionID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, apperror.New(apperror.CodeSessionNotFound)
+		}
+		return nil, err
+	}
+	if session.RevokedAt == nil {
+		if err := revokeSession(db, &session, systemManagerID, SessionRevokedByAdmin); err != nil {
+			return nil, err
+		}
+	}
+	return &session, nil
+}
+
+// LoginHistoryFilter 登录记录的查询条件
+type LoginHistoryFilter struct {
+	UserID    *uint // 为 nil 时查询全部用户
+	NewIPOnly bool
+	Limit     int
+}
+
+// GetLoginHistory 登录记录，最新的在前
+func GetLoginHistory(db *gorm.DB, filter LoginHistoryFilter) ([]models.LoginEvent, error) {
+	query := db.Order("id DESC").Limit(filter.Limit)
+	if filter.UserID != nil {
+		query = query.Where("user_id = ?", *filter.UserID)
+	}
+	if filter.NewIPOnly {
+		query = query.Where("new_ip = ?", true)
+	}
+	var events []models.LoginEvent
+	if err := query.Find(&events).Error; err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// GetUserLoginHistory 系统管理员查看登录记录
+func GetUserLoginHistory(db *gorm.DB, systemManagerID uint, filter LoginHistoryFilter) ([]models.LoginEvent, error) {
+	events, err := GetLoginHistory(db, filter)
+	if err != nil {
+		return nil, err
+	}
+	logAction(db, systemManagerID, "查看登录记录")
+	return events, nil
+}
+
+// AutoPurgeSessions 删除过期或撤销超过保留期的会话
+func AutoPurgeSessions(db *gorm.DB) error {
+	before := time.Now().Add(-sessionRetention)
+	return db.Unscoped().Where("expires_at < ? OR revoked_at < ?", before, before).Delete(&models.Session{}).Error
+}
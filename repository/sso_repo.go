@@ -0,0 +1,187 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"gin-boilerplate/helpers"
+	"gin-boilerplate/infra/apperror"
+	"gin-boilerplate/models"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+/*单点登录：把身份提供方的用户关联到已有用户，或者第一次登录时自动创建用户*/
+
+// SSOIdentity 身份提供方验证过的用户，由控制器根据 ID 令牌和配置传入
+type SSOIdentity struct {
+	Provider          string
+	Issuer            string
+	Subject           string
+	Email             string
+	PreferredUsername string
+	// 为 true 时，没有关联用户的身份按 PreferredUsername 关联到同名的已有用户（特权角色和开启了两步验证的用户除外）
+	LinkByUsername bool
+	// 按分组映射的角色：身份提供方配置了分组映射时不为 nil，没有匹配的分组时为 DEFAULT；为 nil 时新用户为 DEFAULT，已有用户保留原来的角色
+	Role *models.RoleID
+}
+
+// SSOLogin 单点登录，返回身份关联的用户
+// 依次按身份、同名用户（LinkByUsername 为 true 时）查找，都没有时创建 DEFAULT 角色的新用户，新用户不能使用密码登录
+// 账户锁定时返回 CodeAccountLocked；用户开启了两步验证时，返回的用户还需要通过 VerifyLoginTOTP 才算登录成功，
+// 角色也在两步验证通过后才由 SyncSSORole 同步，否则按 identity.Role 同步
+func SSOLogin(db *gorm.DB, identity SSOIdentity, policy LoginPolicy) (*models.User, error) {
+	var userID uint
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var linked models.UserIdentity
+		err := tx.Where("issuer = ? AND subject = ?", identity.Issuer, identity.Subject).First(&linked).Error
+		if err == nil {
+			userID = linked.UserID
+			if linked.Email != identity.Email {
+				return tx.Model(&linked).Update("email", identity.Email).Error
+			}
+			return nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		user, err := ssoUser(tx, identity)
+		if err != nil {
+			return err
+		}
+		userID = user.ID
+		if err := tx.Create(&models.UserIdentity{
+			UserID:   user.ID,
+			Provider: identity.Provider,
+			Issuer:   identity.Issuer,
+			Subject:  identity.Subject,
+			Email:    identity.Email,
+		}).Error; err != nil {
+			return err
+		}
+		return logAction(tx, user.ID, fmt.Sprintf("关联单点登录身份: %s %s", identity.Provider, identity.Subject))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := GetUserByID(db, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkLoginAllowed(user, policy, time.Now()); err != nil {
+		logAction(db, user.ID, "账户锁定或重试过快，单点登录被拒绝")
+		return nil, err
+	}
+	if user.TOTPEnabled {
+		logAction(db, user.ID, "单点登录通过，等待两步验证")
+		return user, nil
+	}
+	if identity.Role != nil {
+		if user, err = SyncSSORole(db, user.ID, identity.Provider, *identity.Role); err != nil {
+			return nil, err
+		}
+	}
+	if err := resetLoginFailures(db, user); err != nil {
+		return nil, err
+	}
+	logAction(db, user.ID, fmt.Sprintf("通过 %s 单点登录成功", identity.Provider))
+	return user, nil
+}
+
+// SyncSSORole 按身份提供方的分组设置用户的角色，身份提供方是角色的来源，不在任何映射的分组中的用户回到 DEFAULT
+func SyncSSORole(db *gorm.DB, userID uint, provider string, role models.RoleID) (*models.User, error) {
+	user, err := GetUserByID(db, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.RoleID == role {
+		return user, nil
+	}
+	if err := db.Model(user).Update("role_id", role).Error; err != nil {
+		return nil, err
+	}
+	logAction(db, user.ID, fmt.Sprintf("按身份提供方 %s 的分组更改角色为: %s", provider, models.RoleNameMap[role]))
+	return GetUserByID(db, userID)
+}
+
+// ssoUser 身份还没有关联用户时，返回同名的已有用户或者新创建的用户
+func ssoUser(tx *gorm.DB, identity SSOIdentity) (*models.User, error) {
+	if identity.LinkByUsername && identity.PreferredUsername != "" {
+		var user models.User
+		err := tx.Where("user_name = ?", identity.PreferredUsername).First(&user).Error
+		if err == nil {
+			// 同名的特权账户或开启了两步验证的账户不能自动关联，否则控制身份提供方用户名的人可以接管这些账户
+			if !user.AutoLinkable() {
+				return nil, apperror.New(apperror.CodeIdentityLinkNotAllowed)
+			}
+			var count int64
+			if err := tx.Model(&models.UserIdentity{}).
+				Where("user_id = ? AND issuer = ?", user.ID, identity.Issuer).Count(&count).Error; err != nil {
+				return nil, err
+			}
+			// 已经关联了该身份提供方的另一个账户，不能再按用户名关联
+			if count > 0 {
+				return nil, apperror.New(apperror.CodeIdentityAlreadyLinked)
+			}
+			return &user, nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+	}
+
+	userName, err := uniqueUserName(tx, identity)
+	if err != nil {
+		return nil, err
+	}
+	// 随机密码的哈希，单点登录创建的用户不知道密码，需要时由系统管理员重置
+	unusable, err := helpers.GenerateTemporaryPassword(helpers.CurrentPasswordPolicy())
+	if err != nil {
+		return nil, err
+	}
+	passwordHash, err := helpers.HashPassword(unusable)
+	if err != nil {
+		return nil, err
+	}
+	role := models.DEFAULT
+	if identity.Role != nil {
+		role = *identity.Role
+	}
+	user := models.User{UserName: userName, PasswordHash: passwordHash, RoleID: role}
+	if err := tx.Create(&user).Error; err != nil {
+		return nil, err
+	}
+	if err := logAction(tx, user.ID, fmt.Sprintf("通过 %s 单点登录新建用户", identity.Provider)); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// uniqueUserName 根据 preferred_username 或邮箱生成可用的用户名，已存在时加数字后缀
+func uniqueUserName(tx *gorm.DB, identity SSOIdentity) (string, error) {
+	candidate := identity.PreferredUsername
+	if candidate == "" {
+		candidate = strings.Split(identity.Email, "@")[0]
+	}
+	base := helpers.SanitizeUsername(candidate, 16)
+	if base == "" {
+		base = "sso"
+	}
+	for i := 1; i < 10000; i++ {
+		userName := base
+		if i > 1 {
+			userName = fmt.Sprintf("%s%d", base, i)
+		}
+		var count int64
+		if err := tx.Unscoped().Model(&models.User{}).Where("user_name = ?", userName).Count(&count).Error; err != nil {
+			return "", err
+		}
+		if count == 0 {
+			return userName, nil
+		}
+	}
+	return "", apperror.New(apperror.CodeConflict)
+}
@@ -0,0 +1,257 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"gin-boilerplate/helpers"
+	"gin-boilerplate/infra/apperror"
+	"gin-boilerplate/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+/*两步验证：绑定 TOTP 密钥、登录时验证验证码或恢复码、关闭和重置*/
+
+// StartTOTPEnrollment 验证当前密码后保存新的密钥，调用 ConfirmTOTPEnrollment 验证过一次验证码后才开启
+// 重复调用会替换尚未确认的密钥
+func StartTOTPEnrollment(db *gorm.DB, userID uint, password, secret string) (*models.User, error) {
+	user, err := GetUserByID(db, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := helpers.CheckPasswordHash(password, user.PasswordHash); err != nil {
+		return nil, apperror.Wrap(apperror.CodeWrongCurrentPassword, err)
+	}
+	if user.TOTPEnabled {
+		return nil, apperror.New(apperror.CodeTOTPAlreadyEnabled)
+	}
+	err = db.Model(user).UpdateColumns(map[string]interface{}{
+		"totp_secret":    models.EncryptedString(secret),
+		"totp_last_step": 0,
+	}).Error
+	if err != nil {
+		return nil, err
+	}
+	logAction(db, userID, "开始绑定两步验证")
+	return GetUserByID(db, userID)
+}
+
+// ConfirmTOTPEnrollment 验证码正确时开启两步验证，并用 recoveryCodes 替换原来的恢复码
+func ConfirmTOTPEnrollment(db *gorm.DB, userID uint, code string, skew int, recoveryCodes []string) (*models.User, error) {
+	user, err := GetUserByID(db, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.TOTPEnabled {
+		return nil, apperror.New(apperror.CodeTOTPAlreadyEnabled)
+	}
+	if user.TOTPSecret == "" {
+		return nil, apperror.New(apperror.CodeTOTPNotEnrolled)
+	}
+	step, ok := helpers.VerifyTOTP(string(user.TOTPSecret), code, time.Now(), skew, user.TOTPLastStep)
+	if !ok {
+		return nil, apperror.New(apperror.CodeInvalidTOTPCode)
+	}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(user).UpdateColumns(map[string]interface{}{
+			"totp_enabled":   true,
+			"totp_last_step": step,
+		}).Error; err != nil {
+			return err
+		}
+		if err := replaceRecoveryCodes(tx, userID, recoveryCodes); err != nil {
+			return err
+		}
+		return logAction(tx, userID, "开启两步验证")
+	})
+	if err != nil {
+		return nil, err
+	}
+	return GetUserByID(db, userID)
+}
+
+// replaceRecoveryCodes 删除用户原来的恢复码，保存新恢复码的哈希
+func replaceRecoveryCodes(tx *gorm.DB, userID uint, codes []string) error {
+	if err := tx.Unscoped().Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+		return err
+	}
+	for _, code := range codes {
+		codeHash, err := helpers.HashPassword(helpers.NormalizeRecoveryCode(code))
+		if err != nil {
+			return err
+		}
+		if err := tx.Create(&models.RecoveryCode{UserID: userID, CodeHash: codeHash}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// verifySecondFactor 验证6位验证码或恢复码，成功时记录验证码的周期或把恢复码标记为已使用
+// 记录时带上条件，并发请求使用同一个周期的验证码或同一个恢复码时只有一个成功；验证失败返回 CodeInvalidTOTPCode
+func verifySecondFactor(db *gorm.DB, user *models.User, code string, skew int, now time.Time) error {
+	if helpers.IsTOTPCode(code) {
+		step, ok := helpers.VerifyTOTP(string(user.TOTPSecret), code, now, skew, user.TOTPLastStep)
+		if !ok {
+			return apperror.New(apperror.CodeInvalidTOTPCode)
+		}
+		result := db.Model(&models.User{}).
+			Where("id = ? AND totp_last_step < ?", user.ID, step).
+			UpdateColumn("totp_last_step", step)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return apperror.New(apperror.CodeInvalidTOTPCode)
+		}
+		return nil
+	}
+	var unused []models.RecoveryCode
+	if err := db.Where("user_id = ? AND used_at IS NULL", user.ID).Find(&unused).Error; err != nil {
+		return err
+	}
+	normalized := helpers.NormalizeRecoveryCode(code)
+	for _, recovery := range unused {
+		if helpers.CheckPasswordHash(normalized, recovery.CodeHash) != nil {
+			continue
+		}
+		result := db.Model(&models.RecoveryCode{}).
+			Where("id = ? AND used_at IS NULL", recovery.ID).
+			UpdateColumn("used_at", now)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return apperror.New(apperror.CodeInvalidTOTPCode)
+		}
+		return logAction(db, user.ID, fmt.Sprintf("使用了恢复码，剩余 %d 个", len(unused)-1))
+	}
+	return apperror.New(apperror.CodeInvalidTOTPCode)
+}
+
+// VerifyLoginTOTP 登录的第二步，验证码错误与密码错误一样计入连续错误次数，达到次数后锁定账户
+func VerifyLoginTOTP(db *gorm.DB, userID uint, code string, skew int, policy LoginPolicy) (*models.User, error) {
+	user, err := GetUserByID(db, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !user.TOTPEnabled {
+		return nil, apperror.New(apperror.CodeTOTPNotEnrolled)
+	}
+	now := time.Now()
+	if err := checkLoginAllowed(user, policy, now); err != nil {
+		logAction(db, user.ID, "账户锁定或重试过快，两步验证被拒绝")
+		return nil, err
+	}
+	if err := verifySecondFactor(db, user, code, skew, now); err != nil {
+		var appErr *apperror.Error
+		if !errors.As(err, &appErr) || appErr.Code != apperror.CodeInvalidTOTPCode {
+			return nil, err
+		}
+		if err := recordLoginFailure(db, user, policy, now); !isInvalidCredentials(err) {
+			return nil, err
+		}
+		return nil, apperror.New(apperror.CodeInvalidTOTPCode)
+	}
+	if err := resetLoginFailures(db, user); err != nil {
+		return nil, err
+	}
+	logAction(db, user.ID, fmt.Sprintf("用户名: %s, 角色%s, 两步验证通过，登录成功", user.UserName, models.RoleNameMap[user.RoleID]))
+	return GetUserByID(db, userID)
+}
+
+func isInvalidCredentials(err error) bool {
+	var appErr *apperror.Error
+	return errors.As(err, &appErr) && appErr.Code == apperror.CodeInvalidCredentials
+}
+
+// DisableTOTP 用户验证当前密码和验证码（或恢复码）后关闭两步验证，删除密钥和恢复码
+// 用户当前的角色在 requiredRoles 中时不能关闭，返回 CodeTOTPRequired（令牌中的角色可能已经过时）
+func DisableTOTP(db *gorm.DB, userID uint, password, code string, skew int, requiredRoles []string) (*models.User, error) {
+	user, err := GetUserByID(db, userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, role := range requiredRoles {
+		if role == models.RoleNameMap[user.RoleID] {
+			return nil, apperror.New(apperror.CodeTOTPRequired)
+		}
+	}
+	if err := helpers.CheckPasswordHash(password, user.PasswordHash); err != nil {
+		return nil, apperror.Wrap(apperror.CodeWrongCurrentPassword, err)
+	}
+	if !user.TOTPEnabled {
+		return nil, apperror.New(apperror.CodeTOTPNotEnrolled)
+	}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := verifySecondFactor(tx, user, code, skew, time.Now()); err != nil {
+			return err
+		}
+		if err := clearTOTP(tx, user); err != nil {
+			return err
+		}
+		return logAction(tx, userID, "关闭两步验证")
+	})
+	if err != nil {
+		return nil, err
+	}
+	return GetUserByID(db, userID)
+}
+
+// RegenerateRecoveryCodes 用户验证验证码后重新生成恢复码，原来的恢复码全部失效
+func RegenerateRecoveryCodes(db *gorm.DB, userID uint, code string, skew int, recoveryCodes []string) error {
+	user, err := GetUserByID(db, userID)
+	if err != nil {
+		return err
+	}
+	if !user.TOTPEnabled {
+		return apperror.New(apperror.CodeTOTPNotEnrolled)
+	}
+	if !helpers.IsTOTPCode(code) {
+		return apperror.New(apperror.CodeInvalidTOTPCode)
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := verifySecondFactor(tx, user, code, skew, time.Now()); err != nil {
+			return err
+		}
+		if err := replaceRecoveryCodes(tx, userID, recoveryCodes); err != nil {
+			return err
+		}
+		return logAction(tx, userID, "重新生成两步验证恢复码")
+	})
+}
+
+// ResetTOTP 系统管理员为丢失验证器和恢复码的用户关闭两步验证，必须使用两步验证的角色下次登录后需要重新绑定
+// 同时撤销用户的全部会话，验证器丢失前登录的会话不能继续使用
+func ResetTOTP(db *gorm.DB, systemManagerID, userID uint) (*models.User, error) {
+	user, err := GetUserByID(db, userID)
+	if err != nil {
+		return nil, err
+	}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := clearTOTP(tx, user); err != nil {
+			return err
+		}
+		revoked, err := revokeUserSessions(tx, userID, "", SessionRevokedTOTPReset)
+		if err != nil {
+			return err
+		}
+		return logAction(tx, systemManagerID, fmt.Sprintf("重置用户: %d 的两步验证，撤销 %d 个会话", userID, revoked))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return GetUserByID(db, userID)
+}
+
+func clearTOTP(tx *gorm.DB, user *models.User) error {
+	if err := tx.Model(user).UpdateColumns(map[string]interface{}{
+		"totp_secret":    models.EncryptedString(""),
+		"totp_enabled":   false,
+		"totp_last_step": 0,
+	}).Error; err != nil {
+		return err
+	}
+	return tx.Unscoped().Where("user_id = ?", user.ID).Delete(&models.RecoveryCode{}).Error
+}
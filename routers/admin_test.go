@@ -0,0 +1,178 @@
+package routers
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// 管理员通过接口建立组织架构并分配人员
+func TestAdminBuildsOrganization(t *testing.T) {
+	s := newTestServer(t)
+
+	var admin, rep authData
+	s.expectStatus(t, http.StatusOK, "/api/v1/register", seededUser{}, url.Values{
+		"username": {"admin"}, "password": {"admin-2468"}, "role": {"系统管理员"},
+	}).decode(t, &admin)
+	s.expectStatus(t, http.StatusOK, "/api/v1/register", seededUser{}, url.Values{
+		"username": {"rep"}, "password": {"rep12345"},
+	}).decode(t, &rep)
+	// 系统管理员必须先绑定两步验证才能使用管理接口
+	adminUser := enrollTOTP(t, s, seededUser{ID: admin.User.ID, Token: admin.AccessToken}, "admin-2468").User
+	adminID := adminUser.idParam()
+
+	var zone, otherZone, department idObject
+	s.mustGet(t, "/api/v1/admin/createZone", adminUser, url.Values{"system_manager_id": {adminID}, "name": {"华东战区"}}).decode(t, &zone)
+	s.mustGet(t, "/api/v1/admin/createZone", adminUser, url.Values{"system_manager_id": {adminID}, "name": {"华南战区"}}).decode(t, &otherZone)
+	s.mustGet(t, "/api/v1/admin/createDepartment", adminUser, url.Values{
+		"system_manager_id": {adminID}, "name": {"华东一部"}, "type": {"销售部"}, "zone_id": {id(zone.ID)},
+	}).decode(t, &department)
+	s.mustGet(t, "/api/v1/admin/createDepartment", adminUser, url.Values{
+		"system_manager_id": {adminID}, "name": {"金融部"}, "type": {"金融部"},
+	})
+
+	steps := []struct {
+		path   string
+		params url.Values
+	}{
+		{"/api/v1/admin/updateUserRole", url.Values{"user_id": {id(rep.User.ID)}, "role": {"销售经理"}}},
+		{"/api/v1/admin/assignDepartmentToZone", url.Values{"department_id": {id(department.ID)}, "zone_id": {id(otherZone.ID)}}},
+		{"/api/v1/admin/assignDepartmentToZone", url.Values{"department_id": {id(department.ID)}, "zone_id": {id(zone.ID)}}},
+		{"/api/v1/admin/assignUserToDepartment", url.Values{"user_id": {id(rep.User.ID)}, "department_id": {id(department.ID)}}},
+		{"/api/v1/admin/assignUserToZone", url.Values{"user_id": {id(rep.User.ID)}, "zone_id": {id(zone.ID)}}},
+		{"/api/v1/admin/assignManagerToDepartment", url.Values{"user_id": {id(rep.User.ID)}, "department_id": {id(department.ID)}}},
+		{"/api/v1/admin/assignDirectorToZone", url.Values{"user_id": {id(admin.User.ID)}, "zone_id": {id(otherZone.ID)}}},
+		{"/api/v1/admin/updateUserBasicInfo", url.Values{"user_id": {id(rep.User.ID)}, "username": {"manager"}, "password": {"manager123"}}},
+	}
+	for _, step := range steps {
+		step.params.Set("system_manager_id", adminID)
+		s.mustGet(t, step.path, adminUser, step.params)
+	}
+
+	var dept struct {
+		ZoneID    *uint `json:"zone_id"`
+		ManagerID *uint `json:"manager_id"`
+	}
+	s.mustGet(t, "/api/v1/getDepartmentByID", adminUser, url.Values{"department_id": {id(department.ID)}}).decode(t, &dept)
+	if dept.ZoneID == nil || *dept.ZoneID != zone.ID || dept.ManagerID == nil || *dept.ManagerID != rep.User.ID {
+		t.Fatalf("department not assigned: %+v", dept)
+	}
+
+	// 修改用户名和密码后使用新凭据登录，角色已变更
+	var manager struct {
+		User struct {
+			RoleID       uint  `json:"role"`
+			DepartmentID *uint `json:"department_id"`
+			ZoneID       *uint `json:"zone_id"`
+		} `json:"user"`
+	}
+	s.expectStatus(t, http.StatusOK, "/api/v1/login", seededUser{}, url.Values{
+		"username": {"manager"}, "password": {"manager123"},
+	}).decode(t, &manager)
+	if manager.User.RoleID != 3 || manager.User.DepartmentID == nil || *manager.User.DepartmentID != department.ID ||
+		manager.User.ZoneID == nil || *manager.User.ZoneID != zone.ID {
+		t.Fatalf("unexpected user after assignment: %+v", manager.User)
+	}
+	s.expectStatus(t, http.StatusUnauthorized, "/api/v1/login", seededUser{}, url.Values{
+		"username": {"rep"}, "password": {"rep12345"},
+	})
+
+	var users []idObject
+	s.mustGet(t, "/api/v1/admin/listAllUsers", adminUser, url.Values{"system_manager_id": {adminID}}).decode(t, &users)
+	if len(users) != 2 {
+		t.Fatalf("listAllUsers returned %d users, want 2", len(users))
+	}
+}
+
+func TestAdminReadsSystemLog(t *testing.T) {
+	s := newTestServer(t)
+	f := seedOrg(t, s)
+
+	createCustomer(t, s, f.Rep, "张三", "13800138000")
+
+	var logs []struct {
+		UserID uint   `json:"user_id"`
+		Action string `json:"action"`
+	}
+	s.mustGet(t, "/api/v1/admin/readSystemLog", f.Admin, url.Values{"system_manager_id": {f.Admin.idParam()}}).decode(t, &logs)
+	var found bool
+	for _, log := range logs {
+		if log.UserID == f.Rep.ID && strings.HasPrefix(log.Action, "新建客户") {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("system log has no customer creation by rep %d: %+v", f.Rep.ID, logs)
+	}
+}
+
+func TestZoneAndDepartmentQueries(t *testing.T) {
+	s := newTestServer(t)
+	f := seedOrg(t, s)
+
+	var zones, departments []idObject
+	s.mustGet(t, "/api/v1/getZones", seededUser{}, nil).decode(t, &zones)
+	s.mustGet(t, "/api/v1/getDepartments", f.Rep, nil).decode(t, &departments)
+	if len(zones) != 2 || len(departments) != 3 {
+		t.Fatalf("got %d zones and %d departments, want 2 and 3", len(zones), len(departments))
+	}
+
+	var zone struct {
+		Name       string `json:"name"`
+		DirectorID *uint  `json:"director_id"`
+	}
+	s.mustGet(t, "/api/v1/getZoneByID", seededUser{}, url.Values{"zone_id": {id(f.ZoneA)}}).decode(t, &zone)
+	if zone.Name != "华东战区" || zone.DirectorID == nil || *zone.DirectorID != f.Director.ID {
+		t.Fatalf("unexpected zone %+v", zone)
+	}
+
+	// 关联数据默认不返回，通过 include 按需返回
+	var withDepartments []struct {
+		ID          uint       `json:"id"`
+		Departments []idObject `json:"departments"`
+	}
+	s.mustGet(t, "/api/v1/getZones", seededUser{}, url.Values{"include": {"departments"}}).decode(t, &withDepartments)
+	for _, z := range withDepartments {
+		if z.ID == f.ZoneA && (len(z.Departments) != 1 || z.Departments[0].ID != f.DeptA) {
+			t.Fatalf("unexpected departments of zone A: %+v", z.Departments)
+		}
+	}
+	var department struct {
+		Users []struct {
+			ID       uint   `json:"id"`
+			RoleName string `json:"role_name"`
+		} `json:"users"`
+	}
+	s.mustGet(t, "/api/v1/getDepartmentByID", f.Rep, url.Values{"department_id": {id(f.DeptA)}}).decode(t, &department)
+	if department.Users != nil {
+		t.Fatalf("users returned without include: %+v", department.Users)
+	}
+	// 部门员工需要登录才能查看，并且不返回锁定、两步验证等账户安全信息
+	s.expectStatus(t, http.StatusUnauthorized, "/api/v1/getDepartmentByID", seededUser{}, url.Values{
+		"department_id": {id(f.DeptA)}, "include": {"users"},
+	})
+	s.expectStatus(t, http.StatusUnauthorized, "/api/v1/getDepartments", seededUser{}, url.Values{"include": {"users"}})
+	resp := s.mustGet(t, "/api/v1/getDepartmentByID", f.Rep, url.Values{
+		"department_id": {id(f.DeptA)}, "include": {"users"},
+	})
+	resp.decode(t, &department)
+	if len(department.Users) != 3 || department.Users[0].RoleName == "" {
+		t.Fatalf("unexpected users of department A: %+v", department.Users)
+	}
+	var members struct {
+		Users []map[string]interface{} `json:"users"`
+	}
+	resp.decode(t, &members)
+	for _, member := range members.Users {
+		for _, field := range []string{"locked_until", "totp_enabled", "must_change_password"} {
+			if _, ok := member[field]; ok {
+				t.Fatalf("department member must not expose %s: %+v", field, member)
+			}
+		}
+	}
+	s.expectStatus(t, http.StatusBadRequest, "/api/v1/getZones", seededUser{}, url.Values{"include": {"users"}})
+
+	s.expectStatus(t, http.StatusNotFound, "/api/v1/getZoneByID", seededUser{}, url.Values{"zone_id": {"999"}})
+	s.expectStatus(t, http.StatusNotFound, "/api/v1/getDepartmentByID", f.Rep, url.Values{"department_id": {"999"}})
+}
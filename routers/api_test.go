@@ -0,0 +1,64 @@
+package routers
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+// 完整走一遍 HTTP API：管理员建立组织架构并分配销售代表，销售代表新建并更新客户
+func TestSalesRepresentativeManagesCustomer(t *testing.T) {
+	s := newTestServer(t)
+
+	// 系统管理员必须绑定两步验证才能通过接口登录，这里直接签发令牌
+	adminUser, err := s.repos.Users.CreateSystemManager(context.Background(), "admin", seedPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	admin := issueToken(t, s, *adminUser)
+
+	var rep authData
+	s.mustGet(t, "/api/v1/register", seededUser{}, url.Values{"username": {"rep"}, "password": {"rep12345"}}).decode(t, &rep)
+
+	adminParams := func(params url.Values) url.Values {
+		params.Set("system_manager_id", admin.idParam())
+		return params
+	}
+	var zone, department idObject
+	s.mustGet(t, "/api/v1/admin/createZone", admin, adminParams(url.Values{"name": {"华东"}})).decode(t, &zone)
+	s.mustGet(t, "/api/v1/admin/createDepartment", admin, adminParams(url.Values{
+		"name": {"销售一部"}, "type": {"销售部"}, "zone_id": {id(zone.ID)},
+	})).decode(t, &department)
+	for _, step := range []struct {
+		path   string
+		params url.Values
+	}{
+		{"/api/v1/admin/updateUserRole", url.Values{"user_id": {id(rep.User.ID)}, "role": {"销售代表"}}},
+		{"/api/v1/admin/assignUserToDepartment", url.Values{"user_id": {id(rep.User.ID)}, "department_id": {id(department.ID)}}},
+		{"/api/v1/admin/assignUserToZone", url.Values{"user_id": {id(rep.User.ID)}, "zone_id": {id(zone.ID)}}},
+	} {
+		s.mustGet(t, step.path, admin, adminParams(step.params))
+	}
+
+	// 角色变更后重新登录获取新令牌
+	s.mustGet(t, "/api/v1/login", seededUser{}, url.Values{"username": {"rep"}, "password": {"rep12345"}}).decode(t, &rep)
+	repUser := seededUser{ID: rep.User.ID, Name: "rep", Token: rep.AccessToken}
+
+	customerID := createCustomer(t, s, repUser, "张三", "13800138000")
+	var updated struct {
+		Name    string `json:"name"`
+		Phone   string `json:"phone"`
+		Address string `json:"address"`
+	}
+	s.mustGet(t, "/api/v1/sale/updateCustomer", repUser, url.Values{
+		"user_id": {repUser.idParam()}, "customer_id": {id(customerID)}, "customer_name": {"张三丰"},
+		"customer_phone": {"13900139000"}, "customer_age": {"30"}, "customer_gender": {"男"}, "customer_address": {"上海"},
+	}).decode(t, &updated)
+	if updated.Name != "张三丰" || updated.Phone != "13900139000" || updated.Address != "上海" {
+		t.Fatalf("update customer returned stale data: %+v", updated)
+	}
+
+	// 未登录不能访问销售接口
+	s.expectStatus(t, http.StatusUnauthorized, "/api/v1/sale/listCustomers", seededUser{}, url.Values{"user_id": {repUser.idParam()}})
+}
@@ -0,0 +1,208 @@
+package routers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"gin-boilerplate/infra/apperror"
+	"gin-boilerplate/routers/middleware"
+)
+
+type apiKeyInfo struct {
+	ID         uint     `json:"id"`
+	Prefix     string   `json:"prefix"`
+	Scopes     []string `json:"scopes"`
+	LastUsedAt *string  `json:"last_used_at"`
+	RevokedAt  *string  `json:"revoked_at"`
+}
+
+type createdAPIKey struct {
+	Key    string     `json:"key"`
+	APIKey apiKeyInfo `json:"api_key"`
+}
+
+// createAPIKey 系统管理员为 owner 创建 API 密钥
+func createAPIKey(t *testing.T, s *testServer, f *orgFixture, owner seededUser, scopes, rateLimit string) createdAPIKey {
+	t.Helper()
+	var created createdAPIKey
+	s.mustGet(t, "/api/v1/admin/createAPIKey", f.Admin, url.Values{
+		"system_manager_id": {f.Admin.idParam()}, "user_id": {owner.idParam()}, "name": {"lead import"},
+		"scopes": {scopes}, "expires_in_days": {"30"}, "rate_limit": {rateLimit},
+	}).decode(t, &created)
+	return created
+}
+
+// getWithAPIKey 以 API 密钥代替令牌发送请求
+func (s *testServer) getWithAPIKey(t *testing.T, path, key string, params url.Values) apiResponse {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, path+"?"+params.Encode(), nil)
+	req.Header.Set(middleware.APIKeyHeader, key)
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, req)
+
+	resp := apiResponse{Status: rec.Code, Header: rec.Header()}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("GET %s: invalid json %q: %s", path, rec.Body.String(), err)
+	}
+	return resp
+}
+
+// 密钥以所属用户的身份访问 scopes 中的接口，系统日志记录密钥ID，撤销后立即失效
+func TestAPIKeyLifecycle(t *testing.T) {
+	s := newTestServer(t)
+	f := seedOrg(t, s)
+	created := createAPIKey(t, s, f, f.Rep, "sale, contract", "0")
+	if !strings.HasPrefix(created.Key, "gbk_"+created.APIKey.Prefix+"_") || len(created.APIKey.Scopes) != 2 {
+		t.Fatalf("unexpected key %+v", created)
+	}
+	var stored string
+	s.db.Table("api_keys").Select("secret_hash").Where("id = ?", created.APIKey.ID).Scan(&stored)
+	if stored == "" || strings.Contains(created.Key, stored) {
+		t.Fatalf("secret must be stored hashed, got %q", stored)
+	}
+
+	params := url.Values{"user_id": {f.Rep.idParam()}}
+	for _, c := range []struct {
+		path string
+		want int
+	}{
+		{"/api/v1/sale/listCustomers", http.StatusOK},
+		{"/api/v1/contract/getContractList", http.StatusOK},
+		// 密钥所属用户的角色没有权限
+		{"/api/v1/finance/updateContractStatus", http.StatusForbidden},
+		// 修改密码等只能由用户本人操作
+		{"/api/v1/me/password", http.StatusForbidden},
+	} {
+		if resp := s.getWithAPIKey(t, c.path, created.Key, params); resp.Status != c.want {
+			t.Fatalf("%s: got %d (%s), want %d", c.path, resp.Status, resp.Message, c.want)
+		}
+	}
+	// 密钥只能以所属用户的身份操作，不能通过 user_id 冒充其他用户
+	resp := s.getWithAPIKey(t, "/api/v1/sale/listCustomers", created.Key, url.Values{"user_id": {f.Manager.idParam()}})
+	if resp.Status != http.StatusForbidden || resp.Code != int(apperror.CodeActorMismatch) {
+		t.Fatalf("api key acting as another user: got %d/%d", resp.Status, resp.Code)
+	}
+	// scopes 不包含的接口即使角色允许也不能访问
+	contractOnly := createAPIKey(t, s, f, f.Rep, "contract", "0")
+	if resp := s.getWithAPIKey(t, "/api/v1/sale/listCustomers", contractOnly.Key, params); resp.Status != http.StatusForbidden {
+		t.Fatalf("out of scope: got %d", resp.Status)
+	}
+
+	// 系统日志记录操作用户和使用的密钥；不传 user_id 时操作人是密钥所属用户
+	resp = s.getWithAPIKey(t, "/api/v1/sale/createCustomer", created.Key, url.Values{
+		"customer_name": {"线索客户"}, "customer_phone": {"13900139000"},
+	})
+	if resp.Status != http.StatusOK {
+		t.Fatalf("create customer with api key: got %d (%s)", resp.Status, resp.Message)
+	}
+	var imported idObject
+	resp.decode(t, &imported)
+	createCustomer(t, s, f.Rep, "手工客户", "13900139001")
+	var logs []struct {
+		UserID   uint   `json:"user_id"`
+		APIKeyID *uint  `json:"api_key_id"`
+		Action   string `json:"action"`
+	}
+	s.mustGet(t, "/api/v1/admin/readSystemLog", f.Admin, url.Values{"system_manager_id": {f.Admin.idParam()}}).decode(t, &logs)
+	attributed := map[string]*uint{}
+	for _, log := range logs {
+		if log.UserID == f.Rep.ID && strings.HasPrefix(log.Action, "新建客户") {
+			attributed[log.Action] = log.APIKeyID
+		}
+	}
+	if len(attributed) != 2 {
+		t.Fatalf("expected two customer logs, got %+v", attributed)
+	}
+	for action, keyID := range attributed {
+		viaKey := strings.Contains(action, " "+id(imported.ID)+" ")
+		if viaKey != (keyID != nil) || (keyID != nil && *keyID != created.APIKey.ID) {
+			t.Fatalf("log %q attributed to key %v", action, keyID)
+		}
+	}
+
+	var keys []apiKeyInfo
+	resp = s.mustGet(t, "/api/v1/admin/listAPIKeys", f.Admin, url.Values{"system_manager_id": {f.Admin.idParam()}})
+	if strings.Contains(string(resp.Data), created.Key) {
+		t.Fatal("listed keys must not contain the secret")
+	}
+	resp.decode(t, &keys)
+	if len(keys) != 2 || keys[0].LastUsedAt == nil || keys[0].RevokedAt != nil {
+		t.Fatalf("unexpected keys %+v", keys)
+	}
+
+	s.mustGet(t, "/api/v1/admin/revokeAPIKey", f.Admin, url.Values{
+		"system_manager_id": {f.Admin.idParam()}, "api_key_id": {id(created.APIKey.ID)},
+	})
+	for name, key := range map[string]string{
+		"revoked":      created.Key,
+		"wrong secret": contractOnly.Key[:len(contractOnly.Key)-1] + "x",
+		"malformed":    "not-a-key",
+	} {
+		resp := s.getWithAPIKey(t, "/api/v1/contract/getContractList", key, params)
+		if resp.Status != http.StatusUnauthorized || resp.Code != int(apperror.CodeAPIKeyInvalid) {
+			t.Fatalf("%s key: got %d/%d", name, resp.Status, resp.Code)
+		}
+	}
+}
+
+// scopes 必须是已知的、密钥所属用户的角色拥有的权限，有效期不能超过上限
+func TestAPIKeyCreateValidation(t *testing.T) {
+	s := newTestServer(t)
+	f := seedOrg(t, s)
+	base := url.Values{
+		"system_manager_id": {f.Admin.idParam()}, "user_id": {f.Rep.idParam()}, "name": {"bank feed"},
+		"scopes": {"sale"}, "expires_in_days": {"30"},
+	}
+	for _, c := range []struct {
+		name  string
+		field string
+		value string
+		code  apperror.Code
+	}{
+		{"unknown scope", "scopes", "sale,everything", apperror.CodeInvalidParams},
+		{"scope not granted to role", "scopes", "finance", apperror.CodeAPIKeyScopeNotAllowed},
+		{"lifetime too long", "expires_in_days", "10000", apperror.CodeInvalidParams},
+		{"missing expiry", "expires_in_days", "", apperror.CodeInvalidParams},
+	} {
+		params := url.Values{}
+		for k, v := range base {
+			params[k] = v
+		}
+		params.Set(c.field, c.value)
+		resp := s.expectStatus(t, http.StatusBadRequest, "/api/v1/admin/createAPIKey", f.Admin, params)
+		if resp.Code != int(c.code) {
+			t.Fatalf("%s: got code %d, want %d", c.name, resp.Code, c.code)
+		}
+	}
+	s.expectStatus(t, http.StatusNotFound, "/api/v1/admin/revokeAPIKey", f.Admin, url.Values{
+		"system_manager_id": {f.Admin.idParam()}, "api_key_id": {"999"},
+	})
+}
+
+// 每个密钥单独限流，超过后返回429和 Retry-After
+func TestAPIKeyRateLimit(t *testing.T) {
+	s := newTestServer(t)
+	f := seedOrg(t, s)
+	limited := createAPIKey(t, s, f, f.Accountant, "commission", "2")
+	other := createAPIKey(t, s, f, f.Accountant, "commission", "0")
+	params := url.Values{"user_id": {f.Accountant.idParam()}}
+
+	for i := 0; i < 2; i++ {
+		if resp := s.getWithAPIKey(t, "/api/v1/commission/getPlans", limited.Key, params); resp.Status != http.StatusOK {
+			t.Fatalf("request %d: got %d (%s)", i+1, resp.Status, resp.Message)
+		}
+	}
+	resp := s.getWithAPIKey(t, "/api/v1/commission/getPlans", limited.Key, params)
+	if resp.Status != http.StatusTooManyRequests || resp.Header.Get("Retry-After") == "" {
+		t.Fatalf("over limit: got %d, Retry-After %q", resp.Status, resp.Header.Get("Retry-After"))
+	}
+	if resp := s.getWithAPIKey(t, "/api/v1/commission/getPlans", other.Key, params); resp.Status != http.StatusOK {
+		t.Fatalf("other key: got %d", resp.Status)
+	}
+	// 使用令牌的请求不受密钥限流影响
+	s.mustGet(t, "/api/v1/commission/getPlans", f.Accountant, params)
+}
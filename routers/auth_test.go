@@ -0,0 +1,302 @@
+package routers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"gin-boilerplate/config"
+	"gin-boilerplate/helpers"
+	"gin-boilerplate/infra/apperror"
+	"gin-boilerplate/models"
+
+	"github.com/golang-jwt/jwt"
+	"gorm.io/gorm"
+)
+
+type authData struct {
+	User        idObject `json:"user"`
+	AccessToken string   `json:"access_token"`
+}
+
+func TestRegisterAndLogin(t *testing.T) {
+	s := newTestServer(t)
+
+	var registered authData
+	s.expectStatus(t, http.StatusOK, "/api/v1/register", seededUser{}, url.Values{
+		"username": {"alice"}, "password": {"alice1234"},
+	}).decode(t, &registered)
+	if registered.User.ID == 0 || registered.AccessToken == "" {
+		t.Fatalf("register returned no user or token: %+v", registered)
+	}
+
+	var loggedIn authData
+	s.expectStatus(t, http.StatusOK, "/api/v1/login", seededUser{}, url.Values{
+		"username": {"alice"}, "password": {"alice1234"},
+	}).decode(t, &loggedIn)
+	if loggedIn.User.ID != registered.User.ID || loggedIn.AccessToken == "" {
+		t.Fatalf("login returned %+v, want user %d with token", loggedIn, registered.User.ID)
+	}
+
+	// 响应中不包含密码哈希和 gorm 内部字段，个人信息需要 include=profile
+	resp := s.mustGet(t, "/api/v1/login", seededUser{}, url.Values{"username": {"alice"}, "password": {"alice1234"}})
+	for _, leaked := range []string{"PasswordHash", "password_hash", "DeletedAt", "profile"} {
+		if strings.Contains(string(resp.Data), leaked) {
+			t.Fatalf("login response contains %s: %s", leaked, resp.Data)
+		}
+	}
+	var withProfile struct {
+		User struct {
+			RoleName string           `json:"role_name"`
+			Profile  *json.RawMessage `json:"profile"`
+		} `json:"user"`
+	}
+	s.mustGet(t, "/api/v1/login", seededUser{}, url.Values{
+		"username": {"alice"}, "password": {"alice1234"}, "include": {"profile"},
+	}).decode(t, &withProfile)
+	if withProfile.User.RoleName != "默认权限" || withProfile.User.Profile == nil {
+		t.Fatalf("unexpected user with profile %+v", withProfile.User)
+	}
+	resp = s.expectStatus(t, http.StatusBadRequest, "/api/v1/login", seededUser{}, url.Values{
+		"username": {"alice"}, "password": {"alice1234"}, "include": {"profile,password"},
+	})
+	if resp.Code != int(apperror.CodeInvalidParams) {
+		t.Fatalf("unknown include: got code %d", resp.Code)
+	}
+
+	cases := []struct {
+		name   string
+		path   string
+		params url.Values
+		want   int
+	}{
+		{"wrong password", "/api/v1/login", url.Values{"username": {"alice"}, "password": {"wrong1234"}}, http.StatusUnauthorized},
+		{"unknown user", "/api/v1/login", url.Values{"username": {"bob"}, "password": {"alice1234"}}, http.StatusUnauthorized},
+		{"invalid username", "/api/v1/register", url.Values{"username": {"a b"}, "password": {"alice1234"}}, http.StatusBadRequest},
+		{"short password", "/api/v1/register", url.Values{"username": {"carol"}, "password": {"short"}}, http.StatusBadRequest},
+		{"duplicate username", "/api/v1/register", url.Values{"username": {"alice"}, "password": {"alice1234"}}, http.StatusConflict},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			s.expectStatus(t, c.want, c.path, seededUser{}, c.params)
+		})
+	}
+}
+
+func TestUpdateUserProfile(t *testing.T) {
+	s := newTestServer(t)
+	f := seedOrg(t, s)
+
+	var user struct {
+		ID          uint `json:"id"`
+		UserProfile struct {
+			Name    string `json:"name"`
+			Age     uint   `json:"age"`
+			Gender  uint   `json:"gender"`
+			Phone   string `json:"phone"`
+			Address string `json:"address"`
+		} `json:"profile"`
+	}
+	params := url.Values{
+		"name": {"李四"}, "age": {"28"}, "gender": {"男"},
+		"phone": {"13700137000"}, "address": {"杭州"}, "include": {"profile"},
+	}
+	s.expectStatus(t, http.StatusUnauthorized, "/api/v1/updateUserProfile", seededUser{}, params)
+
+	// 只能修改令牌对应用户自己的资料，user_id 参数被忽略
+	params.Set("user_id", f.Rep2.idParam())
+	s.mustGet(t, "/api/v1/updateUserProfile", f.Rep, params).decode(t, &user)
+	profile := user.UserProfile
+	if user.ID != f.Rep.ID || profile.Name != "李四" || profile.Age != 28 || profile.Gender != 1 || profile.Phone != "13700137000" || profile.Address != "杭州" {
+		t.Fatalf("unexpected profile %d %+v", user.ID, profile)
+	}
+}
+
+// 每个路由组都要拒绝未携带令牌、令牌无效或过期以及角色不匹配的请求
+func TestRouteGroupAuthorization(t *testing.T) {
+	s := newTestServer(t)
+	f := seedOrg(t, s)
+
+	jwtConfig := config.Get().JWT
+	expired, err := jwt.NewWithClaims(jwt.GetSigningMethod(jwtConfig.Algorithm), &helpers.Claims{
+		UserID:         f.Rep.ID,
+		UserName:       f.Rep.Name,
+		UserRole:       "销售代表",
+		StandardClaims: jwt.StandardClaims{ExpiresAt: time.Now().Add(-time.Minute).Unix()},
+	}).SignedString([]byte(jwtConfig.Secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	forged, err := jwt.NewWithClaims(jwt.GetSigningMethod(jwtConfig.Algorithm), &helpers.Claims{
+		UserID:         f.Rep.ID,
+		UserName:       f.Rep.Name,
+		UserRole:       "系统管理员",
+		StandardClaims: jwt.StandardClaims{ExpiresAt: time.Now().Add(time.Hour).Unix()},
+	}).SignedString([]byte("not-the-server-secret-not-the-server-secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name string
+		path string
+		user seededUser
+		want int
+	}{
+		{"no token", "/api/v1/sale/listCustomers", seededUser{}, http.StatusUnauthorized},
+		{"garbage token", "/api/v1/sale/listCustomers", seededUser{Token: "not-a-jwt"}, http.StatusUnauthorized},
+		{"expired token", "/api/v1/sale/listCustomers", seededUser{Token: expired}, http.StatusUnauthorized},
+		{"token signed with another key", "/api/v1/admin/listAllUsers", seededUser{Token: forged}, http.StatusUnauthorized},
+		{"default role on sale", "/api/v1/sale/listCustomers", f.Newbie, http.StatusForbidden},
+		{"finance on sale", "/api/v1/sale/createCustomer", f.Finance, http.StatusForbidden},
+		{"general manager on sale", "/api/v1/sale/migrateCustomer", f.GeneralManager, http.StatusForbidden},
+		{"rep on admin", "/api/v1/admin/listAllUsers", f.Rep, http.StatusForbidden},
+		{"general manager on admin", "/api/v1/admin/readSystemLog", f.GeneralManager, http.StatusForbidden},
+		{"rep on finance", "/api/v1/finance/updateContractStatus", f.Rep, http.StatusForbidden},
+		{"accountant on finance", "/api/v1/finance/updateContractAmount", f.Accountant, http.StatusForbidden},
+		{"admin on contract", "/api/v1/contract/getContractList", f.Admin, http.StatusForbidden},
+		{"finance specialist on contract", "/api/v1/contract/getContractList", f.Finance, http.StatusForbidden},
+		{"default role on contract", "/api/v1/contract/getContractDetail", f.Newbie, http.StatusForbidden},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			s.expectStatus(t, c.want, c.path, c.user, url.Values{"user_id": {c.user.idParam()}})
+		})
+	}
+
+	// 操作人参数必须是令牌对应的用户；管理员接口的操作人是 system_manager_id，user_id 是被操作的用户
+	for _, c := range []struct {
+		path   string
+		user   seededUser
+		params url.Values
+	}{
+		{"/api/v1/sale/listCustomers", f.Rep, url.Values{"user_id": {f.Manager.idParam()}}},
+		{"/api/v1/contract/getContractList", f.Rep, url.Values{"user_id": {f.Director.idParam()}}},
+		{"/api/v1/admin/listAllUsers", f.Admin, url.Values{"system_manager_id": {f.Rep.idParam()}}},
+		// 格式错误的操作人参数同样拒绝，不会被当作没有传
+		{"/api/v1/sale/listCustomers", f.Rep, url.Values{"user_id": {"abc"}}},
+		{"/api/v1/sale/listCustomers", f.Rep, url.Values{"user_id": {""}}},
+		{"/api/v1/admin/listAllUsers", f.Admin, url.Values{"system_manager_id": {"-1"}}},
+	} {
+		resp := s.expectStatus(t, http.StatusForbidden, c.path, c.user, c.params)
+		if resp.Code != int(apperror.CodeActorMismatch) {
+			t.Fatalf("%s acting as another user: got code %d", c.path, resp.Code)
+		}
+	}
+	s.mustGet(t, "/api/v1/admin/unlockUser", f.Admin, url.Values{"system_manager_id": {f.Admin.idParam()}, "user_id": {f.Rep.idParam()}})
+
+	// 不传操作人参数时以令牌对应的用户操作
+	customerID := createCustomer(t, s, f.Rep, "令牌客户", "13800000009")
+	var customers []idObject
+	s.mustGet(t, "/api/v1/sale/createCustomer", f.Rep, url.Values{
+		"customer_name": {"无参数客户"}, "customer_phone": {"13800000010"},
+	})
+	s.mustGet(t, "/api/v1/sale/listCustomers", f.Rep, nil).decode(t, &customers)
+	if len(customers) != 2 || customers[0].ID != customerID {
+		t.Fatalf("customers created without user_id must belong to the token user, got %+v", customers)
+	}
+	s.mustGet(t, "/api/v1/sale/listCustomers", f.Manager, nil).decode(t, &customers)
+	if len(customers) != 2 {
+		t.Fatalf("manager must see the department's customers, got %+v", customers)
+	}
+	s.mustGet(t, "/api/v1/sale/listCustomers", f.OtherManager, nil).decode(t, &customers)
+	if len(customers) != 0 {
+		t.Fatalf("other department must not see the customers, got %+v", customers)
+	}
+	s.mustGet(t, "/api/v1/admin/unlockUser", f.Admin, url.Values{"user_id": {f.Rep.idParam()}})
+}
+
+// 错误统一返回业务错误码，提示语言由 Accept-Language 决定
+func TestErrorResponses(t *testing.T) {
+	s := newTestServer(t)
+	f := seedOrg(t, s)
+
+	request := func(path, token, acceptLanguage string, params url.Values) apiResponse {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, path+"?"+params.Encode(), nil)
+		req.Header.Set("Accept-Language", acceptLanguage)
+		if token != "" {
+			req.Header.Set("Authorization", token)
+		}
+		rec := httptest.NewRecorder()
+		s.router.ServeHTTP(rec, req)
+		resp := apiResponse{Status: rec.Code}
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("invalid json %q: %s", rec.Body.String(), err)
+		}
+		return resp
+	}
+
+	cases := []struct {
+		name           string
+		path           string
+		token          string
+		acceptLanguage string
+		params         url.Values
+		status         int
+		code           apperror.Code
+		message        string
+	}{
+		{"invalid credentials zh", "/api/v1/login", "", "zh-CN,zh;q=0.9", url.Values{"username": {"rep"}, "password": {"wrong1234"}},
+			http.StatusUnauthorized, apperror.CodeInvalidCredentials, "用户名或密码错误"},
+		{"invalid credentials en", "/api/v1/login", "", "en-US,en;q=0.9,zh;q=0.8", url.Values{"username": {"rep"}, "password": {"wrong1234"}},
+			http.StatusUnauthorized, apperror.CodeInvalidCredentials, "Invalid username or password"},
+		{"not found en", "/api/v1/getZoneByID", "", "en", url.Values{"zone_id": {"999"}},
+			http.StatusNotFound, apperror.CodeNotFound, "Resource not found"},
+		{"forbidden defaults to zh", "/api/v1/admin/listAllUsers", f.Rep.Token, "", nil,
+			http.StatusForbidden, apperror.CodeForbidden, "当前角色无权访问"},
+		{"unknown route", "/api/v1/nope", "", "en", nil,
+			http.StatusNotFound, apperror.CodeRouteNotFound, "Route not found"},
+		{"refresh token cannot access api", "/api/v1/sale/listCustomers", refreshToken(t, s, f.Rep), "", nil,
+			http.StatusForbidden, apperror.CodeForbidden, "当前角色无权访问"},
+		{"access token without session", "/api/v1/sale/listCustomers", sessionlessToken(t, f.Rep), "", nil,
+			http.StatusUnauthorized, apperror.CodeUnauthorized, "未登录或令牌无效"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			resp := request(c.path, c.token, c.acceptLanguage, c.params)
+			if resp.Status != c.status || resp.Code != int(c.code) || resp.Message != c.message {
+				t.Fatalf("got %d/%d %q, want %d/%d %q", resp.Status, resp.Code, resp.Message, c.status, c.code, c.message)
+			}
+		})
+	}
+
+	// 数据库错误不能原样返回给客户端
+	resp := request("/api/v1/register", "", "en", url.Values{"username": {"rep"}, "password": {"rep12345"}})
+	if resp.Status != http.StatusConflict || strings.Contains(resp.Message, "UNIQUE") {
+		t.Fatalf("duplicate register: got %d %q", resp.Status, resp.Message)
+	}
+}
+
+// sessionlessToken 不属于任何会话的访问令牌，签名和其他声明都有效
+func sessionlessToken(t *testing.T, user seededUser) string {
+	t.Helper()
+	jwtConfig := config.Get().JWT
+	token, err := helpers.SignToken(&helpers.Claims{
+		UserID:   user.ID,
+		UserName: user.Name,
+		UserRole: "销售代表",
+		StandardClaims: jwt.StandardClaims{
+			Issuer:    jwtConfig.Issuer,
+			Audience:  jwtConfig.Audience,
+			ExpiresAt: time.Now().Add(time.Hour).Unix(),
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func refreshToken(t *testing.T, s *testServer, user seededUser) string {
+	t.Helper()
+	_, refresh, err := helpers.GenerateToken(models.User{Model: gorm.Model{ID: user.ID}, UserName: user.Name}, seedSession(t, s, user.ID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return refresh
+}
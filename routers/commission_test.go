@@ -0,0 +1,140 @@
+package routers
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"gin-boilerplate/infra/apperror"
+)
+
+type statementData struct {
+	ID                 uint   `json:"id"`
+	UserID             uint   `json:"user_id"`
+	Period             string `json:"period"`
+	Volume             string `json:"volume"`
+	OwnCommission      string `json:"own_commission"`
+	OverrideCommission string `json:"override_commission"`
+	Adjustment         string `json:"adjustment"`
+	Total              string `json:"total"`
+	Status             uint   `json:"status"`
+	Lines              []struct {
+		ContractID uint   `json:"contract_id"`
+		Kind       uint   `json:"kind"`
+		Rate       string `json:"rate"`
+		Amount     string `json:"amount"`
+	} `json:"lines"`
+}
+
+func TestCommissionSettlement(t *testing.T) {
+	s := newTestServer(t)
+	f := seedOrg(t, s)
+	accountant := func(params url.Values) url.Values {
+		params.Set("user_id", f.Accountant.idParam())
+		return params
+	}
+
+	// 销售代表当月签单满15万时费率从30%提高到40%；经理、总监分别提取部门、战区服务费的5%、2%
+	for _, plan := range []url.Values{
+		{"name": {"销售代表2024"}, "role": {"销售代表"}, "base_rate": {"0.3"}, "override_rate": {"0"},
+			"tier_min_volumes": {"150000", "500000"}, "tier_rates": {"0.4", "0.5"}},
+		{"name": {"销售经理2024"}, "role": {"销售经理"}, "base_rate": {"0.3"}, "override_rate": {"0.05"}},
+		{"name": {"销售总监2024"}, "role": {"销售总监"}, "base_rate": {"0.3"}, "override_rate": {"0.02"}},
+	} {
+		s.mustGet(t, "/api/v1/commission/createPlan", f.Accountant, accountant(plan))
+	}
+	s.expectStatus(t, http.StatusBadRequest, "/api/v1/commission/createPlan", f.Accountant, accountant(url.Values{
+		"name": {"不完整的阶梯"}, "role": {"销售代表"}, "base_rate": {"0.3"}, "override_rate": {"0"},
+		"tier_min_volumes": {"150000", "500000"}, "tier_rates": {"0.4"},
+	}))
+	s.expectStatus(t, http.StatusForbidden, "/api/v1/commission/getPlans", f.Finance, nil)
+
+	approve := func(saler seededUser, phone, amount string) {
+		t.Helper()
+		customerID := createCustomer(t, s, saler, "提成客户", phone)
+		contract := submitContract(t, s, f, saler, customerID, amount)
+		verifyKYC(t, s, f, saler, customerID)
+		s.mustGet(t, "/api/v1/finance/updateContractStatus", f.FinanceManager, url.Values{
+			"user_id": {f.FinanceManager.idParam()}, "contract_id": {id(contract.ID)}, "status": {"已批准"},
+		})
+	}
+	// 每个合同的服务费都是1000
+	approve(f.Rep, "13800000001", "100000")
+	approve(f.Rep, "13800000002", "60000")
+	approve(f.Rep2, "13800000003", "50000")
+	approve(f.Manager, "13800000004", "10000")
+	submitContract(t, s, f, f.OtherRep, createCustomer(t, s, f.OtherRep, "未批准客户", "13800000005"), "80000")
+
+	period := time.Now().Format("2006-01")
+	settle := func() map[uint]statementData {
+		t.Helper()
+		var statements []statementData
+		s.mustGet(t, "/api/v1/commission/settle", f.Accountant, accountant(url.Values{"period": {period}})).decode(t, &statements)
+		byUser := map[uint]statementData{}
+		for _, statement := range statements {
+			byUser[statement.UserID] = statement
+		}
+		return byUser
+	}
+	statements := settle()
+	want := map[uint][3]string{ // 本人提成, 管理提成, 合计
+		f.Rep.ID:      {"800", "0", "800"},
+		f.Rep2.ID:     {"300", "0", "300"},
+		f.Manager.ID:  {"300", "150", "450"},
+		f.Director.ID: {"0", "80", "80"},
+	}
+	if len(statements) != len(want) {
+		t.Fatalf("got %d statements, want %d: %+v", len(statements), len(want), statements)
+	}
+	for userID, w := range want {
+		got := statements[userID]
+		if got.OwnCommission != w[0] || got.OverrideCommission != w[1] || got.Total != w[2] || got.Period != period {
+			t.Fatalf("statement of user %d: got %+v, want %v", userID, got, w)
+		}
+	}
+
+	var detail statementData
+	s.mustGet(t, "/api/v1/commission/getStatement", f.Accountant, accountant(url.Values{
+		"statement_id": {id(statements[f.Rep.ID].ID)},
+	})).decode(t, &detail)
+	if detail.Volume != "160000" || len(detail.Lines) != 2 || detail.Lines[0].Rate != "0.4" || detail.Lines[0].Amount != "400" {
+		t.Fatalf("unexpected statement detail %+v", detail)
+	}
+
+	// 调整并锁定销售代表的提成单
+	repStatement := id(statements[f.Rep.ID].ID)
+	var adjusted statementData
+	s.mustGet(t, "/api/v1/commission/adjustStatement", f.Accountant, accountant(url.Values{
+		"statement_id": {repStatement}, "adjustment": {"-100.5"}, "note": {"客户投诉扣减"},
+	})).decode(t, &adjusted)
+	if adjusted.Adjustment != "-100.5" || adjusted.Total != "699.5" {
+		t.Fatalf("unexpected adjusted statement %+v", adjusted)
+	}
+	s.mustGet(t, "/api/v1/commission/lockStatement", f.Accountant, accountant(url.Values{"statement_id": {repStatement}}))
+	resp := s.get(t, "/api/v1/commission/adjustStatement", f.Accountant.Token, accountant(url.Values{
+		"statement_id": {repStatement}, "adjustment": {"50"}, "note": {"补发"},
+	}))
+	if resp.Status != http.StatusConflict || resp.Code != int(apperror.CodeStatementLocked) {
+		t.Fatalf("adjust locked statement: got %d/%d", resp.Status, resp.Code)
+	}
+
+	// 重新结算：新批准的合同计入待审核的提成单，已锁定的提成单不变
+	approve(f.Rep, "13800000006", "20000")
+	approve(f.Rep2, "13800000007", "20000")
+	statements = settle()
+	if _, ok := statements[f.Rep.ID]; ok {
+		t.Fatalf("locked statement was settled again")
+	}
+	if got := statements[f.Rep2.ID]; got.Total != "600" {
+		t.Fatalf("rep2 after resettle: got %+v", got)
+	}
+	var all []statementData
+	s.mustGet(t, "/api/v1/commission/getStatements", f.Accountant, accountant(url.Values{"period": {period}})).decode(t, &all)
+	for _, statement := range all {
+		if statement.UserID == f.Rep.ID && (statement.Total != "699.5" || statement.Status != 1) {
+			t.Fatalf("locked statement changed: %+v", statement)
+		}
+	}
+	s.expectStatus(t, http.StatusBadRequest, "/api/v1/commission/settle", f.Accountant, accountant(url.Values{"period": {"2024-13"}}))
+}
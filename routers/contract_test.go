@@ -0,0 +1,189 @@
+package routers
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+type contractData struct {
+	ID           uint   `json:"id"`
+	Amount       string `json:"amount"`
+	ServiceFee   string `json:"service_fee"`
+	BankAmount   string `json:"bank_amount"`
+	Currency     string `json:"currency"`
+	Status       uint   `json:"status"`
+	StatusName   string `json:"status_name"`
+	CustomerID   uint   `json:"customer_id"`
+	SalerID      uint   `json:"saler_id"`
+	FinanceID    uint   `json:"finance_id"`
+	AccountantID uint   `json:"accountant_id"`
+	DepartmentID uint   `json:"department_id"`
+	ZoneID       uint   `json:"zone_id"`
+	// 会计确认银行金额后才有值
+	BankConfirmedBy *uint `json:"bank_confirmed_by"`
+}
+
+// submitContract 以销售人员身份为客户提交合同
+func submitContract(t *testing.T, s *testServer, f *orgFixture, saler seededUser, customerID uint, amount string) contractData {
+	t.Helper()
+	var contract contractData
+	s.mustGet(t, "/api/v1/sale/submitContract", saler, url.Values{
+		"user_id": {saler.idParam()}, "customer_id": {id(customerID)},
+		"finance_id": {f.Finance.idParam()}, "accountant_id": {f.Accountant.idParam()},
+		"amount": {amount}, "service_fee": {"1000"}, "bank_amount": {amount},
+		"financial_product": {"经营贷"}, "contract_document": {"contract.pdf"}, "bank_documents": {"bank.pdf"},
+	}).decode(t, &contract)
+	return contract
+}
+
+func TestContractSubmissionAndApproval(t *testing.T) {
+	s := newTestServer(t)
+	f := seedOrg(t, s)
+
+	customerID := createCustomer(t, s, f.Rep, "张三", "13800138000")
+	contract := submitContract(t, s, f, f.Rep, customerID, "100000")
+	if contract.Status != 0 || contract.SalerID != f.Rep.ID || contract.CustomerID != customerID ||
+		contract.DepartmentID != f.DeptA || contract.ZoneID != f.ZoneA || contract.Amount != "100000" || contract.Currency != "CNY" {
+		t.Fatalf("unexpected submitted contract %+v", contract)
+	}
+	verifyKYC(t, s, f, f.Rep, customerID)
+
+	for _, step := range []struct {
+		user   seededUser
+		status string
+		want   uint
+	}{
+		{f.Finance, "审批中", 1},
+		{f.FinanceManager, "已批准", 2},
+	} {
+		var updated contractData
+		s.mustGet(t, "/api/v1/finance/updateContractStatus", step.user, url.Values{
+			"user_id": {step.user.idParam()}, "contract_id": {id(contract.ID)}, "status": {step.status},
+		}).decode(t, &updated)
+		if updated.Status != step.want || updated.StatusName != step.status {
+			t.Fatalf("status after %s: got %d %s, want %d", step.status, updated.Status, updated.StatusName, step.want)
+		}
+	}
+
+	var updated contractData
+	s.mustGet(t, "/api/v1/finance/updateContractAmount", f.FinanceManager, url.Values{
+		"user_id": {f.FinanceManager.idParam()}, "contract_id": {id(contract.ID)},
+		"amount": {"120000.10"}, "service_fee": {"0"}, "bank_amount": {"118000.2"}, "reason": {"客户追加贷款"},
+	}).decode(t, &updated)
+	if updated.Amount != "120000.1" || updated.ServiceFee != "0" || updated.BankAmount != "118000.2" {
+		t.Fatalf("unexpected amounts %+v", updated)
+	}
+
+	var detail contractData
+	s.mustGet(t, "/api/v1/contract/getContractDetail", f.Rep, url.Values{
+		"user_id": {f.Rep.idParam()}, "contract_id": {id(contract.ID)},
+	}).decode(t, &detail)
+	if detail.ID != contract.ID || detail.Status != 2 || detail.Amount != "120000.1" {
+		t.Fatalf("unexpected contract detail %+v", detail)
+	}
+
+	// 销售人员不能审批合同
+	s.expectStatus(t, http.StatusForbidden, "/api/v1/finance/updateContractStatus", f.Rep, url.Values{
+		"user_id": {f.Rep.idParam()}, "contract_id": {id(contract.ID)}, "status": {"已拒绝"},
+	})
+	s.expectStatus(t, http.StatusNotFound, "/api/v1/contract/getContractDetail", f.Rep, url.Values{
+		"user_id": {f.Rep.idParam()}, "contract_id": {"999"},
+	})
+}
+
+// 合同列表按角色过滤：销售代表看自己的，经理看部门的，总监看战区的，总经理/金融经理/会计看全部
+func TestContractListScope(t *testing.T) {
+	s := newTestServer(t)
+	f := seedOrg(t, s)
+
+	submitContract(t, s, f, f.Rep, createCustomer(t, s, f.Rep, "客户A", "13800000001"), "100000")
+	submitContract(t, s, f, f.OtherRep, createCustomer(t, s, f.OtherRep, "客户B", "13800000002"), "50000")
+
+	cases := []struct {
+		name string
+		user seededUser
+		want int
+	}{
+		{"rep", f.Rep, 1},
+		{"rep without contracts", f.Rep2, 0},
+		{"manager", f.Manager, 1},
+		{"other manager", f.OtherManager, 1},
+		{"director", f.Director, 1},
+		{"general manager", f.GeneralManager, 2},
+		{"finance manager", f.FinanceManager, 2},
+		{"accountant", f.Accountant, 2},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var contracts []contractData
+			s.mustGet(t, "/api/v1/contract/getContractList", c.user, url.Values{"user_id": {c.user.idParam()}}).decode(t, &contracts)
+			if len(contracts) != c.want {
+				t.Fatalf("got %d contracts, want %d", len(contracts), c.want)
+			}
+		})
+	}
+}
+
+func TestPerformanceStats(t *testing.T) {
+	s := newTestServer(t)
+	f := seedOrg(t, s)
+
+	type loanAnalysis struct {
+		TotalAmount   string `json:"total_amount"`
+		Count         int    `json:"count"`
+		AverageAmount string `json:"average_amount"`
+	}
+	// 没有合同时平均值为0，而不是 NaN
+	var empty loanAnalysis
+	s.mustGet(t, "/api/v1/getLoanAnalysis", f.GeneralManager, url.Values{"user_id": {f.GeneralManager.idParam()}}).decode(t, &empty)
+	if empty != (loanAnalysis{TotalAmount: "0", Count: 0, AverageAmount: "0"}) {
+		t.Fatalf("unexpected empty loan analysis %+v", empty)
+	}
+
+	submitContract(t, s, f, f.Rep, createCustomer(t, s, f.Rep, "客户A1", "13800000001"), "100000.10")
+	submitContract(t, s, f, f.Rep2, createCustomer(t, s, f.Rep2, "客户A2", "13800000002"), "50000.20")
+	submitContract(t, s, f, f.OtherRep, createCustomer(t, s, f.OtherRep, "客户B1", "13800000003"), "30000.05")
+
+	period := url.Values{"start_date": {"2000-01-01T00:00:00Z"}, "end_date": {"2100-01-01T00:00:00Z"}}
+	with := func(extra url.Values) url.Values {
+		params := url.Values{"user_id": {f.GeneralManager.idParam()}}
+		for k, v := range period {
+			params[k] = v
+		}
+		for k, v := range extra {
+			params[k] = v
+		}
+		return params
+	}
+
+	cases := []struct {
+		name   string
+		path   string
+		params url.Values
+		want   string
+	}{
+		{"saler", "/api/v1/getSalerPerformance", with(url.Values{"saler_id": {f.Rep.idParam()}}), "100000.1"},
+		{"department", "/api/v1/getDepartmentPerformance", with(url.Values{"department_id": {id(f.DeptA)}}), "150000.3"},
+		{"zone A", "/api/v1/getZonePerformance", with(url.Values{"zone_id": {id(f.ZoneA)}}), "150000.3"},
+		{"zone B", "/api/v1/getZonePerformance", with(url.Values{"zone_id": {id(f.ZoneB)}}), "30000.05"},
+		{"zone without contracts in period", "/api/v1/getZonePerformance", with(url.Values{
+			"zone_id": {id(f.ZoneA)}, "start_date": {"2000-01-01T00:00:00Z"}, "end_date": {"2000-02-01T00:00:00Z"},
+		}), "0"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var got string
+			s.mustGet(t, c.path, f.GeneralManager, c.params).decode(t, &got)
+			if got != c.want {
+				t.Fatalf("got %v, want %v", got, c.want)
+			}
+		})
+	}
+
+	var analysis loanAnalysis
+	s.mustGet(t, "/api/v1/getLoanAnalysis", f.GeneralManager, url.Values{"user_id": {f.GeneralManager.idParam()}}).decode(t, &analysis)
+	if analysis != (loanAnalysis{TotalAmount: "180000.35", Count: 3, AverageAmount: "60000.12"}) {
+		t.Fatalf("unexpected loan analysis %+v", analysis)
+	}
+}
@@ -0,0 +1,213 @@
+package routers
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"gin-boilerplate/infra/apperror"
+	"gin-boilerplate/models"
+)
+
+type customerData struct {
+	ID            uint   `json:"id"`
+	Name          string `json:"name"`
+	Phone         string `json:"phone"`
+	Age           uint   `json:"age"`
+	Address       string `json:"address"`
+	LoanIntent    int    `json:"loan_intent"`
+	IsInPublicSea bool   `json:"is_in_public_sea"`
+	SalerID       *uint  `json:"saler_id"`
+	DepartmentID  *uint  `json:"department_id"`
+	ZoneID        *uint  `json:"zone_id"`
+}
+
+func listCustomers(t *testing.T, s *testServer, user seededUser) []customerData {
+	t.Helper()
+	var customers []customerData
+	s.mustGet(t, "/api/v1/sale/listCustomers", user, url.Values{"user_id": {user.idParam()}}).decode(t, &customers)
+	return customers
+}
+
+func TestCustomerCreateAndUpdate(t *testing.T) {
+	s := newTestServer(t)
+	f := seedOrg(t, s)
+
+	var created customerData
+	s.mustGet(t, "/api/v1/sale/createCustomer", f.Rep, url.Values{
+		"user_id": {f.Rep.idParam()}, "customer_name": {"张三"}, "customer_phone": {"13800138000"},
+	}).decode(t, &created)
+	if created.LoanIntent != 10 || created.IsInPublicSea || created.SalerID == nil || *created.SalerID != f.Rep.ID ||
+		created.DepartmentID == nil || *created.DepartmentID != f.DeptA || created.ZoneID == nil || *created.ZoneID != f.ZoneA {
+		t.Fatalf("unexpected new customer %+v", created)
+	}
+
+	// 更新后立即返回最新数据
+	var updated customerData
+	s.mustGet(t, "/api/v1/sale/updateCustomer", f.Rep, url.Values{
+		"user_id": {f.Rep.idParam()}, "customer_id": {id(created.ID)}, "customer_name": {"张三丰"},
+		"customer_phone": {"13900139000"}, "customer_age": {"30"}, "customer_gender": {"男"}, "customer_address": {"上海"},
+	}).decode(t, &updated)
+	if updated.Name != "张三丰" || updated.Phone != "13900139000" || updated.Age != 30 || updated.Address != "上海" {
+		t.Fatalf("update customer returned stale data: %+v", updated)
+	}
+
+	// 销售总监不属于任何部门，不能新建客户
+	s.expectStatus(t, http.StatusBadRequest, "/api/v1/sale/createCustomer", f.Director, url.Values{
+		"user_id": {f.Director.idParam()}, "customer_name": {"王五"}, "customer_phone": {"13600136000"},
+	})
+}
+
+// 销售代表只能看到自己的客户，销售经理看到部门内的客户，销售总监看到战区内的客户
+func TestCustomerListScope(t *testing.T) {
+	s := newTestServer(t)
+	f := seedOrg(t, s)
+
+	createCustomer(t, s, f.Rep, "客户A1", "13800000001")
+	createCustomer(t, s, f.Rep, "客户A2", "13800000002")
+	createCustomer(t, s, f.Rep2, "客户A3", "13800000003")
+	createCustomer(t, s, f.OtherRep, "客户B1", "13800000004")
+
+	cases := []struct {
+		name string
+		user seededUser
+		want int
+	}{
+		{"rep", f.Rep, 2},
+		{"rep2", f.Rep2, 1},
+		{"manager", f.Manager, 3},
+		{"director", f.Director, 3},
+		{"other manager", f.OtherManager, 1},
+		{"other rep", f.OtherRep, 1},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := len(listCustomers(t, s, c.user)); got != c.want {
+				t.Fatalf("got %d customers, want %d", got, c.want)
+			}
+		})
+	}
+}
+
+func TestCustomerMigration(t *testing.T) {
+	s := newTestServer(t)
+	f := seedOrg(t, s)
+
+	customerID := createCustomer(t, s, f.Rep, "张三", "13800138000")
+	migrate := func(user, newSaler seededUser) apiResponse {
+		return s.get(t, "/api/v1/sale/migrateCustomer", user.Token, url.Values{
+			"user_id": {user.idParam()}, "new_saler_id": {newSaler.idParam()}, "customer_id": {id(customerID)},
+		})
+	}
+
+	// 销售经理可以在部门内迁移
+	var migrated customerData
+	resp := migrate(f.Manager, f.Rep2)
+	if resp.Status != http.StatusOK {
+		t.Fatalf("manager migrate: %d %s", resp.Status, resp.Message)
+	}
+	resp.decode(t, &migrated)
+	if migrated.SalerID == nil || *migrated.SalerID != f.Rep2.ID {
+		t.Fatalf("customer not migrated to rep2: %+v", migrated)
+	}
+	if got := len(listCustomers(t, s, f.Rep)); got != 0 {
+		t.Fatalf("rep still sees %d customers after migration", got)
+	}
+
+	// 销售总监可以在战区内迁移
+	if resp := migrate(f.Director, f.Rep); resp.Status != http.StatusOK {
+		t.Fatalf("director migrate: %d %s", resp.Status, resp.Message)
+	}
+	if got := len(listCustomers(t, s, f.Rep)); got != 1 {
+		t.Fatalf("rep sees %d customers after director migration, want 1", got)
+	}
+
+	denied := []struct {
+		name           string
+		user, newSaler seededUser
+	}{
+		{"rep cannot migrate", f.Rep, f.Rep2},
+		{"manager of another department", f.OtherManager, f.OtherRep},
+		{"manager to another department", f.Manager, f.OtherRep},
+	}
+	for _, c := range denied {
+		t.Run(c.name, func(t *testing.T) {
+			resp := migrate(c.user, c.newSaler)
+			if resp.Status != http.StatusForbidden || resp.Code != int(apperror.CodeCustomerMigrateForbidden) {
+				t.Fatalf("got %d/%d, want %d/%d", resp.Status, resp.Code, http.StatusForbidden, apperror.CodeCustomerMigrateForbidden)
+			}
+		})
+	}
+
+	customer, err := s.repos.Customers.GetCustomerByID(context.Background(), customerID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if customer.SalerID == nil || *customer.SalerID != f.Rep.ID {
+		t.Fatalf("denied migration changed the customer: saler %v", customer.SalerID)
+	}
+}
+
+// 贷款意向降为0的客户由定时任务移入公海，所有销售人员都能看到
+func TestPublicSea(t *testing.T) {
+	s := newTestServer(t)
+	f := seedOrg(t, s)
+
+	fading := createCustomer(t, s, f.Rep, "意向将尽", "13800000001")
+	active := createCustomer(t, s, f.Rep, "意向充足", "13800000002")
+	if err := s.db.Model(&models.Customer{}).Where("id = ?", fading).Update("loan_intent", 1).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	if err := s.repos.Customers.AutoUpdateCustomerLoanIntent(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.repos.Customers.AutoMigrateCustomerToPublicSea(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, user := range []seededUser{f.Rep2, f.OtherRep, f.Director} {
+		var sea []customerData
+		s.mustGet(t, "/api/v1/sale/getPublicSeaCustomerList", user, url.Values{"user_id": {user.idParam()}}).decode(t, &sea)
+		if len(sea) != 1 || sea[0].ID != fading {
+			t.Fatalf("%s sees public sea %+v, want only customer %d", user.Name, sea, fading)
+		}
+		if !sea[0].IsInPublicSea || sea[0].SalerID != nil || sea[0].DepartmentID != nil || sea[0].ZoneID != nil {
+			t.Fatalf("public sea customer still assigned: %+v", sea[0])
+		}
+	}
+
+	customers := listCustomers(t, s, f.Rep)
+	if len(customers) != 1 || customers[0].ID != active || customers[0].LoanIntent != 9 {
+		t.Fatalf("rep customers after daily job: %+v", customers)
+	}
+}
+
+func TestWorkLog(t *testing.T) {
+	s := newTestServer(t)
+	f := seedOrg(t, s)
+
+	var workLog struct {
+		ID         uint   `json:"id"`
+		UserID     uint   `json:"user_id"`
+		Calls      int    `json:"calls"`
+		ValidCalls int    `json:"valid_calls"`
+		Visits     int    `json:"visits"`
+		Contracts  int    `json:"contracts"`
+		Date       string `json:"date"`
+	}
+	s.mustGet(t, "/api/v1/sale/createWorkLog", f.Rep, url.Values{
+		"user_id": {f.Rep.idParam()}, "calls": {"40"}, "valid_calls": {"12"}, "visits": {"3"}, "contracts": {"1"},
+		"date": {"2024-03-01T09:00:00Z"},
+	}).decode(t, &workLog)
+	if workLog.ID == 0 || workLog.UserID != f.Rep.ID || workLog.Calls != 40 || workLog.ValidCalls != 12 ||
+		workLog.Visits != 3 || workLog.Contracts != 1 {
+		t.Fatalf("unexpected work log %+v", workLog)
+	}
+
+	s.expectStatus(t, http.StatusBadRequest, "/api/v1/sale/createWorkLog", f.Rep, url.Values{
+		"user_id": {f.Rep.idParam()}, "date": {"yesterday"},
+	})
+}
@@ -0,0 +1,239 @@
+package routers
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"gin-boilerplate/controllers"
+	"gin-boilerplate/infra/apperror"
+	"gin-boilerplate/models"
+)
+
+type delegationData struct {
+	ID          uint `json:"id"`
+	PrincipalID uint `json:"principal_id"`
+	DelegateID  uint `json:"delegate_id"`
+	Active      bool `json:"active"`
+}
+
+// seedUserWithRole 新建指定角色的用户并签发令牌
+func seedUserWithRole(t *testing.T, s *testServer, f *orgFixture, name string, role models.RoleID) seededUser {
+	t.Helper()
+	user, err := s.repos.Users.CreateUser(context.Background(), name, seedPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user, err = s.repos.Users.UpdateUserRole(context.Background(), f.Admin.ID, user.ID, role); err != nil {
+		t.Fatal(err)
+	}
+	return issueToken(t, s, *user)
+}
+
+// period 以当前时间为基准的委托有效期
+func period(from, to time.Duration) url.Values {
+	now := time.Now().UTC()
+	return url.Values{
+		"start_date": {now.Add(from).Format(time.RFC3339)},
+		"end_date":   {now.Add(to).Format(time.RFC3339)},
+	}
+}
+
+func delegate(t *testing.T, s *testServer, principal, delegateTo seededUser, params url.Values) delegationData {
+	t.Helper()
+	params.Set("delegate_id", delegateTo.idParam())
+	params.Set("reason", "休年假")
+	var delegation delegationData
+	s.mustGet(t, "/api/v1/me/delegations/create", principal, params).decode(t, &delegation)
+	return delegation
+}
+
+// 委托期间被委托人可以处理指派给委托人的合同，日志同时记录被委托人和委托人
+func TestDelegatedApproval(t *testing.T) {
+	s := newTestServer(t)
+	f := seedOrg(t, s)
+	contract := submitContract(t, s, f, f.Rep, createCustomer(t, s, f.Rep, "委托客户", "13800000001"), "100000")
+	finance2 := seedUserWithRole(t, s, f, "finance2", models.FINANCE_SPECIALIST)
+	accountant2 := seedUserWithRole(t, s, f, "accountant2", models.ACCOUNTANT)
+
+	updateAmount := func(amount string) apiResponse {
+		return s.get(t, "/api/v1/finance/updateContractAmount", finance2.Token, url.Values{
+			"user_id": {finance2.idParam()}, "contract_id": {id(contract.ID)},
+			"amount": {amount}, "service_fee": {"1000"}, "bank_amount": {amount}, "reason": {"客户调整金额"},
+		})
+	}
+	if resp := updateAmount("90000"); resp.Code != int(apperror.CodeContractAmountForbidden) {
+		t.Fatalf("before delegation: got %d/%d", resp.Status, resp.Code)
+	}
+	financeDelegation := delegate(t, s, f.Finance, finance2, period(-time.Hour, 24*time.Hour))
+	if !financeDelegation.Active || financeDelegation.PrincipalID != f.Finance.ID {
+		t.Fatalf("unexpected delegation %+v", financeDelegation)
+	}
+	if resp := updateAmount("90000"); resp.Status != http.StatusOK {
+		t.Fatalf("delegated update: got %d (%s)", resp.Status, resp.Message)
+	}
+
+	// 会计已经休假时由系统管理员创建委托
+	params := period(-time.Hour, 24*time.Hour)
+	params.Set("system_manager_id", f.Admin.idParam())
+	params.Set("principal_id", f.Accountant.idParam())
+	params.Set("delegate_id", accountant2.idParam())
+	s.mustGet(t, "/api/v1/admin/createDelegation", f.Admin, params)
+	var confirmed struct {
+		Reconciliation *reconciliationItemData `json:"reconciliation"`
+	}
+	s.mustGet(t, "/api/v1/reconciliation/confirmBankAmount", accountant2, url.Values{
+		"user_id": {accountant2.idParam()}, "contract_id": {id(contract.ID)}, "bank_amount": {"85000"},
+	}).decode(t, &confirmed)
+	// 对账差异仍然由合同指定的会计负责
+	if item := confirmed.Reconciliation; item == nil || item.AccountantID != f.Accountant.ID {
+		t.Fatalf("unexpected reconciliation item %+v", item)
+	}
+	var items []reconciliationItemData
+	s.mustGet(t, "/api/v1/reconciliation/getItems", accountant2, url.Values{"user_id": {accountant2.idParam()}}).decode(t, &items)
+	if len(items) != 1 {
+		t.Fatalf("delegate must see the principal's items, got %+v", items)
+	}
+	s.mustGet(t, "/api/v1/reconciliation/resolveItem", accountant2, url.Values{
+		"user_id": {accountant2.idParam()}, "item_id": {id(items[0].ID)}, "resolution": {"银行扣除了手续费"},
+	})
+
+	onBehalf := map[uint]uint{}
+	for _, log := range readSystemLogs(t, s, f) {
+		if log.OnBehalfOfID != nil {
+			if !strings.Contains(log.Action, "代理用户") {
+				t.Fatalf("delegated log must name the principal: %+v", log)
+			}
+			onBehalf[log.UserID] = *log.OnBehalfOfID
+		}
+	}
+	if onBehalf[finance2.ID] != f.Finance.ID || onBehalf[accountant2.ID] != f.Accountant.ID {
+		t.Fatalf("delegated actions must record delegate and principal, got %v", onBehalf)
+	}
+
+	// 被委托人收到通知，可以看到委托给自己的委托
+	var notifications []struct {
+		Kind string `json:"kind"`
+	}
+	s.mustGet(t, "/api/v1/me/notifications", finance2, nil).decode(t, &notifications)
+	if len(notifications) != 1 || notifications[0].Kind != "delegation" {
+		t.Fatalf("unexpected notifications %+v", notifications)
+	}
+	var received []delegationData
+	s.mustGet(t, "/api/v1/me/delegations", finance2, nil).decode(t, &received)
+	if len(received) != 1 || received[0].ID != financeDelegation.ID {
+		t.Fatalf("unexpected delegations %+v", received)
+	}
+
+	// 只有委托人可以撤销，撤销后立即失效
+	s.expectStatus(t, http.StatusNotFound, "/api/v1/me/delegations/revoke", finance2, url.Values{"delegation_id": {id(financeDelegation.ID)}})
+	s.mustGet(t, "/api/v1/me/delegations/revoke", f.Finance, url.Values{"delegation_id": {id(financeDelegation.ID)}})
+	if resp := updateAmount("80000"); resp.Code != int(apperror.CodeContractAmountForbidden) {
+		t.Fatalf("after revoke: got %d/%d", resp.Status, resp.Code)
+	}
+}
+
+// 委托只在有效期内生效，被委托人必须是可以代理委托人的角色
+func TestDelegationPeriodAndEligibility(t *testing.T) {
+	s := newTestServer(t)
+	f := seedOrg(t, s)
+	contract := submitContract(t, s, f, f.Rep, createCustomer(t, s, f.Rep, "委托客户", "13800000001"), "100000")
+	rep2 := seedUserWithRole(t, s, f, "rep_delegate", models.SALES_REPRESENTATIVE)
+
+	contracts := func() []contractData {
+		var list []contractData
+		s.mustGet(t, "/api/v1/contract/getContractList", rep2, url.Values{"user_id": {rep2.idParam()}}).decode(t, &list)
+		return list
+	}
+	// 不能创建已经结束或超过最长期限的委托
+	for _, c := range []struct {
+		name   string
+		params url.Values
+		rule   string
+	}{
+		{"expired", period(-48*time.Hour, -24*time.Hour), "future"},
+		{"too long", period(0, 31*24*time.Hour), "max"},
+	} {
+		params := c.params
+		params.Set("delegate_id", rep2.idParam())
+		resp := s.expectStatus(t, http.StatusBadRequest, "/api/v1/me/delegations/create", f.Rep, params)
+		var fieldErrors []controllers.FieldError
+		resp.decode(t, &fieldErrors)
+		if resp.Code != int(apperror.CodeInvalidParams) || len(fieldErrors) != 1 ||
+			fieldErrors[0].Field != "end_date" || fieldErrors[0].Rule != c.rule {
+			t.Fatalf("%s: got %d %+v", c.name, resp.Code, fieldErrors)
+		}
+	}
+	// 尚未开始的委托不生效
+	delegate(t, s, f.Rep, rep2, period(24*time.Hour, 48*time.Hour))
+	if list := contracts(); len(list) != 0 {
+		t.Fatalf("inactive delegations must not grant access, got %+v", list)
+	}
+	delegate(t, s, f.Rep, rep2, period(-time.Minute, time.Hour))
+	if list := contracts(); len(list) != 1 || list[0].ID != contract.ID {
+		t.Fatalf("delegate must see the principal's contracts, got %+v", list)
+	}
+	var all []delegationData
+	s.mustGet(t, "/api/v1/admin/listDelegations", f.Admin, url.Values{"system_manager_id": {f.Admin.idParam()}}).decode(t, &all)
+	if len(all) != 2 || !all[0].Active || all[1].Active {
+		t.Fatalf("unexpected delegations %+v", all)
+	}
+
+	for _, c := range []struct {
+		name      string
+		principal seededUser
+		delegate  seededUser
+		code      apperror.Code
+	}{
+		{"different role", f.Rep, f.Accountant, apperror.CodeDelegationNotAllowed},
+		{"role without assigned contracts", f.GeneralManager, f.FinanceManager, apperror.CodeDelegationNotAllowed},
+		{"self", f.Finance, f.Finance, apperror.CodeDelegationNotAllowed},
+	} {
+		params := period(0, time.Hour)
+		params.Set("delegate_id", c.delegate.idParam())
+		resp := s.expectStatus(t, http.StatusBadRequest, "/api/v1/me/delegations/create", c.principal, params)
+		if resp.Code != int(c.code) {
+			t.Fatalf("%s: got code %d, want %d", c.name, resp.Code, c.code)
+		}
+	}
+	// 金融专员可以委托给金融经理
+	delegate(t, s, f.Finance, f.FinanceManager, period(0, time.Hour))
+	params := period(time.Hour, 0)
+	params.Set("delegate_id", rep2.idParam())
+	s.expectStatus(t, http.StatusBadRequest, "/api/v1/me/delegations/create", f.Rep, params)
+}
+
+// 金融专员只能审批指派给自己的合同，委托期间被委托人可以审批委托人的合同
+func TestDelegatedContractStatus(t *testing.T) {
+	s := newTestServer(t)
+	f := seedOrg(t, s)
+	customerID := createCustomer(t, s, f.Rep, "委托客户", "13800000001")
+	contract := submitContract(t, s, f, f.Rep, customerID, "100000")
+	finance2 := seedUserWithRole(t, s, f, "finance2", models.FINANCE_SPECIALIST)
+
+	updateStatus := url.Values{"user_id": {finance2.idParam()}, "contract_id": {id(contract.ID)}, "status": {"审批中"}}
+
+	if resp := s.expectStatus(t, http.StatusForbidden, "/api/v1/finance/updateContractStatus", finance2, updateStatus); resp.Code != int(apperror.CodeContractStatusForbidden) {
+		t.Fatalf("status before delegation: got code %d", resp.Code)
+	}
+
+	delegate(t, s, f.Finance, finance2, period(-time.Hour, 24*time.Hour))
+	var updated contractData
+	s.mustGet(t, "/api/v1/finance/updateContractStatus", finance2, updateStatus).decode(t, &updated)
+	if updated.Status != 1 {
+		t.Fatalf("unexpected contract %+v", updated)
+	}
+
+	var onBehalf *uint
+	for _, log := range readSystemLogs(t, s, f) {
+		if log.UserID == finance2.ID && strings.Contains(log.Action, "状态") {
+			onBehalf = log.OnBehalfOfID
+		}
+	}
+	if onBehalf == nil || *onBehalf != f.Finance.ID {
+		t.Fatalf("delegated status change must record the principal, got %v", onBehalf)
+	}
+}
@@ -0,0 +1,46 @@
+package routers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"gin-boilerplate/controllers"
+	"gin-boilerplate/infra/database"
+)
+
+// /readyz 不需要鉴权，只返回各组件的状态，不返回失败原因
+func TestReadyzHidesErrors(t *testing.T) {
+	s := newTestServer(t)
+	previous := database.DB
+	database.DB = s.db
+	t.Cleanup(func() { database.DB = previous })
+	controllers.CheckMigrations(s.db)
+
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	var body struct {
+		Status     string                            `json:"status"`
+		Components map[string]map[string]interface{} `json:"components"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("invalid json %q: %s", rec.Body.String(), err)
+	}
+	// 测试中没有启动定时任务
+	if rec.Code != http.StatusServiceUnavailable || body.Components["scheduler"]["status"] != "fail" {
+		t.Fatalf("unexpected readiness %d %s", rec.Code, rec.Body.String())
+	}
+	for _, name := range []string{"master", "migrations"} {
+		if body.Components[name]["status"] != "ok" {
+			t.Fatalf("%s must be ok, got %s", name, rec.Body.String())
+		}
+	}
+	for name, component := range body.Components {
+		for field := range component {
+			if field != "status" && field != "latency_ms" {
+				t.Fatalf("%s must only report status and latency, got %s", name, rec.Body.String())
+			}
+		}
+	}
+}
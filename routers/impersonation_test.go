@@ -0,0 +1,192 @@
+package routers
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"gin-boilerplate/infra/apperror"
+)
+
+type startedImpersonation struct {
+	AccessToken   string `json:"access_token"`
+	Impersonation struct {
+		ID         uint    `json:"id"`
+		AdminID    uint    `json:"admin_id"`
+		UserID     uint    `json:"user_id"`
+		AllowWrite bool    `json:"allow_write"`
+		EndedAt    *string `json:"ended_at"`
+	} `json:"impersonation"`
+}
+
+type systemLogEntry struct {
+	UserID          uint   `json:"user_id"`
+	ImpersonationID *uint  `json:"impersonation_id"`
+	ImpersonatorID  *uint  `json:"impersonator_id"`
+	OnBehalfOfID    *uint  `json:"on_behalf_of_id"`
+	Action          string `json:"action"`
+}
+
+// startImpersonation 系统管理员代登录 user，params 为额外的参数
+func startImpersonation(t *testing.T, s *testServer, f *orgFixture, user seededUser, params url.Values) (seededUser, startedImpersonation) {
+	t.Helper()
+	query := url.Values{"system_manager_id": {f.Admin.idParam()}, "user_id": {user.idParam()}, "reason": {"用户反馈看不到客户"}}
+	for k, v := range params {
+		query[k] = v
+	}
+	var started startedImpersonation
+	s.mustGet(t, "/api/v1/admin/startImpersonation", f.Admin, query).decode(t, &started)
+	return seededUser{ID: user.ID, Name: user.Name, Token: started.AccessToken}, started
+}
+
+func readSystemLogs(t *testing.T, s *testServer, f *orgFixture) []systemLogEntry {
+	t.Helper()
+	var logs []systemLogEntry
+	s.mustGet(t, "/api/v1/admin/readSystemLog", f.Admin, url.Values{"system_manager_id": {f.Admin.idParam()}}).decode(t, &logs)
+	return logs
+}
+
+// 只读的代登录可以看到用户看到的数据，不能修改数据，每个请求都记录在系统日志中
+func TestReadOnlyImpersonation(t *testing.T) {
+	s := newTestServer(t)
+	f := seedOrg(t, s)
+	customerID := createCustomer(t, s, f.Rep, "看不到的客户", "13900139000")
+	impersonated, started := startImpersonation(t, s, f, f.Rep, nil)
+	if started.Impersonation.AllowWrite || started.Impersonation.AdminID != f.Admin.ID {
+		t.Fatalf("unexpected impersonation %+v", started.Impersonation)
+	}
+
+	params := url.Values{"user_id": {f.Rep.idParam()}}
+	resp := s.mustGet(t, "/api/v1/sale/listCustomers", impersonated, params)
+	if !strings.Contains(string(resp.Data), "看不到的客户") {
+		t.Fatalf("impersonated list must show the rep's customers, got %s", resp.Data)
+	}
+	s.mustGet(t, "/api/v1/contract/getContractList", impersonated, params)
+	for _, path := range []string{"/api/v1/sale/createCustomer", "/api/v1/sale/revealCustomerPII"} {
+		resp := s.expectStatus(t, http.StatusForbidden, path, impersonated, url.Values{
+			"user_id": {f.Rep.idParam()}, "customer_id": {id(customerID)}, "customer_name": {"代建客户"}, "customer_phone": {"13900139001"},
+		})
+		if resp.Code != int(apperror.CodeImpersonationReadOnly) {
+			t.Fatalf("%s: got code %d", path, resp.Code)
+		}
+	}
+	// 修改密码等只能由用户本人操作
+	s.expectStatus(t, http.StatusForbidden, "/api/v1/me/notifications", impersonated, nil)
+	s.expectStatus(t, http.StatusForbidden, "/api/v1/admin/listAllUsers", impersonated, url.Values{"system_manager_id": {f.Rep.idParam()}})
+
+	// 查询写入的日志和每个请求（包括被拒绝的）的日志都标记为代登录
+	var requests []string
+	for _, log := range readSystemLogs(t, s, f) {
+		if log.ImpersonationID == nil {
+			continue
+		}
+		if *log.ImpersonationID != started.Impersonation.ID || log.ImpersonatorID == nil ||
+			*log.ImpersonatorID != f.Admin.ID || log.UserID != f.Rep.ID {
+			t.Fatalf("unexpected impersonated log %+v", log)
+		}
+		if strings.HasPrefix(log.Action, "代登录请求") {
+			requests = append(requests, log.Action)
+		}
+	}
+	if len(requests) != 6 || !strings.Contains(requests[0], "GET /api/v1/sale/listCustomers（200）") ||
+		!strings.Contains(requests[2], "GET /api/v1/sale/createCustomer（403）") {
+		t.Fatalf("every impersonated request must be logged, got %v", requests)
+	}
+
+	// 只能以被代登录的用户身份操作，不能通过 user_id 换成其他用户
+	for _, path := range []string{"/api/v1/sale/listCustomers", "/api/v1/contract/getContractList"} {
+		resp := s.expectStatus(t, http.StatusForbidden, path, impersonated, url.Values{"user_id": {f.Manager.idParam()}})
+		if resp.Code != int(apperror.CodeActorMismatch) {
+			t.Fatalf("%s as another user: got code %d", path, resp.Code)
+		}
+	}
+	// 登记的只读接口都可以访问
+	s.mustGet(t, "/api/v1/sale/getPublicSeaCustomerList", impersonated, params)
+	s.mustGet(t, "/api/v1/contract/getFinancialProducts", impersonated, params)
+
+	// 被代登录的用户收到通知
+	var notifications []struct {
+		Kind    string  `json:"kind"`
+		Message string  `json:"message"`
+		ReadAt  *string `json:"read_at"`
+	}
+	s.mustGet(t, "/api/v1/me/notifications", f.Rep, url.Values{"unread_only": {"true"}}).decode(t, &notifications)
+	if len(notifications) != 1 || notifications[0].Kind != "impersonation" ||
+		!strings.Contains(notifications[0].Message, "admin") || !strings.Contains(notifications[0].Message, "用户反馈看不到客户") {
+		t.Fatalf("unexpected notifications %+v", notifications)
+	}
+	s.mustGet(t, "/api/v1/me/notifications/read", f.Rep, nil)
+	s.mustGet(t, "/api/v1/me/notifications", f.Rep, url.Values{"unread_only": {"true"}}).decode(t, &notifications)
+	if len(notifications) != 0 {
+		t.Fatalf("notifications must be read, got %+v", notifications)
+	}
+
+	// 结束后令牌立即失效
+	s.mustGet(t, "/api/v1/admin/endImpersonation", f.Admin, url.Values{
+		"system_manager_id": {f.Admin.idParam()}, "impersonation_id": {id(started.Impersonation.ID)},
+	})
+	resp = s.expectStatus(t, http.StatusUnauthorized, "/api/v1/sale/listCustomers", impersonated, params)
+	if resp.Code != int(apperror.CodeImpersonationEnded) {
+		t.Fatalf("ended impersonation: got code %d", resp.Code)
+	}
+}
+
+// 可修改数据的代登录写入的系统日志同时记录代登录和系统管理员
+func TestWritableImpersonation(t *testing.T) {
+	s := newTestServer(t)
+	f := seedOrg(t, s)
+	impersonated, started := startImpersonation(t, s, f, f.Rep, url.Values{"allow_write": {"true"}, "minutes": {"10"}})
+	customerID := createCustomer(t, s, impersonated, "代建客户", "13900139000")
+
+	found := false
+	for _, log := range readSystemLogs(t, s, f) {
+		if strings.HasPrefix(log.Action, "新建客户") && strings.Contains(log.Action, " "+id(customerID)+" ") {
+			found = log.UserID == f.Rep.ID && log.ImpersonationID != nil && *log.ImpersonationID == started.Impersonation.ID &&
+				log.ImpersonatorID != nil && *log.ImpersonatorID == f.Admin.ID
+		}
+	}
+	if !found {
+		t.Fatal("customer created while impersonating must be attributed to the impersonation")
+	}
+
+	var impersonations []struct {
+		ID         uint `json:"id"`
+		AllowWrite bool `json:"allow_write"`
+	}
+	s.mustGet(t, "/api/v1/admin/listImpersonations", f.Admin, url.Values{"system_manager_id": {f.Admin.idParam()}}).decode(t, &impersonations)
+	if len(impersonations) != 1 || !impersonations[0].AllowWrite {
+		t.Fatalf("unexpected impersonations %+v", impersonations)
+	}
+}
+
+// 不能代登录系统管理员，有效期不能超过上限，只有系统管理员可以发起
+func TestImpersonationValidation(t *testing.T) {
+	s := newTestServer(t)
+	f := seedOrg(t, s)
+	base := url.Values{"system_manager_id": {f.Admin.idParam()}, "user_id": {f.Rep.idParam()}, "reason": {"排查问题"}}
+	for _, c := range []struct {
+		name  string
+		field string
+		value string
+		code  apperror.Code
+	}{
+		{"system manager", "user_id", f.Admin.idParam(), apperror.CodeImpersonationNotAllowed},
+		{"too long", "minutes", "1000", apperror.CodeInvalidParams},
+		{"missing reason", "reason", "", apperror.CodeInvalidParams},
+	} {
+		params := url.Values{}
+		for k, v := range base {
+			params[k] = v
+		}
+		params.Set(c.field, c.value)
+		resp := s.expectStatus(t, http.StatusBadRequest, "/api/v1/admin/startImpersonation", f.Admin, params)
+		if resp.Code != int(c.code) {
+			t.Fatalf("%s: got code %d, want %d", c.name, resp.Code, c.code)
+		}
+	}
+	s.expectStatus(t, http.StatusForbidden, "/api/v1/admin/startImpersonation", f.GeneralManager, base)
+	s.expectStatus(t, http.StatusNotFound, "/api/v1/admin/endImpersonation", f.Admin, url.Values{
+		"system_manager_id": {f.Admin.idParam()}, "impersonation_id": {"999"},
+	})
+}
@@ -1,7 +1,11 @@
 package routers
 
 import (
+	"gin-boilerplate/config"
 	"gin-boilerplate/controllers"
+	"gin-boilerplate/infra/apperror"
+	"gin-boilerplate/infra/metrics"
+	"gin-boilerplate/models"
 	"gin-boilerplate/routers/middleware"
 	"net/http"
 
@@ -9,83 +13,170 @@ import (
 )
 
 // RegisterRoutes add all routing list here automatically get main router
-func RegisterRoutes(route *gin.Engine) {
+func RegisterRoutes(route *gin.Engine, ctrl *controllers.Controller) {
 	route.NoRoute(func(ctx *gin.Context) {
-		ctx.JSON(http.StatusNotFound, gin.H{"status": http.StatusNotFound, "message": "Route Not Found"})
+		_ = ctx.Error(apperror.New(apperror.CodeRouteNotFound))
 	})
 	route.GET("/health", func(ctx *gin.Context) { ctx.JSON(http.StatusOK, gin.H{"live": "ok"}) })
+	route.GET("/livez", controllers.Livez)
+	route.GET("/readyz", controllers.Readyz)
+	route.GET("/.well-known/jwks.json", controllers.JWKS)
+	if metricsConfig := config.Get().Metrics; metricsConfig.Enabled {
+		route.GET("/metrics", middleware.MetricsAuthMiddleware(metricsConfig.Token), gin.WrapH(metrics.Handler()))
+	}
 
 	//Add All route
 	api_version := "/api/v1"
-	route.GET(api_version+"/register", controllers.UserRegister)
-	route.GET(api_version+"/login", controllers.UserLogin)
-	route.GET(api_version+"/updateUserProfile", controllers.UserUpdateProfile)
+	route.GET(api_version+"/register", ctrl.UserRegister)
+	route.GET(api_version+"/login", ctrl.UserLogin)
+	route.GET(api_version+"/login/verify", ctrl.UserVerifyLoginTOTP)
+	route.GET(api_version+"/token/refresh", ctrl.RefreshToken)
+	route.GET(api_version+"/sso/:provider/login", ctrl.SSOLogin)
+	route.GET(api_version+"/sso/:provider/callback", ctrl.SSOCallback)
+	route.GET(api_version+"/updateUserProfile", middleware.AuthenticatedMiddleware(), ctrl.UserUpdateProfile)
+
+	// 当前登录用户自己的账户，任何角色都可以访问
+	meGroup := route.Group(api_version+"/me", middleware.AuthenticatedMiddleware())
+	{
+		meGroup.GET("/password", ctrl.UserChangePassword)
+		// 两步验证
+		meGroup.GET("/totp/enroll", ctrl.UserStartTOTPEnrollment)
+		meGroup.GET("/totp/confirm", ctrl.UserConfirmTOTPEnrollment)
+		meGroup.GET("/totp/disable", ctrl.UserDisableTOTP)
+		meGroup.GET("/totp/recoveryCodes", ctrl.UserRegenerateRecoveryCodes)
+		// 登录会话和登录记录
+		meGroup.GET("/sessions", ctrl.UserListSessions)
+		meGroup.GET("/sessions/revoke", ctrl.UserRevokeSession)
+		meGroup.GET("/sessions/revokeOthers", ctrl.UserRevokeOtherSessions)
+		meGroup.GET("/loginHistory", ctrl.UserGetLoginHistory)
+		// 通知
+		meGroup.GET("/notifications", ctrl.UserListNotifications)
+		meGroup.GET("/notifications/read", ctrl.UserReadNotifications)
+		// 休假期间委托审批
+		meGroup.GET("/delegations", ctrl.UserListDelegations)
+		meGroup.GET("/delegations/create", ctrl.UserCreateDelegation)
+		meGroup.GET("/delegations/revoke", ctrl.UserRevokeDelegation)
+	}
 
-	// todo: not tested
 	// stats
-	route.GET(api_version+"/getSalerPerformance", controllers.GetSalerPerformance)
-	route.GET(api_version+"/getDepartmentPerformance", controllers.GetDepartmentPerformance)
-	route.GET(api_version+"/getZonePerformance", controllers.GetZonePerformance)
-	route.GET(api_version+"/getLoanAnalysis", controllers.LoanAnalysis)
+	route.GET(api_version+"/getSalerPerformance", ctrl.GetSalerPerformance)
+	route.GET(api_version+"/getDepartmentPerformance", ctrl.GetDepartmentPerformance)
+	route.GET(api_version+"/getZonePerformance", ctrl.GetZonePerformance)
+	route.GET(api_version+"/getLoanAnalysis", ctrl.LoanAnalysis)
 
-	// todo: not tested
 	// get methods for department and zone
-	route.GET(api_version+"/getDepartments", controllers.GetDepartments)
-	route.GET(api_version+"/getZones", controllers.GetZones)
-	route.GET(api_version+"/getDepartmentByID", controllers.GetDepartmentByID)
-	route.GET(api_version+"/getZoneByID", controllers.GetZoneByID)
+	// 部门可以通过 include=users 返回员工，需要登录
+	route.GET(api_version+"/getDepartments", middleware.AuthenticatedMiddleware(), ctrl.GetDepartments)
+	route.GET(api_version+"/getZones", ctrl.GetZones)
+	route.GET(api_version+"/getDepartmentByID", middleware.AuthenticatedMiddleware(), ctrl.GetDepartmentByID)
+	route.GET(api_version+"/getZoneByID", ctrl.GetZoneByID)
 
-	adminGroup := route.Group(api_version+"/admin", middleware.UserRoleAuthMiddleware([]string{"系统管理员"}))
+	adminGroup := route.Group(api_version+"/admin", middleware.PermissionAuthMiddleware(models.PermissionAdmin))
 	{
 		// user ops
-		adminGroup.GET("/updateUserBasicInfo", controllers.AdministratorUpdateUserNameOrPassword)
-		adminGroup.GET("/updateUserRole", controllers.AdministratorUpdateUserRole)
-		adminGroup.GET("/listAllUsers", controllers.AdministratorListAllUsers)
+		adminGroup.GET("/updateUserBasicInfo", ctrl.AdministratorUpdateUserNameOrPassword)
+		adminGroup.GET("/updateUserRole", ctrl.AdministratorUpdateUserRole)
+		adminGroup.GET("/listAllUsers", ctrl.AdministratorListAllUsers)
+		adminGroup.GET("/unlockUser", ctrl.AdministratorUnlockUser)
+		adminGroup.GET("/resetPassword", ctrl.AdministratorResetPassword)
+		adminGroup.GET("/resetTOTP", ctrl.AdministratorResetTOTP)
+		adminGroup.GET("/listUserSessions", ctrl.AdministratorListUserSessions)
+		adminGroup.GET("/revokeUserSession", ctrl.AdministratorRevokeUserSession)
+		adminGroup.GET("/loginHistory", ctrl.AdministratorGetLoginHistory)
+		// 以其他用户的身份登录排查问题
+		adminGroup.GET("/startImpersonation", ctrl.AdministratorStartImpersonation)
+		adminGroup.GET("/endImpersonation", ctrl.AdministratorEndImpersonation)
+		adminGroup.GET("/listImpersonations", ctrl.AdministratorListImpersonations)
+		// 审批委托
+		adminGroup.GET("/createDelegation", ctrl.AdministratorCreateDelegation)
+		adminGroup.GET("/listDelegations", ctrl.AdministratorListDelegations)
+		adminGroup.GET("/revokeDelegation", ctrl.AdministratorRevokeDelegation)
 		// zone & department ops
-		adminGroup.GET("/createZone", controllers.AdministratorCreateZone)
-		adminGroup.GET("/createDepartment", controllers.AdministratorCreateDepartment)
+		adminGroup.GET("/createZone", ctrl.AdministratorCreateZone)
+		adminGroup.GET("/createDepartment", ctrl.AdministratorCreateDepartment)
 
-		// todo: not tested
 		// admin assigning ops
-		adminGroup.GET("/assignDepartmentToZone", controllers.AdministratorAssignDepartmentToZone)
-		adminGroup.GET("/assignUserToDepartment", controllers.AdministratorAssignUserToDepartment)
-		adminGroup.GET("/assignUserToZone", controllers.AdministratorAssignUserToZone)
-		adminGroup.GET("/assignDirectorToZone", controllers.AdministratorAssignDirectorToZone)
-		adminGroup.GET("/assignManagerToDepartment", controllers.AdministratorAssignManagerToDepartment)
+		adminGroup.GET("/assignDepartmentToZone", ctrl.AdministratorAssignDepartmentToZone)
+		adminGroup.GET("/assignUserToDepartment", ctrl.AdministratorAssignUserToDepartment)
+		adminGroup.GET("/assignUserToZone", ctrl.AdministratorAssignUserToZone)
+		adminGroup.GET("/assignDirectorToZone", ctrl.AdministratorAssignDirectorToZone)
+		adminGroup.GET("/assignManagerToDepartment", ctrl.AdministratorAssignManagerToDepartment)
 
-		// todo: not tested
 		// read system log
-		adminGroup.GET("/readSystemLog", controllers.AdministratorQuerySystemLog)
+		adminGroup.GET("/readSystemLog", ctrl.AdministratorQuerySystemLog)
+		// 轮换敏感信息加密密钥
+		adminGroup.GET("/rotatePIIKeys", ctrl.AdministratorRotatePIIKeys)
+		// 脚本使用的 API 密钥
+		adminGroup.GET("/createAPIKey", ctrl.AdministratorCreateAPIKey)
+		adminGroup.GET("/listAPIKeys", ctrl.AdministratorListAPIKeys)
+		adminGroup.GET("/revokeAPIKey", ctrl.AdministratorRevokeAPIKey)
 	}
 
-	saleGroup := route.Group(api_version+"/sale", middleware.UserRoleAuthMiddleware([]string{"销售代表", "销售经理", "销售总监"}))
+	saleGroup := route.Group(api_version+"/sale", middleware.PermissionAuthMiddleware(models.PermissionSale))
 	{
-		// todo: not tested
 		// 管理客户
-		saleGroup.GET("/createCustomer", controllers.SaleCreateCustomer)
-		saleGroup.GET("/updateCustomer", controllers.SaleUpdateCustomer)
-		saleGroup.GET("/listCustomers", controllers.SaleListCustomers)
-		saleGroup.GET("/migrateCustomer", controllers.SaleMigrateCustomer)
-		saleGroup.GET("/getPublicSeaCustomerList", controllers.SaleGetPublicSeaCustomerList)
-		// todo: not tested
+		saleGroup.GET("/createCustomer", ctrl.SaleCreateCustomer)
+		saleGroup.GET("/updateCustomer", ctrl.SaleUpdateCustomer)
+		saleGroup.GET("/listCustomers", ctrl.SaleListCustomers)
+		saleGroup.GET("/migrateCustomer", ctrl.SaleMigrateCustomer)
+		saleGroup.GET("/getPublicSeaCustomerList", ctrl.SaleGetPublicSeaCustomerList)
+		saleGroup.GET("/findCustomerByPhone", ctrl.SaleFindCustomerByPhone)
+		saleGroup.GET("/revealCustomerPII", ctrl.RevealCustomerPII)
+		// 客户KYC资料
+		saleGroup.GET("/updateCustomerKYC", ctrl.SaleUpdateCustomerKYC)
+		saleGroup.GET("/addKYCDocument", ctrl.SaleAddKYCDocument)
+		saleGroup.GET("/getCustomerKYC", ctrl.GetCustomerKYC)
 		// 管理工作日志
-		saleGroup.GET("/createWorkLog", controllers.SaleCreateWorkLog)
+		saleGroup.GET("/createWorkLog", ctrl.SaleCreateWorkLog)
 		// 提交合同
-		saleGroup.GET("/submitContract", controllers.SaleSubmitContract)
+		saleGroup.GET("/submitContract", ctrl.SaleSubmitContract)
+	}
+
+	finanaceGroup := route.Group(api_version+"/finance", middleware.PermissionAuthMiddleware(models.PermissionFinance))
+	{
+		finanaceGroup.GET("/updateContractStatus", ctrl.FinanaceUpdateContractStatus)
+		finanaceGroup.GET("/updateContractAmount", ctrl.FinanaceUpdateContractAmount)
+		// 审核客户KYC资料
+		finanaceGroup.GET("/getCustomerKYC", ctrl.GetCustomerKYC)
+		finanaceGroup.GET("/revealCustomerPII", ctrl.RevealCustomerPII)
+		finanaceGroup.GET("/reviewCustomerKYC", ctrl.FinanceReviewCustomerKYC)
+		// 金融产品、放款和还款
+		finanaceGroup.GET("/createFinancialProduct", ctrl.FinanceCreateFinancialProduct)
+		finanaceGroup.GET("/recordDisbursement", ctrl.FinanceRecordDisbursement)
+		finanaceGroup.GET("/recordRepayment", ctrl.FinanceRecordRepayment)
+	}
+
+	commissionGroup := route.Group(api_version+"/commission", middleware.PermissionAuthMiddleware(models.PermissionCommission))
+	{
+		// 提成方案
+		commissionGroup.GET("/createPlan", ctrl.AccountantCreateCommissionPlan)
+		commissionGroup.GET("/getPlans", ctrl.AccountantGetCommissionPlans)
+		// 结算、审核、调整和锁定提成单
+		commissionGroup.GET("/settle", ctrl.AccountantSettleCommissions)
+		commissionGroup.GET("/getStatements", ctrl.AccountantGetCommissionStatements)
+		commissionGroup.GET("/getStatement", ctrl.AccountantGetCommissionStatement)
+		commissionGroup.GET("/adjustStatement", ctrl.AccountantAdjustCommissionStatement)
+		commissionGroup.GET("/lockStatement", ctrl.AccountantLockCommissionStatement)
 	}
 
-	finanaceGroup := route.Group(api_version+"/finance", middleware.UserRoleAuthMiddleware([]string{"金融专员", "金融经理"}))
+	reconciliationGroup := route.Group(api_version+"/reconciliation", middleware.PermissionAuthMiddleware(models.PermissionReconciliation))
 	{
-		finanaceGroup.GET("/updateContractStatus", controllers.FinanaceUpdateContractStatus)
-		finanaceGroup.GET("/updateContractAmount", controllers.FinanaceUpdateContractAmount)
+		// 确认银行金额和处理对账差异
+		reconciliationGroup.GET("/confirmBankAmount", ctrl.AccountantConfirmBankAmount)
+		reconciliationGroup.GET("/getItems", ctrl.AccountantGetReconciliationItems)
+		reconciliationGroup.GET("/resolveItem", ctrl.AccountantResolveReconciliationItem)
 	}
 
-	contractAccessGroup := route.Group(api_version+"/contract", middleware.UserRoleAuthMiddleware([]string{"销售代表", "销售经理", "销售总监", "总经理", "金融经理", "会计"}))
+	contractAccessGroup := route.Group(api_version+"/contract", middleware.PermissionAuthMiddleware(models.PermissionContract))
 	{
-		// todo: not tested
 		// 获取合同列表
-		contractAccessGroup.GET("/getContractList", controllers.GetContractList)
+		contractAccessGroup.GET("/getContractList", ctrl.GetContractList)
 		// 获取合同详情
-		contractAccessGroup.GET("/getContractDetail", controllers.GetContractDetail)
+		contractAccessGroup.GET("/getContractDetail", ctrl.GetContractDetail)
+		// 金融产品列表和合同的还款计划
+		contractAccessGroup.GET("/getFinancialProducts", ctrl.GetFinancialProducts)
+		contractAccessGroup.GET("/getRepaymentSchedule", ctrl.GetRepaymentSchedule)
+		// 合同金额的修改历史
+		contractAccessGroup.GET("/getAmountHistory", ctrl.GetContractAmountHistory)
 	}
 }
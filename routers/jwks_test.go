@@ -0,0 +1,172 @@
+package routers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"gin-boilerplate/config"
+	"gin-boilerplate/helpers"
+	"gin-boilerplate/infra/jwtkeys"
+
+	"github.com/golang-jwt/jwt"
+)
+
+// useKeyring 在测试期间使用 algorithm 和 keysDir 签发令牌，结束后恢复
+func useKeyring(t *testing.T, algorithm, keysDir string) *jwtkeys.Keyring {
+	t.Helper()
+	jwtConfig := &config.Get().JWT
+	previousAlgorithm, previousDir := jwtConfig.Algorithm, jwtConfig.KeysDir
+	previous, err := jwtkeys.Current()
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwtConfig.Algorithm, jwtConfig.KeysDir = algorithm, keysDir
+	keyring, err := jwtConfig.Keyring()
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwtkeys.Setup(keyring)
+	t.Cleanup(func() {
+		jwtConfig.Algorithm, jwtConfig.KeysDir = previousAlgorithm, previousDir
+		jwtkeys.Setup(previous)
+	})
+	return keyring
+}
+
+func (s *testServer) jwks(t *testing.T) jwtkeys.JSONWebKeySet {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil))
+	var set jwtkeys.JSONWebKeySet
+	if rec.Code != http.StatusOK || json.Unmarshal(rec.Body.Bytes(), &set) != nil {
+		t.Fatalf("jwks: got %d %s", rec.Code, rec.Body.String())
+	}
+	return set
+}
+
+func tokenKeyID(t *testing.T, token string) string {
+	t.Helper()
+	parsed, _, err := new(jwt.Parser).ParseUnverified(token, &helpers.Claims{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	kid, _ := parsed.Header["kid"].(string)
+	return kid
+}
+
+// 只接受配置的签名算法、本服务的 iss 和 aud
+func TestTokenVerificationRejectsUnexpectedClaims(t *testing.T) {
+	s := newTestServer(t)
+	f := seedOrg(t, s)
+	jwtConfig := config.Get().JWT
+	session := seedSession(t, s, f.Rep.ID)
+
+	sign := func(method jwt.SigningMethod, key interface{}, issuer, audience string) string {
+		t.Helper()
+		token, err := jwt.NewWithClaims(method, &helpers.Claims{
+			UserID:    f.Rep.ID,
+			UserName:  f.Rep.Name,
+			UserRole:  "销售代表",
+			SessionID: session.SessionID,
+			StandardClaims: jwt.StandardClaims{
+				Issuer:    issuer,
+				Audience:  audience,
+				ExpiresAt: time.Now().Add(time.Hour).Unix(),
+			},
+		}).SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	secret := []byte(jwtConfig.Secret)
+	cases := []struct {
+		name  string
+		token string
+		want  int
+	}{
+		{"valid", sign(jwt.SigningMethodHS256, secret, jwtConfig.Issuer, jwtConfig.Audience), http.StatusOK},
+		{"other hmac algorithm", sign(jwt.SigningMethodHS512, secret, jwtConfig.Issuer, jwtConfig.Audience), http.StatusUnauthorized},
+		{"alg none", sign(jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, jwtConfig.Issuer, jwtConfig.Audience), http.StatusUnauthorized},
+		{"wrong issuer", sign(jwt.SigningMethodHS256, secret, "someone-else", jwtConfig.Audience), http.StatusUnauthorized},
+		{"wrong audience", sign(jwt.SigningMethodHS256, secret, jwtConfig.Issuer, "another-api"), http.StatusUnauthorized},
+		{"no issuer or audience", sign(jwt.SigningMethodHS256, secret, "", ""), http.StatusUnauthorized},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			s.expectStatus(t, c.want, "/api/v1/sale/listCustomers", seededUser{Token: c.token}, url.Values{"user_id": {f.Rep.idParam()}})
+		})
+	}
+	// 共享密钥不能公开
+	if keys := s.jwks(t).Keys; len(keys) != 0 {
+		t.Fatalf("HS256 must not publish keys, got %+v", keys)
+	}
+}
+
+// 轮换后新令牌使用新密钥，旧令牌在旧密钥删除前仍然有效
+func TestAsymmetricKeyRotation(t *testing.T) {
+	for _, algorithm := range []string{"RS256", "EdDSA"} {
+		t.Run(algorithm, func(t *testing.T) {
+			dir := t.TempDir()
+			now := time.Now()
+			oldKID, err := jwtkeys.GenerateKey(algorithm, dir, now.Add(-time.Hour))
+			if err != nil {
+				t.Fatal(err)
+			}
+			keyring := useKeyring(t, algorithm, dir)
+			s := newTestServer(t)
+			f := seedOrg(t, s)
+			params := url.Values{"user_id": {f.Rep.idParam()}}
+			if kid := tokenKeyID(t, f.Rep.Token); kid != oldKID {
+				t.Fatalf("token kid %q, want %q", kid, oldKID)
+			}
+			s.mustGet(t, "/api/v1/sale/listCustomers", f.Rep, params)
+
+			newKID, err := jwtkeys.GenerateKey(algorithm, dir, now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := keyring.Reload(); err != nil {
+				t.Fatal(err)
+			}
+			var login struct {
+				AccessToken string `json:"access_token"`
+			}
+			s.mustGet(t, "/api/v1/login", seededUser{}, url.Values{"username": {"rep"}, "password": {seedPassword}}).decode(t, &login)
+			if kid := tokenKeyID(t, login.AccessToken); kid != newKID {
+				t.Fatalf("token kid after rotation %q, want %q", kid, newKID)
+			}
+			s.mustGet(t, "/api/v1/sale/listCustomers", seededUser{Token: login.AccessToken}, params)
+			s.mustGet(t, "/api/v1/sale/listCustomers", f.Rep, params)
+			set := s.jwks(t)
+			if len(set.Keys) != 2 || set.Keys[0].Kid != newKID || set.Keys[0].Alg != algorithm {
+				t.Fatalf("unexpected jwks %+v", set)
+			}
+
+			// 使用共享密钥签名的令牌不能冒充非对称签名
+			forged, err := jwt.NewWithClaims(jwt.SigningMethodHS256, &helpers.Claims{
+				UserID: f.Rep.ID, UserName: f.Rep.Name, UserRole: "销售代表",
+				StandardClaims: jwt.StandardClaims{Issuer: config.Get().JWT.Issuer, Audience: config.Get().JWT.Audience, ExpiresAt: now.Add(time.Hour).Unix()},
+			}).SignedString([]byte(config.Get().JWT.Secret))
+			if err != nil {
+				t.Fatal(err)
+			}
+			s.expectStatus(t, http.StatusUnauthorized, "/api/v1/sale/listCustomers", seededUser{Token: forged}, params)
+
+			// 旧密钥被替换的时间超过保留期后删除，旧令牌失效
+			pruned, err := jwtkeys.Prune(dir, 30*time.Minute, now.Add(time.Hour))
+			if err != nil || len(pruned) != 1 || pruned[0] != oldKID {
+				t.Fatalf("prune: %v %v", pruned, err)
+			}
+			if err := keyring.Reload(); err != nil {
+				t.Fatal(err)
+			}
+			s.expectStatus(t, http.StatusUnauthorized, "/api/v1/sale/listCustomers", f.Rep, params)
+			s.mustGet(t, "/api/v1/sale/listCustomers", seededUser{Token: login.AccessToken}, params)
+		})
+	}
+}
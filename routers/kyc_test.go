@@ -0,0 +1,123 @@
+package routers
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"gin-boilerplate/infra/apperror"
+)
+
+// 符合 GB 11643-1999 校验码的身份证号码
+const testNationalID = "11010519491231002X"
+
+type kycProfileData struct {
+	CustomerID    uint   `json:"customer_id"`
+	NationalID    string `json:"national_id"`
+	MonthlyIncome string `json:"monthly_income"`
+	MaritalStatus uint   `json:"marital_status"`
+	Status        uint   `json:"status"`
+	ReviewNote    string `json:"review_note"`
+	Documents     []struct {
+		Kind string `json:"kind"`
+		File string `json:"file"`
+	} `json:"documents"`
+}
+
+func kycParams(saler seededUser, customerID uint) url.Values {
+	return url.Values{
+		"user_id": {saler.idParam()}, "customer_id": {id(customerID)}, "national_id": {testNationalID},
+		"occupation": {"个体工商户"}, "monthly_income": {"30000"}, "assets": {"2000000"}, "existing_debts": {"0"},
+		"marital_status": {"已婚"},
+	}
+}
+
+// verifyKYC 销售人员填写客户的KYC资料，金融经理认证
+func verifyKYC(t *testing.T, s *testServer, f *orgFixture, saler seededUser, customerID uint) {
+	t.Helper()
+	s.mustGet(t, "/api/v1/sale/updateCustomerKYC", saler, kycParams(saler, customerID))
+	s.mustGet(t, "/api/v1/finance/reviewCustomerKYC", f.FinanceManager, url.Values{
+		"user_id": {f.FinanceManager.idParam()}, "customer_id": {id(customerID)}, "status": {"已认证"},
+	})
+}
+
+func TestCustomerKYC(t *testing.T) {
+	s := newTestServer(t)
+	f := seedOrg(t, s)
+	customerID := createCustomer(t, s, f.Rep, "KYC客户", "13800000001")
+	contract := submitContract(t, s, f, f.Rep, customerID, "100000")
+	approve := func() apiResponse {
+		return s.get(t, "/api/v1/finance/updateContractStatus", f.FinanceManager.Token, url.Values{
+			"user_id": {f.FinanceManager.idParam()}, "contract_id": {id(contract.ID)}, "status": {"已批准"},
+		})
+	}
+
+	// 没有KYC资料时不能批准
+	if resp := approve(); resp.Status != http.StatusConflict || resp.Code != int(apperror.CodeCustomerKYCNotVerified) {
+		t.Fatalf("approve without kyc: got %d/%d", resp.Status, resp.Code)
+	}
+
+	// 只有客户当前的销售人员可以填写
+	s.expectStatus(t, http.StatusForbidden, "/api/v1/sale/updateCustomerKYC", f.Rep2, kycParams(f.Rep2, customerID))
+
+	var profile kycProfileData
+	s.mustGet(t, "/api/v1/sale/updateCustomerKYC", f.Rep, kycParams(f.Rep, customerID)).decode(t, &profile)
+	if profile.NationalID != "110105********002X" || profile.MonthlyIncome != "30000" || profile.MaritalStatus != 1 || profile.Status != 0 {
+		t.Fatalf("unexpected kyc profile %+v", profile)
+	}
+	s.mustGet(t, "/api/v1/sale/addKYCDocument", f.Rep, url.Values{
+		"user_id": {f.Rep.idParam()}, "customer_id": {id(customerID)}, "kind": {"征信报告"}, "file": {"credit.pdf"},
+	}).decode(t, &profile)
+	if len(profile.Documents) != 1 || profile.Documents[0].File != "credit.pdf" {
+		t.Fatalf("unexpected kyc documents %+v", profile.Documents)
+	}
+
+	// 待审核时不能批准，拒绝后也不能
+	if resp := approve(); resp.Status != http.StatusConflict {
+		t.Fatalf("approve with pending kyc: got %d", resp.Status)
+	}
+	s.mustGet(t, "/api/v1/finance/reviewCustomerKYC", f.Finance, url.Values{
+		"user_id": {f.Finance.idParam()}, "customer_id": {id(customerID)}, "status": {"已拒绝"}, "note": {"收入证明缺失"},
+	}).decode(t, &profile)
+	if profile.Status != 2 || profile.ReviewNote != "收入证明缺失" {
+		t.Fatalf("unexpected rejected profile %+v", profile)
+	}
+	if resp := approve(); resp.Status != http.StatusConflict {
+		t.Fatalf("approve with rejected kyc: got %d", resp.Status)
+	}
+	s.expectStatus(t, http.StatusBadRequest, "/api/v1/finance/reviewCustomerKYC", f.Finance, url.Values{
+		"user_id": {f.Finance.idParam()}, "customer_id": {id(customerID)}, "status": {"待审核"},
+	})
+
+	verifyKYC(t, s, f, f.Rep, customerID)
+	if resp := approve(); resp.Status != http.StatusOK {
+		t.Fatalf("approve with verified kyc: got %d", resp.Status)
+	}
+
+	// 查看权限：本人、本部门经理、本战区总监和金融人员可以查看，其他部门不行
+	for _, viewer := range []struct {
+		path string
+		user seededUser
+		want int
+	}{
+		{"/api/v1/sale/getCustomerKYC", f.Rep, http.StatusOK},
+		{"/api/v1/sale/getCustomerKYC", f.Manager, http.StatusOK},
+		{"/api/v1/sale/getCustomerKYC", f.Director, http.StatusOK},
+		{"/api/v1/finance/getCustomerKYC", f.Finance, http.StatusOK},
+		{"/api/v1/sale/getCustomerKYC", f.Rep2, http.StatusForbidden},
+		{"/api/v1/sale/getCustomerKYC", f.OtherManager, http.StatusForbidden},
+	} {
+		resp := s.get(t, viewer.path, viewer.user.Token, url.Values{
+			"user_id": {viewer.user.idParam()}, "customer_id": {id(customerID)},
+		})
+		if resp.Status != viewer.want {
+			t.Fatalf("%s as %s: got %d, want %d", viewer.path, viewer.user.Name, resp.Status, viewer.want)
+		}
+		if viewer.want == http.StatusOK {
+			resp.decode(t, &profile)
+			if profile.NationalID != "110105********002X" || profile.Status != 1 {
+				t.Fatalf("unexpected profile for %s: %+v", viewer.user.Name, profile)
+			}
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package routers
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"gin-boilerplate/infra/apperror"
+)
+
+type installmentData struct {
+	Period     int       `json:"period"`
+	DueDate    time.Time `json:"due_date"`
+	Principal  string    `json:"principal"`
+	Interest   string    `json:"interest"`
+	Amount     string    `json:"amount"`
+	PaidAmount string    `json:"paid_amount"`
+	Status     uint      `json:"status"`
+}
+
+type scheduleData struct {
+	Disbursement struct {
+		Amount         string `json:"amount"`
+		ExpectedAmount string `json:"expected_amount"`
+		Bank           string `json:"bank"`
+	} `json:"disbursement"`
+	Shortfall    string            `json:"shortfall"`
+	Installments []installmentData `json:"installments"`
+}
+
+// createApprovedContract 创建使用指定金融产品的合同并审批通过
+func createApprovedContract(t *testing.T, s *testServer, f *orgFixture, product, phone string) contractData {
+	t.Helper()
+	customerID := createCustomer(t, s, f.Rep, "贷款客户", phone)
+	var contract contractData
+	s.mustGet(t, "/api/v1/sale/submitContract", f.Rep, url.Values{
+		"user_id": {f.Rep.idParam()}, "customer_id": {id(customerID)},
+		"finance_id": {f.Finance.idParam()}, "accountant_id": {f.Accountant.idParam()},
+		"amount": {"120000"}, "service_fee": {"1000"}, "bank_amount": {"120000"}, "financial_product": {product},
+	}).decode(t, &contract)
+	verifyKYC(t, s, f, f.Rep, customerID)
+	s.mustGet(t, "/api/v1/finance/updateContractStatus", f.FinanceManager, url.Values{
+		"user_id": {f.FinanceManager.idParam()}, "contract_id": {id(contract.ID)}, "status": {"已批准"},
+	})
+	return contract
+}
+
+func TestFinancialProducts(t *testing.T) {
+	s := newTestServer(t)
+	f := seedOrg(t, s)
+
+	product := url.Values{"name": {"经营贷"}, "term_months": {"12"}, "annual_rate": {"0.06"}, "repayment_method": {"等额本息"}}
+	product.Set("user_id", f.Finance.idParam())
+	s.expectStatus(t, http.StatusForbidden, "/api/v1/finance/createFinancialProduct", f.Finance, product)
+	product.Set("user_id", f.FinanceManager.idParam())
+	s.mustGet(t, "/api/v1/finance/createFinancialProduct", f.FinanceManager, product)
+	s.expectStatus(t, http.StatusConflict, "/api/v1/finance/createFinancialProduct", f.FinanceManager, product)
+	product.Set("annual_rate", "1.5")
+	s.expectStatus(t, http.StatusBadRequest, "/api/v1/finance/createFinancialProduct", f.FinanceManager, product)
+
+	var products []struct {
+		Name       string `json:"name"`
+		TermMonths int    `json:"term_months"`
+		AnnualRate string `json:"annual_rate"`
+	}
+	s.mustGet(t, "/api/v1/contract/getFinancialProducts", f.Rep, nil).decode(t, &products)
+	if len(products) != 1 || products[0].Name != "经营贷" || products[0].TermMonths != 12 || products[0].AnnualRate != "0.06" {
+		t.Fatalf("unexpected products %+v", products)
+	}
+}
+
+func TestDisbursementAndRepayment(t *testing.T) {
+	s := newTestServer(t)
+	f := seedOrg(t, s)
+
+	for _, product := range []url.Values{
+		{"name": {"经营贷"}, "term_months": {"12"}, "annual_rate": {"0.06"}, "repayment_method": {"等额本息"}},
+		{"name": {"消费贷"}, "term_months": {"12"}, "annual_rate": {"0.06"}, "repayment_method": {"等额本金"}},
+	} {
+		product.Set("user_id", f.FinanceManager.idParam())
+		s.mustGet(t, "/api/v1/finance/createFinancialProduct", f.FinanceManager, product)
+	}
+
+	// 放款日期在75天前，前两期已经到期
+	disbursedAt := time.Now().AddDate(0, 0, -75).UTC().Format(time.RFC3339)
+	disburse := func(contractID uint) apiResponse {
+		return s.get(t, "/api/v1/finance/recordDisbursement", f.Finance.Token, url.Values{
+			"user_id": {f.Finance.idParam()}, "contract_id": {id(contractID)},
+			"bank": {"工商银行"}, "amount": {"100000"}, "disbursed_at": {disbursedAt},
+		})
+	}
+
+	// 未批准的合同不能放款
+	pending := submitContract(t, s, f, f.Rep, createCustomer(t, s, f.Rep, "待审批客户", "13800000009"), "50000")
+	if resp := disburse(pending.ID); resp.Code != int(apperror.CodeContractNotApproved) {
+		t.Fatalf("disburse pending contract: got %d/%d", resp.Status, resp.Code)
+	}
+	// 合同的金融产品不存在
+	unknown := createApprovedContract(t, s, f, "不存在的产品", "13800000008")
+	if resp := disburse(unknown.ID); resp.Code != int(apperror.CodeFinancialProductNotFound) {
+		t.Fatalf("disburse contract without product: got %d/%d", resp.Status, resp.Code)
+	}
+	s.expectStatus(t, http.StatusConflict, "/api/v1/contract/getRepaymentSchedule", f.Rep, url.Values{
+		"user_id": {f.Rep.idParam()}, "contract_id": {id(unknown.ID)},
+	})
+
+	contract := createApprovedContract(t, s, f, "经营贷", "13800000001")
+	var schedule scheduleData
+	resp := disburse(contract.ID)
+	if resp.Status != http.StatusOK {
+		t.Fatalf("disburse: got %d (%s)", resp.Status, resp.Message)
+	}
+	resp.decode(t, &schedule)
+	if schedule.Disbursement.Amount != "100000" || schedule.Disbursement.ExpectedAmount != "120000" || schedule.Shortfall != "20000" {
+		t.Fatalf("unexpected disbursement %+v", schedule.Disbursement)
+	}
+	// 等额本息：10万元，年利率6%，12期，月供8606.64
+	if len(schedule.Installments) != 12 {
+		t.Fatalf("got %d installments, want 12", len(schedule.Installments))
+	}
+	first, last := schedule.Installments[0], schedule.Installments[11]
+	if first.Amount != "8606.64" || first.Interest != "500" || first.Principal != "8106.64" {
+		t.Fatalf("unexpected first installment %+v", first)
+	}
+	if last.Period != 12 || last.Principal != "8563.87" || last.Interest != "42.82" || last.Amount != "8606.69" {
+		t.Fatalf("unexpected last installment %+v", last)
+	}
+	if resp := disburse(contract.ID); resp.Code != int(apperror.CodeContractAlreadyDisbursed) {
+		t.Fatalf("second disbursement: got %d/%d", resp.Status, resp.Code)
+	}
+
+	// 等额本金：每期本金8333.33，最后一期补足尾差
+	equalPrincipal := createApprovedContract(t, s, f, "消费贷", "13800000002")
+	disburse(equalPrincipal.ID).decode(t, &schedule)
+	first, last = schedule.Installments[0], schedule.Installments[11]
+	if first.Principal != "8333.33" || first.Interest != "500" || last.Principal != "8333.37" || last.Interest != "41.67" {
+		t.Fatalf("unexpected equal principal schedule %+v ... %+v", first, last)
+	}
+
+	// 还款10000：第一期还清，第二期部分还款
+	repay := func(amount string) apiResponse {
+		return s.get(t, "/api/v1/finance/recordRepayment", f.Finance.Token, url.Values{
+			"user_id": {f.Finance.idParam()}, "contract_id": {id(contract.ID)},
+			"amount": {amount}, "paid_at": {time.Now().UTC().Format(time.RFC3339)},
+		})
+	}
+	if resp := repay("10000"); resp.Status != http.StatusOK {
+		t.Fatalf("repay: got %d (%s)", resp.Status, resp.Message)
+	}
+	if resp := repay("1000000"); resp.Code != int(apperror.CodeRepaymentExceedsOutstanding) {
+		t.Fatalf("overpay: got %d/%d", resp.Status, resp.Code)
+	}
+
+	// 每日任务把到期未还清的分期标记为逾期
+	if err := s.repos.Loans.AutoFlagOverdueInstallments(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	s.mustGet(t, "/api/v1/contract/getRepaymentSchedule", f.Rep, url.Values{
+		"user_id": {f.Rep.idParam()}, "contract_id": {id(contract.ID)},
+	}).decode(t, &schedule)
+	want := []struct {
+		paid   string
+		status uint
+	}{{"8606.64", 1}, {"1393.36", 2}, {"0", 0}}
+	for i, w := range want {
+		got := schedule.Installments[i]
+		if got.PaidAmount != w.paid || got.Status != w.status {
+			t.Fatalf("installment %d: got %s/%d, want %s/%d", got.Period, got.PaidAmount, got.Status, w.paid, w.status)
+		}
+	}
+}
+
+// 月末放款时，较短月份的应还日期为该月最后一天，各期都按放款日期计算，不会逐期漂移
+func TestRepaymentDueDatesAtMonthEnd(t *testing.T) {
+	s := newTestServer(t)
+	f := seedOrg(t, s)
+	s.mustGet(t, "/api/v1/finance/createFinancialProduct", f.FinanceManager, url.Values{
+		"user_id": {f.FinanceManager.idParam()}, "name": {"经营贷"}, "term_months": {"12"},
+		"annual_rate": {"0.06"}, "repayment_method": {"等额本息"},
+	})
+
+	contract := createApprovedContract(t, s, f, "经营贷", "13800000001")
+	var schedule scheduleData
+	s.mustGet(t, "/api/v1/finance/recordDisbursement", f.Finance, url.Values{
+		"user_id": {f.Finance.idParam()}, "contract_id": {id(contract.ID)}, "bank": {"工商银行"},
+		"amount": {"100000"}, "disbursed_at": {"2024-01-31T00:00:00Z"},
+	}).decode(t, &schedule)
+	want := []string{"2024-02-29", "2024-03-31", "2024-04-30", "2024-05-31", "2024-06-30", "2024-07-31",
+		"2024-08-31", "2024-09-30", "2024-10-31", "2024-11-30", "2024-12-31", "2025-01-31"}
+	if len(schedule.Installments) != len(want) {
+		t.Fatalf("got %d installments, want %d", len(schedule.Installments), len(want))
+	}
+	for i, installment := range schedule.Installments {
+		if got := installment.DueDate.UTC().Format("2006-01-02"); got != want[i] {
+			t.Fatalf("installment %d: due %s, want %s", installment.Period, got, want[i])
+		}
+	}
+}
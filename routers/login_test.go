@@ -0,0 +1,186 @@
+package routers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"gin-boilerplate/config"
+	"gin-boilerplate/infra/apperror"
+	"gin-boilerplate/infra/ratelimit"
+	"gin-boilerplate/models"
+	"gin-boilerplate/repository"
+	"gin-boilerplate/routers/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 同一用户名连续密码错误后需要等待，达到次数后锁定，系统管理员可以解锁
+func TestLoginLockout(t *testing.T) {
+	s := newTestServer(t)
+	f := seedOrg(t, s)
+	login := config.Get().Login
+	wrong := url.Values{"username": {"rep"}, "password": {"wrong1234"}}
+	right := url.Values{"username": {"rep"}, "password": {seedPassword}}
+	// 跳过等待时间，模拟上一次密码错误已经过去很久
+	skipDelay := func() {
+		t.Helper()
+		if err := s.db.Model(&models.User{}).Where("id = ?", f.Rep.ID).
+			Update("last_failed_login_at", time.Now().Add(-time.Hour)).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i := 0; i < login.DelayAfter; i++ {
+		s.expectStatus(t, http.StatusUnauthorized, "/api/v1/login", seededUser{}, wrong)
+	}
+	// 达到 LOGIN_DELAY_AFTER 后，即使密码正确也要等待
+	resp := s.expectStatus(t, http.StatusTooManyRequests, "/api/v1/login", seededUser{}, right)
+	if resp.Code != int(apperror.CodeLoginThrottled) || resp.Header.Get("Retry-After") == "" {
+		t.Fatalf("throttled login: got code %d, Retry-After %q", resp.Code, resp.Header.Get("Retry-After"))
+	}
+
+	for i := login.DelayAfter + 1; i < login.LockoutAfter; i++ {
+		skipDelay()
+		s.expectStatus(t, http.StatusUnauthorized, "/api/v1/login", seededUser{}, wrong)
+	}
+	skipDelay()
+	resp = s.expectStatus(t, http.StatusLocked, "/api/v1/login", seededUser{}, wrong)
+	if resp.Code != int(apperror.CodeAccountLocked) {
+		t.Fatalf("lockout: got code %d", resp.Code)
+	}
+	resp = s.expectStatus(t, http.StatusLocked, "/api/v1/login", seededUser{}, right)
+	if retryAfter, _ := strconv.Atoi(resp.Header.Get("Retry-After")); retryAfter <= 0 || retryAfter > int(login.LockoutDuration/time.Second) {
+		t.Fatalf("locked login: unexpected Retry-After %q", resp.Header.Get("Retry-After"))
+	}
+
+	// 只有系统管理员可以解锁
+	s.expectStatus(t, http.StatusForbidden, "/api/v1/admin/unlockUser", f.Rep, url.Values{
+		"system_manager_id": {f.Rep.idParam()}, "user_id": {f.Rep.idParam()},
+	})
+	var unlocked struct {
+		LockedUntil *time.Time `json:"locked_until"`
+	}
+	s.mustGet(t, "/api/v1/admin/unlockUser", f.Admin, url.Values{
+		"system_manager_id": {f.Admin.idParam()}, "user_id": {f.Rep.idParam()},
+	}).decode(t, &unlocked)
+	if unlocked.LockedUntil != nil {
+		t.Fatalf("user still locked until %s", unlocked.LockedUntil)
+	}
+	s.mustGet(t, "/api/v1/login", seededUser{}, right)
+
+	var locks int64
+	s.db.Model(&models.SystemLog{}).Where("user_id = ? AND action LIKE ?", f.Rep.ID, "%账户锁定至%").Count(&locks)
+	if locks != 1 {
+		t.Fatalf("lockout should be logged once, got %d", locks)
+	}
+}
+
+// 同时提交的错误密码都计入错误次数，不会因为读到旧的次数而互相覆盖
+func TestConcurrentLoginFailuresLockAccount(t *testing.T) {
+	s := newTestServer(t)
+	f := seedOrg(t, s)
+	policy := repository.LoginPolicy{DelayAfter: 100, LockoutAfter: 5, LockoutDuration: time.Minute}
+
+	var wg sync.WaitGroup
+	for i := 0; i < policy.LockoutAfter; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _ = s.repos.Users.Login(context.Background(), "rep", "wrong1234", policy)
+		}()
+	}
+	wg.Wait()
+
+	var user models.User
+	if err := s.db.First(&user, f.Rep.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if user.LockedUntil == nil || user.FailedLogins != 0 {
+		t.Fatalf("%d concurrent failures must lock the account: locked until %v, %d failures", policy.LockoutAfter, user.LockedUntil, user.FailedLogins)
+	}
+	var locks int64
+	s.db.Model(&models.SystemLog{}).Where("user_id = ? AND action LIKE ?", f.Rep.ID, "%账户锁定至%").Count(&locks)
+	if locks != 1 {
+		t.Fatalf("lockout should be logged once, got %d", locks)
+	}
+}
+
+// 同一客户端IP登录失败次数过多时，即使换用户名也会被拒绝
+func TestLoginIPThrottling(t *testing.T) {
+	s := newTestServer(t)
+	seedOrg(t, s)
+	maxFailures := int(config.Get().Login.IPMaxFailures)
+
+	for i := 0; i < maxFailures; i++ {
+		s.expectStatus(t, http.StatusUnauthorized, "/api/v1/login", seededUser{}, url.Values{
+			"username": {"nobody" + strconv.Itoa(i)}, "password": {"wrong1234"},
+		})
+	}
+	resp := s.expectStatus(t, http.StatusTooManyRequests, "/api/v1/login", seededUser{}, url.Values{
+		"username": {"rep"}, "password": {seedPassword},
+	})
+	if resp.Code != int(apperror.CodeLoginThrottled) {
+		t.Fatalf("throttled ip: got code %d", resp.Code)
+	}
+}
+
+// 限流中间件在内存和 Redis 上的行为一致，设置 TEST_REDIS_ADDR（如 localhost:6379）时测试 Redis
+func TestRateLimitMiddleware(t *testing.T) {
+	stores := map[string]func(t *testing.T) ratelimit.Store{
+		"memory": func(t *testing.T) ratelimit.Store { return ratelimit.NewMemoryStore() },
+		"redis": func(t *testing.T) ratelimit.Store {
+			addr := os.Getenv("TEST_REDIS_ADDR")
+			if addr == "" {
+				t.Skip("TEST_REDIS_ADDR is not set")
+			}
+			store := ratelimit.NewRedisStore(addr, "", 0)
+			if err := store.Ping(context.Background()); err != nil {
+				t.Skipf("redis at %s is not available: %s", addr, err)
+			}
+			t.Cleanup(func() { store.Close() })
+			return store
+		},
+	}
+	for name, newStore := range stores {
+		t.Run(name, func(t *testing.T) {
+			store := newStore(t)
+			// 每次运行使用不同的路由，避免 Redis 中残留上一次的计数
+			limited := "/limited/" + strconv.FormatInt(time.Now().UnixNano(), 10)
+			router := gin.New()
+			router.Use(middleware.ErrorMiddleware())
+			router.Use(middleware.RateLimitMiddleware(store, map[string]config.RateLimitRule{
+				limited:                      {Limit: 2, Window: time.Minute},
+				config.DefaultRateLimitRoute: {Limit: 100, Window: time.Minute},
+			}))
+			ok := func(ctx *gin.Context) { ctx.Status(http.StatusNoContent) }
+			router.GET(limited, ok)
+			router.GET("/other", ok)
+
+			request := func(path string) *httptest.ResponseRecorder {
+				rec := httptest.NewRecorder()
+				router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+				return rec
+			}
+			for i, want := range []int{http.StatusNoContent, http.StatusNoContent, http.StatusTooManyRequests} {
+				if rec := request(limited); rec.Code != want {
+					t.Fatalf("request %d: got %d, want %d", i+1, rec.Code, want)
+				}
+			}
+			rec := request(limited)
+			if retryAfter, _ := strconv.Atoi(rec.Header().Get("Retry-After")); retryAfter <= 0 || retryAfter > 60 {
+				t.Fatalf("unexpected Retry-After %q", rec.Header().Get("Retry-After"))
+			}
+			// 其他路由使用默认规则，不受影响
+			if rec := request("/other"); rec.Code != http.StatusNoContent || rec.Header().Get("X-RateLimit-Limit") != "100" {
+				t.Fatalf("default rule: got %d, limit %q", rec.Code, rec.Header().Get("X-RateLimit-Limit"))
+			}
+		})
+	}
+}
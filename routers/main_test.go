@@ -0,0 +1,127 @@
+package routers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gin-boilerplate/config"
+	"gin-boilerplate/infra/database"
+	"gin-boilerplate/infra/jwtkeys"
+	"gin-boilerplate/infra/logger"
+	"gin-boilerplate/infra/pii"
+	"gin-boilerplate/migrations"
+	"gin-boilerplate/repository"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// 端到端测试使用 SQLite，不依赖 Postgres，在任意 Linux 机器上都可以直接 go test
+func TestMain(m *testing.M) {
+	err := config.SetupConfig([]string{
+		"--config", filepath.Join("testdata", "test.env"),
+	})
+	if err != nil {
+		panic(err)
+	}
+	if err := logger.Setup(config.Get().Log.Level, config.Get().Log.Format); err != nil {
+		panic(err)
+	}
+	active, keys, err := config.Get().PII.Keys()
+	if err != nil {
+		panic(err)
+	}
+	if err := pii.Setup(active, keys, []byte(config.Get().PII.BlindIndexKey)); err != nil {
+		panic(err)
+	}
+	keyring, err := config.Get().JWT.Keyring()
+	if err != nil {
+		panic(err)
+	}
+	jwtkeys.Setup(keyring)
+	os.Exit(m.Run())
+}
+
+// testServer 在一个独立的 SQLite 数据库上运行完整的 HTTP API
+type testServer struct {
+	router *gin.Engine
+	db     *gorm.DB
+	repos  *repository.Repositories
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+	db, err := database.SQLiteConnection(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("open sqlite: %s", err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	if err := migrations.Migrate(db); err != nil {
+		t.Fatalf("migrate: %s", err)
+	}
+	repos := repository.NewGormRepositories(db)
+	return &testServer{router: SetupRoute(repos), db: db, repos: repos}
+}
+
+// apiResponse 对应 controllers.Response，Data 保留原始 JSON 以便按需解析
+type apiResponse struct {
+	Status  int             `json:"-"`
+	Header  http.Header     `json:"-"`
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// get 以 query 参数发送 GET 请求，token 为空时不携带令牌
+func (s *testServer) get(t *testing.T, path, token string, params url.Values) apiResponse {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, path+"?"+params.Encode(), nil)
+	if token != "" {
+		req.Header.Set("Authorization", token)
+	}
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, req)
+
+	resp := apiResponse{Status: rec.Code, Header: rec.Header()}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("GET %s: invalid json %q: %s", path, rec.Body.String(), err)
+	}
+	return resp
+}
+
+// mustGet 以 user 的身份发送请求，要求返回200
+func (s *testServer) mustGet(t *testing.T, path string, user seededUser, params url.Values) apiResponse {
+	t.Helper()
+	resp := s.get(t, path, user.Token, params)
+	if resp.Status != http.StatusOK {
+		t.Fatalf("GET %s: got %d (%s), want 200", path, resp.Status, resp.Message)
+	}
+	return resp
+}
+
+// expectStatus 以 user 的身份发送请求，要求返回指定状态码
+func (s *testServer) expectStatus(t *testing.T, want int, path string, user seededUser, params url.Values) apiResponse {
+	t.Helper()
+	resp := s.get(t, path, user.Token, params)
+	if resp.Status != want {
+		t.Fatalf("GET %s: got %d (%s), want %d", path, resp.Status, resp.Message, want)
+	}
+	return resp
+}
+
+// decode 把响应中的 Data 解析到 v
+func (r apiResponse) decode(t *testing.T, v interface{}) {
+	t.Helper()
+	if err := json.Unmarshal(r.Data, v); err != nil {
+		t.Fatalf("decode data %s: %s", r.Data, err)
+	}
+}
@@ -0,0 +1,42 @@
+package routers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"gin-boilerplate/infra/metrics"
+)
+
+// 重复注册数据库和业务指标（例如重新连接数据库）时替换之前的注册，抓取结果来自最新的数据来源
+func TestMetricsRegistration(t *testing.T) {
+	first := newTestServer(t)
+	s := newTestServer(t)
+	f := seedOrg(t, s)
+	submitContract(t, s, f, f.Rep, createCustomer(t, s, f.Rep, "指标客户", "13800000001"), "100000")
+
+	for _, server := range []*testServer{first, s} {
+		if err := metrics.RegisterDB(server.db, "test"); err != nil {
+			t.Fatalf("register db metrics: %s", err)
+		}
+		if err := metrics.RegisterBusiness(server.repos.Stats); err != nil {
+			t.Fatalf("register business metrics: %s", err)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("scrape: got %d: %s", rec.Code, rec.Body.String())
+	}
+	body := rec.Body.String()
+	for _, want := range []string{
+		`gin_backend_business_contracts{status="新建"} 1`,
+		`go_sql_open_connections{db_name="test"}`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Fatalf("scrape must contain %s, got:\n%s", want, body)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package middleware
+
+import (
+	"strconv"
+	"time"
+
+	"gin-boilerplate/config"
+	"gin-boilerplate/helpers"
+	"gin-boilerplate/infra/apperror"
+	"gin-boilerplate/infra/logger"
+	"gin-boilerplate/infra/ratelimit"
+	"gin-boilerplate/models"
+	"gin-boilerplate/repository"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 脚本通过该请求头传入 API 密钥，代替 Authorization 中的令牌
+const APIKeyHeader = "X-API-Key"
+
+// 通过验证的 API 密钥对应的声明以该键保存在 gin.Context 中，由鉴权中间件读取
+const apiKeyClaimsKey = "api_key_claims"
+
+// API 密钥中间件，请求带有 X-API-Key 时验证密钥并按密钥限流，没有时直接放行，由后续的鉴权中间件验证令牌
+// 验证通过后接口以密钥所属用户的身份处理请求，写入的系统日志记录密钥ID
+func APIKeyMiddleware(keys repository.APIKeyRepo, store ratelimit.Store, apiKeyConfig config.APIKeyConfiguration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		plaintext := c.GetHeader(APIKeyHeader)
+		if plaintext == "" {
+			c.Next()
+			return
+		}
+		key, owner, err := keys.AuthenticateAPIKey(c, plaintext, time.Now())
+		if err != nil {
+			AbortWithError(c, err)
+			return
+		}
+
+		limit := key.RateLimit
+		if limit <= 0 {
+			limit = apiKeyConfig.RateLimit
+		}
+		// 计数存储不可用时与 RateLimitMiddleware 一样放行
+		count, ttl, err := store.Incr(c, "apikey:"+strconv.FormatUint(uint64(key.ID), 10), apiKeyConfig.RateLimitWindow)
+		if err != nil {
+			logger.FromContext(c).Warnf("rate limit store unavailable: %s", err)
+		} else {
+			remaining := limit - count
+			if remaining < 0 {
+				remaining = 0
+			}
+			c.Header("X-RateLimit-Limit", strconv.FormatInt(limit, 10))
+			c.Header("X-RateLimit-Remaining", strconv.FormatInt(remaining, 10))
+			if count > limit {
+				AbortWithError(c, apperror.New(apperror.CodeTooManyRequests).WithRetryAfter(ttl))
+				return
+			}
+		}
+
+		c.Request = c.Request.WithContext(repository.ContextWithAPIKey(c.Request.Context(), key.ID))
+		c.Set(apiKeyClaimsKey, &helpers.Claims{
+			UserID:       owner.ID,
+			UserName:     owner.UserName,
+			UserRole:     models.RoleNameMap[owner.RoleID],
+			APIKeyID:     key.ID,
+			APIKeyScopes: key.Scopes,
+		})
+		c.Next()
+	}
+}
@@ -1,76 +1,163 @@
 package middleware
 
 import (
-	"net/http"
-	"strings"
+	"fmt"
+	"strconv"
 
-	"gin-boilerplate/config"
 	"gin-boilerplate/helpers"
+	"gin-boilerplate/infra/apperror"
 	"gin-boilerplate/models"
 
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt"
 )
 
+// 通过鉴权后，令牌中的声明以该键保存在 gin.Context 中
+const ClaimsKey = "claims"
+
 func IsStringInMap(str string, m map[string]models.RoleID) bool {
 	_, exists := m[str]
 	return exists
 }
 
 // 用户角色验证中间件，满足给定条件的才可以修改个人信息
+// 不能使用 API 密钥访问，需要支持 API 密钥的接口使用 PermissionAuthMiddleware
 func UserRoleAuthMiddleware(allowed_roles []string) gin.HandlerFunc {
+	return roleAuthMiddleware(allowed_roles, "")
+}
+
+// 权限验证中间件，拥有该权限的角色可以访问；使用 API 密钥时，密钥的 scopes 还必须包含该权限
+func PermissionAuthMiddleware(permission models.Permission) gin.HandlerFunc {
+	roles, ok := models.PermissionRoles[permission]
+	if !ok {
+		panic("unknown permission: " + string(permission))
+	}
+	return roleAuthMiddleware(roles, permission)
+}
+
+func roleAuthMiddleware(allowed_roles []string, permission models.Permission) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// 所有role必须在model中给出
 		for _, role := range allowed_roles {
 			if !IsStringInMap(role, models.RoleStrToEnumMap) {
-				c.JSON(http.StatusBadRequest, gin.H{"error": "角色验证中间件被指派了无效的角色"})
-				c.Abort()
+				AbortWithError(c, fmt.Errorf("角色验证中间件被指派了无效的角色: %s", role))
 				return
 			}
 		}
 
-		// 从请求头中获取令牌
-		tokenString := c.GetHeader("Authorization")
-		// 验证令牌
-		if tokenString == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "请求未携带令牌"})
-			c.Abort()
+		claims, err := parseAccessToken(c)
+		if err != nil {
+			AbortWithError(c, err)
 			return
 		}
+		// 角色必须与允许的角色完全一致（刷新令牌不含角色，不能用于访问接口）
+		if !isRoleAllowed(claims.UserRole, allowed_roles) {
+			AbortWithError(c, apperror.New(apperror.CodeForbidden).WithDetails(gin.H{
+				"role":          claims.UserRole,
+				"allowed_roles": allowed_roles,
+			}))
+			return
+		}
+		// API 密钥只能访问 scopes 中的接口
+		if claims.APIKeyID != 0 && (permission == "" || !claims.APIKeyScopes.Has(permission)) {
+			AbortWithError(c, apperror.New(apperror.CodeForbidden).WithDetails(gin.H{
+				"scope":  permission,
+				"scopes": claims.APIKeyScopes.List(),
+			}))
+			return
+		}
+		// 请求中的操作人必须是令牌对应的用户，API 密钥、代登录令牌和普通令牌都不能冒充其他用户
+		if err := checkActor(c, claims, permission); err != nil {
+			AbortWithError(c, err)
+			return
+		}
+		// 使用临时密码登录后，修改密码前不能访问其他接口
+		if claims.MustChangePassword {
+			AbortWithError(c, apperror.New(apperror.CodePasswordChangeRequired))
+			return
+		}
+		// 必须使用两步验证的角色，绑定前不能访问其他接口
+		if claims.MFAEnrollmentRequired {
+			AbortWithError(c, apperror.New(apperror.CodeMFAEnrollmentRequired))
+			return
+		}
+		// 继续处理请求
+		c.Set(ClaimsKey, claims)
+		c.Next()
+	}
+}
 
-		// 解析令牌
-		token, err := jwt.ParseWithClaims(tokenString, &helpers.Claims{}, func(token *jwt.Token) (interface{}, error) {
-			return []byte(config.JWTSecret()), nil
-		})
-
-		// 检查错误
+// 登录用户访问自己账户的中间件，任何角色都可以访问，需要修改密码或绑定两步验证时也可以访问
+func AuthenticatedMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, err := parseAccessToken(c)
 		if err != nil {
-			// 如果错误是过期错误，则返回特定的过期响应
-			if ve, ok := err.(*jwt.ValidationError); ok && ve.Errors&jwt.ValidationErrorExpired != 0 {
-				c.JSON(http.StatusUnauthorized, gin.H{"error": "令牌已过期"})
-				c.Abort()
-				return
-			} else {
-				c.JSON(http.StatusUnauthorized, gin.H{"error": "无效的令牌"})
-				c.Abort()
-				return
-			}
+			AbortWithError(c, err)
+			return
+		}
+		if claims.UserRole == "" {
+			AbortWithError(c, apperror.New(apperror.CodeUnauthorized))
+			return
+		}
+		// 修改密码、两步验证等只能由用户本人操作，不能使用 API 密钥或代登录
+		if claims.APIKeyID != 0 || claims.ImpersonationID != 0 {
+			AbortWithError(c, apperror.New(apperror.CodeForbidden))
+			return
 		}
+		c.Set(ClaimsKey, claims)
+		c.Next()
+	}
+}
 
-		// 验证令牌是否有效
-		allowed_roles_str := strings.Join(allowed_roles, ",")
-		if claims, ok := token.Claims.(*helpers.Claims); ok && token.Valid {
-			// 检查用户角色是否尚未分配角色
-			if !strings.Contains(allowed_roles_str, claims.UserRole) {
-				c.JSON(http.StatusForbidden, gin.H{"error": "当前角色" + claims.UserRole + "无权访问该组路由, 当前路由组允许的角色为: " + allowed_roles_str})
-				c.Abort()
-				return
-			}
-			// 继续处理请求
-			c.Next()
-		} else {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "无效的令牌"})
-			c.Abort()
+// parseAccessToken 从请求头中读取并验证令牌，返回其中的声明
+// 已经通过 APIKeyMiddleware 验证 API 密钥时，返回密钥所属用户的声明；SessionMiddleware 已经验证过令牌时直接使用其结果
+func parseAccessToken(c *gin.Context) (*helpers.Claims, error) {
+	if claims, ok := c.Get(apiKeyClaimsKey); ok {
+		return claims.(*helpers.Claims), nil
+	}
+	if verified, ok := c.Get(accessTokenKey); ok {
+		token := verified.(accessToken)
+		if token.err != nil {
+			return nil, token.err
+		}
+		return token.claims, nil
+	}
+	// 从请求头中获取令牌
+	tokenString := c.GetHeader("Authorization")
+	// 验证令牌
+	if tokenString == "" {
+		return nil, apperror.New(apperror.CodeUnauthorized)
+	}
+
+	// 解析并验证令牌
+	claims := &helpers.Claims{}
+	if err := helpers.ParseToken(tokenString, claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// checkActor 操作人总是令牌中的用户，控制器不再读取操作人参数（管理员接口为 system_manager_id，其他接口为 user_id）；
+// 为兼容旧的客户端参数可以不传，传了但与令牌中的用户不一致（包括格式错误）时拒绝
+func checkActor(c *gin.Context, claims *helpers.Claims, permission models.Permission) error {
+	param := "user_id"
+	if permission == models.PermissionAdmin {
+		param = "system_manager_id"
+	}
+	value, ok := c.GetQuery(param)
+	if !ok {
+		return nil
+	}
+	if actorID, err := strconv.ParseUint(value, 10, 64); err == nil && uint(actorID) == claims.UserID {
+		return nil
+	}
+	return apperror.New(apperror.CodeActorMismatch).WithDetails(gin.H{param: value})
+}
+
+func isRoleAllowed(role string, allowed_roles []string) bool {
+	for _, allowed := range allowed_roles {
+		if role == allowed {
+			return true
 		}
 	}
+	return false
 }
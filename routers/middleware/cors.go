@@ -2,7 +2,6 @@ package middleware
 
 import (
 	"github.com/gin-gonic/gin"
-	"log"
 )
 
 func CORSMiddleware() gin.HandlerFunc {
@@ -16,7 +15,6 @@ func CORSMiddleware() gin.HandlerFunc {
 		ctx.Writer.Header().Set("Cache-Control", "no-cache")
 
 		if ctx.Request.Method == "OPTIONS" {
-			log.Println("OPTIONS")
 			ctx.AbortWithStatus(200)
 		} else {
 			ctx.Next()
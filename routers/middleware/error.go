@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+
+	"gin-boilerplate/infra/apperror"
+	"gin-boilerplate/infra/logger"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 错误处理中间件，把处理过程中通过 ctx.Error 记录的最后一个错误统一输出为
+// {"code": 业务错误码, "message": 按 Accept-Language 选择的提示, "data": 详细信息}
+func ErrorMiddleware() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ctx.Next()
+
+		if len(ctx.Errors) == 0 || ctx.Writer.Written() {
+			return
+		}
+		appErr := apperror.From(ctx.Errors.Last().Err)
+		if appErr.Code.Status() >= http.StatusInternalServerError {
+			logger.FromContext(ctx).Errorf("%s %s: %s", ctx.Request.Method, routeLabel(ctx), appErr)
+		}
+		renderError(ctx, appErr)
+	}
+}
+
+// AbortWithError 中断请求并交给 ErrorMiddleware 输出错误，用于中间件
+func AbortWithError(ctx *gin.Context, err error) {
+	_ = ctx.Error(err)
+	ctx.Abort()
+}
+
+func renderError(ctx *gin.Context, appErr *apperror.Error) {
+	lang := apperror.Language(ctx.GetHeader("Accept-Language"))
+	if appErr.RetryAfter > 0 {
+		ctx.Header("Retry-After", strconv.FormatInt(appErr.RetryAfterSeconds(), 10))
+	}
+	ctx.JSON(appErr.Code.Status(), gin.H{
+		"code":    appErr.Code,
+		"message": appErr.Code.Message(lang),
+		"data":    appErr.Details,
+	})
+}
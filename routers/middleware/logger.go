@@ -0,0 +1,70 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"time"
+
+	"gin-boilerplate/helpers"
+	"gin-boilerplate/infra/apperror"
+	"gin-boilerplate/infra/logger"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 请求日志中间件，记录耗时、状态码、用户ID和路由模板
+func RequestLoggerMiddleware() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		start := time.Now()
+		ctx.Next()
+
+		route := routeLabel(ctx)
+		fields := logger.Fields{
+			"method":     ctx.Request.Method,
+			"route":      route,
+			"status":     ctx.Writer.Status(),
+			"latency_ms": float64(time.Since(start).Microseconds()) / 1000,
+			"client_ip":  ctx.ClientIP(),
+		}
+		if claims, ok := ctx.Get(ClaimsKey); ok {
+			fields["user_id"] = claims.(*helpers.Claims).UserID
+		}
+		entry := logger.FromContext(ctx).WithFields(map[string]interface{}(fields))
+		if len(ctx.Errors) > 0 {
+			entry = entry.WithField("errors", ctx.Errors.String())
+		}
+
+		msg := fmt.Sprintf("%s %s", ctx.Request.Method, route)
+		switch status := ctx.Writer.Status(); {
+		case status >= http.StatusInternalServerError:
+			entry.Error(msg)
+		case status >= http.StatusBadRequest:
+			entry.Warn(msg)
+		default:
+			entry.Info(msg)
+		}
+	}
+}
+
+// 返回路由模板（例如 /api/v1/sale/createCustomer），未匹配到路由时返回固定值，避免记录任意路径
+func routeLabel(ctx *gin.Context) string {
+	if route := ctx.FullPath(); route != "" {
+		return route
+	}
+	return "<no route>"
+}
+
+// 异常恢复中间件，panic 时记录堆栈并返回500
+func RecoveryMiddleware() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		defer func() {
+			if r := recover(); r != nil {
+				logger.FromContext(ctx).WithField("stack", string(debug.Stack())).Errorf("panic recovered: %v", r)
+				ctx.Abort()
+				renderError(ctx, apperror.New(apperror.CodeInternal))
+			}
+		}()
+		ctx.Next()
+	}
+}
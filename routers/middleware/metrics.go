@@ -0,0 +1,36 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"time"
+
+	"gin-boilerplate/infra/apperror"
+	"gin-boilerplate/infra/metrics"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 请求指标中间件，按路由模板和状态码统计请求数和耗时
+func MetricsMiddleware() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		start := time.Now()
+		ctx.Next()
+		metrics.ObserveHTTPRequest(ctx.Request.Method, routeLabel(ctx), ctx.Writer.Status(), time.Since(start))
+	}
+}
+
+// /metrics 鉴权中间件，token 为空时不校验（仅允许在调试模式下为空）
+func MetricsAuthMiddleware(token string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if token == "" {
+			ctx.Next()
+			return
+		}
+		expected := "Bearer " + token
+		if subtle.ConstantTimeCompare([]byte(ctx.GetHeader("Authorization")), []byte(expected)) != 1 {
+			AbortWithError(ctx, apperror.New(apperror.CodeUnauthorized))
+			return
+		}
+		ctx.Next()
+	}
+}
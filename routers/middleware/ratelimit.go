@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"strconv"
+
+	"gin-boilerplate/config"
+	"gin-boilerplate/infra/apperror"
+	"gin-boilerplate/infra/logger"
+	"gin-boilerplate/infra/ratelimit"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 限流中间件，按路由模板和客户端IP计数，路由没有单独的规则时使用 "*" 规则，都没有时不限流
+// 计数存储不可用时只记录日志并放行，避免 Redis 故障导致整个服务不可用
+func RateLimitMiddleware(store ratelimit.Store, rules map[string]config.RateLimitRule) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		route := ctx.FullPath()
+		rule, ok := rules[route]
+		if !ok {
+			rule, ok = rules[config.DefaultRateLimitRoute]
+			route = config.DefaultRateLimitRoute
+		}
+		if !ok {
+			ctx.Next()
+			return
+		}
+		count, ttl, err := store.Incr(ctx, "route:"+route+":"+ctx.ClientIP(), rule.Window)
+		if err != nil {
+			logger.FromContext(ctx).Warnf("rate limit store unavailable: %s", err)
+			ctx.Next()
+			return
+		}
+		remaining := rule.Limit - count
+		if remaining < 0 {
+			remaining = 0
+		}
+		ctx.Header("X-RateLimit-Limit", strconv.FormatInt(rule.Limit, 10))
+		ctx.Header("X-RateLimit-Remaining", strconv.FormatInt(remaining, 10))
+		if count > rule.Limit {
+			AbortWithError(ctx, apperror.New(apperror.CodeTooManyRequests).WithRetryAfter(ttl))
+			return
+		}
+		ctx.Next()
+	}
+}
@@ -0,0 +1,15 @@
+package middleware
+
+import (
+	"gin-boilerplate/infra/database"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 读写一致性中间件，请求中写入数据后，同一请求内的后续读取都走主库
+func ReadYourWritesMiddleware() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ctx.Request = ctx.Request.WithContext(database.WithReadYourWrites(ctx.Request.Context()))
+		ctx.Next()
+	}
+}
@@ -0,0 +1,41 @@
+package middleware
+
+import (
+	"time"
+
+	"gin-boilerplate/helpers"
+	"gin-boilerplate/infra/apperror"
+	"gin-boilerplate/repository"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 会话中间件验证过的访问令牌以该键保存在 gin.Context 中，鉴权中间件不再重复验证
+const accessTokenKey = "access_token"
+
+type accessToken struct {
+	claims *helpers.Claims
+	err    error
+}
+
+// 会话中间件，请求带有令牌时检查令牌所属的会话仍然有效，并更新会话的最近访问时间
+// 会话撤销或过期时由后续的鉴权中间件拒绝请求，不需要登录的接口不受影响
+// 访问令牌必须属于会话，只有代登录令牌例外（由代登录记录控制有效期）
+func SessionMiddleware(sessions repository.SessionRepo) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tokenString := c.GetHeader("Authorization")
+		if _, ok := c.Get(apiKeyClaimsKey); ok || tokenString == "" {
+			c.Next()
+			return
+		}
+		claims := &helpers.Claims{}
+		err := helpers.ParseToken(tokenString, claims)
+		if err == nil && claims.SessionID != "" {
+			err = sessions.TouchSession(c, claims.SessionID, time.Now())
+		} else if err == nil && claims.UserRole != "" && claims.ImpersonationID == 0 {
+			err = apperror.New(apperror.CodeUnauthorized)
+		}
+		c.Set(accessTokenKey, accessToken{claims: claims, err: err})
+		c.Next()
+	}
+}
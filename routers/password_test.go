@@ -0,0 +1,160 @@
+package routers
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"gin-boilerplate/controllers"
+	"gin-boilerplate/infra/apperror"
+	"gin-boilerplate/models"
+)
+
+// 密码策略：允许空格和中文，按配置检查长度、字符种类和常见密码，不满足的规则放在 param 中
+func TestPasswordPolicy(t *testing.T) {
+	s := newTestServer(t)
+
+	s.mustGet(t, "/api/v1/register", seededUser{}, url.Values{
+		"username": {"alice"}, "password": {"correct horse 电池 staple and more"},
+	})
+
+	cases := []struct {
+		name       string
+		password   string
+		violations string
+	}{
+		{"too short", "ab12", "min_length"},
+		{"single class", "abcdefghij", "classes"},
+		{"common password", "Password123", "common"},
+		{"too long", strings.Repeat("a1", 37), "max_length"},
+		{"control character", "abcd\t1234", "invalid_characters"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			resp := s.expectStatus(t, http.StatusBadRequest, "/api/v1/register", seededUser{}, url.Values{
+				"username": {"bob"}, "password": {c.password},
+			})
+			var fieldErrors []controllers.FieldError
+			resp.decode(t, &fieldErrors)
+			if len(fieldErrors) != 1 || fieldErrors[0].Rule != "password" || fieldErrors[0].Param != c.violations {
+				t.Fatalf("got field errors %+v, want password/%s", fieldErrors, c.violations)
+			}
+		})
+	}
+}
+
+// 用户验证当前密码后修改自己的密码，不能与最近使用过的密码相同
+func TestChangePassword(t *testing.T) {
+	s := newTestServer(t)
+	f := seedOrg(t, s)
+	change := func(current, next string) url.Values {
+		return url.Values{"current_password": {current}, "new_password": {next}}
+	}
+
+	s.expectStatus(t, http.StatusUnauthorized, "/api/v1/me/password", seededUser{}, change(seedPassword, "rep-secret-1"))
+	resp := s.expectStatus(t, http.StatusBadRequest, "/api/v1/me/password", f.Rep, change("wrong1234", "rep-secret-1"))
+	if resp.Code != int(apperror.CodeWrongCurrentPassword) {
+		t.Fatalf("wrong current password: got code %d", resp.Code)
+	}
+
+	// 依次修改两次后，之前使用过的密码都不能再用
+	s.mustGet(t, "/api/v1/me/password", f.Rep, change(seedPassword, "rep-secret-1"))
+	var changed struct {
+		AccessToken string `json:"access_token"`
+	}
+	s.mustGet(t, "/api/v1/me/password", f.Rep, change("rep-secret-1", "rep-secret-2")).decode(t, &changed)
+	if changed.AccessToken == "" {
+		t.Fatal("changing the password should return a new access token")
+	}
+	for _, reused := range []string{"rep-secret-2", "rep-secret-1"} {
+		resp := s.expectStatus(t, http.StatusBadRequest, "/api/v1/me/password", f.Rep, change("rep-secret-2", reused))
+		if resp.Code != int(apperror.CodePasswordReused) {
+			t.Fatalf("reusing %q: got code %d", reused, resp.Code)
+		}
+	}
+
+	s.expectStatus(t, http.StatusUnauthorized, "/api/v1/login", seededUser{}, url.Values{"username": {"rep"}, "password": {seedPassword}})
+	s.mustGet(t, "/api/v1/login", seededUser{}, url.Values{"username": {"rep"}, "password": {"rep-secret-2"}})
+
+	// 系统管理员只修改用户名时不会改动密码
+	s.mustGet(t, "/api/v1/admin/updateUserBasicInfo", f.Admin, url.Values{
+		"system_manager_id": {f.Admin.idParam()}, "user_id": {f.Rep.idParam()}, "username": {"repnew"},
+	})
+	s.mustGet(t, "/api/v1/login", seededUser{}, url.Values{"username": {"repnew"}, "password": {"rep-secret-2"}})
+}
+
+// 系统管理员重置密码后，用户使用临时密码登录，修改密码前只能访问 /me 接口
+func TestAdminResetPassword(t *testing.T) {
+	s := newTestServer(t)
+	f := seedOrg(t, s)
+	reset := func() string {
+		t.Helper()
+		var result struct {
+			User              controllers.UserDTO `json:"user"`
+			TemporaryPassword string              `json:"temporary_password"`
+		}
+		s.mustGet(t, "/api/v1/admin/resetPassword", f.Admin, url.Values{
+			"system_manager_id": {f.Admin.idParam()}, "user_id": {f.Rep.idParam()},
+		}).decode(t, &result)
+		if !result.User.MustChangePassword || result.User.PasswordExpiresAt == nil || result.TemporaryPassword == "" {
+			t.Fatalf("unexpected reset result %+v", result)
+		}
+		return result.TemporaryPassword
+	}
+	type loginResult struct {
+		User        controllers.UserDTO `json:"user"`
+		AccessToken string              `json:"access_token"`
+	}
+
+	s.expectStatus(t, http.StatusForbidden, "/api/v1/admin/resetPassword", f.Rep, url.Values{
+		"system_manager_id": {f.Rep.idParam()}, "user_id": {f.Rep.idParam()},
+	})
+	s.mustGet(t, "/api/v1/me/password", f.Rep, url.Values{"current_password": {seedPassword}, "new_password": {"rep-old-secret"}})
+	temporary := reset()
+	s.expectStatus(t, http.StatusUnauthorized, "/api/v1/login", seededUser{}, url.Values{"username": {"rep"}, "password": {"rep-old-secret"}})
+
+	var login loginResult
+	s.mustGet(t, "/api/v1/login", seededUser{}, url.Values{"username": {"rep"}, "password": {temporary}}).decode(t, &login)
+	if !login.User.MustChangePassword {
+		t.Fatal("login with a temporary password should require a password change")
+	}
+	restricted := seededUser{ID: f.Rep.ID, Token: login.AccessToken}
+	resp := s.expectStatus(t, http.StatusForbidden, "/api/v1/sale/listCustomers", restricted, url.Values{"user_id": {f.Rep.idParam()}})
+	if resp.Code != int(apperror.CodePasswordChangeRequired) {
+		t.Fatalf("restricted token: got code %d", resp.Code)
+	}
+
+	// 重置前使用的密码仍然不能再用
+	resp = s.expectStatus(t, http.StatusBadRequest, "/api/v1/me/password", restricted, url.Values{
+		"current_password": {temporary}, "new_password": {"rep-old-secret"},
+	})
+	if resp.Code != int(apperror.CodePasswordReused) {
+		t.Fatalf("reused password: got code %d", resp.Code)
+	}
+	s.mustGet(t, "/api/v1/me/password", restricted, url.Values{
+		"current_password": {temporary}, "new_password": {"rep-new-secret"},
+	}).decode(t, &login)
+	if login.User.MustChangePassword {
+		t.Fatal("password change should clear must_change_password")
+	}
+	s.mustGet(t, "/api/v1/sale/listCustomers", seededUser{ID: f.Rep.ID, Token: login.AccessToken}, url.Values{"user_id": {f.Rep.idParam()}})
+
+	// 过期的临时密码不能登录
+	temporary = reset()
+	if err := s.db.Model(&models.User{}).Where("id = ?", f.Rep.ID).
+		Update("password_expires_at", time.Now().Add(-time.Minute)).Error; err != nil {
+		t.Fatal(err)
+	}
+	resp = s.expectStatus(t, http.StatusUnauthorized, "/api/v1/login", seededUser{}, url.Values{"username": {"rep"}, "password": {temporary}})
+	if resp.Code != int(apperror.CodeTemporaryPasswordExpired) {
+		t.Fatalf("expired temporary password: got code %d", resp.Code)
+	}
+
+	var resets int64
+	s.db.Model(&models.SystemLog{}).Where("user_id = ? AND action LIKE ?", f.Admin.ID, "%重置用户%").Count(&resets)
+	if resets != 2 {
+		t.Fatalf("password resets should be logged, got %d", resets)
+	}
+}
@@ -0,0 +1,222 @@
+package routers
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"gin-boilerplate/config"
+	"gin-boilerplate/controllers"
+	"gin-boilerplate/infra/apperror"
+	"gin-boilerplate/infra/pii"
+	"gin-boilerplate/migrations"
+	"gin-boilerplate/models"
+)
+
+// usePIIKey 临时用配置中的另一个密钥加密，模拟轮换前写入的数据
+func usePIIKey(t *testing.T, active string) {
+	t.Helper()
+	piiConfig := config.Get().PII
+	current, keys, err := piiConfig.Keys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pii.Setup(active, keys, []byte(piiConfig.BlindIndexKey)); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := pii.Setup(current, keys, []byte(piiConfig.BlindIndexKey)); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+// rawCustomerColumn 不经过解密直接读取数据库中的值
+func rawCustomerColumn(t *testing.T, s *testServer, customerID uint, column string) string {
+	t.Helper()
+	var value string
+	if err := s.db.Table("customers").Where("id = ?", customerID).Select(column).Row().Scan(&value); err != nil {
+		t.Fatal(err)
+	}
+	return value
+}
+
+func TestCustomerPIIEncryptionAndMasking(t *testing.T) {
+	s := newTestServer(t)
+	f := seedOrg(t, s)
+	customerID := createCustomer(t, s, f.Rep, "张三", "13812341234")
+	s.mustGet(t, "/api/v1/sale/updateCustomer", f.Rep, url.Values{
+		"user_id": {f.Rep.idParam()}, "customer_id": {id(customerID)}, "customer_name": {"张三"},
+		"customer_phone": {"13812341234"}, "customer_address": {"上海市浦东新区世纪大道100号"},
+	})
+
+	// 数据库中只有密文
+	for _, column := range []string{"phone", "address"} {
+		if raw := rawCustomerColumn(t, s, customerID, column); !strings.HasPrefix(raw, "enc:k2:") || strings.Contains(raw, "1234") {
+			t.Fatalf("%s is not encrypted: %q", column, raw)
+		}
+	}
+
+	// 电话通过盲索引去重
+	resp := s.get(t, "/api/v1/sale/createCustomer", f.Rep2.Token, url.Values{
+		"user_id": {f.Rep2.idParam()}, "customer_name": {"张三"}, "customer_phone": {"13812341234"},
+	})
+	if resp.Status != http.StatusConflict || resp.Code != int(apperror.CodeCustomerPhoneExists) {
+		t.Fatalf("duplicate phone: got %d/%d", resp.Status, resp.Code)
+	}
+
+	// 客户的销售人员看到完整信息，经理看到脱敏后的信息
+	if got := listCustomers(t, s, f.Rep); got[0].Phone != "13812341234" || got[0].Address != "上海市浦东新区世纪大道100号" {
+		t.Fatalf("saler should see full details: %+v", got[0])
+	}
+	if got := listCustomers(t, s, f.Manager); got[0].Phone != "138****1234" || got[0].Address != "上海市浦东新****" {
+		t.Fatalf("manager should see masked details: %+v", got[0])
+	}
+	// 只能更新权限范围内的客户，经理更新后返回的也是脱敏后的信息
+	resp = s.get(t, "/api/v1/sale/updateCustomer", f.OtherRep.Token, url.Values{
+		"user_id": {f.OtherRep.idParam()}, "customer_id": {id(customerID)}, "customer_name": {"张三"},
+		"customer_phone": {"13900000000"}, "customer_address": {"北京市朝阳区"},
+	})
+	if resp.Status != http.StatusForbidden || resp.Code != int(apperror.CodeCustomerAccessForbidden) {
+		t.Fatalf("update by other saler: got %d/%d", resp.Status, resp.Code)
+	}
+	var updated customerData
+	s.mustGet(t, "/api/v1/sale/updateCustomer", f.Manager, url.Values{
+		"user_id": {f.Manager.idParam()}, "customer_id": {id(customerID)}, "customer_name": {"张三"},
+		"customer_phone": {"13812341234"}, "customer_address": {"上海市浦东新区世纪大道100号"},
+	}).decode(t, &updated)
+	if updated.Phone != "138****1234" {
+		t.Fatalf("manager should see masked details after update: %+v", updated)
+	}
+	var found customerData
+	s.mustGet(t, "/api/v1/sale/findCustomerByPhone", f.Director, url.Values{
+		"user_id": {f.Director.idParam()}, "customer_phone": {"13812341234"},
+	}).decode(t, &found)
+	if found.ID != customerID || found.Phone != "138****1234" {
+		t.Fatalf("unexpected customer found by phone %+v", found)
+	}
+	s.expectStatus(t, http.StatusForbidden, "/api/v1/sale/findCustomerByPhone", f.OtherRep, url.Values{
+		"user_id": {f.OtherRep.idParam()}, "customer_phone": {"13812341234"},
+	})
+	s.expectStatus(t, http.StatusNotFound, "/api/v1/sale/findCustomerByPhone", f.Rep, url.Values{
+		"user_id": {f.Rep.idParam()}, "customer_phone": {"13900000000"},
+	})
+
+	// 查看完整信息需要填写原因，并记录到系统日志
+	s.expectStatus(t, http.StatusBadRequest, "/api/v1/sale/revealCustomerPII", f.Manager, url.Values{
+		"user_id": {f.Manager.idParam()}, "customer_id": {id(customerID)},
+	})
+	var revealed controllers.CustomerPIIDTO
+	s.mustGet(t, "/api/v1/sale/revealCustomerPII", f.Manager, url.Values{
+		"user_id": {f.Manager.idParam()}, "customer_id": {id(customerID)}, "reason": {"回访客户"},
+	}).decode(t, &revealed)
+	if revealed.Phone != "13812341234" || revealed.Address != "上海市浦东新区世纪大道100号" {
+		t.Fatalf("unexpected revealed details %+v", revealed)
+	}
+	var audits int64
+	s.db.Model(&models.SystemLog{}).Where("user_id = ? AND action LIKE ?", f.Manager.ID, "%完整%回访客户%").Count(&audits)
+	if audits != 1 {
+		t.Fatalf("reveal should be audited once, got %d", audits)
+	}
+	resp = s.get(t, "/api/v1/sale/revealCustomerPII", f.OtherManager.Token, url.Values{
+		"user_id": {f.OtherManager.idParam()}, "customer_id": {id(customerID)}, "reason": {"越权查看"},
+	})
+	if resp.Status != http.StatusForbidden || resp.Code != int(apperror.CodeCustomerAccessForbidden) {
+		t.Fatalf("reveal by other department: got %d/%d", resp.Status, resp.Code)
+	}
+
+	// 管理员的用户列表中员工电话脱敏
+	s.mustGet(t, "/api/v1/updateUserProfile", f.Rep, url.Values{
+		"name": {"李四"}, "phone": {"13912345678"}, "address": {"北京市海淀区中关村"},
+	})
+	var users []struct {
+		ID          uint `json:"id"`
+		UserProfile struct {
+			Phone string `json:"phone"`
+		} `json:"profile"`
+	}
+	s.mustGet(t, "/api/v1/admin/listAllUsers", f.Admin, url.Values{
+		"system_manager_id": {f.Admin.idParam()}, "include": {"profile"},
+	}).decode(t, &users)
+	for _, user := range users {
+		if user.ID == f.Rep.ID && user.UserProfile.Phone != "139****5678" {
+			t.Fatalf("admin should see masked staff phone, got %q", user.UserProfile.Phone)
+		}
+	}
+}
+
+func TestPIIKeyRotation(t *testing.T) {
+	s := newTestServer(t)
+	f := seedOrg(t, s)
+
+	// 旧密钥加密的客户和加密上线前的明文客户
+	usePIIKey(t, "k1")
+	oldKey := createCustomer(t, s, f.Rep, "旧密钥客户", "13800000001")
+	if raw := rawCustomerColumn(t, s, oldKey, "phone"); !strings.HasPrefix(raw, "enc:k1:") {
+		t.Fatalf("expected a k1 ciphertext, got %q", raw)
+	}
+	usePIIKey(t, "k2")
+	legacy := createCustomer(t, s, f.Rep, "明文客户", "13800000002")
+	if err := s.db.Exec("UPDATE customers SET phone = ?, phone_index = '' WHERE id = ?", "13800000002", legacy).Error; err != nil {
+		t.Fatal(err)
+	}
+	if got := listCustomers(t, s, f.Rep); len(got) != 2 || got[0].Phone != "13800000001" || got[1].Phone != "13800000002" {
+		t.Fatalf("old ciphertext and plaintext should both be readable: %+v", got)
+	}
+
+	var rotated struct {
+		Rotated int `json:"rotated"`
+	}
+	s.mustGet(t, "/api/v1/admin/rotatePIIKeys", f.Admin, url.Values{"system_manager_id": {f.Admin.idParam()}}).decode(t, &rotated)
+	if rotated.Rotated != 2 {
+		t.Fatalf("got %d rotated rows, want 2", rotated.Rotated)
+	}
+	for _, customerID := range []uint{oldKey, legacy} {
+		if raw := rawCustomerColumn(t, s, customerID, "phone"); !strings.HasPrefix(raw, "enc:k2:") {
+			t.Fatalf("customer %d not re-encrypted: %q", customerID, raw)
+		}
+	}
+	// 补齐盲索引后可以按电话查找
+	var found customerData
+	s.mustGet(t, "/api/v1/sale/findCustomerByPhone", f.Rep, url.Values{
+		"user_id": {f.Rep.idParam()}, "customer_phone": {"13800000002"},
+	}).decode(t, &found)
+	if found.ID != legacy || found.Phone != "13800000002" {
+		t.Fatalf("unexpected customer after rotation %+v", found)
+	}
+
+	s.mustGet(t, "/api/v1/admin/rotatePIIKeys", f.Admin, url.Values{"system_manager_id": {f.Admin.idParam()}}).decode(t, &rotated)
+	if rotated.Rotated != 0 {
+		t.Fatalf("second rotation should be a no-op, got %d", rotated.Rotated)
+	}
+}
+
+// 迁移时加密上线前的明文客户并补齐盲索引，不需要等到第一次轮换密钥就能去重
+func TestMigrationBackfillsCustomerPII(t *testing.T) {
+	s := newTestServer(t)
+	f := seedOrg(t, s)
+	legacy := createCustomer(t, s, f.Rep, "明文客户", "13800000002")
+	if err := s.db.Exec("UPDATE customers SET phone = ?, address = ?, phone_index = NULL WHERE id = ?",
+		"13800000002", "上海市浦东新区世纪大道100号", legacy).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if err := migrations.Migrate(s.db); err != nil {
+		t.Fatal(err)
+	}
+	for _, column := range []string{"phone", "address"} {
+		if raw := rawCustomerColumn(t, s, legacy, column); !strings.HasPrefix(raw, "enc:k2:") {
+			t.Fatalf("%s not encrypted by the migration: %q", column, raw)
+		}
+	}
+	resp := s.get(t, "/api/v1/sale/createCustomer", f.Rep2.Token, url.Values{
+		"user_id": {f.Rep2.idParam()}, "customer_name": {"张三"}, "customer_phone": {"13800000002"},
+	})
+	if resp.Status != http.StatusConflict || resp.Code != int(apperror.CodeCustomerPhoneExists) {
+		t.Fatalf("duplicate of a legacy customer: got %d/%d", resp.Status, resp.Code)
+	}
+	if got := listCustomers(t, s, f.Rep); len(got) != 1 || got[0].Phone != "13800000002" || got[0].Address != "上海市浦东新区世纪大道100号" {
+		t.Fatalf("unexpected customers after migration %+v", got)
+	}
+}
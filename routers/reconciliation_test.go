@@ -0,0 +1,172 @@
+package routers
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"gin-boilerplate/infra/apperror"
+	"gin-boilerplate/models"
+)
+
+type reconciliationItemData struct {
+	ID           uint   `json:"id"`
+	ContractID   uint   `json:"contract_id"`
+	AccountantID uint   `json:"accountant_id"`
+	Amount       string `json:"amount"`
+	BankAmount   string `json:"bank_amount"`
+	Difference   string `json:"difference"`
+	Status       uint   `json:"status"`
+	Resolution   string `json:"resolution"`
+}
+
+type amountVersionData struct {
+	Version    int    `json:"version"`
+	Amount     string `json:"amount"`
+	BankAmount string `json:"bank_amount"`
+	ChangedBy  uint   `json:"changed_by"`
+	Reason     string `json:"reason"`
+}
+
+func TestReconciliation(t *testing.T) {
+	s := newTestServer(t)
+	f := seedOrg(t, s)
+	contract := submitContract(t, s, f, f.Rep, createCustomer(t, s, f.Rep, "对账客户", "13800000001"), "100000")
+
+	// 提交合同时金融专员、会计必须是对应角色
+	s.expectStatus(t, http.StatusBadRequest, "/api/v1/sale/submitContract", f.Rep, url.Values{
+		"user_id": {f.Rep.idParam()}, "customer_id": {id(contract.CustomerID)},
+		"finance_id": {f.Finance.idParam()}, "accountant_id": {f.Rep.idParam()},
+		"amount": {"100000"}, "service_fee": {"1000"}, "bank_amount": {"100000"},
+		"financial_product": {"经营贷"}, "contract_document": {"contract.pdf"}, "bank_documents": {"bank.pdf"},
+	})
+
+	// 只有合同指定的金融专员或金融经理可以修改金额
+	other, err := s.repos.Users.CreateUser(context.Background(), "finance2", seedPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other, err = s.repos.Users.UpdateUserRole(context.Background(), f.Admin.ID, other.ID, models.FINANCE_SPECIALIST); err != nil {
+		t.Fatal(err)
+	}
+	otherFinance := issueToken(t, s, *other)
+	resp := s.get(t, "/api/v1/finance/updateContractAmount", otherFinance.Token, url.Values{
+		"user_id": {otherFinance.idParam()}, "contract_id": {id(contract.ID)},
+		"amount": {"90000"}, "service_fee": {"1000"}, "bank_amount": {"90000"}, "reason": {"越权修改"},
+	})
+	if resp.Status != http.StatusForbidden || resp.Code != int(apperror.CodeContractAmountForbidden) {
+		t.Fatalf("update amount by unassigned finance: got %d/%d", resp.Status, resp.Code)
+	}
+	s.expectStatus(t, http.StatusBadRequest, "/api/v1/finance/updateContractAmount", f.Finance, url.Values{
+		"user_id": {f.Finance.idParam()}, "contract_id": {id(contract.ID)},
+		"amount": {"90000"}, "service_fee": {"1000"}, "bank_amount": {"90000"},
+	})
+	s.mustGet(t, "/api/v1/finance/updateContractAmount", f.Finance, url.Values{
+		"user_id": {f.Finance.idParam()}, "contract_id": {id(contract.ID)},
+		"amount": {"95000"}, "service_fee": {"1000"}, "bank_amount": {"95000"}, "reason": {"客户减少贷款金额"},
+	})
+
+	accountant := func(params url.Values) url.Values {
+		params.Set("user_id", f.Accountant.idParam())
+		return params
+	}
+	confirm := func(bankAmount string) *reconciliationItemData {
+		t.Helper()
+		var data struct {
+			Contract       contractData            `json:"contract"`
+			Reconciliation *reconciliationItemData `json:"reconciliation"`
+		}
+		s.mustGet(t, "/api/v1/reconciliation/confirmBankAmount", f.Accountant, accountant(url.Values{
+			"contract_id": {id(contract.ID)}, "bank_amount": {bankAmount},
+		})).decode(t, &data)
+		if data.Contract.BankAmount != bankAmount {
+			t.Fatalf("bank amount after confirm: got %s, want %s", data.Contract.BankAmount, bankAmount)
+		}
+		return data.Reconciliation
+	}
+
+	// 容差默认100元，差额在容差内不生成对账差异
+	if item := confirm("94900"); item != nil {
+		t.Fatalf("difference within tolerance should not open an item: %+v", item)
+	}
+	item := confirm("94000.5")
+	if item == nil || item.Difference != "999.5" || item.Amount != "95000" || item.AccountantID != f.Accountant.ID || item.Status != 0 {
+		t.Fatalf("unexpected reconciliation item %+v", item)
+	}
+	// 再次确认更新同一条待处理的差异
+	if again := confirm("94500"); again == nil || again.ID != item.ID || again.Difference != "500" {
+		t.Fatalf("reconfirm should update the open item: %+v", again)
+	}
+
+	resp = s.get(t, "/api/v1/reconciliation/confirmBankAmount", otherFinance.Token, url.Values{
+		"user_id": {otherFinance.idParam()}, "contract_id": {id(contract.ID)}, "bank_amount": {"95000"},
+	})
+	if resp.Status != http.StatusForbidden {
+		t.Fatalf("confirm by finance: got %d", resp.Status)
+	}
+
+	var items []reconciliationItemData
+	s.mustGet(t, "/api/v1/reconciliation/getItems", f.Accountant, accountant(url.Values{"status": {"待处理"}})).decode(t, &items)
+	if len(items) != 1 || items[0].ID != item.ID {
+		t.Fatalf("unexpected open items %+v", items)
+	}
+	s.expectStatus(t, http.StatusBadRequest, "/api/v1/reconciliation/getItems", f.Accountant, accountant(url.Values{"status": {"未知"}}))
+
+	var resolved reconciliationItemData
+	s.mustGet(t, "/api/v1/reconciliation/resolveItem", f.Accountant, accountant(url.Values{
+		"item_id": {id(item.ID)}, "resolution": {"银行扣除了手续费"},
+	})).decode(t, &resolved)
+	if resolved.Status != 1 || resolved.Resolution != "银行扣除了手续费" {
+		t.Fatalf("unexpected resolved item %+v", resolved)
+	}
+	resp = s.get(t, "/api/v1/reconciliation/resolveItem", f.Accountant.Token, accountant(url.Values{
+		"item_id": {id(item.ID)}, "resolution": {"重复处理"},
+	}))
+	if resp.Status != http.StatusConflict || resp.Code != int(apperror.CodeReconciliationResolved) {
+		t.Fatalf("resolve twice: got %d/%d", resp.Status, resp.Code)
+	}
+
+	// 新的差异在差额回到容差内后自动处理
+	if reopened := confirm("90000"); reopened == nil || reopened.ID == item.ID {
+		t.Fatalf("expected a new open item, got %+v", reopened)
+	}
+	confirm("95000")
+	s.mustGet(t, "/api/v1/reconciliation/getItems", f.Accountant, accountant(url.Values{"status": {"待处理"}})).decode(t, &items)
+	if len(items) != 0 {
+		t.Fatalf("open items should be resolved automatically: %+v", items)
+	}
+
+	// 提交、修改金额和每次银行金额变化都留下版本
+	var versions []amountVersionData
+	s.mustGet(t, "/api/v1/contract/getAmountHistory", f.Rep, url.Values{
+		"user_id": {f.Rep.idParam()}, "contract_id": {id(contract.ID)},
+	}).decode(t, &versions)
+	wantBank := []string{"100000", "95000", "94900", "94000.5", "94500", "90000", "95000"}
+	if len(versions) != len(wantBank) {
+		t.Fatalf("got %d versions, want %d: %+v", len(versions), len(wantBank), versions)
+	}
+	for i, version := range versions {
+		if version.Version != i+1 || version.BankAmount != wantBank[i] {
+			t.Fatalf("version %d: got %+v, want bank amount %s", i+1, version, wantBank[i])
+		}
+	}
+	if versions[0].ChangedBy != f.Rep.ID || versions[1].ChangedBy != f.Finance.ID || versions[1].Reason != "客户减少贷款金额" ||
+		versions[2].ChangedBy != f.Accountant.ID {
+		t.Fatalf("unexpected version authors %+v", versions[:3])
+	}
+
+	// 金融专员修改已确认的银行金额后，会计的确认失效，并按同样的容差生成对账差异
+	var amended contractData
+	s.mustGet(t, "/api/v1/finance/updateContractAmount", f.Finance, url.Values{
+		"user_id": {f.Finance.idParam()}, "contract_id": {id(contract.ID)},
+		"amount": {"95000"}, "service_fee": {"1000"}, "bank_amount": {"80000"}, "reason": {"覆盖银行金额"},
+	}).decode(t, &amended)
+	if amended.BankAmount != "80000" || amended.BankConfirmedBy != nil {
+		t.Fatalf("changing the bank amount must clear the accountant confirmation: %+v", amended)
+	}
+	s.mustGet(t, "/api/v1/reconciliation/getItems", f.Accountant, accountant(url.Values{"status": {"待处理"}})).decode(t, &items)
+	if len(items) != 1 || items[0].Difference != "15000" || items[0].BankAmount != "80000" {
+		t.Fatalf("changing the bank amount must open a reconciliation item: %+v", items)
+	}
+}
@@ -0,0 +1,170 @@
+package routers
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+
+	"gin-boilerplate/infra/database"
+	"gin-boilerplate/infra/metrics"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/plugin/dbresolver"
+)
+
+type probe struct {
+	ID   uint
+	Name string
+}
+
+// replicaCluster 一个主库和多个从库，每个库的 probes 表中保存库名，读到的值就是实际查询的数据库
+type replicaCluster struct {
+	master   *gorm.DB
+	replicas []*sql.DB
+}
+
+func newReplicaCluster(t *testing.T, count int) *replicaCluster {
+	t.Helper()
+	open := func(name string) *gorm.DB {
+		db, err := database.SQLiteConnection(filepath.Join(t.TempDir(), name+".db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := db.AutoMigrate(&probe{}); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Create(&probe{ID: 1, Name: name}).Error; err != nil {
+			t.Fatal(err)
+		}
+		return db
+	}
+	cluster := &replicaCluster{master: open("master")}
+	var replicaDBs []*gorm.DB
+	var dialectors []gorm.Dialector
+	for i := 0; i < count; i++ {
+		replicaDB := open(fmt.Sprintf("replica_%d", i))
+		sqlDB, err := replicaDB.DB()
+		if err != nil {
+			t.Fatal(err)
+		}
+		replicaDBs = append(replicaDBs, replicaDB)
+		dialectors = append(dialectors, &sqlite.Dialector{Conn: sqlDB})
+		cluster.replicas = append(cluster.replicas, sqlDB)
+	}
+	if err := database.UseReplicas(cluster.master, replicaDBs, dialectors, 20*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		database.StopReplicaHealthCheck()
+		for _, sqlDB := range cluster.replicas {
+			sqlDB.Close()
+		}
+	})
+	return cluster
+}
+
+// read 返回这次读请求实际查询的数据库
+func (c *replicaCluster) read(t *testing.T, ctx context.Context) string {
+	t.Helper()
+	name, err := c.tryRead(ctx)
+	if err != nil {
+		t.Fatalf("read: %s", err)
+	}
+	return name
+}
+
+func (c *replicaCluster) tryRead(ctx context.Context) (string, error) {
+	var row probe
+	err := c.master.WithContext(ctx).First(&row, 1).Error
+	return row.Name, err
+}
+
+// waitFor 等待健康检查生效，直到连续多次读请求都落在 want 中的数据库上
+func (c *replicaCluster) waitFor(t *testing.T, want ...string) {
+	t.Helper()
+	allowed := map[string]bool{}
+	for _, name := range want {
+		allowed[name] = true
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for hits := 0; hits < 20; {
+		if time.Now().After(deadline) {
+			t.Fatalf("reads did not move to %v", want)
+		}
+		// 从库关闭后、健康检查发现之前的读请求会失败
+		if name, err := c.tryRead(context.Background()); err == nil && allowed[name] {
+			hits++
+		} else {
+			hits = 0
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+}
+
+func routedQueries(t *testing.T, target, kind string) int {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	pattern := regexp.MustCompile(fmt.Sprintf(`gin_backend_db_routed_queries_total\{kind="%s",target="%s"\} (\d+)`, kind, target))
+	match := pattern.FindStringSubmatch(rec.Body.String())
+	if match == nil {
+		return 0
+	}
+	count, _ := strconv.Atoi(match[1])
+	return count
+}
+
+// 不健康的从库不参与读请求，全部不健康时回退到主库
+func TestReplicaHealthFallback(t *testing.T) {
+	c := newReplicaCluster(t, 2)
+	c.waitFor(t, "replica_0", "replica_1")
+
+	c.replicas[0].Close()
+	c.waitFor(t, "replica_1")
+	c.replicas[1].Close()
+	c.waitFor(t, "master")
+}
+
+// 同一请求写入之后的读请求走主库；在主库上执行的读请求不算写入，计入主库的读指标
+func TestReadYourWrites(t *testing.T) {
+	c := newReplicaCluster(t, 1)
+	c.waitFor(t, "replica_0")
+
+	ctx := database.WithReadYourWrites(context.Background())
+	if got := c.read(t, ctx); got != "replica_0" {
+		t.Fatalf("read before write went to %s", got)
+	}
+	masterReads, masterWrites := routedQueries(t, "master", "read"), routedQueries(t, "master", "write")
+	var row probe
+	if err := c.master.WithContext(ctx).Clauses(dbresolver.Write).First(&row, 1).Error; err != nil || row.Name != "master" {
+		t.Fatalf("explicit master read: %+v %v", row, err)
+	}
+	if got := c.read(t, ctx); got != "replica_0" {
+		t.Fatalf("a read on the master must not count as a write, next read went to %s", got)
+	}
+	if routedQueries(t, "master", "read") != masterReads+1 || routedQueries(t, "master", "write") != masterWrites {
+		t.Fatal("a read on the master must be labelled as a read")
+	}
+
+	if err := c.master.WithContext(ctx).Model(&probe{}).Where("id = ?", 1).Update("name", "master").Error; err != nil {
+		t.Fatal(err)
+	}
+	if routedQueries(t, "master", "write") != masterWrites+1 {
+		t.Fatal("the update must be labelled as a write")
+	}
+	if got := c.read(t, ctx); got != "master" {
+		t.Fatalf("read after write went to %s", got)
+	}
+	// 其他请求不受影响
+	if got := c.read(t, database.WithReadYourWrites(context.Background())); got != "replica_0" {
+		t.Fatalf("read in another request went to %s", got)
+	}
+}
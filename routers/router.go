@@ -1,28 +1,56 @@
 package routers
 
 import (
+	"gin-boilerplate/config"
+	"gin-boilerplate/controllers"
+	"gin-boilerplate/infra/logger"
+	"gin-boilerplate/infra/ratelimit"
+	"gin-boilerplate/repository"
 	"gin-boilerplate/routers/middleware"
 	"github.com/gin-gonic/gin"
-	"github.com/spf13/viper"
 )
 
-func SetupRoute() *gin.Engine {
+// SetupRoute 创建路由，控制器通过 repos 访问数据
+func SetupRoute(repos *repository.Repositories) *gin.Engine {
+	gin.DefaultWriter = logger.DebugWriter()
+	gin.DefaultErrorWriter = logger.ErrorWriter()
 
-	environment := viper.GetBool("DEBUG")
+	environment := config.Get().Server.Debug
 	if environment {
 		gin.SetMode(gin.DebugMode)
 	} else {
 		gin.SetMode(gin.ReleaseMode)
 	}
 
-	allowedHosts := viper.GetString("ALLOWED_HOSTS")
+	allowedHosts := config.Get().Server.AllowedHosts
 	router := gin.New()
+	// 使 gin.Context 可以读取请求 context 中的请求ID等信息
+	router.ContextWithFallback = true
 	router.SetTrustedProxies([]string{allowedHosts})
-	router.Use(gin.Logger())
-	router.Use(gin.Recovery())
+	router.Use(middleware.RequestIDMiddleware())
+	router.Use(middleware.RequestLoggerMiddleware())
+	router.Use(middleware.MetricsMiddleware())
+	router.Use(middleware.ErrorMiddleware())
+	router.Use(middleware.RecoveryMiddleware())
+	// 配置已经过校验，规则不会解析失败
+	limits := newRateLimitStore(config.Get().RateLimit)
+	rules, _ := config.Get().RateLimit.ParseRules()
+	router.Use(middleware.RateLimitMiddleware(limits, rules))
+	router.Use(middleware.APIKeyMiddleware(repos.APIKeys, limits, config.Get().APIKey))
+	router.Use(middleware.SessionMiddleware(repos.Sessions))
+	router.Use(middleware.ImpersonationMiddleware(repos.Impersonations))
+	router.Use(middleware.ReadYourWritesMiddleware())
 	router.Use(middleware.CORSMiddleware())
 
-	RegisterRoutes(router) //routes register
+	RegisterRoutes(router, controllers.NewController(repos, limits)) //routes register
 
 	return router
 }
+
+// newRateLimitStore 限流计数和按IP统计的登录失败次数使用同一个存储
+func newRateLimitStore(rateLimit config.RateLimitConfiguration) ratelimit.Store {
+	if rateLimit.Backend == "redis" {
+		return ratelimit.NewRedisStore(rateLimit.RedisAddr, rateLimit.RedisPassword, rateLimit.RedisDB)
+	}
+	return ratelimit.NewMemoryStore()
+}
@@ -0,0 +1,177 @@
+package routers
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"gin-boilerplate/helpers"
+	"gin-boilerplate/models"
+)
+
+// seededUser 种子用户及其访问令牌
+type seededUser struct {
+	ID    uint
+	Name  string
+	Token string
+}
+
+// idParam 返回用作 query 参数的用户ID
+func (u seededUser) idParam() string {
+	return id(u.ID)
+}
+
+// orgFixture 测试用的组织架构：
+//
+//	华东战区（销售总监 director）
+//	  └── 华东一部（销售经理 manager，销售代表 rep、rep2）
+//	华南战区
+//	  └── 华南一部（销售经理 otherManager，销售代表 otherRep）
+//	金融部（金融专员 finance，金融经理 financeManager，会计 accountant）
+//
+// 另有系统管理员 admin、总经理 generalManager 和未分配角色的 newbie
+type orgFixture struct {
+	Admin          seededUser
+	GeneralManager seededUser
+	Director       seededUser
+	Manager        seededUser
+	Rep            seededUser
+	Rep2           seededUser
+	OtherManager   seededUser
+	OtherRep       seededUser
+	Finance        seededUser
+	FinanceManager seededUser
+	Accountant     seededUser
+	Newbie         seededUser
+
+	ZoneA, ZoneB              uint
+	DeptA, DeptB, FinanceDept uint
+}
+
+const seedPassword = "password123"
+
+// seedUserAgent 标记 seedSession 创建的会话
+const seedUserAgent = "seed"
+
+// idObject 只解析响应对象中的ID
+type idObject struct {
+	ID uint `json:"id"`
+}
+
+func id(v uint) string {
+	return strconv.FormatUint(uint64(v), 10)
+}
+
+// seedOrg 通过仓储直接写入组织架构，并为每个用户签发令牌
+func seedOrg(t *testing.T, s *testServer) *orgFixture {
+	t.Helper()
+	ctx := context.Background()
+	repos := s.repos
+	must := func(err error) {
+		t.Helper()
+		if err != nil {
+			t.Fatalf("seed: %s", err)
+		}
+	}
+
+	f := &orgFixture{}
+	admin, err := repos.Users.CreateSystemManager(ctx, "admin", seedPassword)
+	must(err)
+	f.Admin = issueToken(t, s, *admin)
+
+	zoneA, err := repos.Org.CreateZone(ctx, admin.ID, "华东战区")
+	must(err)
+	zoneB, err := repos.Org.CreateZone(ctx, admin.ID, "华南战区")
+	must(err)
+	deptA, err := repos.Org.CreateSalesDepartment(ctx, admin.ID, "华东一部", &zoneA.ID)
+	must(err)
+	deptB, err := repos.Org.CreateSalesDepartment(ctx, admin.ID, "华南一部", &zoneB.ID)
+	must(err)
+	financeDept, err := repos.Org.CreateFinanceDepartment(ctx, admin.ID, "金融部")
+	must(err)
+	f.ZoneA, f.ZoneB = zoneA.ID, zoneB.ID
+	f.DeptA, f.DeptB, f.FinanceDept = deptA.ID, deptB.ID, financeDept.ID
+
+	newUser := func(name string, role models.RoleID, departmentID, zoneID *uint) seededUser {
+		t.Helper()
+		user, err := repos.Users.CreateUser(ctx, name, seedPassword)
+		must(err)
+		_, err = repos.Users.UpdateUserRole(ctx, admin.ID, user.ID, role)
+		must(err)
+		if departmentID != nil {
+			must(repos.Org.AssignUserToDepartment(ctx, admin.ID, user.ID, *departmentID))
+		}
+		if zoneID != nil {
+			must(repos.Org.AssignUserToZone(ctx, admin.ID, user.ID, *zoneID))
+		}
+		user, err = repos.Users.GetUserByID(ctx, user.ID)
+		must(err)
+		return issueToken(t, s, *user)
+	}
+
+	f.GeneralManager = newUser("gm", models.GENERAL_MANAGER, nil, nil)
+	f.Director = newUser("director", models.SALES_DIRECTOR, nil, &zoneA.ID)
+	f.Manager = newUser("manager", models.SALES_MANAGER, &deptA.ID, &zoneA.ID)
+	f.Rep = newUser("rep", models.SALES_REPRESENTATIVE, &deptA.ID, &zoneA.ID)
+	f.Rep2 = newUser("rep2", models.SALES_REPRESENTATIVE, &deptA.ID, &zoneA.ID)
+	f.OtherManager = newUser("other_manager", models.SALES_MANAGER, &deptB.ID, &zoneB.ID)
+	f.OtherRep = newUser("other_rep", models.SALES_REPRESENTATIVE, &deptB.ID, &zoneB.ID)
+	f.Finance = newUser("finance", models.FINANCE_SPECIALIST, &financeDept.ID, nil)
+	f.FinanceManager = newUser("finance_manager", models.FINANCE_MANAGER, &financeDept.ID, nil)
+	f.Accountant = newUser("accountant", models.ACCOUNTANT, &financeDept.ID, nil)
+	f.Newbie = newUser("newbie", models.DEFAULT, nil, nil)
+
+	must(repos.Org.AssignDirectorToZone(ctx, admin.ID, f.Director.ID, zoneA.ID))
+	must(repos.Org.AssignManagerToDepartment(ctx, admin.ID, f.Manager.ID, deptA.ID))
+	must(repos.Org.AssignManagerToDepartment(ctx, admin.ID, f.OtherManager.ID, deptB.ID))
+	return f
+}
+
+// issueToken 不经过登录接口为 user 创建会话并签发令牌
+func issueToken(t *testing.T, s *testServer, user models.User) seededUser {
+	t.Helper()
+	token, _, err := helpers.GenerateToken(user, seedSession(t, s, user.ID))
+	if err != nil {
+		t.Fatalf("seed: generate token for %s: %s", user.UserName, err)
+	}
+	return seededUser{ID: user.ID, Name: user.UserName, Token: token}
+}
+
+// createCustomer 以销售人员身份通过接口新建客户，返回客户ID
+func createCustomer(t *testing.T, s *testServer, saler seededUser, name, phone string) uint {
+	t.Helper()
+	var customer idObject
+	s.mustGet(t, "/api/v1/sale/createCustomer", saler, url.Values{
+		"user_id": {saler.idParam()}, "customer_name": {name}, "customer_phone": {phone},
+	}).decode(t, &customer)
+	return customer.ID
+}
+
+// seedSession 直接创建一个会话，会话不记录登录，user agent 为 seedUserAgent
+func seedSession(t *testing.T, s *testServer, userID uint) helpers.TokenSession {
+	t.Helper()
+	session := helpers.TokenSession{SessionID: newTokenID(t), RefreshID: newTokenID(t)}
+	if err := s.db.Create(&models.Session{
+		UserID:     userID,
+		Family:     session.SessionID,
+		RefreshID:  session.RefreshID,
+		Method:     models.LoginMethodPassword,
+		UserAgent:  seedUserAgent,
+		LastSeenAt: time.Now(),
+		ExpiresAt:  time.Now().Add(helpers.RefreshTokenLifetime()),
+	}).Error; err != nil {
+		t.Fatalf("seed: create session for user %d: %s", userID, err)
+	}
+	return session
+}
+
+func newTokenID(t *testing.T) string {
+	t.Helper()
+	id, err := helpers.NewTokenID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
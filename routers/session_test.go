@@ -0,0 +1,276 @@
+package routers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"gin-boilerplate/infra/apperror"
+)
+
+type sessionInfo struct {
+	ID            uint    `json:"id"`
+	UserID        uint    `json:"user_id"`
+	Method        string  `json:"method"`
+	IP            string  `json:"ip"`
+	UserAgent     string  `json:"user_agent"`
+	RevokedAt     *string `json:"revoked_at"`
+	RevokedReason string  `json:"revoked_reason"`
+	Current       bool    `json:"current"`
+}
+
+type loginEvent struct {
+	UserID    uint   `json:"user_id"`
+	SessionID uint   `json:"session_id"`
+	Method    string `json:"method"`
+	IP        string `json:"ip"`
+	NewIP     bool   `json:"new_ip"`
+}
+
+type issuedTokens struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// loginFrom 以 ip 和 userAgent 作为客户端登录，返回签发的令牌
+func (s *testServer) loginFrom(t *testing.T, username, ip, userAgent string) issuedTokens {
+	t.Helper()
+	params := url.Values{"username": {username}, "password": {seedPassword}}
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/login?"+params.Encode(), nil)
+	req.RemoteAddr = ip + ":40000"
+	req.Header.Set("User-Agent", userAgent)
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, req)
+
+	resp := apiResponse{Status: rec.Code, Header: rec.Header()}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("login: invalid json %q: %s", rec.Body.String(), err)
+	}
+	if resp.Status != http.StatusOK {
+		t.Fatalf("login %s from %s: got %d (%s)", username, ip, resp.Status, resp.Message)
+	}
+	var tokens issuedTokens
+	resp.decode(t, &tokens)
+	return tokens
+}
+
+// loginSessions 去掉 seedSession 创建的会话，只保留登录接口创建的
+func loginSessions(sessions []sessionInfo) []sessionInfo {
+	var filtered []sessionInfo
+	for _, session := range sessions {
+		if session.UserAgent != seedUserAgent {
+			filtered = append(filtered, session)
+		}
+	}
+	return filtered
+}
+
+// 每次登录创建一个会话，刷新令牌在会话内轮换，重复使用旧的刷新令牌撤销整个会话
+func TestSessionRefreshRotation(t *testing.T) {
+	s := newTestServer(t)
+	f := seedOrg(t, s)
+	tokens := s.loginFrom(t, "rep", "203.0.113.10", "laptop")
+	laptop := seededUser{ID: f.Rep.ID, Token: tokens.AccessToken}
+
+	var sessions []sessionInfo
+	s.mustGet(t, "/api/v1/me/sessions", laptop, nil).decode(t, &sessions)
+	sessions = loginSessions(sessions)
+	if len(sessions) != 1 || !sessions[0].Current || sessions[0].IP != "203.0.113.10" ||
+		sessions[0].UserAgent != "laptop" || sessions[0].Method != "password" {
+		t.Fatalf("unexpected sessions %+v", sessions)
+	}
+
+	var rotated issuedTokens
+	s.mustGet(t, "/api/v1/token/refresh", seededUser{}, url.Values{"refresh_token": {tokens.RefreshToken}}).decode(t, &rotated)
+	if rotated.RefreshToken == "" || rotated.RefreshToken == tokens.RefreshToken {
+		t.Fatalf("refresh token must rotate, got %+v", rotated)
+	}
+	s.mustGet(t, "/api/v1/me/sessions", seededUser{Token: rotated.AccessToken}, nil).decode(t, &sessions)
+	if sessions = loginSessions(sessions); len(sessions) != 1 || !sessions[0].Current {
+		t.Fatalf("refresh must stay in the same session, got %+v", sessions)
+	}
+
+	// 旧的刷新令牌再次使用说明可能已泄露，会话内的全部令牌失效
+	resp := s.expectStatus(t, http.StatusUnauthorized, "/api/v1/token/refresh", seededUser{}, url.Values{"refresh_token": {tokens.RefreshToken}})
+	if resp.Code != int(apperror.CodeSessionRevoked) {
+		t.Fatalf("reused refresh token: got code %d", resp.Code)
+	}
+	for _, token := range []string{tokens.AccessToken, rotated.AccessToken} {
+		resp := s.expectStatus(t, http.StatusUnauthorized, "/api/v1/me/sessions", seededUser{Token: token}, nil)
+		if resp.Code != int(apperror.CodeSessionRevoked) {
+			t.Fatalf("token of revoked session: got code %d", resp.Code)
+		}
+	}
+	s.expectStatus(t, http.StatusUnauthorized, "/api/v1/token/refresh", seededUser{}, url.Values{"refresh_token": {rotated.RefreshToken}})
+	// 访问令牌不能当作刷新令牌使用
+	s.expectStatus(t, http.StatusUnauthorized, "/api/v1/token/refresh", seededUser{}, url.Values{"refresh_token": {s.loginFrom(t, "rep", "203.0.113.10", "laptop").AccessToken}})
+}
+
+// 用户可以撤销自己的会话，撤销后该会话的令牌立即失效，其他用户的会话不能撤销
+func TestRevokeOwnSessions(t *testing.T) {
+	s := newTestServer(t)
+	f := seedOrg(t, s)
+	laptop := seededUser{ID: f.Rep.ID, Token: s.loginFrom(t, "rep", "203.0.113.10", "laptop").AccessToken}
+	phone := seededUser{ID: f.Rep.ID, Token: s.loginFrom(t, "rep", "198.51.100.7", "phone").AccessToken}
+	tablet := seededUser{ID: f.Rep.ID, Token: s.loginFrom(t, "rep", "198.51.100.8", "tablet").AccessToken}
+	gm := seededUser{ID: f.GeneralManager.ID, Token: s.loginFrom(t, "gm", "203.0.113.20", "desktop").AccessToken}
+
+	var sessions []sessionInfo
+	s.mustGet(t, "/api/v1/me/sessions", laptop, nil).decode(t, &sessions)
+	if sessions = loginSessions(sessions); len(sessions) != 3 {
+		t.Fatalf("expected 3 sessions, got %+v", sessions)
+	}
+	byAgent := map[string]sessionInfo{}
+	for _, session := range sessions {
+		byAgent[session.UserAgent] = session
+	}
+	if !byAgent["laptop"].Current || byAgent["phone"].Current {
+		t.Fatalf("only the requesting session is current: %+v", sessions)
+	}
+
+	resp := s.expectStatus(t, http.StatusNotFound, "/api/v1/me/sessions/revoke", gm, url.Values{"session_id": {id(byAgent["phone"].ID)}})
+	if resp.Code != int(apperror.CodeSessionNotFound) {
+		t.Fatalf("revoke other user's session: got code %d", resp.Code)
+	}
+	s.mustGet(t, "/api/v1/me/sessions/revoke", laptop, url.Values{"session_id": {id(byAgent["phone"].ID)}})
+	s.expectStatus(t, http.StatusUnauthorized, "/api/v1/sale/listCustomers", phone, url.Values{"user_id": {f.Rep.idParam()}})
+	s.mustGet(t, "/api/v1/sale/listCustomers", tablet, url.Values{"user_id": {f.Rep.idParam()}})
+
+	var revoked struct {
+		Revoked int64 `json:"revoked"`
+	}
+	s.mustGet(t, "/api/v1/me/sessions/revokeOthers", laptop, nil).decode(t, &revoked)
+	// 平板和 seed 创建的会话
+	if revoked.Revoked != 2 {
+		t.Fatalf("expected 2 other sessions revoked, got %d", revoked.Revoked)
+	}
+	s.expectStatus(t, http.StatusUnauthorized, "/api/v1/me/sessions", tablet, nil)
+	s.expectStatus(t, http.StatusUnauthorized, "/api/v1/me/sessions", f.Rep, nil)
+	s.mustGet(t, "/api/v1/me/sessions", laptop, nil).decode(t, &sessions)
+	if len(sessions) != 1 || !sessions[0].Current {
+		t.Fatalf("unexpected sessions %+v", sessions)
+	}
+	// 其他用户的会话不受影响
+	s.mustGet(t, "/api/v1/me/sessions", gm, nil)
+}
+
+// 修改密码撤销其他会话，保留当前会话；管理员重置密码或两步验证撤销用户的全部会话
+func TestCredentialChangesRevokeSessions(t *testing.T) {
+	s := newTestServer(t)
+	f := seedOrg(t, s)
+	laptop := seededUser{ID: f.Rep.ID, Token: s.loginFrom(t, "rep", "203.0.113.10", "laptop").AccessToken}
+	phone := seededUser{ID: f.Rep.ID, Token: s.loginFrom(t, "rep", "198.51.100.7", "phone").AccessToken}
+	gm := seededUser{ID: f.GeneralManager.ID, Token: s.loginFrom(t, "gm", "203.0.113.20", "desktop").AccessToken}
+	expectRevoked := func(user seededUser) {
+		t.Helper()
+		resp := s.expectStatus(t, http.StatusUnauthorized, "/api/v1/me/sessions", user, nil)
+		if resp.Code != int(apperror.CodeSessionRevoked) {
+			t.Fatalf("token of revoked session: got code %d", resp.Code)
+		}
+	}
+	sessionsOf := func(user seededUser) []sessionInfo {
+		t.Helper()
+		var sessions []sessionInfo
+		s.mustGet(t, "/api/v1/admin/listUserSessions", f.Admin, url.Values{
+			"system_manager_id": {f.Admin.idParam()}, "user_id": {user.idParam()},
+		}).decode(t, &sessions)
+		return sessions
+	}
+
+	var changed issuedTokens
+	s.mustGet(t, "/api/v1/me/password", laptop, url.Values{
+		"current_password": {seedPassword}, "new_password": {"rep-secret-1"},
+	}).decode(t, &changed)
+	expectRevoked(phone)
+	s.mustGet(t, "/api/v1/me/sessions", laptop, nil)
+	s.mustGet(t, "/api/v1/me/sessions", seededUser{Token: changed.AccessToken}, nil)
+	for _, session := range sessionsOf(f.Rep) {
+		if (session.UserAgent != "laptop") != (session.RevokedReason == "password_changed") {
+			t.Fatalf("only the other session should be revoked by the password change: %+v", session)
+		}
+	}
+
+	s.mustGet(t, "/api/v1/admin/resetPassword", f.Admin, url.Values{
+		"system_manager_id": {f.Admin.idParam()}, "user_id": {f.Rep.idParam()},
+	})
+	expectRevoked(laptop)
+	expectRevoked(seededUser{Token: changed.AccessToken})
+
+	s.mustGet(t, "/api/v1/admin/resetTOTP", f.Admin, url.Values{
+		"system_manager_id": {f.Admin.idParam()}, "user_id": {f.GeneralManager.idParam()},
+	})
+	expectRevoked(gm)
+	sessions := sessionsOf(f.GeneralManager)
+	if len(sessions) != 2 {
+		t.Fatalf("unexpected sessions after totp reset %+v", sessions)
+	}
+	for _, session := range sessions {
+		if session.RevokedReason != "totp_reset" {
+			t.Fatalf("all sessions should be revoked by the totp reset: %+v", session)
+		}
+	}
+}
+
+// 系统管理员查看和撤销任意用户的会话，登录记录标记来自新IP的登录
+func TestAdminSessionsAndLoginHistory(t *testing.T) {
+	s := newTestServer(t)
+	f := seedOrg(t, s)
+	first := s.loginFrom(t, "rep", "203.0.113.10", "laptop")
+	s.loginFrom(t, "rep", "203.0.113.10", "laptop")
+	fromNewIP := seededUser{ID: f.Rep.ID, Token: s.loginFrom(t, "rep", "198.51.100.7", "phone").AccessToken}
+	s.loginFrom(t, "gm", "203.0.113.20", "desktop")
+
+	var history []loginEvent
+	s.mustGet(t, "/api/v1/me/loginHistory", fromNewIP, nil).decode(t, &history)
+	if len(history) != 3 {
+		t.Fatalf("expected 3 logins, got %+v", history)
+	}
+	// 最新的在前；第一次登录没有可比较的记录，不算新IP
+	if !history[0].NewIP || history[0].IP != "198.51.100.7" || history[1].NewIP || history[2].NewIP {
+		t.Fatalf("unexpected new ip flags %+v", history)
+	}
+	s.expectStatus(t, http.StatusBadRequest, "/api/v1/me/loginHistory", fromNewIP, url.Values{"limit": {"1000"}})
+
+	admin := url.Values{"system_manager_id": {f.Admin.idParam()}}
+	s.mustGet(t, "/api/v1/admin/loginHistory", f.Admin, admin).decode(t, &history)
+	if len(history) != 4 {
+		t.Fatalf("expected all 4 logins, got %d", len(history))
+	}
+	s.mustGet(t, "/api/v1/admin/loginHistory", f.Admin, url.Values{
+		"system_manager_id": {f.Admin.idParam()}, "new_ip_only": {"true"},
+	}).decode(t, &history)
+	if len(history) != 1 || history[0].UserID != f.Rep.ID {
+		t.Fatalf("expected one new ip login, got %+v", history)
+	}
+	// 只有系统管理员可以查看
+	s.expectStatus(t, http.StatusForbidden, "/api/v1/admin/loginHistory", fromNewIP, url.Values{"system_manager_id": {f.Rep.idParam()}})
+
+	var sessions []sessionInfo
+	s.mustGet(t, "/api/v1/admin/listUserSessions", f.Admin, url.Values{
+		"system_manager_id": {f.Admin.idParam()}, "user_id": {f.Rep.idParam()},
+	}).decode(t, &sessions)
+	if sessions = loginSessions(sessions); len(sessions) != 3 || sessions[0].UserAgent != "phone" {
+		t.Fatalf("unexpected user sessions %+v", sessions)
+	}
+	var revoked sessionInfo
+	s.mustGet(t, "/api/v1/admin/revokeUserSession", f.Admin, url.Values{
+		"system_manager_id": {f.Admin.idParam()}, "session_id": {id(sessions[0].ID)},
+	}).decode(t, &revoked)
+	if revoked.RevokedAt == nil || revoked.RevokedReason != "admin" {
+		t.Fatalf("unexpected revoked session %+v", revoked)
+	}
+	s.expectStatus(t, http.StatusUnauthorized, "/api/v1/me/sessions", fromNewIP, nil)
+	s.mustGet(t, "/api/v1/me/sessions", seededUser{Token: first.AccessToken}, nil)
+	// 撤销的会话仍然出现在管理员视图中
+	s.mustGet(t, "/api/v1/admin/listUserSessions", f.Admin, url.Values{
+		"system_manager_id": {f.Admin.idParam()}, "user_id": {f.Rep.idParam()},
+	}).decode(t, &sessions)
+	if sessions = loginSessions(sessions); len(sessions) != 3 || sessions[0].RevokedAt == nil {
+		t.Fatalf("unexpected user sessions after revoke %+v", sessions)
+	}
+	s.expectStatus(t, http.StatusNotFound, "/api/v1/admin/revokeUserSession", f.Admin, url.Values{
+		"system_manager_id": {f.Admin.idParam()}, "session_id": {"999"},
+	})
+}
@@ -0,0 +1,264 @@
+package routers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gin-boilerplate/config"
+	"gin-boilerplate/infra/apperror"
+	"gin-boilerplate/infra/oidc/oidctest"
+	"gin-boilerplate/models"
+)
+
+const ssoRedirectURL = "http://app.test/api/v1/sso/corp/callback"
+
+// newSSOTestServer 启动本地身份提供方，并以名称 corp 配置到新的测试服务器
+func newSSOTestServer(t *testing.T, provider config.OIDCProvider) (*testServer, *oidctest.Server) {
+	t.Helper()
+	idp := oidctest.NewServer("gin-boilerplate", "client-secret")
+	t.Cleanup(idp.Close)
+	provider.Name = "corp"
+	provider.Issuer = idp.Issuer()
+	provider.ClientID = idp.ClientID
+	provider.ClientSecret = idp.ClientSecret
+	provider.RedirectURL = ssoRedirectURL
+	content, err := json.Marshal([]config.OIDCProvider{provider})
+	if err != nil {
+		t.Fatal(err)
+	}
+	providersFile := filepath.Join(t.TempDir(), "oidc.json")
+	if err := os.WriteFile(providersFile, content, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	oidcConfig := &config.Get().OIDC
+	previous := oidcConfig.ProvidersFile
+	oidcConfig.ProvidersFile = providersFile
+	t.Cleanup(func() { oidcConfig.ProvidersFile = previous })
+	if _, err := oidcConfig.Providers(); err != nil {
+		t.Fatal(err)
+	}
+	return newTestServer(t), idp
+}
+
+// ssoRequest 发送请求并携带 Cookie，返回响应记录
+func (s *testServer) ssoRequest(t *testing.T, target string, cookies []*http.Cookie) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, req)
+	return rec
+}
+
+// ssoAuthorize 开始单点登录并在身份提供方以 subject 登录，返回回调地址的参数和状态 Cookie
+func ssoAuthorize(t *testing.T, s *testServer, subject string) (url.Values, []*http.Cookie) {
+	t.Helper()
+	rec := s.ssoRequest(t, "/api/v1/sso/corp/login", nil)
+	var resp apiResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("sso login: got %d %s", rec.Code, rec.Body.String())
+	}
+	var login struct {
+		AuthorizationURL string `json:"authorization_url"`
+	}
+	resp.decode(t, &login)
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 || !cookies[0].HttpOnly {
+		t.Fatalf("expected one HttpOnly state cookie, got %+v", cookies)
+	}
+
+	authorizationURL, err := url.Parse(login.AuthorizationURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := authorizationURL.Query()
+	if q.Get("code_challenge_method") != "S256" || q.Get("nonce") == "" || q.Get("redirect_uri") != ssoRedirectURL {
+		t.Fatalf("unexpected authorization request %s", login.AuthorizationURL)
+	}
+	q.Set("login_hint", subject)
+	authorizationURL.RawQuery = q.Encode()
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	idpResp, err := client.Get(authorizationURL.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	idpResp.Body.Close()
+	callback, err := url.Parse(idpResp.Header.Get("Location"))
+	if err != nil || idpResp.StatusCode != http.StatusFound {
+		t.Fatalf("authorize: got %d %q", idpResp.StatusCode, idpResp.Header.Get("Location"))
+	}
+	return callback.Query(), cookies
+}
+
+// ssoCallback 以身份提供方返回的参数请求回调接口
+func ssoCallback(t *testing.T, s *testServer, params url.Values, cookies []*http.Cookie) apiResponse {
+	t.Helper()
+	rec := s.ssoRequest(t, "/api/v1/sso/corp/callback?"+params.Encode(), cookies)
+	resp := apiResponse{Status: rec.Code}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("sso callback: invalid json %q", rec.Body.String())
+	}
+	return resp
+}
+
+type ssoLogin struct {
+	User struct {
+		ID       uint          `json:"id"`
+		UserName string        `json:"user_name"`
+		Role     models.RoleID `json:"role"`
+	} `json:"user"`
+	AccessToken    string `json:"access_token"`
+	MFARequired    bool   `json:"mfa_required"`
+	ChallengeToken string `json:"challenge_token"`
+}
+
+// 第一次单点登录时创建默认角色的用户，之后登录使用同一个用户，签发的令牌与密码登录相同
+func TestSSOJustInTimeProvisioning(t *testing.T) {
+	s, idp := newSSOTestServer(t, config.OIDCProvider{})
+	idp.AddUser(oidctest.User{Subject: "u-100", Email: "li.lei@corp.example", PreferredUsername: "li.lei"})
+
+	var first ssoLogin
+	resp := ssoSignIn(t, s, "u-100")
+	if resp.Status != http.StatusOK {
+		t.Fatalf("first sso login: got %d (%s)", resp.Status, resp.Message)
+	}
+	resp.decode(t, &first)
+	if first.User.UserName != "lilei" || first.User.Role != models.DEFAULT || first.AccessToken == "" {
+		t.Fatalf("unexpected provisioned user %+v", first)
+	}
+	// 令牌有效，但默认角色不能访问业务接口
+	s.expectStatus(t, http.StatusForbidden, "/api/v1/sale/listCustomers", seededUser{Token: first.AccessToken}, url.Values{})
+
+	// 再次登录不会重复创建用户；身份提供方轮换密钥后重新获取 JWKS
+	idp.RotateKey("test-2")
+	var second ssoLogin
+	ssoSignIn(t, s, "u-100").decode(t, &second)
+	if second.User.ID != first.User.ID {
+		t.Fatalf("second sso login created user %d, want %d", second.User.ID, first.User.ID)
+	}
+	var identities int64
+	s.db.Model(&models.UserIdentity{}).Count(&identities)
+	if identities != 1 {
+		t.Fatalf("got %d identities, want 1", identities)
+	}
+	// 单点登录创建的用户不能使用密码登录
+	s.expectStatus(t, http.StatusUnauthorized, "/api/v1/login", seededUser{}, url.Values{"username": {"lilei"}, "password": {seedPassword}})
+}
+
+// 按分组设置角色，按用户名关联已有用户（特权角色和开启了两步验证的用户除外），开启了两步验证的用户仍需输入验证码
+// 每次登录按分组同步角色，不在映射的分组中时回到默认权限；开启了两步验证的用户在验证通过后才同步
+func TestSSORoleMappingAndLinking(t *testing.T) {
+	s, idp := newSSOTestServer(t, config.OIDCProvider{
+		LinkByUsername: true,
+		GroupsClaim:    "groups",
+		RoleMapping: []config.OIDCRoleMapping{
+			{Group: "finance", Role: "会计"},
+			{Group: "sales", Role: "销售代表"},
+		},
+	})
+	f := seedOrg(t, s)
+	idp.AddUser(oidctest.User{Subject: "u-1", PreferredUsername: "hanmeimei", Groups: []string{"staff", "sales"}})
+	idp.AddUser(oidctest.User{Subject: "u-2", PreferredUsername: "rep", Groups: []string{"sales"}})
+
+	var mapped ssoLogin
+	ssoSignIn(t, s, "u-1").decode(t, &mapped)
+	if mapped.User.Role != models.SALES_REPRESENTATIVE {
+		t.Fatalf("group sales: got role %d", mapped.User.Role)
+	}
+	// 移出分组后回到默认权限
+	idp.AddUser(oidctest.User{Subject: "u-1", PreferredUsername: "hanmeimei", Groups: []string{"staff"}})
+	var removed ssoLogin
+	ssoSignIn(t, s, "u-1").decode(t, &removed)
+	if removed.User.Role != models.DEFAULT {
+		t.Fatalf("removed from group sales: got role %d", removed.User.Role)
+	}
+
+	var linked ssoLogin
+	ssoSignIn(t, s, "u-2").decode(t, &linked)
+	if linked.User.ID != f.Rep.ID || linked.AccessToken == "" {
+		t.Fatalf("linked to %+v, want user %d", linked, f.Rep.ID)
+	}
+
+	// 同名的特权账户和开启了两步验证的账户不能自动关联
+	enrollTOTP(t, s, f.Rep2, seedPassword)
+	idp.AddUser(oidctest.User{Subject: "u-3", PreferredUsername: "admin", Groups: []string{"sales"}})
+	idp.AddUser(oidctest.User{Subject: "u-4", PreferredUsername: "rep2", Groups: []string{"sales"}})
+	for _, subject := range []string{"u-3", "u-4"} {
+		if resp := ssoSignIn(t, s, subject); resp.Status != http.StatusForbidden || resp.Code != int(apperror.CodeIdentityLinkNotAllowed) {
+			t.Fatalf("%s: got %d/%d", subject, resp.Status, resp.Code)
+		}
+	}
+	var identities int64
+	s.db.Model(&models.UserIdentity{}).Where("user_id IN ?", []uint{f.Admin.ID, f.Rep2.ID}).Count(&identities)
+	if identities != 0 {
+		t.Fatalf("privileged or two-factor accounts must not be linked, got %d identities", identities)
+	}
+
+	enrolled := enrollTOTP(t, s, f.Rep, seedPassword)
+	idp.AddUser(oidctest.User{Subject: "u-2", PreferredUsername: "rep", Groups: []string{"finance"}})
+	var challenged ssoLogin
+	ssoSignIn(t, s, "u-2").decode(t, &challenged)
+	if !challenged.MFARequired || challenged.AccessToken != "" {
+		t.Fatalf("linked user with totp: %+v", challenged)
+	}
+	var user models.User
+	if err := s.db.First(&user, f.Rep.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if user.RoleID != models.SALES_REPRESENTATIVE {
+		t.Fatalf("role changed before two-factor verification: %d", user.RoleID)
+	}
+	var verified ssoLogin
+	s.mustGet(t, "/api/v1/login/verify", seededUser{}, url.Values{
+		"challenge_token": {challenged.ChallengeToken}, "code": {totpCode(t, enrolled.Secret, 1)},
+	}).decode(t, &verified)
+	if verified.User.ID != f.Rep.ID || verified.User.Role != models.ACCOUNTANT {
+		t.Fatalf("after verification: got user %d role %d", verified.User.ID, verified.User.Role)
+	}
+}
+
+// 状态 Cookie 缺失、state 不一致或者重复使用回调时拒绝登录
+func TestSSOCallbackRejectsInvalidState(t *testing.T) {
+	s, idp := newSSOTestServer(t, config.OIDCProvider{})
+	idp.AddUser(oidctest.User{Subject: "u-1", PreferredUsername: "sso1"})
+
+	params, cookies := ssoAuthorize(t, s, "u-1")
+	for name, tc := range map[string]struct {
+		params  url.Values
+		cookies []*http.Cookie
+	}{
+		"missing cookie": {params, nil},
+		"wrong state":    {url.Values{"code": {params.Get("code")}, "state": {"forged"}}, cookies},
+	} {
+		resp := ssoCallback(t, s, tc.params, tc.cookies)
+		if resp.Status != http.StatusBadRequest || resp.Code != int(apperror.CodeSSOStateInvalid) {
+			t.Fatalf("%s: got %d/%d", name, resp.Status, resp.Code)
+		}
+	}
+	// 授权码只能换取一次令牌
+	if resp := ssoCallback(t, s, params, cookies); resp.Status != http.StatusOK {
+		t.Fatalf("valid callback: got %d (%s)", resp.Status, resp.Message)
+	}
+	if resp := ssoCallback(t, s, params, cookies); resp.Code != int(apperror.CodeSSOFailed) {
+		t.Fatalf("replayed code: got %d/%d", resp.Status, resp.Code)
+	}
+
+	rec := s.ssoRequest(t, "/api/v1/sso/unknown/login", nil)
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("unknown provider: got %d", rec.Code)
+	}
+}
+
+// ssoSignIn 在身份提供方以 subject 登录并完成回调
+func ssoSignIn(t *testing.T, s *testServer, subject string) apiResponse {
+	t.Helper()
+	params, cookies := ssoAuthorize(t, s, subject)
+	return ssoCallback(t, s, params, cookies)
+}
@@ -0,0 +1,255 @@
+package routers
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gin-boilerplate/config"
+	"gin-boilerplate/helpers"
+	"gin-boilerplate/infra/apperror"
+	"gin-boilerplate/models"
+	"gin-boilerplate/repository"
+)
+
+// totpCode 当前周期之后第 offset 个周期的验证码，同一个周期的验证码只能使用一次
+func totpCode(t *testing.T, secret string, offset int64) string {
+	t.Helper()
+	code, err := helpers.TOTPCode(secret, helpers.TOTPStep(time.Now())+offset)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code
+}
+
+type totpEnrollment struct {
+	Secret        string
+	RecoveryCodes []string
+	User          seededUser // 开启两步验证后签发的令牌
+}
+
+// enrollTOTP 以 user 的身份绑定并开启两步验证
+func enrollTOTP(t *testing.T, s *testServer, user seededUser, password string) totpEnrollment {
+	t.Helper()
+	var started struct {
+		Secret     string `json:"secret"`
+		OTPAuthURI string `json:"otpauth_uri"`
+	}
+	s.mustGet(t, "/api/v1/me/totp/enroll", user, url.Values{"password": {password}}).decode(t, &started)
+	if started.Secret == "" || !strings.HasPrefix(started.OTPAuthURI, "otpauth://totp/") ||
+		!strings.Contains(started.OTPAuthURI, "secret="+started.Secret) {
+		t.Fatalf("unexpected enrollment %+v", started)
+	}
+	var confirmed struct {
+		AccessToken   string   `json:"access_token"`
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+	s.mustGet(t, "/api/v1/me/totp/confirm", user, url.Values{"code": {totpCode(t, started.Secret, 0)}}).decode(t, &confirmed)
+	if len(confirmed.RecoveryCodes) != config.Get().TOTP.RecoveryCodes {
+		t.Fatalf("got %d recovery codes", len(confirmed.RecoveryCodes))
+	}
+	return totpEnrollment{
+		Secret:        started.Secret,
+		RecoveryCodes: confirmed.RecoveryCodes,
+		User:          seededUser{ID: user.ID, Name: user.Name, Token: confirmed.AccessToken},
+	}
+}
+
+type loginChallenge struct {
+	MFARequired    bool   `json:"mfa_required"`
+	ChallengeToken string `json:"challenge_token"`
+	AccessToken    string `json:"access_token"`
+}
+
+// 必须使用两步验证的角色登录后只能绑定两步验证，开启后登录需要输入验证码
+func TestTOTPRequiredForPrivilegedRoles(t *testing.T) {
+	s := newTestServer(t)
+	f := seedOrg(t, s)
+	credentials := url.Values{"username": {"finance_manager"}, "password": {seedPassword}}
+
+	var enrollment struct {
+		AccessToken           string `json:"access_token"`
+		MFAEnrollmentRequired bool   `json:"mfa_enrollment_required"`
+	}
+	s.mustGet(t, "/api/v1/login", seededUser{}, credentials).decode(t, &enrollment)
+	if !enrollment.MFAEnrollmentRequired {
+		t.Fatal("金融经理 must enroll two-factor authentication")
+	}
+	restricted := seededUser{ID: f.FinanceManager.ID, Token: enrollment.AccessToken}
+	resp := s.expectStatus(t, http.StatusForbidden, "/api/v1/contract/getContractList", restricted, url.Values{"user_id": {f.FinanceManager.idParam()}})
+	if resp.Code != int(apperror.CodeMFAEnrollmentRequired) {
+		t.Fatalf("enrollment token: got code %d", resp.Code)
+	}
+	// 销售代表不强制两步验证
+	var rep struct {
+		MFAEnrollmentRequired bool `json:"mfa_enrollment_required"`
+	}
+	s.mustGet(t, "/api/v1/login", seededUser{}, url.Values{"username": {"rep"}, "password": {seedPassword}}).decode(t, &rep)
+	if rep.MFAEnrollmentRequired {
+		t.Fatal("销售代表 should not need two-factor authentication")
+	}
+
+	s.expectStatus(t, http.StatusBadRequest, "/api/v1/me/totp/enroll", restricted, url.Values{"password": {"wrong1234"}})
+	enrolled := enrollTOTP(t, s, restricted, seedPassword)
+	s.mustGet(t, "/api/v1/contract/getContractList", enrolled.User, url.Values{"user_id": {f.FinanceManager.idParam()}})
+	resp = s.expectStatus(t, http.StatusForbidden, "/api/v1/me/totp/disable", enrolled.User, url.Values{
+		"password": {seedPassword}, "code": {enrolled.RecoveryCodes[0]},
+	})
+	if resp.Code != int(apperror.CodeTOTPRequired) {
+		t.Fatalf("disable mandatory totp: got code %d", resp.Code)
+	}
+
+	// 登录分两步：密码正确后只返回挑战令牌
+	var challenge loginChallenge
+	s.mustGet(t, "/api/v1/login", seededUser{}, credentials).decode(t, &challenge)
+	if !challenge.MFARequired || challenge.ChallengeToken == "" || challenge.AccessToken != "" {
+		t.Fatalf("unexpected login challenge %+v", challenge)
+	}
+	// 挑战令牌不含角色，不能访问接口
+	s.expectStatus(t, http.StatusForbidden, "/api/v1/contract/getContractList", seededUser{Token: challenge.ChallengeToken}, url.Values{"user_id": {f.FinanceManager.idParam()}})
+	// 绑定时使用过的验证码不能再用
+	resp = s.expectStatus(t, http.StatusUnauthorized, "/api/v1/login/verify", seededUser{}, url.Values{
+		"challenge_token": {challenge.ChallengeToken}, "code": {totpCode(t, enrolled.Secret, 0)},
+	})
+	if resp.Code != int(apperror.CodeInvalidTOTPCode) {
+		t.Fatalf("reused code: got code %d", resp.Code)
+	}
+	var verified loginChallenge
+	s.mustGet(t, "/api/v1/login/verify", seededUser{}, url.Values{
+		"challenge_token": {challenge.ChallengeToken}, "code": {totpCode(t, enrolled.Secret, 1)},
+	}).decode(t, &verified)
+	s.mustGet(t, "/api/v1/contract/getContractList", seededUser{Token: verified.AccessToken}, url.Values{"user_id": {f.FinanceManager.idParam()}})
+
+	// 恢复码可以代替验证码，每个只能使用一次
+	for i, want := range []int{http.StatusOK, http.StatusUnauthorized} {
+		s.mustGet(t, "/api/v1/login", seededUser{}, credentials).decode(t, &challenge)
+		resp := s.get(t, "/api/v1/login/verify", "", url.Values{
+			"challenge_token": {challenge.ChallengeToken}, "code": {strings.ToUpper(enrolled.RecoveryCodes[0])},
+		})
+		if resp.Status != want {
+			t.Fatalf("recovery code attempt %d: got %d (%s), want %d", i+1, resp.Status, resp.Message, want)
+		}
+	}
+}
+
+// 验证码错误计入连续错误次数，正确的密码不会清零，达到次数后锁定账户
+func TestTOTPLoginLockout(t *testing.T) {
+	s := newTestServer(t)
+	f := seedOrg(t, s)
+	enrolled := enrollTOTP(t, s, f.Rep, seedPassword)
+	credentials := url.Values{"username": {"rep"}, "password": {seedPassword}}
+	login := config.Get().Login
+
+	var resp apiResponse
+	for i := 0; i < login.LockoutAfter; i++ {
+		if err := s.db.Model(&models.User{}).Where("id = ?", f.Rep.ID).
+			Update("last_failed_login_at", time.Now().Add(-time.Hour)).Error; err != nil {
+			t.Fatal(err)
+		}
+		var challenge loginChallenge
+		s.mustGet(t, "/api/v1/login", seededUser{}, credentials).decode(t, &challenge)
+		resp = s.get(t, "/api/v1/login/verify", "", url.Values{"challenge_token": {challenge.ChallengeToken}, "code": {"000000"}})
+	}
+	if resp.Status != http.StatusLocked || resp.Code != int(apperror.CodeAccountLocked) {
+		t.Fatalf("after %d wrong codes: got %d/%d", login.LockoutAfter, resp.Status, resp.Code)
+	}
+
+	// 重新生成恢复码后，原来的恢复码失效；关闭后登录不再需要验证码
+	s.expectStatus(t, http.StatusOK, "/api/v1/admin/unlockUser", f.Admin, url.Values{
+		"system_manager_id": {f.Admin.idParam()}, "user_id": {f.Rep.idParam()},
+	})
+	var regenerated struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+	s.mustGet(t, "/api/v1/me/totp/recoveryCodes", enrolled.User, url.Values{"code": {totpCode(t, enrolled.Secret, 1)}}).decode(t, &regenerated)
+	s.expectStatus(t, http.StatusUnauthorized, "/api/v1/me/totp/disable", enrolled.User, url.Values{
+		"password": {seedPassword}, "code": {enrolled.RecoveryCodes[1]},
+	})
+	s.mustGet(t, "/api/v1/me/totp/disable", enrolled.User, url.Values{
+		"password": {seedPassword}, "code": {regenerated.RecoveryCodes[0]},
+	})
+	var loggedIn loginChallenge
+	s.mustGet(t, "/api/v1/login", seededUser{}, credentials).decode(t, &loggedIn)
+	if loggedIn.MFARequired || loggedIn.AccessToken == "" {
+		t.Fatalf("login after disabling totp: %+v", loggedIn)
+	}
+}
+
+// 系统管理员重置两步验证后，必须使用的角色需要重新绑定
+func TestAdminResetTOTP(t *testing.T) {
+	s := newTestServer(t)
+	f := seedOrg(t, s)
+	enrollTOTP(t, s, f.GeneralManager, seedPassword)
+
+	s.mustGet(t, "/api/v1/admin/resetTOTP", f.Admin, url.Values{
+		"system_manager_id": {f.Admin.idParam()}, "user_id": {f.GeneralManager.idParam()},
+	})
+	var recoveryCodes int64
+	s.db.Model(&models.RecoveryCode{}).Where("user_id = ?", f.GeneralManager.ID).Count(&recoveryCodes)
+	if recoveryCodes != 0 {
+		t.Fatalf("reset should delete recovery codes, %d left", recoveryCodes)
+	}
+	var login struct {
+		MFARequired           bool `json:"mfa_required"`
+		MFAEnrollmentRequired bool `json:"mfa_enrollment_required"`
+	}
+	s.mustGet(t, "/api/v1/login", seededUser{}, url.Values{"username": {"gm"}, "password": {seedPassword}}).decode(t, &login)
+	if login.MFARequired || !login.MFAEnrollmentRequired {
+		t.Fatalf("login after reset: %+v", login)
+	}
+}
+
+// 并发使用同一个周期的验证码或同一个恢复码时只有一个请求成功
+func TestConcurrentSecondFactorReplay(t *testing.T) {
+	s := newTestServer(t)
+	f := seedOrg(t, s)
+	enrolled := enrollTOTP(t, s, f.Rep, seedPassword)
+	policy := repository.LoginPolicy{DelayAfter: 100, LockoutAfter: 100, LockoutDuration: time.Minute}
+
+	for _, code := range []string{totpCode(t, enrolled.Secret, 1), enrolled.RecoveryCodes[0]} {
+		var wg sync.WaitGroup
+		var accepted int32
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if _, err := s.repos.TwoFactor.VerifyLoginTOTP(context.Background(), f.Rep.ID, code, config.Get().TOTP.Skew, policy); err == nil {
+					atomic.AddInt32(&accepted, 1)
+				}
+			}()
+		}
+		wg.Wait()
+		if accepted != 1 {
+			t.Fatalf("code %s accepted %d times, want once", code, accepted)
+		}
+	}
+}
+
+// 角色在令牌签发后变为必须使用两步验证的角色时，也不能关闭两步验证
+func TestTOTPDisableFollowsCurrentRole(t *testing.T) {
+	s := newTestServer(t)
+	f := seedOrg(t, s)
+	enrolled := enrollTOTP(t, s, f.Rep, seedPassword)
+	if _, err := s.repos.Users.UpdateUserRole(context.Background(), f.Admin.ID, f.Rep.ID, models.FINANCE_MANAGER); err != nil {
+		t.Fatal(err)
+	}
+
+	resp := s.expectStatus(t, http.StatusForbidden, "/api/v1/me/totp/disable", enrolled.User, url.Values{
+		"password": {seedPassword}, "code": {enrolled.RecoveryCodes[0]},
+	})
+	if resp.Code != int(apperror.CodeTOTPRequired) {
+		t.Fatalf("disable after promotion: got code %d", resp.Code)
+	}
+	var user models.User
+	if err := s.db.First(&user, f.Rep.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if !user.TOTPEnabled {
+		t.Fatal("two-factor authentication must stay enabled")
+	}
+}
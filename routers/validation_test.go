@@ -0,0 +1,88 @@
+package routers
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"gin-boilerplate/controllers"
+	"gin-boilerplate/infra/apperror"
+)
+
+// 表单校验失败返回400，data 中给出出错的字段和规则
+func TestFormValidation(t *testing.T) {
+	s := newTestServer(t)
+	f := seedOrg(t, s)
+	customerID := createCustomer(t, s, f.Rep, "张三", "13800138000")
+
+	contract := func(overrides url.Values) url.Values {
+		params := url.Values{
+			"user_id": {f.Rep.idParam()}, "customer_id": {id(customerID)},
+			"finance_id": {f.Finance.idParam()}, "accountant_id": {f.Accountant.idParam()},
+			"amount": {"100000"}, "service_fee": {"1000"}, "bank_amount": {"100000"}, "financial_product": {"经营贷"},
+		}
+		for k, v := range overrides {
+			params[k] = v
+		}
+		return params
+	}
+
+	kyc := func(overrides url.Values) url.Values {
+		params := kycParams(f.Rep, customerID)
+		for k, v := range overrides {
+			params[k] = v
+		}
+		return params
+	}
+
+	cases := []struct {
+		name   string
+		path   string
+		user   seededUser
+		params url.Values
+		field  string
+		rule   string
+	}{
+		{"invalid username", "/api/v1/register", seededUser{}, url.Values{"username": {"bad name!"}, "password": {"alice1234"}}, "username", "username"},
+		{"short password", "/api/v1/register", seededUser{}, url.Values{"username": {"alice"}, "password": {"123"}}, "password", "password"},
+		{"unknown role", "/api/v1/register", seededUser{}, url.Values{"username": {"alice"}, "password": {"alice1234"}, "role": {"老板"}}, "role", "enum"},
+		{"missing login password", "/api/v1/login", seededUser{}, url.Values{"username": {"rep"}}, "password", "required"},
+		{"unknown gender", "/api/v1/updateUserProfile", f.Rep, url.Values{"gender": {"未知"}}, "gender", "enum"},
+		{"invalid profile phone", "/api/v1/updateUserProfile", f.Rep, url.Values{"phone": {"12345"}}, "phone", "cnmobile"},
+		{"empty zone name", "/api/v1/admin/createZone", f.Admin, url.Values{"system_manager_id": {f.Admin.idParam()}}, "name", "required"},
+		{"unknown department type", "/api/v1/admin/createDepartment", f.Admin, url.Values{"system_manager_id": {f.Admin.idParam()}, "name": {"三部"}, "type": {"市场部"}}, "type", "oneof"},
+		{"unknown role update", "/api/v1/admin/updateUserRole", f.Admin, url.Values{"system_manager_id": {f.Admin.idParam()}, "user_id": {f.Rep.idParam()}, "role": {"老板"}}, "role", "enum"},
+		{"invalid customer phone", "/api/v1/sale/createCustomer", f.Rep, url.Values{"user_id": {f.Rep.idParam()}, "customer_name": {"王五"}, "customer_phone": {"23800138000"}}, "customer_phone", "cnmobile"},
+		{"empty customer name", "/api/v1/sale/createCustomer", f.Rep, url.Values{"user_id": {f.Rep.idParam()}, "customer_phone": {"13800138001"}}, "customer_name", "required"},
+		{"valid calls above calls", "/api/v1/sale/createWorkLog", f.Rep, url.Values{"user_id": {f.Rep.idParam()}, "calls": {"3"}, "valid_calls": {"5"}, "date": {"2024-01-02T00:00:00Z"}}, "valid_calls", "ltefield"},
+		{"negative amount", "/api/v1/sale/submitContract", f.Rep, contract(url.Values{"amount": {"-1"}}), "amount", "money"},
+		{"zero bank amount", "/api/v1/sale/submitContract", f.Rep, contract(url.Values{"bank_amount": {"0"}}), "bank_amount", "money"},
+		{"negative service fee", "/api/v1/sale/submitContract", f.Rep, contract(url.Values{"service_fee": {"-5"}}), "service_fee", "money"},
+		{"amount with fractions of a cent", "/api/v1/sale/submitContract", f.Rep, contract(url.Values{"amount": {"100.005"}}), "amount", "money"},
+		{"zero customer id", "/api/v1/sale/submitContract", f.Rep, contract(url.Values{"customer_id": {"0"}}), "customer_id", "required"},
+		{"national id checksum", "/api/v1/sale/updateCustomerKYC", f.Rep, kyc(url.Values{"national_id": {"110105194912310021"}}), "national_id", "nationalid"},
+		{"national id birth date", "/api/v1/sale/updateCustomerKYC", f.Rep, kyc(url.Values{"national_id": {"110105194913310023"}}), "national_id", "nationalid"},
+		{"unknown marital status", "/api/v1/sale/updateCustomerKYC", f.Rep, kyc(url.Values{"marital_status": {"保密"}}), "marital_status", "enum"},
+		{"unknown contract status", "/api/v1/finance/updateContractStatus", f.Finance, url.Values{"user_id": {f.Finance.idParam()}, "contract_id": {"1"}, "status": {"DONE"}}, "status", "enum"},
+		{"end before start", "/api/v1/getSalerPerformance", seededUser{}, url.Values{
+			"user_id": {f.Manager.idParam()}, "saler_id": {f.Rep.idParam()},
+			"start_date": {"2024-02-01T00:00:00Z"}, "end_date": {"2024-01-01T00:00:00Z"},
+		}, "end_date", "gtfield"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			resp := s.get(t, c.path, c.user.Token, c.params)
+			if resp.Status != http.StatusBadRequest || resp.Code != int(apperror.CodeInvalidParams) {
+				t.Fatalf("got %d/%d (%s), want %d/%d", resp.Status, resp.Code, resp.Message, http.StatusBadRequest, apperror.CodeInvalidParams)
+			}
+			var fieldErrors []controllers.FieldError
+			resp.decode(t, &fieldErrors)
+			for _, fe := range fieldErrors {
+				if fe.Field == c.field && fe.Rule == c.rule {
+					return
+				}
+			}
+			t.Fatalf("field errors %+v do not contain %s/%s", fieldErrors, c.field, c.rule)
+		})
+	}
+}